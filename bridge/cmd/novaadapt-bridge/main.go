@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"log"
@@ -20,7 +21,32 @@ func main() {
 	host := flag.String("host", envOrDefault("NOVAADAPT_BRIDGE_HOST", "127.0.0.1"), "Bridge host")
 	port := flag.Int("port", envOrDefaultInt("NOVAADAPT_BRIDGE_PORT", 9797), "Bridge port")
 	coreURL := flag.String("core-url", envOrDefault("NOVAADAPT_CORE_URL", "http://127.0.0.1:8787"), "Core API URL")
+	coreURLs := flag.String(
+		"core-urls",
+		envOrDefault("NOVAADAPT_CORE_URLS", ""),
+		"Optional comma-separated core replica URLs with optional weights (url|weight); overrides --core-url",
+	)
 	bridgeToken := flag.String("bridge-token", os.Getenv("NOVAADAPT_BRIDGE_TOKEN"), "Bearer token required for bridge clients")
+	requireAuth := flag.Bool(
+		"require-auth",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REQUIRE_AUTH", false),
+		"Refuse to start without a bridge token or session signing key (no open-access mode)",
+	)
+	onlyStaticTokenCanIssue := flag.Bool(
+		"only-static-token-can-issue",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_ONLY_STATIC_TOKEN_CAN_ISSUE", false),
+		"Require the static bridge token (not an admin session token) for /auth/session, /auth/session/revoke and /auth/pair",
+	)
+	sessionIssueRPS := flag.Float64(
+		"session-issue-rps",
+		envOrDefaultFloat("NOVAADAPT_BRIDGE_SESSION_ISSUE_RPS", 0),
+		"Tokens per second /auth/session and /auth/pair may issue across all callers (0 = unlimited)",
+	)
+	openAccessAllowedPaths := flag.String(
+		"open-access-allowed-paths",
+		envOrDefault("NOVAADAPT_BRIDGE_OPEN_ACCESS_ALLOWED_PATHS", ""),
+		"Comma-separated paths (e.g. /models,/plans/{id}) reachable in open-access mode; others return 403 (empty keeps full access)",
+	)
 	coreToken := flag.String("core-token", os.Getenv("NOVAADAPT_CORE_TOKEN"), "Bearer token used when calling core API")
 	coreCAFile := flag.String(
 		"core-ca-file",
@@ -37,6 +63,21 @@ func main() {
 		envOrDefault("NOVAADAPT_CORE_CLIENT_KEY_FILE", ""),
 		"Optional client private key PEM file for bridge->core mTLS",
 	)
+	coreCAPEM := flag.String(
+		"core-ca-pem",
+		envOrDefault("NOVAADAPT_CORE_CA_PEM", ""),
+		"Optional inline CA bundle PEM used to verify bridge->core TLS (overrides --core-ca-file)",
+	)
+	coreClientCertPEM := flag.String(
+		"core-client-cert-pem",
+		envOrDefault("NOVAADAPT_CORE_CLIENT_CERT_PEM", ""),
+		"Optional inline client certificate PEM for bridge->core mTLS (overrides --core-client-cert-file)",
+	)
+	coreClientKeyPEM := flag.String(
+		"core-client-key-pem",
+		envOrDefault("NOVAADAPT_CORE_CLIENT_KEY_PEM", ""),
+		"Optional inline client private key PEM for bridge->core mTLS (overrides --core-client-key-file)",
+	)
 	coreTLSServerName := flag.String(
 		"core-tls-server-name",
 		envOrDefault("NOVAADAPT_CORE_TLS_SERVER_NAME", ""),
@@ -47,6 +88,41 @@ func main() {
 		envOrDefaultBool("NOVAADAPT_CORE_TLS_INSECURE_SKIP_VERIFY", false),
 		"Disable certificate verification for bridge->core TLS (unsafe; dev only)",
 	)
+	coreTLSMinVersion := flag.String(
+		"core-tls-min-version",
+		envOrDefault("NOVAADAPT_CORE_TLS_MIN_VERSION", "1.2"),
+		"Minimum TLS version for bridge->core HTTPS (1.2 or 1.3)",
+	)
+	coreTLSCipherSuites := flag.String(
+		"core-tls-cipher-suites",
+		envOrDefault("NOVAADAPT_CORE_TLS_CIPHER_SUITES", ""),
+		"Optional comma-separated TLS 1.2 cipher suite names allowed for bridge->core HTTPS",
+	)
+	coreMaxIdleConns := flag.Int(
+		"core-max-idle-conns",
+		envOrDefaultInt("NOVAADAPT_CORE_MAX_IDLE_CONNS", 100),
+		"Max idle keep-alive connections kept across all cores",
+	)
+	coreMaxIdleConnsPerHost := flag.Int(
+		"core-max-idle-conns-per-host",
+		envOrDefaultInt("NOVAADAPT_CORE_MAX_IDLE_CONNS_PER_HOST", 64),
+		"Max idle keep-alive connections kept per core",
+	)
+	coreMaxConnsPerHost := flag.Int(
+		"core-max-conns-per-host",
+		envOrDefaultInt("NOVAADAPT_CORE_MAX_CONNS_PER_HOST", 0),
+		"Max total connections per core (0 = unlimited)",
+	)
+	coreRetryBudgetRPS := flag.Float64(
+		"core-retry-budget-rps",
+		envOrDefaultFloat("NOVAADAPT_CORE_RETRY_BUDGET_RPS", 0),
+		"Retries per second shared by all forwarded GETs that fail with a transport error or 502/503/504 (0 disables retries)",
+	)
+	coreRetryBudgetBurst := flag.Int(
+		"core-retry-budget-burst",
+		envOrDefaultInt("NOVAADAPT_CORE_RETRY_BUDGET_BURST", 0),
+		"Retry budget bucket size (0 = ceil(core-retry-budget-rps))",
+	)
 	tlsCertFile := flag.String(
 		"tls-cert-file",
 		envOrDefault("NOVAADAPT_BRIDGE_TLS_CERT_FILE", ""),
@@ -57,36 +133,166 @@ func main() {
 		envOrDefault("NOVAADAPT_BRIDGE_TLS_KEY_FILE", ""),
 		"Optional TLS private key PEM file for HTTPS listener",
 	)
+	disableHTTP2 := flag.Bool(
+		"disable-http2",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_DISABLE_HTTP2", false),
+		"Serve only HTTP/1.1 on the TLS listener instead of negotiating HTTP/2",
+	)
 	sessionSigningKey := flag.String(
 		"session-signing-key",
 		os.Getenv("NOVAADAPT_BRIDGE_SESSION_SIGNING_KEY"),
 		"HMAC key for issuing/verifying scoped bridge session tokens (defaults to bridge token when unset)",
 	)
+	forwardCallerIdentity := flag.Bool(
+		"forward-caller-identity",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_FORWARD_CALLER_IDENTITY", false),
+		"Send the authenticated subject, scopes and device ID to core as X-Bridge-Subject/X-Bridge-Scopes/X-Bridge-Device-ID",
+	)
+	forwardSubjectHeader := flag.Bool(
+		"forward-subject-header",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_FORWARD_SUBJECT_HEADER", false),
+		"Send the authenticated subject and device ID to core as X-Nova-Subject/X-Nova-Device",
+	)
+	requireTenant := flag.Bool(
+		"require-tenant",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REQUIRE_TENANT", false),
+		"Forward session token tenant claims to core as X-Tenant-ID and reject core-bound requests without one",
+	)
 	sessionTokenTTL := flag.Int(
 		"session-token-ttl-seconds",
 		envOrDefaultInt("NOVAADAPT_BRIDGE_SESSION_TTL_SECONDS", 900),
 		"Default ttl for issued bridge session tokens",
 	)
+	maxSessionTokenTTL := flag.Int(
+		"max-session-token-ttl-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_MAX_SESSION_TTL_SECONDS", 24*3600),
+		"Maximum ttl for bridge session tokens issued by /auth/session",
+	)
+	minSessionTokenTTL := flag.Int(
+		"min-session-token-ttl-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_MIN_SESSION_TTL_SECONDS", 60),
+		"Minimum ttl for issued bridge session tokens; must not exceed the maximum",
+	)
+	tokenExpiryLeeway := flag.Int(
+		"token-expiry-leeway-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_TOKEN_EXPIRY_LEEWAY_SECONDS", 0),
+		"Clock-skew tolerance applied when checking session token expiry (0 = strict)",
+	)
 	allowedDeviceIDs := flag.String(
 		"allowed-device-ids",
 		envOrDefault("NOVAADAPT_BRIDGE_ALLOWED_DEVICE_IDS", ""),
 		"Comma-separated trusted X-Device-ID values (optional)",
 	)
+	allowedBrowserActions := flag.String(
+		"allowed-browser-actions",
+		envOrDefault("NOVAADAPT_BRIDGE_ALLOWED_BROWSER_ACTIONS", ""),
+		"Comma-separated browser action types allowed through the bridge (empty allows all)",
+	)
+	allowedTerminalCommands := flag.String(
+		"allowed-terminal-commands",
+		envOrDefault("NOVAADAPT_BRIDGE_ALLOWED_TERMINAL_COMMANDS", ""),
+		"Comma-separated programs terminal sessions may start (empty allows all)",
+	)
+	corsMaxAgeSeconds := flag.Int(
+		"cors-max-age-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_CORS_MAX_AGE_SECONDS", 600),
+		"Access-Control-Max-Age for CORS preflight responses",
+	)
+	corsAllowCredentials := flag.Bool(
+		"cors-allow-credentials",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_CORS_ALLOW_CREDENTIALS", false),
+		"Send Access-Control-Allow-Credentials: true on CORS responses (not allowed with a * origin)",
+	)
+	requireCSRFForBrowsers := flag.Bool(
+		"require-csrf-for-browsers",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REQUIRE_CSRF_FOR_BROWSERS", false),
+		"Require X-CSRF-Token on state-changing browser requests made with session tokens",
+	)
+	gzipResponses := flag.Bool(
+		"gzip-responses",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_GZIP_RESPONSES", false),
+		"Gzip-compress responses for clients sending Accept-Encoding: gzip",
+	)
+	gzipMinBytes := flag.Int(
+		"gzip-min-bytes",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_GZIP_MIN_BYTES", 1024),
+		"Smallest response body to gzip",
+	)
+	gzipLevel := flag.Int(
+		"gzip-level",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_GZIP_LEVEL", 0),
+		"Gzip compression level 1-9 (0 uses the default level)",
+	)
 	corsAllowedOrigins := flag.String(
 		"cors-allowed-origins",
 		envOrDefault("NOVAADAPT_BRIDGE_CORS_ALLOWED_ORIGINS", ""),
 		"Comma-separated allowed CORS origins for browser clients (use * to allow any)",
 	)
+	allowedHosts := flag.String(
+		"allowed-hosts",
+		envOrDefault("NOVAADAPT_BRIDGE_ALLOWED_HOSTS", ""),
+		"Comma-separated Host header values accepted by the bridge; others get 421 (entries without a port match any port)",
+	)
 	trustedProxyCIDRs := flag.String(
 		"trusted-proxy-cidrs",
 		envOrDefault("NOVAADAPT_BRIDGE_TRUSTED_PROXY_CIDRS", ""),
 		"Comma-separated CIDRs/IPs for trusted reverse proxies allowed to set X-Forwarded-* headers",
 	)
+	requireHTTPSForAuth := flag.Bool(
+		"require-https-for-auth",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REQUIRE_HTTPS_FOR_AUTH", false),
+		"Reject bearer-token requests that arrive over plain HTTP (X-Forwarded-Proto honored from trusted proxies)",
+	)
+	adminAllowedCIDRs := flag.String(
+		"admin-allowed-cidrs",
+		envOrDefault("NOVAADAPT_BRIDGE_ADMIN_ALLOWED_CIDRS", ""),
+		"Comma-separated IP/CIDR list allowed to reach /admin/* and /auth/session* (client IP resolved via trusted proxies)",
+	)
+	requireClientRequestID := flag.Bool(
+		"require-client-request-id",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REQUIRE_CLIENT_REQUEST_ID", false),
+		"Reject requests without an X-Request-ID header (400 request_id_required); /health, /metrics, /ws exempt",
+	)
+	allowClientIPEcho := flag.Bool(
+		"allow-client-ip-echo",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_ALLOW_CLIENT_IP_ECHO", false),
+		"Echo the resolved client IP in X-Bridge-Client-IP and enable GET /debug/client-ip",
+	)
+	auditLogPath := flag.String(
+		"audit-log-path",
+		envOrDefault("NOVAADAPT_BRIDGE_AUDIT_LOG_PATH", ""),
+		"Optional JSON-lines file recording session token issuance and revocation (token values are never written)",
+	)
 	revocationStorePath := flag.String(
 		"revocation-store-path",
 		envOrDefault("NOVAADAPT_BRIDGE_REVOCATION_STORE_PATH", ""),
 		"Optional file path for persisted session revocation state",
 	)
+	sessionIndexPath := flag.String(
+		"session-index-path",
+		envOrDefault("NOVAADAPT_BRIDGE_SESSION_INDEX_PATH", ""),
+		"Optional file path for the persisted issued-session index used by subject revocation",
+	)
+	maxIssuableScopes := flag.String(
+		"max-issuable-scopes",
+		envOrDefault("NOVAADAPT_BRIDGE_MAX_ISSUABLE_SCOPES", ""),
+		"Optional comma-separated scopes /auth/session and /auth/pair may issue (e.g. read,run,plan); empty allows all",
+	)
+	singleSessionPerDevice := flag.Bool(
+		"single-session-per-device",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_SINGLE_SESSION_PER_DEVICE", false),
+		"Invalidate a device's previous session token whenever a new one is issued for it",
+	)
+	deviceSessionStorePath := flag.String(
+		"device-session-store-path",
+		envOrDefault("NOVAADAPT_BRIDGE_DEVICE_SESSION_STORE_PATH", ""),
+		"Optional file path for persisted device -> current session state",
+	)
+	maintenanceStorePath := flag.String(
+		"maintenance-store-path",
+		envOrDefault("NOVAADAPT_BRIDGE_MAINTENANCE_STORE_PATH", ""),
+		"Optional file path for persisted maintenance mode state",
+	)
 	rateLimitRPS := flag.Float64(
 		"rate-limit-rps",
 		envOrDefaultFloat("NOVAADAPT_BRIDGE_RATE_LIMIT_RPS", 0),
@@ -97,43 +303,406 @@ func main() {
 		envOrDefaultInt("NOVAADAPT_BRIDGE_RATE_LIMIT_BURST", 20),
 		"Per-client bridge burst capacity for rate limit",
 	)
+	maxTokenRateLimitRPS := flag.Float64(
+		"max-token-rate-limit-rps",
+		envOrDefaultFloat("NOVAADAPT_BRIDGE_MAX_TOKEN_RATE_LIMIT_RPS", 0),
+		"Cap for the rate_limit_rps session token claim that overrides the per-client rate (0 disables overrides)",
+	)
+	penaltyBoxStrikes := flag.Int(
+		"penalty-box-strikes",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_PENALTY_BOX_STRIKES", 0),
+		"Rate-limit episodes (decaying) before a client is held to the reduced penalty rate; <=0 disables",
+	)
+	penaltyBoxRPS := flag.Float64(
+		"penalty-box-rps",
+		envOrDefaultFloat("NOVAADAPT_BRIDGE_PENALTY_BOX_RPS", 0),
+		"Per-client rate while penalized (default rate-limit-rps/10)",
+	)
+	penaltyBoxSeconds := flag.Int(
+		"penalty-box-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_PENALTY_BOX_SECONDS", 600),
+		"How long a penalized client stays at the reduced rate",
+	)
+	wsMaxBacklogEvents := flag.Int(
+		"ws-max-backlog-events",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_WS_MAX_BACKLOG_EVENTS", 0),
+		"Fast-forward /ws clients more than this many events behind core's latest (send backlog_skipped; ?backfill=1 opts out; 0 disables)",
+	)
+	wsSendQueueSize := flag.Int(
+		"ws-send-queue-size",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_WS_SEND_QUEUE_SIZE", 256),
+		"Per-connection websocket outbound queue size; oldest audit frames are dropped when full",
+	)
+	wsFailFastWhenCoreDown := flag.Bool(
+		"ws-fail-fast-when-core-down",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_WS_FAIL_FAST_WHEN_CORE_DOWN", false),
+		"Reject /ws terminal, browser and command messages with core_unavailable while every core replica is ejected",
+	)
+	sharedAuditPump := flag.Bool(
+		"shared-audit-pump",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_SHARED_AUDIT_PUMP", false),
+		"Serve websocket audit events from a single core /events/stream poll loop shared by all connections",
+	)
 	maxWSConnections := flag.Int(
 		"max-ws-connections",
 		envOrDefaultInt("NOVAADAPT_BRIDGE_MAX_WS_CONNECTIONS", 100),
 		"Maximum concurrent websocket sessions (0 disables limit)",
 	)
+	probeCoreCapabilities := flag.Bool(
+		"probe-core-capabilities",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_PROBE_CORE_CAPABILITIES", false),
+		"Fetch core /openapi.json and return 501 core_unsupported for paths core does not advertise",
+	)
+	coreCapabilitiesRefresh := flag.Int(
+		"core-capabilities-refresh-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_CORE_CAPABILITIES_REFRESH_SECONDS", 300),
+		"How often the core capability probe is refreshed",
+	)
+	maxInflightPerSubject := flag.Int(
+		"max-inflight-per-subject",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_MAX_INFLIGHT_PER_SUBJECT", 0),
+		"Maximum concurrent core requests per token subject (0 disables limit)",
+	)
+	maxTerminalSessionsPerSubject := flag.Int(
+		"max-terminal-sessions-per-subject",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_MAX_TERMINAL_SESSIONS_PER_SUBJECT", 0),
+		"Maximum terminal sessions a token subject may start over /ws or POST /terminal/sessions (best effort; 0 disables limit)",
+	)
+	bridgeLoadHeader := flag.Bool(
+		"bridge-load-header",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_LOAD_HEADER", false),
+		"Add X-Bridge-Load: low|medium|high response header from in-flight requests and websocket usage",
+	)
+	loadInflightCapacity := flag.Int(
+		"load-inflight-capacity",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_LOAD_INFLIGHT_CAPACITY", 64),
+		"In-flight request count treated as full load for X-Bridge-Load",
+	)
+	wsTicketTTL := flag.Int(
+		"ws-ticket-ttl-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_WS_TICKET_TTL_SECONDS", 30),
+		"Lifetime of single-use websocket tickets issued by POST /auth/ws-ticket",
+	)
+	wsHandshakeTimeout := flag.Int(
+		"ws-handshake-timeout-seconds",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_WS_HANDSHAKE_TIMEOUT_SECONDS", 10),
+		"Deadline for completing the /ws upgrade handshake",
+	)
+	rejectAmbiguousWSAuth := flag.Bool(
+		"reject-ambiguous-ws-auth",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_REJECT_AMBIGUOUS_WS_AUTH", false),
+		"Reject /ws with 400 when the Authorization header and ?token= query parameter carry different tokens",
+	)
+	wsBanner := flag.String(
+		"ws-banner",
+		envOrDefault("NOVAADAPT_BRIDGE_WS_BANNER", ""),
+		"Notice sent to each /ws connection right after hello (e.g. maintenance at 02:00 UTC)",
+	)
+	wsBannerFile := flag.String(
+		"ws-banner-file",
+		envOrDefault("NOVAADAPT_BRIDGE_WS_BANNER_FILE", ""),
+		"File holding the /ws connect notice; overrides --ws-banner and is re-read on SIGHUP",
+	)
 	timeout := flag.Int("timeout", envOrDefaultInt("NOVAADAPT_BRIDGE_TIMEOUT", 30), "Core request timeout seconds")
+	healthProbeTimeout := flag.Int(
+		"health-probe-timeout",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_HEALTH_PROBE_TIMEOUT", 5),
+		"Timeout seconds for the core request made by /health?deep=1, independent of --timeout",
+	)
+	maxPathBytes := flag.Int(
+		"max-path-bytes",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_MAX_PATH_BYTES", 2048),
+		"Max URL path length for HTTP requests and ws command paths (longer paths get 414)",
+	)
 	logRequests := flag.Bool("log-requests", envOrDefaultBool("NOVAADAPT_BRIDGE_LOG_REQUESTS", true), "Enable per-request bridge logs")
+	logSampleRate := flag.Float64(
+		"log-sample-rate",
+		envOrDefaultFloat("NOVAADAPT_BRIDGE_LOG_SAMPLE_RATE", 1),
+		"Fraction [0..1] of successful requests to log (0 logs errors only); 4xx/5xx responses are always logged",
+	)
+	cacheTTLs := flag.String(
+		"cache-ttls",
+		envOrDefault("NOVAADAPT_BRIDGE_CACHE_TTLS", ""),
+		"Comma-separated route=seconds GET response cache TTLs (e.g. /plans=5,/models=60)",
+	)
+	serveStaleOnError := flag.Bool(
+		"serve-stale-on-error",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_SERVE_STALE_ON_ERROR", false),
+		"Serve the last cached copy of a cacheable GET (X-Cache: STALE) when core is unreachable or returns 5xx",
+	)
+	fallbackResponsesFile := flag.String(
+		"fallback-responses-file",
+		envOrDefault("NOVAADAPT_BRIDGE_FALLBACK_RESPONSES_FILE", ""),
+		"JSON file mapping GET route templates to canned payloads served (X-Bridge-Fallback: true) while core is down",
+	)
+	routeTimeouts := flag.String(
+		"route-timeouts",
+		envOrDefault("NOVAADAPT_BRIDGE_ROUTE_TIMEOUTS", ""),
+		"Comma-separated route=seconds core timeouts overriding --timeout (e.g. /run=300)",
+	)
+	cacheInvalidations := flag.String(
+		"cache-invalidations",
+		envOrDefault("NOVAADAPT_BRIDGE_CACHE_INVALIDATIONS", ""),
+		"Comma-separated write_route=cached_route|cached_route cache eviction map",
+	)
+	cacheMaxEntries := flag.Int(
+		"cache-max-entries",
+		envOrDefaultInt("NOVAADAPT_BRIDGE_CACHE_MAX_ENTRIES", 256),
+		"Maximum cached GET responses",
+	)
+	coreRedirectPolicy := flag.String(
+		"core-redirect-policy",
+		envOrDefault("NOVAADAPT_CORE_REDIRECT_POLICY", relay.CoreRedirectPassthrough),
+		"How to handle core 3xx responses: passthrough, error (502), or same-host (follow only same-host redirects)",
+	)
+	coreAcceptHeader := flag.String(
+		"core-accept-header",
+		envOrDefault("NOVAADAPT_CORE_ACCEPT_HEADER", ""),
+		"Optional Accept header sent on core JSON requests (e.g. application/vnd.novaadapt.v2+json)",
+	)
+	coreVersionAccept := flag.String(
+		"core-version-accept",
+		envOrDefault("NOVAADAPT_CORE_VERSION_ACCEPT", ""),
+		"Comma-separated version=accept pairs clients may select via X-Core-Version (e.g. v2=application/vnd.novaadapt.v2+json)",
+	)
+	strictCoreJSON := flag.Bool(
+		"strict-core-json",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_STRICT_CORE_JSON", false),
+		"Return 502 core_invalid_json when core answers 2xx with a body that is not valid JSON",
+	)
+	honorCoreRetryAfter := flag.Bool(
+		"honor-core-retry-after",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_HONOR_CORE_RETRY_AFTER", false),
+		"After a core 429 with Retry-After, answer forwarded requests for that replica with a local 429 until the delay elapses",
+	)
+	eventsPageLinks := flag.Bool(
+		"events-page-links",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_EVENTS_PAGE_LINKS", false),
+		"Add a Link rel=\"next\" header (since_id cursor) to GET /events responses",
+	)
+	disableRootInfo := flag.Bool(
+		"disable-root-info",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_DISABLE_ROOT_INFO", false),
+		"Handle GET / like any other non-forwarded path instead of serving the unauthenticated service/version summary",
+	)
+	stripResponseHeaders := flag.String(
+		"strip-response-headers",
+		envOrDefault("NOVAADAPT_BRIDGE_STRIP_RESPONSE_HEADERS", ""),
+		"Comma-separated core response headers never relayed to clients, even if forwarded (e.g. Server,X-Internal-Node)",
+	)
+	forwardedRequestHeaders := flag.String(
+		"forwarded-request-headers",
+		envOrDefault("NOVAADAPT_BRIDGE_FORWARDED_REQUEST_HEADERS", ""),
+		"Comma-separated client request headers copied to core (hop-by-hop and auth headers are never copied)",
+	)
+	hopByHopHeaders := flag.String(
+		"hop-by-hop-headers",
+		envOrDefault("NOVAADAPT_BRIDGE_HOP_BY_HOP_HEADERS", ""),
+		"Comma-separated extra headers treated as hop-by-hop and stripped in both directions",
+	)
+	forwardedResponseHeaders := flag.String(
+		"forwarded-response-headers",
+		envOrDefault("NOVAADAPT_BRIDGE_FORWARDED_RESPONSE_HEADERS", ""),
+		"Comma-separated core response headers relayed to clients; all others are withheld",
+	)
+	coreErrorHeaders := flag.String(
+		"core-error-headers",
+		envOrDefault("NOVAADAPT_BRIDGE_CORE_ERROR_HEADERS", ""),
+		"Comma-separated core response headers echoed in core_status on non-2xx responses (default X-Error-Code)",
+	)
+	putRouteScopes := flag.String(
+		"put-route-scopes",
+		envOrDefault("NOVAADAPT_BRIDGE_PUT_ROUTE_SCOPES", ""),
+		"Comma-separated route=scope pairs enabling PUT on extra route templates (e.g. /plans/{id}/steps=plan)",
+	)
+	bodyFieldRenames := flag.String(
+		"body-field-renames",
+		envOrDefault("NOVAADAPT_BRIDGE_BODY_FIELD_RENAMES", ""),
+		"Comma-separated route:old=new entries renaming top-level JSON body keys before forwarding (e.g. /run:goal=objective)",
+	)
+	validationErrorRoutes := flag.String(
+		"validation-error-routes",
+		envOrDefault("NOVAADAPT_BRIDGE_VALIDATION_ERROR_ROUTES", ""),
+		"Comma-separated route[=fields.path] entries whose core 422 bodies are normalized to a validation_failed envelope (default path: errors)",
+	)
+	logRouteTemplate := flag.Bool(
+		"log-route-template",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_LOG_ROUTE_TEMPLATE", true),
+		"Include the normalized route template (e.g. /plans/{id}/approve) in request logs",
+	)
+	logJSON := flag.Bool(
+		"log-json",
+		envOrDefaultBool("NOVAADAPT_BRIDGE_LOG_JSON", false),
+		"Write request log lines as JSON objects (including the route template) instead of key=value text",
+	)
+	debugDeviceIDs := flag.String(
+		"debug-device-ids",
+		envOrDefault("NOVAADAPT_BRIDGE_DEBUG_DEVICE_IDS", ""),
+		"Comma-separated device IDs whose requests always get a verbose debug log line, even with request logging off",
+	)
 	flag.Parse()
 
+	parsedCacheTTLs, err := relay.ParseCacheTTLs(parseCSV(*cacheTTLs))
+	if err != nil {
+		log.Fatalf("invalid --cache-ttls: %v", err)
+	}
+	parsedRouteTimeouts, err := relay.ParseRouteTimeouts(parseCSV(*routeTimeouts))
+	if err != nil {
+		log.Fatalf("invalid --route-timeouts: %v", err)
+	}
+	parsedCacheInvalidations, err := relay.ParseCacheInvalidations(parseCSV(*cacheInvalidations))
+	if err != nil {
+		log.Fatalf("invalid --cache-invalidations: %v", err)
+	}
+	parsedPutRouteScopes, err := relay.ParsePutRouteScopes(parseCSV(*putRouteScopes))
+	if err != nil {
+		log.Fatalf("invalid --put-route-scopes: %v", err)
+	}
+	parsedBodyFieldRenames, err := relay.ParseBodyFieldRenames(parseCSV(*bodyFieldRenames))
+	if err != nil {
+		log.Fatalf("invalid --body-field-renames: %v", err)
+	}
+	parsedValidationErrorRoutes, err := relay.ParseValidationErrorRoutes(parseCSV(*validationErrorRoutes))
+	if err != nil {
+		log.Fatalf("invalid --validation-error-routes: %v", err)
+	}
+	parsedCoreVersionAccept, err := relay.ParseCoreVersionAccept(parseCSV(*coreVersionAccept))
+	if err != nil {
+		log.Fatalf("invalid --core-version-accept: %v", err)
+	}
+
+	var fallbackResponses map[string]json.RawMessage
+	if path := strings.TrimSpace(*fallbackResponsesFile); path != "" {
+		fallbackResponses, err = readFallbackResponses(path)
+		if err != nil {
+			log.Fatalf("invalid --fallback-responses-file: %v", err)
+		}
+	}
+
+	bannerPath := strings.TrimSpace(*wsBannerFile)
+	banner := *wsBanner
+	if bannerPath != "" {
+		banner, err = readBannerFile(bannerPath)
+		if err != nil {
+			log.Fatalf("invalid --ws-banner-file: %v", err)
+		}
+	}
+
 	handler, err := relay.NewHandler(relay.Config{
-		CoreBaseURL:               *coreURL,
-		BridgeToken:               *bridgeToken,
-		CoreToken:                 *coreToken,
-		CoreCAFile:                *coreCAFile,
-		CoreClientCertFile:        *coreClientCertFile,
-		CoreClientKeyFile:         *coreClientKeyFile,
-		CoreTLSServerName:         *coreTLSServerName,
-		CoreTLSInsecureSkipVerify: *coreTLSInsecureSkipVerify,
-		SessionSigningKey:         *sessionSigningKey,
-		SessionTokenTTL:           time.Duration(max(60, *sessionTokenTTL)) * time.Second,
-		AllowedDeviceIDs:          parseCSV(*allowedDeviceIDs),
-		CORSAllowedOrigins:        parseCSV(*corsAllowedOrigins),
-		TrustedProxyCIDRs:         parseCSV(*trustedProxyCIDRs),
-		RevocationStorePath:       strings.TrimSpace(*revocationStorePath),
-		RateLimitRPS:              *rateLimitRPS,
-		RateLimitBurst:            max(1, *rateLimitBurst),
-		MaxWSConnections:          *maxWSConnections,
-		Timeout:                   time.Duration(max(1, *timeout)) * time.Second,
-		LogRequests:               *logRequests,
-		Logger:                    log.Default(),
+		CoreBaseURL:                   *coreURL,
+		CoreBaseURLs:                  parseCSV(*coreURLs),
+		BridgeToken:                   *bridgeToken,
+		RequireAuth:                   *requireAuth,
+		OpenAccessAllowedPaths:        parseCSV(*openAccessAllowedPaths),
+		OnlyStaticTokenCanIssue:       *onlyStaticTokenCanIssue,
+		SessionIssueRPS:               *sessionIssueRPS,
+		CoreToken:                     *coreToken,
+		CoreCAFile:                    *coreCAFile,
+		CoreClientCertFile:            *coreClientCertFile,
+		CoreClientKeyFile:             *coreClientKeyFile,
+		CoreCAPEM:                     *coreCAPEM,
+		CoreClientCertPEM:             *coreClientCertPEM,
+		CoreClientKeyPEM:              *coreClientKeyPEM,
+		CoreTLSServerName:             *coreTLSServerName,
+		CoreTLSInsecureSkipVerify:     *coreTLSInsecureSkipVerify,
+		CoreTLSMinVersion:             strings.TrimSpace(*coreTLSMinVersion),
+		CoreTLSCipherSuites:           parseCSV(*coreTLSCipherSuites),
+		CoreMaxIdleConns:              *coreMaxIdleConns,
+		CoreMaxIdleConnsPerHost:       *coreMaxIdleConnsPerHost,
+		CoreMaxConnsPerHost:           *coreMaxConnsPerHost,
+		CoreRetryBudgetRPS:            *coreRetryBudgetRPS,
+		CoreRetryBudgetBurst:          *coreRetryBudgetBurst,
+		DisableHTTP2:                  *disableHTTP2,
+		SessionSigningKey:             *sessionSigningKey,
+		RequireTenant:                 *requireTenant,
+		ForwardCallerIdentity:         *forwardCallerIdentity,
+		ForwardSubjectHeader:          *forwardSubjectHeader,
+		SessionTokenTTL:               time.Duration(*sessionTokenTTL) * time.Second,
+		MaxSessionTokenTTL:            time.Duration(*maxSessionTokenTTL) * time.Second,
+		MinSessionTokenTTL:            time.Duration(*minSessionTokenTTL) * time.Second,
+		TokenExpiryLeeway:             time.Duration(max(0, *tokenExpiryLeeway)) * time.Second,
+		AllowedDeviceIDs:              parseCSV(*allowedDeviceIDs),
+		AllowedBrowserActions:         parseCSV(*allowedBrowserActions),
+		AllowedTerminalCommands:       parseCSV(*allowedTerminalCommands),
+		CORSAllowedOrigins:            parseCSV(*corsAllowedOrigins),
+		AllowedHosts:                  parseCSV(*allowedHosts),
+		CORSMaxAge:                    time.Duration(max(1, *corsMaxAgeSeconds)) * time.Second,
+		CORSAllowCredentials:          *corsAllowCredentials,
+		RequireCSRFForBrowsers:        *requireCSRFForBrowsers,
+		GzipResponses:                 *gzipResponses,
+		GzipMinBytes:                  *gzipMinBytes,
+		GzipLevel:                     *gzipLevel,
+		TrustedProxyCIDRs:             parseCSV(*trustedProxyCIDRs),
+		AdminAllowedCIDRs:             parseCSV(*adminAllowedCIDRs),
+		RequireHTTPSForAuth:           *requireHTTPSForAuth,
+		RequireClientRequestID:        *requireClientRequestID,
+		AllowClientIPEcho:             *allowClientIPEcho,
+		RevocationStorePath:           strings.TrimSpace(*revocationStorePath),
+		AuditLogPath:                  strings.TrimSpace(*auditLogPath),
+		SingleSessionPerDevice:        *singleSessionPerDevice,
+		SessionIndexPath:              strings.TrimSpace(*sessionIndexPath),
+		MaxIssuableScopes:             parseCSV(*maxIssuableScopes),
+		DeviceSessionStorePath:        strings.TrimSpace(*deviceSessionStorePath),
+		MaintenanceStorePath:          strings.TrimSpace(*maintenanceStorePath),
+		RateLimitRPS:                  *rateLimitRPS,
+		RateLimitBurst:                max(1, *rateLimitBurst),
+		MaxTokenRateLimitRPS:          *maxTokenRateLimitRPS,
+		PenaltyBoxStrikes:             *penaltyBoxStrikes,
+		PenaltyBoxRPS:                 *penaltyBoxRPS,
+		PenaltyBoxDuration:            time.Duration(max(1, *penaltyBoxSeconds)) * time.Second,
+		SharedAuditPump:               *sharedAuditPump,
+		MaxWSConnections:              *maxWSConnections,
+		ProbeCoreCapabilities:         *probeCoreCapabilities,
+		CoreCapabilitiesRefresh:       time.Duration(*coreCapabilitiesRefresh) * time.Second,
+		MaxInflightPerSubject:         *maxInflightPerSubject,
+		MaxTerminalSessionsPerSubject: *maxTerminalSessionsPerSubject,
+		BridgeLoadHeader:              *bridgeLoadHeader,
+		LoadInflightCapacity:          *loadInflightCapacity,
+		WSSendQueueSize:               max(1, *wsSendQueueSize),
+		WSMaxBacklogEvents:            max(0, *wsMaxBacklogEvents),
+		WSFailFastWhenCoreDown:        *wsFailFastWhenCoreDown,
+		WSTicketTTL:                   time.Duration(max(1, *wsTicketTTL)) * time.Second,
+		WSHandshakeTimeout:            time.Duration(*wsHandshakeTimeout) * time.Second,
+		RejectAmbiguousWSAuth:         *rejectAmbiguousWSAuth,
+		WSBanner:                      banner,
+		Timeout:                       time.Duration(max(1, *timeout)) * time.Second,
+		HealthProbeTimeout:            time.Duration(max(1, *healthProbeTimeout)) * time.Second,
+		MaxPathBytes:                  *maxPathBytes,
+		LogRequests:                   *logRequests,
+		LogSampleRate:                 *logSampleRate,
+		LogSampleRateSet:              true,
+		CacheTTLs:                     parsedCacheTTLs,
+		ServeStaleOnError:             *serveStaleOnError,
+		FallbackResponses:             fallbackResponses,
+		RouteTimeouts:                 parsedRouteTimeouts,
+		CacheInvalidations:            parsedCacheInvalidations,
+		CacheMaxEntries:               *cacheMaxEntries,
+		CoreRedirectPolicy:            *coreRedirectPolicy,
+		CoreAcceptHeader:              strings.TrimSpace(*coreAcceptHeader),
+		CoreVersionAccept:             parsedCoreVersionAccept,
+		StrictCoreJSON:                *strictCoreJSON,
+		HonorCoreRetryAfter:           *honorCoreRetryAfter,
+		EventsPageLinks:               *eventsPageLinks,
+		DisableRootInfo:               *disableRootInfo,
+		StripResponseHeaders:          parseCSV(*stripResponseHeaders),
+		ForwardedRequestHeaders:       parseCSV(*forwardedRequestHeaders),
+		HopByHopHeaders:               parseCSV(*hopByHopHeaders),
+		ForwardedResponseHeaders:      parseCSV(*forwardedResponseHeaders),
+		CoreErrorHeaders:              parseCSV(*coreErrorHeaders),
+		PutRouteScopes:                parsedPutRouteScopes,
+		BodyFieldRenames:              parsedBodyFieldRenames,
+		ValidationErrorRoutes:         parsedValidationErrorRoutes,
+		DisableLogRouteTemplate:       !*logRouteTemplate,
+		LogJSON:                       *logJSON,
+		DebugDeviceIDs:                parseCSV(*debugDeviceIDs),
+		Logger:                        log.Default(),
 	})
 	if err != nil {
 		log.Fatalf("failed to initialize relay: %v", err)
 	}
 
 	addr := *host + ":" + strconv.Itoa(*port)
-	server := &http.Server{Addr: addr, Handler: handler}
+	server := relay.NewServer(addr, handler)
 	tlsCert := strings.TrimSpace(*tlsCertFile)
 	tlsKey := strings.TrimSpace(*tlsKeyFile)
 	if (tlsCert == "") != (tlsKey == "") {
@@ -151,6 +720,23 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if bannerPath != "" {
+		reload := make(chan os.Signal, 1)
+		signal.Notify(reload, syscall.SIGHUP)
+		defer signal.Stop(reload)
+		go func() {
+			for range reload {
+				next, err := readBannerFile(bannerPath)
+				if err != nil {
+					log.Printf("ws banner reload failed: %v", err)
+					continue
+				}
+				handler.SetWSBanner(next)
+				log.Printf("ws banner reloaded from %s", bannerPath)
+			}
+		}()
+	}
+
 	errCh := make(chan error, 1)
 	go func() {
 		log.Printf("novaadapt-bridge-go listening on %s://%s -> core %s", listenLabel, addr, *coreURL)
@@ -175,6 +761,26 @@ func main() {
 	log.Printf("bridge stopped")
 }
 
+func readBannerFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+func readFallbackResponses(path string) (map[string]json.RawMessage, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func envOrDefault(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"net"
+	"strings"
+)
+
+// isAdminNetworkPath reports whether path is covered by Config.AdminAllowedCIDRs:
+// the /admin/* routes and the /auth/session* issuance and revocation routes.
+func isAdminNetworkPath(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/") || strings.HasPrefix(path, "/auth/session")
+}
+
+// adminNetworkAllows reports whether the resolved client IP may reach an admin or
+// session route. The client IP honors X-Forwarded-For from trusted proxies, like
+// rate limiting does.
+func (h *Handler) adminNetworkAllows(clientAddr string, path string) bool {
+	if len(h.adminNetworks) == 0 || !isAdminNetworkPath(path) {
+		return true
+	}
+	ip := net.ParseIP(clientAddr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range h.adminNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
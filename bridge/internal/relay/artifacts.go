@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	artifactDownloadPrefix   = "/artifacts/"
+	artifactRouteTemplate    = "/artifacts/{artifact_id}"
+	maxArtifactIDLength      = 128
+	defaultArtifactMediaType = "application/octet-stream"
+)
+
+func isArtifactDownloadPath(p string) bool {
+	return strings.HasPrefix(p, artifactDownloadPrefix)
+}
+
+// validateArtifactID accepts core artifact ids (hex uuids today) and rejects anything
+// that could escape the core artifact path.
+func validateArtifactID(id string) error {
+	if id == "" {
+		return fmt.Errorf("artifact id is required")
+	}
+	if len(id) > maxArtifactIDLength {
+		return fmt.Errorf("artifact id is too long")
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return fmt.Errorf("invalid artifact id")
+		}
+	}
+	return nil
+}
+
+// handleArtifactDownload streams GET /artifacts/{id} from core's
+// /control/artifacts/{id}/preview with the core content type.
+func (h *Handler) handleArtifactDownload(w http.ResponseWriter, r *http.Request, requestID string, auth authContext) int {
+	if r.Method != http.MethodGet {
+		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "Method not allowed", "request_id": requestID})
+		return http.StatusMethodNotAllowed
+	}
+	if !auth.hasScope(scopeRead) {
+		h.writeJSON(w, http.StatusForbidden, map[string]any{"error": "Forbidden", "request_id": requestID})
+		return http.StatusForbidden
+	}
+	if h.missingTenant(auth) {
+		h.writeJSON(w, http.StatusForbidden, map[string]any{"error": "Tenant required", "code": "tenant_required", "request_id": requestID})
+		return http.StatusForbidden
+	}
+	artifactID := strings.TrimPrefix(r.URL.Path, artifactDownloadPrefix)
+	if err := validateArtifactID(artifactID); err != nil {
+		h.writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "request_id": requestID})
+		return http.StatusBadRequest
+	}
+
+	started := time.Now()
+	replica := h.cores.pick(started)
+	target, err := joinURL(replica.baseURL, "/control/artifacts/"+url.PathEscape(artifactID)+"/preview", "")
+	if err != nil {
+		h.writeJSON(w, http.StatusBadGateway, map[string]any{"error": "Failed to build core URL", "request_id": requestID})
+		return http.StatusBadGateway
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadGateway, map[string]any{"error": "Failed to create core request", "request_id": requestID})
+		return http.StatusBadGateway
+	}
+	h.copyForwardedRequestHeaders(req.Header, r.Header)
+	h.setCoreTenantHeader(req.Header, auth)
+	setCoreMetadataHeaders(req.Header, auth)
+	h.setCoreIdentityHeaders(req.Header, auth)
+	req.Header.Set("X-Request-ID", requestID)
+	if strings.TrimSpace(h.cfg.CoreToken) != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
+	}
+	resp, err := h.doCore(req, replica)
+	if err != nil {
+		h.writeJSON(w, http.StatusBadGateway, map[string]any{"error": fmt.Sprintf("Core API unreachable: %v", err), "request_id": requestID})
+		return http.StatusBadGateway
+	}
+	defer resp.Body.Close()
+	if isRedirectStatus(resp.StatusCode) {
+		status, payload := h.coreRedirectPayload(resp, requestID)
+		h.writeJSON(w, status, payload)
+		return status
+	}
+
+	header := h.clientResponseHeaders(resp.Header)
+	h.appendBridgeTiming(header, started)
+	copyResponseHeaders(w.Header(), header)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = defaultArtifactMediaType
+	}
+	w.Header().Set("Content-Type", contentType)
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	return resp.StatusCode
+}
@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	auditEventSessionIssued  = "session_issued"
+	auditEventSessionRevoked = "session_revoked"
+)
+
+// appendAuditLog appends entry as one JSON line to Config.AuditLogPath. Writes are
+// serialized by auditLogMu. Token values must never be part of entry.
+func (h *Handler) appendAuditLog(event string, entry map[string]any) {
+	path := strings.TrimSpace(h.cfg.AuditLogPath)
+	if path == "" {
+		return
+	}
+	entry["event"] = event
+	entry["ts"] = time.Now().UTC().Format(time.RFC3339Nano)
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		h.cfg.Logger.Printf("WARN bridge audit log encode failed event=%s: %v", event, err)
+		return
+	}
+
+	h.auditLogMu.Lock()
+	defer h.auditLogMu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		h.cfg.Logger.Printf("WARN bridge audit log write failed event=%s: %v", event, err)
+		return
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		h.cfg.Logger.Printf("WARN bridge audit log write failed event=%s: %v", event, err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(encoded, '\n')); err != nil {
+		h.cfg.Logger.Printf("WARN bridge audit log write failed event=%s: %v", event, err)
+	}
+}
+
+// auditSessionIssued records a session token grant by issuer.
+func (h *Handler) auditSessionIssued(claims sessionTokenClaims, issuer authContext, via string, requestID string) {
+	h.appendAuditLog(auditEventSessionIssued, map[string]any{
+		"subject":        claims.Sub,
+		"scopes":         claims.Scopes,
+		"device_id":      claims.DeviceID,
+		"tenant":         claims.Tenant,
+		"session_id":     claims.JTI,
+		"ttl_seconds":    claims.Exp - claims.Iat,
+		"issued_at":      claims.Iat,
+		"expires_at":     claims.Exp,
+		"issuer_subject": issuer.Subject,
+		"via":            via,
+		"request_id":     requestID,
+	})
+}
+
+// auditSessionsRevoked records revoked session IDs and who revoked them.
+func (h *Handler) auditSessionsRevoked(sessionIDs []string, subject string, via string, revoker authContext, requestID string) {
+	h.appendAuditLog(auditEventSessionRevoked, map[string]any{
+		"session_ids":     sessionIDs,
+		"subject":         subject,
+		"via":             via,
+		"revoked_by":      revoker.Subject,
+		"revoked_by_type": revoker.TokenType,
+		"request_id":      requestID,
+	})
+}
@@ -8,11 +8,10 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -29,6 +28,7 @@ const (
 	scopeCancel  = "cancel"
 
 	defaultSessionMaxTTLSeconds = 24 * 3600
+	defaultSessionMinTTLSeconds = 60
 	defaultPairingTTLSeconds    = 30 * 24 * 3600
 	maxPairingTTLSeconds        = 90 * 24 * 3600
 )
@@ -52,14 +52,55 @@ var bridgeScopeSet = func() map[string]struct{} {
 	return out
 }()
 
+// Auth failure reasons reported by novaadapt_bridge_auth_failures_total{reason}.
+const (
+	authFailureMissingToken     = "missing_token"
+	authFailureInvalidTicket    = "invalid_ticket"
+	authFailureBadFormat        = "bad_format"
+	authFailureBadSignature     = "bad_signature"
+	authFailureExpired          = "expired"
+	authFailureRevoked          = "revoked"
+	authFailureSuperseded       = "superseded"
+	authFailureDeviceMismatch   = "device_mismatch"
+	authFailureDeviceNotAllowed = "device_not_allowed"
+)
+
+// tokenError is a session token verification failure tagged with its metrics reason.
+type tokenError struct {
+	reason string
+	msg    string
+}
+
+func (e *tokenError) Error() string {
+	return e.msg
+}
+
+func newTokenError(reason string, msg string) error {
+	return &tokenError{reason: reason, msg: msg}
+}
+
+// tokenFailureReason maps a verifySessionToken error to its auth failure reason.
+func tokenFailureReason(err error) string {
+	var tokenErr *tokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr.reason
+	}
+	return authFailureBadFormat
+}
+
 type authContext struct {
 	Authorized bool
 	TokenType  string
 	Subject    string
 	SessionID  string
 	DeviceID   string
+	Tenant     string
+	Metadata   map[string]string
 	Scopes     map[string]struct{}
 	ExpiresAt  int64
+
+	// FailureReason explains why Authorized is false (one of the authFailure* reasons).
+	FailureReason string
 }
 
 func (ctx authContext) hasScope(scope string) bool {
@@ -85,18 +126,60 @@ type sessionTokenClaims struct {
 	Sub      string   `json:"sub,omitempty"`
 	Scopes   []string `json:"scopes,omitempty"`
 	DeviceID string   `json:"device_id,omitempty"`
-	JTI      string   `json:"jti,omitempty"`
-	Exp      int64    `json:"exp"`
-	Iat      int64    `json:"iat,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+	// Metadata is forwarded to core as X-Nova-Meta-<Key> headers.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	JTI      string            `json:"jti,omitempty"`
+	Exp      int64             `json:"exp"`
+	Iat      int64             `json:"iat,omitempty"`
+	// RateLimitRPS overrides Config.RateLimitRPS for requests carrying this token.
+	RateLimitRPS float64 `json:"rate_limit_rps,omitempty"`
+}
+
+// Bridge auth modes reported in health and checked at startup.
+const (
+	authModeOpen    = "open"
+	authModeStatic  = "static"
+	authModeSession = "session"
+)
+
+// authModeFor reports open when no auth material is configured, static when a bridge
+// token is set (session tokens are then also accepted), and session when only a
+// session signing key is set.
+func authModeFor(cfg Config) string {
+	switch {
+	case strings.TrimSpace(cfg.BridgeToken) != "":
+		return authModeStatic
+	case strings.TrimSpace(cfg.SessionSigningKey) != "":
+		return authModeSession
+	default:
+		return authModeOpen
+	}
 }
 
-type revocationStorePayload struct {
-	Version         int              `json:"version"`
-	RevokedSessions map[string]int64 `json:"revoked_sessions"`
+// requiresStaticIssuer reports whether Config.OnlyStaticTokenCanIssue refuses auth
+// at token issuing and revocation endpoints.
+func (h *Handler) requiresStaticIssuer(auth authContext) bool {
+	return h.cfg.OnlyStaticTokenCanIssue && auth.TokenType != "static"
+}
+
+// openAccessAllows applies Config.OpenAccessAllowedPaths to open-access requests.
+// Authenticated requests and open mode without an allowlist are never restricted.
+func (h *Handler) openAccessAllows(auth authContext, p string) bool {
+	if auth.TokenType != "open" || len(h.cfg.OpenAccessAllowedPaths) == 0 {
+		return true
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for _, allowed := range h.cfg.OpenAccessAllowedPaths {
+		if matchPathTemplate(strings.Split(strings.Trim(allowed, "/"), "/"), segments) {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Handler) authenticate(r *http.Request) authContext {
-	if strings.TrimSpace(h.cfg.BridgeToken) == "" && strings.TrimSpace(h.cfg.SessionSigningKey) == "" {
+	if authModeFor(h.cfg) == authModeOpen {
 		return authContext{
 			Authorized: true,
 			TokenType:  "open",
@@ -107,14 +190,23 @@ func (h *Handler) authenticate(r *http.Request) authContext {
 
 	token := extractRequestToken(r)
 	if token == "" {
-		return authContext{}
+		if r.URL.Path == "/ws" {
+			ticket := r.URL.Query().Get("ticket")
+			if ticketAuth, ok := h.consumeWSTicket(ticket, time.Now()); ok {
+				return ticketAuth
+			}
+			if strings.TrimSpace(ticket) != "" {
+				return authContext{FailureReason: authFailureInvalidTicket}
+			}
+		}
+		return authContext{FailureReason: authFailureMissingToken}
 	}
 
 	if strings.TrimSpace(h.cfg.BridgeToken) != "" &&
 		subtle.ConstantTimeCompare([]byte(token), []byte(strings.TrimSpace(h.cfg.BridgeToken))) == 1 {
-		deviceID, ok := h.resolveAndValidateDeviceID(r, "")
-		if !ok {
-			return authContext{}
+		deviceID, reason := h.resolveAndValidateDeviceID(r, "")
+		if reason != "" {
+			return authContext{FailureReason: reason}
 		}
 		return authContext{
 			Authorized: true,
@@ -127,14 +219,17 @@ func (h *Handler) authenticate(r *http.Request) authContext {
 
 	claims, err := h.verifySessionToken(token)
 	if err != nil {
-		return authContext{}
+		return authContext{FailureReason: tokenFailureReason(err)}
 	}
 	if h.isSessionRevoked(claims.JTI, time.Now().Unix()) {
-		return authContext{}
+		return authContext{FailureReason: authFailureRevoked}
 	}
-	deviceID, ok := h.resolveAndValidateDeviceID(r, claims.DeviceID)
-	if !ok {
-		return authContext{}
+	if h.isSupersededDeviceSession(claims.DeviceID, claims.JTI, time.Now().Unix()) {
+		return authContext{FailureReason: authFailureSuperseded}
+	}
+	deviceID, reason := h.resolveAndValidateDeviceID(r, claims.DeviceID)
+	if reason != "" {
+		return authContext{FailureReason: reason}
 	}
 	subject := strings.TrimSpace(claims.Sub)
 	if subject == "" {
@@ -146,6 +241,8 @@ func (h *Handler) authenticate(r *http.Request) authContext {
 		Subject:    subject,
 		SessionID:  claims.JTI,
 		DeviceID:   deviceID,
+		Tenant:     strings.TrimSpace(claims.Tenant),
+		Metadata:   claims.Metadata,
 		Scopes:     scopeSet(claims.Scopes),
 		ExpiresAt:  claims.Exp,
 	}
@@ -157,13 +254,18 @@ func (h *Handler) issueSessionToken(
 	deviceID string,
 	ttlSeconds int,
 ) (string, sessionTokenClaims, error) {
-	return h.issueSessionTokenWithLimit(subject, scopes, deviceID, ttlSeconds, defaultSessionMaxTTLSeconds)
+	return h.issueSessionTokenWithLimit(subject, scopes, deviceID, "", nil, 0, ttlSeconds, 0)
 }
 
+// issueSessionTokenWithLimit clamps ttlSeconds to maxTTLSeconds, which defaults to
+// Config.MaxSessionTokenTTL when zero, and then to Config.MinSessionTokenTTL.
 func (h *Handler) issueSessionTokenWithLimit(
 	subject string,
 	scopes []string,
 	deviceID string,
+	tenant string,
+	metadata map[string]string,
+	rateLimitRPS float64,
 	ttlSeconds int,
 	maxTTLSeconds int,
 ) (string, sessionTokenClaims, error) {
@@ -179,14 +281,17 @@ func (h *Handler) issueSessionTokenWithLimit(
 	now := time.Now().Unix()
 	ttl := ttlSeconds
 	if ttl <= 0 {
-		ttl = int(max(60, int(h.cfg.SessionTokenTTL.Seconds())))
+		ttl = int(h.cfg.SessionTokenTTL.Seconds())
 	}
 	if maxTTLSeconds <= 0 {
-		maxTTLSeconds = defaultSessionMaxTTLSeconds
+		maxTTLSeconds = int(h.cfg.MaxSessionTokenTTL.Seconds())
 	}
 	if ttl > maxTTLSeconds {
 		ttl = maxTTLSeconds
 	}
+	if minTTLSeconds := int(h.cfg.MinSessionTokenTTL.Seconds()); ttl < minTTLSeconds {
+		ttl = minTTLSeconds
+	}
 	sessionID, err := generateSessionID()
 	if err != nil {
 		return "", sessionTokenClaims{}, fmt.Errorf("failed to generate session id")
@@ -195,9 +300,13 @@ func (h *Handler) issueSessionTokenWithLimit(
 		Sub:      strings.TrimSpace(subject),
 		Scopes:   normalizedScopes,
 		DeviceID: strings.TrimSpace(deviceID),
+		Tenant:   strings.TrimSpace(tenant),
+		Metadata: metadata,
 		JTI:      sessionID,
 		Iat:      now,
 		Exp:      now + int64(ttl),
+
+		RateLimitRPS: rateLimitRPS,
 	}
 	if claims.Sub == "" {
 		claims.Sub = "bridge-session"
@@ -209,6 +318,9 @@ func (h *Handler) issueSessionTokenWithLimit(
 	body := base64.RawURLEncoding.EncodeToString(payload)
 	signature := signSessionBody(body, key)
 	token := "na1." + body + "." + signature
+	if err := h.recordIssuedSession(claims); err != nil {
+		return "", sessionTokenClaims{}, err
+	}
 	return token, claims, nil
 }
 
@@ -219,29 +331,30 @@ func (h *Handler) verifySessionToken(token string) (sessionTokenClaims, error) {
 	}
 	parts := strings.Split(token, ".")
 	if len(parts) != 3 || parts[0] != "na1" {
-		return sessionTokenClaims{}, fmt.Errorf("invalid token format")
+		return sessionTokenClaims{}, newTokenError(authFailureBadFormat, "invalid token format")
 	}
 	body := parts[1]
 	expectedSig := signSessionBody(body, key)
 	if subtle.ConstantTimeCompare([]byte(parts[2]), []byte(expectedSig)) != 1 {
-		return sessionTokenClaims{}, fmt.Errorf("invalid token signature")
+		return sessionTokenClaims{}, newTokenError(authFailureBadSignature, "invalid token signature")
 	}
 
 	raw, err := base64.RawURLEncoding.DecodeString(body)
 	if err != nil {
-		return sessionTokenClaims{}, fmt.Errorf("invalid token payload")
+		return sessionTokenClaims{}, newTokenError(authFailureBadFormat, "invalid token payload")
 	}
 	var claims sessionTokenClaims
 	if err := json.Unmarshal(raw, &claims); err != nil {
-		return sessionTokenClaims{}, fmt.Errorf("invalid token claims")
+		return sessionTokenClaims{}, newTokenError(authFailureBadFormat, "invalid token claims")
 	}
 	now := time.Now().Unix()
-	if claims.Exp <= now {
-		return sessionTokenClaims{}, fmt.Errorf("token expired")
+	leeway := int64(max(0, h.cfg.TokenExpiryLeeway) / time.Second)
+	if claims.Exp+leeway <= now {
+		return sessionTokenClaims{}, newTokenError(authFailureExpired, "token expired")
 	}
 	claims.Scopes = normalizeScopes(claims.Scopes)
 	if err := validateScopes(claims.Scopes); err != nil {
-		return sessionTokenClaims{}, fmt.Errorf("invalid token scopes")
+		return sessionTokenClaims{}, newTokenError(authFailureBadFormat, "invalid token scopes")
 	}
 	return claims, nil
 }
@@ -253,7 +366,9 @@ func (h *Handler) sessionSigningKey() string {
 	return strings.TrimSpace(h.cfg.BridgeToken)
 }
 
-func (h *Handler) resolveAndValidateDeviceID(r *http.Request, tokenDeviceID string) (string, bool) {
+// resolveAndValidateDeviceID returns the effective device id, or a non-empty auth
+// failure reason when the request device conflicts with the token or allowlist.
+func (h *Handler) resolveAndValidateDeviceID(r *http.Request, tokenDeviceID string) (string, string) {
 	requestDeviceID := strings.TrimSpace(r.Header.Get("X-Device-ID"))
 	if requestDeviceID == "" && r.URL.Path == "/ws" {
 		requestDeviceID = strings.TrimSpace(r.URL.Query().Get("device_id"))
@@ -263,16 +378,16 @@ func (h *Handler) resolveAndValidateDeviceID(r *http.Request, tokenDeviceID stri
 		requestDeviceID = tokenDeviceID
 	}
 	if tokenDeviceID != "" && requestDeviceID != "" && tokenDeviceID != requestDeviceID {
-		return "", false
+		return "", authFailureDeviceMismatch
 	}
 
 	if !h.hasAllowedDevices() {
-		return requestDeviceID, true
+		return requestDeviceID, ""
 	}
-	if requestDeviceID == "" {
-		return "", false
+	if requestDeviceID == "" || !h.isAllowedDevice(requestDeviceID) {
+		return "", authFailureDeviceNotAllowed
 	}
-	return requestDeviceID, h.isAllowedDevice(requestDeviceID)
+	return requestDeviceID, ""
 }
 
 func requiredScopeForRoute(method string, path string) string {
@@ -280,6 +395,9 @@ func requiredScopeForRoute(method string, path string) string {
 	if method == http.MethodGet {
 		return scopeRead
 	}
+	if method == http.MethodPut && isPutForwardPath(path) {
+		return scopePlan
+	}
 	if method != http.MethodPost {
 		return ""
 	}
@@ -367,6 +485,39 @@ func validateScopes(scopes []string) error {
 	return fmt.Errorf("unknown scope(s): %s", strings.Join(unknown, ", "))
 }
 
+// checkIssuableScopes rejects scopes outside Config.MaxIssuableScopes. An empty
+// allowlist leaves issuance unrestricted.
+func (h *Handler) checkIssuableScopes(scopes []string) error {
+	if len(h.issuableScopes) == 0 {
+		return nil
+	}
+	forbidden := make([]string, 0)
+	for _, scope := range normalizeScopes(scopes) {
+		if _, ok := h.issuableScopes[scope]; ok {
+			continue
+		}
+		forbidden = append(forbidden, scope)
+	}
+	if len(forbidden) == 0 {
+		return nil
+	}
+	return fmt.Errorf("scope(s) not issuable: %s", strings.Join(forbidden, ", "))
+}
+
+// issuableSubset filters default scopes down to the issuable allowlist, if any.
+func (h *Handler) issuableSubset(scopes []string) []string {
+	if len(h.issuableScopes) == 0 {
+		return scopes
+	}
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if _, ok := h.issuableScopes[scope]; ok {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
+
 func generateSessionID() (string, error) {
 	buf := make([]byte, 12)
 	if _, err := rand.Read(buf); err != nil {
@@ -395,6 +546,21 @@ func extractRequestToken(r *http.Request) string {
 	return ""
 }
 
+// ambiguousWSAuth reports whether a /ws request carries both a bearer header and a
+// ?token= query parameter that disagree.
+func ambiguousWSAuth(r *http.Request) bool {
+	if r.URL.Path != "/ws" {
+		return false
+	}
+	queryToken := strings.TrimSpace(r.URL.Query().Get("token"))
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if queryToken == "" || !strings.HasPrefix(strings.ToLower(header), "bearer ") {
+		return false
+	}
+	headerToken := strings.TrimSpace(header[len("Bearer "):])
+	return headerToken != "" && headerToken != queryToken
+}
+
 func (h *Handler) handleIssueSessionToken(body []byte, auth authContext, requestID string) (map[string]any, error) {
 	payload := map[string]any{}
 	if len(bytesTrimSpace(body)) > 0 {
@@ -419,6 +585,19 @@ func (h *Handler) handleIssueSessionToken(body []byte, auth authContext, request
 		return nil, fmt.Errorf("device_id is not in allowed list")
 	}
 
+	tenant, err := issuedTenant(auth, toString(payload["tenant"]))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseSessionMetadata(payload["metadata"])
+	if err != nil {
+		return nil, err
+	}
+	rateLimitRPS, err := h.issuedRateLimitRPS(payload["rate_limit_rps"])
+	if err != nil {
+		return nil, err
+	}
+
 	ttlSeconds := int(h.cfg.SessionTokenTTL.Seconds())
 	if rawTTL := toInt(payload["ttl_seconds"]); rawTTL > 0 {
 		ttlSeconds = rawTTL
@@ -426,26 +605,39 @@ func (h *Handler) handleIssueSessionToken(body []byte, auth authContext, request
 
 	scopes := extractScopes(payload["scopes"])
 	if len(scopes) == 0 {
-		scopes = []string{scopeRead, scopeRun, scopePlan, scopeApprove, scopeReject, scopeUndo, scopeCancel}
+		scopes = h.issuableSubset([]string{scopeRead, scopeRun, scopePlan, scopeApprove, scopeReject, scopeUndo, scopeCancel})
 	}
 	if err := validateScopes(scopes); err != nil {
 		return nil, err
 	}
-	token, claims, err := h.issueSessionToken(subject, scopes, deviceID, ttlSeconds)
+	if err := h.checkIssuableScopes(scopes); err != nil {
+		return nil, err
+	}
+	token, claims, err := h.issueSessionTokenWithLimit(subject, scopes, deviceID, tenant, metadata, rateLimitRPS, ttlSeconds, 0)
 	if err != nil {
 		return nil, err
 	}
-	return map[string]any{
+	if err := h.setCurrentDeviceSession(claims.DeviceID, claims.JTI, claims.Exp); err != nil {
+		return nil, err
+	}
+	h.auditSessionIssued(claims, auth, "session", requestID)
+	issued := map[string]any{
 		"token":      token,
 		"token_type": "session",
 		"subject":    claims.Sub,
 		"session_id": claims.JTI,
 		"scopes":     claims.Scopes,
 		"device_id":  claims.DeviceID,
+		"tenant":     claims.Tenant,
+		"metadata":   claims.Metadata,
 		"expires_at": claims.Exp,
 		"issued_at":  claims.Iat,
 		"request_id": requestID,
-	}, nil
+	}
+	if h.cfg.RequireCSRFForBrowsers {
+		issued["csrf_token"] = h.csrfToken(claims.JTI)
+	}
+	return issued, nil
 }
 
 func (h *Handler) handleIssuePairingPayload(body []byte, auth authContext, requestID string, r *http.Request) (map[string]any, error) {
@@ -476,6 +668,11 @@ func (h *Handler) handleIssuePairingPayload(body []byte, auth authContext, reque
 		deviceID = generated
 	}
 
+	tenant, err := issuedTenant(auth, toString(payload["tenant"]))
+	if err != nil {
+		return nil, err
+	}
+
 	autoAllowlist := h.hasAllowedDevices()
 	if value, ok := toBool(payload["auto_allowlist"]); ok {
 		autoAllowlist = value
@@ -496,7 +693,7 @@ func (h *Handler) handleIssuePairingPayload(body []byte, auth authContext, reque
 
 	operatorScopes := extractScopes(payload["scopes"])
 	if len(operatorScopes) == 0 {
-		operatorScopes = []string{scopeRead, scopeRun, scopePlan, scopeApprove, scopeReject, scopeUndo, scopeCancel}
+		operatorScopes = h.issuableSubset([]string{scopeRead, scopeRun, scopePlan, scopeApprove, scopeReject, scopeUndo, scopeCancel})
 	}
 	if err := validateScopes(operatorScopes); err != nil {
 		return nil, err
@@ -523,24 +720,36 @@ func (h *Handler) handleIssuePairingPayload(body []byte, auth authContext, reque
 	if value, ok := toBool(payload["include_admin_token"]); ok {
 		includeAdminToken = value
 	}
+	if err := h.checkIssuableScopes(operatorScopes); err != nil {
+		return nil, err
+	}
+	if includeAdminToken {
+		if err := h.checkIssuableScopes(adminScopes); err != nil {
+			return nil, err
+		}
+	}
 
 	autoConnect := true
 	if value, ok := toBool(payload["auto_connect"]); ok {
 		autoConnect = value
 	}
 
-	operatorToken, operatorClaims, err := h.issueSessionTokenWithLimit(subject, operatorScopes, deviceID, ttlSeconds, maxPairingTTLSeconds)
+	operatorToken, operatorClaims, err := h.issueSessionTokenWithLimit(subject, operatorScopes, deviceID, tenant, nil, 0, ttlSeconds, maxPairingTTLSeconds)
 	if err != nil {
 		return nil, err
 	}
 	adminToken := ""
 	adminClaims := sessionTokenClaims{}
 	if includeAdminToken {
-		adminToken, adminClaims, err = h.issueSessionTokenWithLimit(subject+"-admin", adminScopes, deviceID, adminTTLSeconds, maxPairingTTLSeconds)
+		adminToken, adminClaims, err = h.issueSessionTokenWithLimit(subject+"-admin", adminScopes, deviceID, tenant, nil, 0, adminTTLSeconds, maxPairingTTLSeconds)
 		if err != nil {
 			return nil, err
 		}
 	}
+	h.auditSessionIssued(operatorClaims, auth, "pair", requestID)
+	if includeAdminToken {
+		h.auditSessionIssued(adminClaims, auth, "pair", requestID)
+	}
 
 	httpURL, wsURL := h.publicBridgeURLs(r)
 	manifest := map[string]any{
@@ -579,7 +788,7 @@ func (h *Handler) handleIssuePairingPayload(body []byte, auth authContext, reque
 	}, nil
 }
 
-func (h *Handler) handleRevokeSessionToken(body []byte, requestID string) (map[string]any, error) {
+func (h *Handler) handleRevokeSessionToken(body []byte, auth authContext, requestID string) (map[string]any, error) {
 	payload := map[string]any{}
 	if len(bytesTrimSpace(body)) > 0 {
 		if err := json.Unmarshal(body, &payload); err != nil {
@@ -605,7 +814,24 @@ func (h *Handler) handleRevokeSessionToken(body []byte, requestID string) (map[s
 		expiresAt = claims.Exp
 		via = "token"
 	} else if sessionID == "" {
-		return nil, fmt.Errorf("'token' or 'session_id' is required")
+		if bySubject := strings.TrimSpace(toString(payload["subject"])); bySubject != "" {
+			revoked, err := h.revokeSubjectSessions(bySubject)
+			if err != nil {
+				return nil, err
+			}
+			if len(revoked) > 0 {
+				h.auditSessionsRevoked(revoked, bySubject, "subject", auth, requestID)
+			}
+			return map[string]any{
+				"revoked":     len(revoked) > 0,
+				"subject":     bySubject,
+				"session_ids": revoked,
+				"count":       len(revoked),
+				"via":         "subject",
+				"request_id":  requestID,
+			}, nil
+		}
+		return nil, fmt.Errorf("'token', 'session_id', or 'subject' is required")
 	}
 
 	if expiresAt == 0 {
@@ -619,6 +845,7 @@ func (h *Handler) handleRevokeSessionToken(body []byte, requestID string) (map[s
 	if err != nil {
 		return nil, err
 	}
+	h.auditSessionsRevoked([]string{sessionID}, subject, via, auth, requestID)
 
 	return map[string]any{
 		"revoked":         true,
@@ -729,20 +956,8 @@ func (h *Handler) revokeSession(sessionID string, expiresAt int64) (bool, error)
 	if sessionID == "" {
 		return false, nil
 	}
-	now := time.Now().Unix()
-	h.revokedSessionsMu.Lock()
-	defer h.revokedSessionsMu.Unlock()
-	h.pruneExpiredRevocationsLocked(now)
-	currentExpiry, exists := h.revokedSessions[sessionID]
-	alreadyRevoked := exists && currentExpiry > now
-	previousExpiry := currentExpiry
-	h.revokedSessions[sessionID] = expiresAt
-	if err := persistRevocationEntries(strings.TrimSpace(h.cfg.RevocationStorePath), h.revokedSessions); err != nil {
-		if exists {
-			h.revokedSessions[sessionID] = previousExpiry
-		} else {
-			delete(h.revokedSessions, sessionID)
-		}
+	alreadyRevoked, err := h.revocations.Revoke(sessionID, expiresAt, time.Now().Unix())
+	if err != nil {
 		return false, fmt.Errorf("failed to persist session revocation: %w", err)
 	}
 	return alreadyRevoked, nil
@@ -753,84 +968,5 @@ func (h *Handler) isSessionRevoked(sessionID string, now int64) bool {
 	if sessionID == "" {
 		return false
 	}
-	h.revokedSessionsMu.RLock()
-	expiresAt, exists := h.revokedSessions[sessionID]
-	h.revokedSessionsMu.RUnlock()
-	if !exists {
-		return false
-	}
-	if expiresAt > 0 && expiresAt <= now {
-		h.revokedSessionsMu.Lock()
-		if current, ok := h.revokedSessions[sessionID]; ok && current <= now {
-			delete(h.revokedSessions, sessionID)
-		}
-		h.revokedSessionsMu.Unlock()
-		return false
-	}
-	return true
-}
-
-func (h *Handler) pruneExpiredRevocationsLocked(now int64) {
-	for sessionID, expiresAt := range h.revokedSessions {
-		if expiresAt > 0 && expiresAt <= now {
-			delete(h.revokedSessions, sessionID)
-		}
-	}
-}
-
-func loadRevocationEntries(path string, now int64) (map[string]int64, error) {
-	out := make(map[string]int64)
-	path = strings.TrimSpace(path)
-	if path == "" {
-		return out, nil
-	}
-	raw, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return out, nil
-		}
-		return nil, err
-	}
-	payload := revocationStorePayload{}
-	if err := json.Unmarshal(raw, &payload); err != nil {
-		return nil, err
-	}
-	for sessionID, expiresAt := range payload.RevokedSessions {
-		trimmed := strings.TrimSpace(sessionID)
-		if trimmed == "" {
-			continue
-		}
-		if expiresAt > 0 && expiresAt <= now {
-			continue
-		}
-		out[trimmed] = expiresAt
-	}
-	return out, nil
-}
-
-func persistRevocationEntries(path string, entries map[string]int64) error {
-	path = strings.TrimSpace(path)
-	if path == "" {
-		return nil
-	}
-	payload := revocationStorePayload{
-		Version:         1,
-		RevokedSessions: entries,
-	}
-	encoded, err := json.MarshalIndent(payload, "", "  ")
-	if err != nil {
-		return err
-	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, encoded, 0o600); err != nil {
-		return err
-	}
-	if err := os.Rename(tmp, path); err != nil {
-		_ = os.Remove(tmp)
-		return err
-	}
-	return nil
+	return h.revocations.IsRevoked(sessionID, now)
 }
@@ -1,13 +1,18 @@
 package relay
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -79,6 +84,68 @@ func TestSessionTokenIssueAndScopeEnforcement(t *testing.T) {
 	}
 }
 
+func TestSessionTokenTTLClampedToConfiguredBounds(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:        "http://127.0.0.1:8787",
+		BridgeToken:        "bridge",
+		Timeout:            5 * time.Second,
+		MaxSessionTokenTTL: time.Hour,
+		MinSessionTokenTTL: 5 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		ttlSeconds int
+		want       int64
+	}{
+		{name: "above max", ttlSeconds: 7200, want: 3600},
+		{name: "below min", ttlSeconds: 30, want: 300},
+		{name: "within bounds", ttlSeconds: 900, want: 900},
+	} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(
+			http.MethodPost,
+			"/auth/session",
+			strings.NewReader(`{"subject":"iphone","scopes":["read"],"ttl_seconds":`+strconv.Itoa(tc.ttlSeconds)+`}`),
+		)
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 from /auth/session got %d body=%s", tc.name, rr.Code, rr.Body.String())
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("%s: unmarshal issue payload: %v", tc.name, err)
+		}
+		if got := int64(toInt(payload["expires_at"])) - int64(toInt(payload["issued_at"])); got != tc.want {
+			t.Fatalf("%s: expected ttl %d got %d", tc.name, tc.want, got)
+		}
+	}
+
+	_, claims, err := h.issueSessionToken("internal", []string{scopeRead}, "", 10)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	if got := claims.Exp - claims.Iat; got != 300 {
+		t.Fatalf("expected internal issuance clamped to min ttl 300 got %d", got)
+	}
+}
+
+func TestSessionTokenTTLBoundsValidatedAtStartup(t *testing.T) {
+	_, err := NewHandler(Config{
+		CoreBaseURL:        "http://127.0.0.1:8787",
+		BridgeToken:        "bridge",
+		MaxSessionTokenTTL: time.Minute,
+		MinSessionTokenTTL: 2 * time.Minute,
+	})
+	if err == nil || !strings.Contains(err.Error(), "exceeds max session token ttl") {
+		t.Fatalf("expected min > max ttl to fail handler construction, got %v", err)
+	}
+}
+
 func TestRequiredScopeForRetryFailedRoute(t *testing.T) {
 	scope := requiredScopeForRoute(http.MethodPost, "/plans/plan-1/retry_failed")
 	if scope != scopeApprove {
@@ -148,6 +215,79 @@ func TestSessionTokenCannotIssueSessionWithoutAdminScope(t *testing.T) {
 	}
 }
 
+func TestOnlyStaticTokenCanIssueRejectsAdminSessionToken(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:             "http://example.com",
+		BridgeToken:             "bridge",
+		OnlyStaticTokenCanIssue: true,
+		Timeout:                 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	adminToken, _, err := h.issueSessionToken("operator-admin", []string{scopeAdmin}, "", 120)
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+
+	for _, path := range []string{"/auth/session", "/auth/session/revoke", "/auth/pair"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"scopes":["read"],"subject":"x"}`))
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"code":"static_token_required"`) {
+			t.Fatalf("expected admin session token to be refused at %s, got %d body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"scopes":["read"]}`))
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected static bridge token to issue, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSessionIssueRPSThrottlesTokenIssuance(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:     "http://example.com",
+		BridgeToken:     "bridge",
+		SessionIssueRPS: 1,
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	codes := make([]int, 0, 5)
+	for i := 0; i < 5; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"scopes":["read"]}`))
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+		if rr.Code == http.StatusTooManyRequests && !strings.Contains(rr.Body.String(), `"code":"session_issue_rate_limited"`) {
+			t.Fatalf("expected session_issue_rate_limited code, got body=%s", rr.Body.String())
+		}
+	}
+	if codes[0] != http.StatusOK {
+		t.Fatalf("expected first issuance to succeed, got %v", codes)
+	}
+	if codes[len(codes)-1] != http.StatusTooManyRequests {
+		t.Fatalf("expected rapid issuance to be throttled, got %v", codes)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/pair", strings.NewReader(`{"scopes":["read"]}`))
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected /auth/pair to share the issuance limit, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestSessionTokenDeviceBinding(t *testing.T) {
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/models" {
@@ -749,6 +889,134 @@ func TestSessionTokenRevocationPersistsAcrossHandlerRestart(t *testing.T) {
 	}
 }
 
+type sharedRevocationStore struct {
+	mu      sync.Mutex
+	entries map[string]int64
+}
+
+func (s *sharedRevocationStore) Load(int64) error { return nil }
+
+func (s *sharedRevocationStore) Revoke(sessionID string, expiresAt int64, now int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.entries[sessionID]
+	s.entries[sessionID] = expiresAt
+	return exists && current > now, nil
+}
+
+func (s *sharedRevocationStore) IsRevoked(sessionID string, now int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, exists := s.entries[sessionID]
+	return exists && (expiresAt == 0 || expiresAt > now)
+}
+
+func (s *sharedRevocationStore) Prune(int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func TestCustomRevocationStoreIsSharedAcrossHandlers(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	store := &sharedRevocationStore{entries: make(map[string]int64)}
+	newBridge := func() *Handler {
+		h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", RevocationStore: store, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		return h
+	}
+	h1, h2 := newBridge(), newBridge()
+
+	sessionToken, _, err := h1.issueSessionToken("phone", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	rrRevoke := httptest.NewRecorder()
+	reqRevoke := httptest.NewRequest(http.MethodPost, "/auth/session/revoke", strings.NewReader(`{"token":"`+sessionToken+`"}`))
+	reqRevoke.Header.Set("Authorization", "Bearer bridge")
+	h1.ServeHTTP(rrRevoke, reqRevoke)
+	if rrRevoke.Code != http.StatusOK {
+		t.Fatalf("revoke session token failed: %d body=%s", rrRevoke.Code, rrRevoke.Body.String())
+	}
+
+	rrModels := httptest.NewRecorder()
+	reqModels := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqModels.Header.Set("Authorization", "Bearer "+sessionToken)
+	h2.ServeHTTP(rrModels, reqModels)
+	if rrModels.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revocation on one bridge to apply to another, got %d body=%s", rrModels.Code, rrModels.Body.String())
+	}
+}
+
+func TestAuditLogRecordsSessionLifecycleWithoutToken(t *testing.T) {
+	auditLogPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:  "http://example.com",
+			BridgeToken:  "bridge",
+			AuditLogPath: auditLogPath,
+			Timeout:      5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rrIssue := httptest.NewRecorder()
+	reqIssue := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"subject":"iphone","scopes":["read"],"device_id":"dev-1","ttl_seconds":120}`))
+	reqIssue.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rrIssue, reqIssue)
+	if rrIssue.Code != http.StatusOK {
+		t.Fatalf("issue session token failed: %d body=%s", rrIssue.Code, rrIssue.Body.String())
+	}
+	var issuePayload map[string]any
+	if err := json.Unmarshal(rrIssue.Body.Bytes(), &issuePayload); err != nil {
+		t.Fatalf("unmarshal issue payload: %v", err)
+	}
+	sessionToken := toString(issuePayload["token"])
+
+	rrRevoke := httptest.NewRecorder()
+	reqRevoke := httptest.NewRequest(http.MethodPost, "/auth/session/revoke", strings.NewReader(`{"token":"`+sessionToken+`"}`))
+	reqRevoke.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rrRevoke, reqRevoke)
+	if rrRevoke.Code != http.StatusOK {
+		t.Fatalf("revoke session token failed: %d body=%s", rrRevoke.Code, rrRevoke.Body.String())
+	}
+
+	raw, err := os.ReadFile(auditLogPath)
+	if err != nil {
+		t.Fatalf("read audit log: %v", err)
+	}
+	if strings.Contains(string(raw), sessionToken) {
+		t.Fatalf("audit log must not contain the session token: %s", raw)
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit lines, got %d: %s", len(lines), raw)
+	}
+	var issued, revoked map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &issued); err != nil {
+		t.Fatalf("decode issued entry: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &revoked); err != nil {
+		t.Fatalf("decode revoked entry: %v", err)
+	}
+	if issued["event"] != auditEventSessionIssued || issued["subject"] != "iphone" || issued["device_id"] != "dev-1" ||
+		issued["issuer_subject"] != "bridge-static-token" || issued["session_id"] != issuePayload["session_id"] ||
+		issued["ttl_seconds"] != float64(120) {
+		t.Fatalf("unexpected issued entry %#v", issued)
+	}
+	if revoked["event"] != auditEventSessionRevoked || revoked["via"] != "token" || revoked["revoked_by"] != "bridge-static-token" {
+		t.Fatalf("unexpected revoked entry %#v", revoked)
+	}
+}
+
 func TestInvalidRevocationStoreFailsHandlerInit(t *testing.T) {
 	tempDir := t.TempDir()
 	storePath := filepath.Join(tempDir, "revocations.json")
@@ -818,6 +1086,62 @@ func TestSessionIssueAndRevokeMetricsIncrement(t *testing.T) {
 	}
 }
 
+func TestAuthFailureMetricsByReason(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL: "http://example.com",
+		BridgeToken: "bridge",
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	token, _, err := h.issueSessionToken("viewer", []string{scopeRead}, "iphone-1", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + ".bad"
+
+	cases := []struct {
+		token    string
+		deviceID string
+	}{
+		{token: ""},
+		{token: "garbage"},
+		{token: tampered},
+		{token: token, deviceID: "iphone-2"},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		if tc.deviceID != "" {
+			req.Header.Set("X-Device-ID", tc.deviceID)
+		}
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	rrMetrics := httptest.NewRecorder()
+	h.ServeHTTP(rrMetrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	metrics := rrMetrics.Body.String()
+	for _, want := range []string{
+		`novaadapt_bridge_auth_failures_total{reason="bad_format"} 1`,
+		`novaadapt_bridge_auth_failures_total{reason="bad_signature"} 1`,
+		`novaadapt_bridge_auth_failures_total{reason="device_mismatch"} 1`,
+		`novaadapt_bridge_auth_failures_total{reason="missing_token"} 1`,
+		"novaadapt_bridge_unauthorized_total 4",
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("expected %q in metrics, got: %s", want, metrics)
+		}
+	}
+}
+
 func TestWebSocketReadScopedTokenCannotRunCommand(t *testing.T) {
 	runCalls := 0
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -919,3 +1243,984 @@ func TestWebSocketRequiresReadScope(t *testing.T) {
 		t.Fatalf("expected 403 got %d", resp.StatusCode)
 	}
 }
+
+func TestPlanPutRequiresPlanScope(t *testing.T) {
+	putCalls := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/plans/client-plan-1" {
+			putCalls++
+			_, _ = w.Write([]byte(`{"id":"client-plan-1","status":"pending"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "bridge",
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	planToken, _, err := h.issueSessionToken("planner", []string{scopePlan}, "", 120)
+	if err != nil {
+		t.Fatalf("issue plan token: %v", err)
+	}
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+
+	rrPut := httptest.NewRecorder()
+	reqPut := httptest.NewRequest(http.MethodPut, "/plans/client-plan-1", strings.NewReader(`{"objective":"test"}`))
+	reqPut.Header.Set("Authorization", "Bearer "+planToken)
+	h.ServeHTTP(rrPut, reqPut)
+	if rrPut.Code != http.StatusOK {
+		t.Fatalf("expected 200 for plan-scoped PUT, got %d body=%s", rrPut.Code, rrPut.Body.String())
+	}
+
+	rrForbidden := httptest.NewRecorder()
+	reqForbidden := httptest.NewRequest(http.MethodPut, "/plans/client-plan-1", strings.NewReader(`{"objective":"test"}`))
+	reqForbidden.Header.Set("Authorization", "Bearer "+readToken)
+	h.ServeHTTP(rrForbidden, reqForbidden)
+	if rrForbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for read-scoped PUT, got %d body=%s", rrForbidden.Code, rrForbidden.Body.String())
+	}
+
+	rrInvalid := httptest.NewRecorder()
+	reqInvalid := httptest.NewRequest(http.MethodPut, "/plans/client-plan-1", strings.NewReader(`not-json`))
+	reqInvalid.Header.Set("Authorization", "Bearer "+planToken)
+	h.ServeHTTP(rrInvalid, reqInvalid)
+	if rrInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid PUT body, got %d body=%s", rrInvalid.Code, rrInvalid.Body.String())
+	}
+	if putCalls != 1 {
+		t.Fatalf("expected exactly one upstream PUT, got %d", putCalls)
+	}
+}
+
+func TestSingleSessionPerDeviceInvalidatesPreviousToken(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	storePath := filepath.Join(t.TempDir(), "device-sessions.json")
+	cfg := Config{
+		CoreBaseURL:            core.URL,
+		BridgeToken:            "bridge",
+		SingleSessionPerDevice: true,
+		DeviceSessionStorePath: storePath,
+		Timeout:                5 * time.Second,
+	}
+	h, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	issue := func() string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"scopes":["read"],"device_id":"iphone-1"}`))
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 from /auth/session got %d body=%s", rr.Code, rr.Body.String())
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("unmarshal issue payload: %v", err)
+		}
+		return toString(payload["token"])
+	}
+	models := func(handler *Handler, token string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	first := issue()
+	if code := models(h, first); code != http.StatusOK {
+		t.Fatalf("expected first token valid, got %d", code)
+	}
+	second := issue()
+	if code := models(h, first); code != http.StatusUnauthorized {
+		t.Fatalf("expected first token invalidated after re-issue, got %d", code)
+	}
+	if code := models(h, second); code != http.StatusOK {
+		t.Fatalf("expected second token valid, got %d", code)
+	}
+
+	restarted, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler after restart: %v", err)
+	}
+	if code := models(restarted, first); code != http.StatusUnauthorized {
+		t.Fatalf("expected first token still invalid after restart, got %d", code)
+	}
+	if code := models(restarted, second); code != http.StatusOK {
+		t.Fatalf("expected second token valid after restart, got %d", code)
+	}
+}
+
+func TestSubjectRevocationUsesPersistedSessionIndex(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	dir := t.TempDir()
+	cfg := Config{
+		CoreBaseURL:         core.URL,
+		BridgeToken:         "bridge",
+		SessionIndexPath:    filepath.Join(dir, "session-index.json"),
+		RevocationStorePath: filepath.Join(dir, "revocations.json"),
+		Timeout:             5 * time.Second,
+	}
+	h, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	first, _, err := h.issueSessionToken("iphone", []string{"read"}, "iphone-1", 300)
+	if err != nil {
+		t.Fatalf("issue first token: %v", err)
+	}
+	second, _, err := h.issueSessionToken("iphone", []string{"read"}, "iphone-2", 300)
+	if err != nil {
+		t.Fatalf("issue second token: %v", err)
+	}
+	other, _, err := h.issueSessionToken("ipad", []string{"read"}, "ipad-1", 300)
+	if err != nil {
+		t.Fatalf("issue other token: %v", err)
+	}
+
+	restarted, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler after restart: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/session/revoke", strings.NewReader(`{"subject":"iphone"}`))
+	req.Header.Set("Authorization", "Bearer bridge")
+	restarted.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 from subject revoke got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal revoke payload: %v", err)
+	}
+	if toInt(payload["count"]) != 2 {
+		t.Fatalf("expected two revoked sessions, got %#v", payload)
+	}
+
+	for token, want := range map[string]int{first: http.StatusUnauthorized, second: http.StatusUnauthorized, other: http.StatusOK} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		restarted.ServeHTTP(rr, req)
+		if rr.Code != want {
+			t.Fatalf("expected %d for token got %d body=%s", want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestMaxIssuableScopesRejectsAdminIssuance(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		BridgeToken:       "bridge",
+		MaxIssuableScopes: []string{"read", "run"},
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	issue := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := issue(`{"scopes":["read","admin"]}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 issuing admin, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "not issuable: admin") {
+		t.Fatalf("expected offending scope in error, got %s", rr.Body.String())
+	}
+
+	rr = issue(`{"scopes":["read","run"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 issuing read/run, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = issue(`{}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 issuing default scopes, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal issue payload: %v", err)
+	}
+	if scopes := extractScopes(payload["scopes"]); len(scopes) != 2 {
+		t.Fatalf("expected default scopes limited to issuable set, got %#v", payload["scopes"])
+	}
+}
+
+func TestTokenExpiryLeewayToleratesClockSkew(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		BridgeToken:       "bridge",
+		TokenExpiryLeeway: 30 * time.Second,
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	signExpired := func(secondsAgo int64) string {
+		now := time.Now().Unix()
+		raw, err := json.Marshal(sessionTokenClaims{
+			Sub:    "skewed",
+			Scopes: []string{scopeRead},
+			JTI:    "skew-" + strconv.FormatInt(secondsAgo, 10),
+			Iat:    now - 600,
+			Exp:    now - secondsAgo,
+		})
+		if err != nil {
+			t.Fatalf("marshal claims: %v", err)
+		}
+		body := base64.RawURLEncoding.EncodeToString(raw)
+		return "na1." + body + "." + signSessionBody(body, h.sessionSigningKey())
+	}
+
+	if _, err := h.verifySessionToken(signExpired(5)); err != nil {
+		t.Fatalf("expected token within leeway to verify, got %v", err)
+	}
+	if _, err := h.verifySessionToken(signExpired(60)); err == nil || !strings.Contains(err.Error(), "token expired") {
+		t.Fatalf("expected token beyond leeway to be expired, got %v", err)
+	}
+}
+
+func TestOpenAuthModeWarnsAndRequireAuthFailsFast(t *testing.T) {
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL: "http://example.com",
+		Logger:      log.New(&logs, "", 0),
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if !strings.Contains(logs.String(), "WARN bridge auth_mode=open") {
+		t.Fatalf("expected open-mode warning, got %q", logs.String())
+	}
+	if mode := h.bridgeHealthSnapshot()["auth_mode"]; mode != authModeOpen {
+		t.Fatalf("expected open auth mode in health, got %#v", mode)
+	}
+
+	_, err = NewHandler(Config{CoreBaseURL: "http://example.com", RequireAuth: true, Timeout: 5 * time.Second})
+	if err == nil || !strings.Contains(err.Error(), "auth is required") {
+		t.Fatalf("expected RequireAuth to fail without auth material, got %v", err)
+	}
+
+	logs.Reset()
+	h, err = NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		SessionSigningKey: "signing",
+		RequireAuth:       true,
+		Logger:            log.New(&logs, "", 0),
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler with signing key: %v", err)
+	}
+	if logs.Len() != 0 || h.bridgeHealthSnapshot()["auth_mode"] != authModeSession {
+		t.Fatalf("expected session auth mode without warning, got %q %#v", logs.String(), h.bridgeHealthSnapshot()["auth_mode"])
+	}
+}
+
+func TestOpenAccessAllowedPathsRestrictOpenMode(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:            core.URL,
+		OpenAccessAllowedPaths: []string{"/models", "/plans/{id}"},
+		Logger:                 log.New(io.Discard, "", 0),
+		Timeout:                5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	for _, path := range []string{"/models", "/plans/plan1"} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected open-access GET %s to be allowed, got %d body=%s", path, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"objective":"x"}`)))
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"code":"open_access_forbidden"`) {
+		t.Fatalf("expected open-access POST /run to be forbidden, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestConfiguredPutRouteForwardsWithScope(t *testing.T) {
+	var gotMethod, gotBody string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/plans/plan1/steps" {
+			raw, _ := io.ReadAll(r.Body)
+			gotMethod = r.Method
+			gotBody = string(raw)
+			_, _ = w.Write([]byte(`{"id":"plan1","replaced":true}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	disabled, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rrDisabled := httptest.NewRecorder()
+	reqDisabled := httptest.NewRequest(http.MethodPut, "/plans/plan1/steps", strings.NewReader(`{"steps":[]}`))
+	reqDisabled.Header.Set("Authorization", "Bearer bridge")
+	disabled.ServeHTTP(rrDisabled, reqDisabled)
+	if rrDisabled.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405 when put route is not configured, got %d body=%s", rrDisabled.Code, rrDisabled.Body.String())
+	}
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:    core.URL,
+		BridgeToken:    "bridge",
+		PutRouteScopes: map[string]string{"/plans/{id}/steps": scopeApprove},
+		Timeout:        5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	approveToken, _, err := h.issueSessionToken("approver", []string{scopeApprove}, "", 120)
+	if err != nil {
+		t.Fatalf("issue approve token: %v", err)
+	}
+	planToken, _, err := h.issueSessionToken("planner", []string{scopePlan}, "", 120)
+	if err != nil {
+		t.Fatalf("issue plan token: %v", err)
+	}
+
+	rrForbidden := httptest.NewRecorder()
+	reqForbidden := httptest.NewRequest(http.MethodPut, "/plans/plan1/steps", strings.NewReader(`{"steps":[]}`))
+	reqForbidden.Header.Set("Authorization", "Bearer "+planToken)
+	h.ServeHTTP(rrForbidden, reqForbidden)
+	if rrForbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without configured scope, got %d body=%s", rrForbidden.Code, rrForbidden.Body.String())
+	}
+
+	rrInvalid := httptest.NewRecorder()
+	reqInvalid := httptest.NewRequest(http.MethodPut, "/plans/plan1/steps", strings.NewReader(`[1,2]`))
+	reqInvalid.Header.Set("Authorization", "Bearer "+approveToken)
+	h.ServeHTTP(rrInvalid, reqInvalid)
+	if rrInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for non-object PUT body, got %d body=%s", rrInvalid.Code, rrInvalid.Body.String())
+	}
+	if gotMethod != "" {
+		t.Fatalf("expected rejected requests not to reach core, got %s", gotMethod)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/plans/plan1/steps", strings.NewReader(`{"steps":[{"action":"noop"}]}`))
+	req.Header.Set("Authorization", "Bearer "+approveToken)
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for configured PUT, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if gotMethod != http.MethodPut || gotBody != `{"steps":[{"action":"noop"}]}` {
+		t.Fatalf("expected PUT body forwarded to core, got method=%q body=%q", gotMethod, gotBody)
+	}
+
+	if _, err := NewHandler(Config{
+		CoreBaseURL:    core.URL,
+		BridgeToken:    "bridge",
+		PutRouteScopes: map[string]string{"/plans/{id}/steps": "superuser"},
+	}); err == nil {
+		t.Fatalf("expected unknown put route scope to fail handler construction")
+	}
+}
+
+func TestRequireTenantForwardsTokenTenant(t *testing.T) {
+	var gotTenant []string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTenant = append(gotTenant, r.Header.Get("X-Tenant-ID"))
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:             core.URL,
+		BridgeToken:             "bridge",
+		RequireTenant:           true,
+		ForwardedRequestHeaders: []string{"X-Tenant-ID"},
+		Timeout:                 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rrIssue := httptest.NewRecorder()
+	reqIssue := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"subject":"acme-phone","scopes":["read"],"tenant":"acme"}`))
+	reqIssue.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rrIssue, reqIssue)
+	if rrIssue.Code != http.StatusOK {
+		t.Fatalf("expected 200 issuing tenant token, got %d body=%s", rrIssue.Code, rrIssue.Body.String())
+	}
+	var issued map[string]any
+	if err := json.Unmarshal(rrIssue.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("decode issue response: %v", err)
+	}
+	if issued["tenant"] != "acme" {
+		t.Fatalf("expected tenant in issue response, got %#v", issued["tenant"])
+	}
+	tenantToken, _ := issued["token"].(string)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	req.Header.Set("Authorization", "Bearer "+tenantToken)
+	req.Header.Set("X-Tenant-ID", "other-tenant")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for tenant-bound token, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(gotTenant) != 1 || gotTenant[0] != "acme" {
+		t.Fatalf("expected core to receive token tenant only, got %#v", gotTenant)
+	}
+
+	plainToken, _, err := h.issueSessionToken("no-tenant", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue tenantless token: %v", err)
+	}
+	rrMissing := httptest.NewRecorder()
+	reqMissing := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	reqMissing.Header.Set("Authorization", "Bearer "+plainToken)
+	reqMissing.Header.Set("X-Tenant-ID", "acme")
+	h.ServeHTTP(rrMissing, reqMissing)
+	if rrMissing.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for tenantless token, got %d body=%s", rrMissing.Code, rrMissing.Body.String())
+	}
+	var missing map[string]any
+	if err := json.Unmarshal(rrMissing.Body.Bytes(), &missing); err != nil {
+		t.Fatalf("decode tenant_required response: %v", err)
+	}
+	if missing["code"] != "tenant_required" {
+		t.Fatalf("expected tenant_required code, got %#v", missing)
+	}
+	if len(gotTenant) != 1 {
+		t.Fatalf("expected tenantless request not to reach core, got %d calls", len(gotTenant))
+	}
+}
+
+func TestSessionMetadataForwardedAsCoreHeaders(t *testing.T) {
+	var gotHeaders http.Header
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:             core.URL,
+		BridgeToken:             "bridge",
+		ForwardedRequestHeaders: []string{"X-Nova-Meta-Admin"},
+		Timeout:                 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rrIssue := httptest.NewRecorder()
+	reqIssue := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"scopes":["read"],"metadata":{"role":"viewer","Region":"eu-west"}}`))
+	reqIssue.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rrIssue, reqIssue)
+	if rrIssue.Code != http.StatusOK {
+		t.Fatalf("expected 200 issuing metadata token, got %d body=%s", rrIssue.Code, rrIssue.Body.String())
+	}
+	var issued map[string]any
+	if err := json.Unmarshal(rrIssue.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("decode issue response: %v", err)
+	}
+	token, _ := issued["token"].(string)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Nova-Meta-Admin", "true")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if gotHeaders.Get("X-Nova-Meta-Role") != "viewer" || gotHeaders.Get("X-Nova-Meta-Region") != "eu-west" {
+		t.Fatalf("expected metadata headers at core, got %#v", gotHeaders)
+	}
+	if gotHeaders.Get("X-Nova-Meta-Admin") != "" {
+		t.Fatalf("expected client metadata header to be stripped, got %q", gotHeaders.Get("X-Nova-Meta-Admin"))
+	}
+
+	for _, body := range []string{
+		`{"metadata":"role=viewer"}`,
+		`{"metadata":{"bad key":"x"}}`,
+		`{"metadata":{"role":"` + strings.Repeat("x", maxSessionMetadataValueLength+1) + `"}}`,
+		`{"metadata":{"a":"1","b":"2","c":"3","d":"4","e":"5","f":"6","g":"7","h":"8","i":"9"}}`,
+	} {
+		rrBad := httptest.NewRecorder()
+		reqBad := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(body))
+		reqBad.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rrBad, reqBad)
+		if rrBad.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for metadata %s, got %d body=%s", body, rrBad.Code, rrBad.Body.String())
+		}
+	}
+}
+
+func TestForwardCallerIdentityOverwritesSpoofedHeaders(t *testing.T) {
+	var gotHeaders http.Header
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	newHandler := func(forward bool) *Handler {
+		h, err := NewHandler(Config{
+			CoreBaseURL:             core.URL,
+			BridgeToken:             "bridge",
+			ForwardCallerIdentity:   forward,
+			ForwardedRequestHeaders: []string{"X-Bridge-Subject", "X-Bridge-Scopes", "X-Bridge-Device-ID"},
+			Timeout:                 5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		return h
+	}
+	spoofed := func(h *Handler, token string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Bridge-Subject", "root")
+		req.Header.Set("X-Bridge-Scopes", "admin")
+		req.Header.Set("X-Bridge-Device-ID", "spoofed-device")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	h := newHandler(true)
+	token, _, err := h.issueSessionToken("iphone", []string{scopeRead, scopePlan}, "dev-1", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	spoofed(h, token)
+	if gotHeaders.Get("X-Bridge-Subject") != "iphone" || gotHeaders.Get("X-Bridge-Scopes") != "plan,read" ||
+		gotHeaders.Get("X-Bridge-Device-ID") != "dev-1" {
+		t.Fatalf("expected caller identity headers from token, got %#v", gotHeaders)
+	}
+
+	spoofed(newHandler(false), "bridge")
+	for _, name := range []string{"X-Bridge-Subject", "X-Bridge-Scopes", "X-Bridge-Device-ID"} {
+		if gotHeaders.Get(name) != "" {
+			t.Fatalf("expected spoofed %s to be stripped when identity forwarding is off, got %q", name, gotHeaders.Get(name))
+		}
+	}
+}
+
+func TestForwardSubjectHeaderUsesTokenSubject(t *testing.T) {
+	var gotHeaders http.Header
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	newHandler := func(forward bool) *Handler {
+		h, err := NewHandler(Config{
+			CoreBaseURL:             core.URL,
+			BridgeToken:             "bridge",
+			ForwardSubjectHeader:    forward,
+			ForwardedRequestHeaders: []string{"X-Nova-Subject", "X-Nova-Device"},
+			Timeout:                 5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		return h
+	}
+	spoofed := func(h *Handler, token string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("X-Nova-Subject", "root")
+		req.Header.Set("X-Nova-Device", "spoofed-device")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+
+	h := newHandler(true)
+	token, _, err := h.issueSessionToken("iphone", []string{scopeRead}, "dev-1", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	spoofed(h, token)
+	if gotHeaders.Get("X-Nova-Subject") != "iphone" || gotHeaders.Get("X-Nova-Device") != "dev-1" {
+		t.Fatalf("expected X-Nova subject headers from token, got %#v", gotHeaders)
+	}
+	if gotHeaders.Get("X-Bridge-Subject") != "" {
+		t.Fatalf("expected X-Bridge identity headers to stay off, got %#v", gotHeaders)
+	}
+
+	spoofed(newHandler(false), "bridge")
+	for _, name := range []string{"X-Nova-Subject", "X-Nova-Device"} {
+		if gotHeaders.Get(name) != "" {
+			t.Fatalf("expected spoofed %s to be stripped when subject forwarding is off, got %q", name, gotHeaders.Get(name))
+		}
+	}
+}
+
+func TestTenantBoundAdminCannotIssueForOtherTenant(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge", RequireTenant: true})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	adminToken, _, err := h.issueSessionTokenWithLimit("acme-admin", []string{scopeAdmin}, "", "acme", nil, 0, 120, defaultSessionMaxTTLSeconds)
+	if err != nil {
+		t.Fatalf("issue tenant admin token: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"tenant":"globex"}`))
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 issuing for another tenant, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminAllowedCIDRsRestrictAdminRoutes(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		BridgeToken:       "bridge",
+		TrustedProxyCIDRs: []string{"192.0.2.1"},
+		AdminAllowedCIDRs: []string{"10.20.0.0/16"},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	adminToken, _, err := h.issueSessionTokenWithLimit("ops", []string{scopeAdmin}, "", "", nil, 0, 120, defaultSessionMaxTTLSeconds)
+	if err != nil {
+		t.Fatalf("issue admin token: %v", err)
+	}
+
+	do := func(path string, body string, forwardedFor string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set("Authorization", "Bearer "+adminToken)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("/auth/session", `{"subject":"phone","scopes":["read"]}`, "10.20.3.4"); rr.Code != http.StatusOK {
+		t.Fatalf("expected on-network session issue to succeed, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do("/admin/cache/flush", `{}`, "10.20.3.4"); rr.Code != http.StatusOK {
+		t.Fatalf("expected on-network admin route to succeed, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	for _, path := range []string{"/auth/session", "/auth/session/revoke", "/admin/cache/flush"} {
+		rr := do(path, `{}`, "198.51.100.9")
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("%s: expected 403 off-network, got %d body=%s", path, rr.Code, rr.Body.String())
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("%s: decode: %v", path, err)
+		}
+		if payload["code"] != "admin_ip_not_allowed" {
+			t.Fatalf("%s: unexpected payload %#v", path, payload)
+		}
+	}
+
+	// Only trusted proxies may supply X-Forwarded-For.
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/cache/flush", strings.NewReader(`{}`))
+	req.RemoteAddr = "198.51.100.9:40000"
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("X-Forwarded-For", "10.20.3.4")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected spoofed X-Forwarded-For to be ignored, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRejectAmbiguousWSAuth(t *testing.T) {
+	doWS := func(h *Handler, query string, header string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/ws"+query, nil)
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	lenient, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	// Plain GETs that pass auth get 426 from the /ws handler.
+	if rr := doWS(lenient, "?token=other", "bridge"); rr.Code != http.StatusUpgradeRequired {
+		t.Fatalf("expected header to win by default, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge", RejectAmbiguousWSAuth: true})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr := doWS(h, "?token=other", "bridge")
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "ambiguous_ws_auth") {
+		t.Fatalf("expected conflicting tokens rejected, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	for _, tc := range []struct{ query, header string }{
+		{"?token=bridge", ""},
+		{"", "bridge"},
+		{"?token=bridge", "bridge"},
+	} {
+		if rr := doWS(h, tc.query, tc.header); rr.Code != http.StatusUpgradeRequired {
+			t.Fatalf("query=%q header=%q: expected single token source accepted, got %d body=%s", tc.query, tc.header, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestRequireHTTPSForAuthHonorsTrustedProxyProto(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:         "http://example.com",
+		BridgeToken:         "bridge",
+		TrustedProxyCIDRs:   []string{"192.0.2.1"},
+		RequireHTTPSForAuth: true,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	do := func(path string, remoteAddr string, proto string, token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.RemoteAddr = remoteAddr
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := do("/admin/cache/flush", "192.0.2.1:4000", "https", "bridge"); rr.Code != http.StatusOK {
+		t.Fatalf("expected proxied https request to pass, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	for _, tc := range []struct{ name, remoteAddr, proto string }{
+		{"proxied http", "192.0.2.1:4000", "http"},
+		{"direct http", "192.0.2.1:4000", ""},
+		{"untrusted forwarded proto", "198.51.100.9:4000", "https"},
+	} {
+		rr := do("/admin/cache/flush", tc.remoteAddr, tc.proto, "bridge")
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "insecure_transport") {
+			t.Fatalf("%s: expected 400 insecure_transport, got %d body=%s", tc.name, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := do("/admin/cache/flush", "192.0.2.1:4000", "http", ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected tokenless http request to reach auth, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected /health exempt, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminRevocationsListsActiveEntries(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	revoked := map[string]int64{}
+	for _, subject := range []string{"phone", "tablet"} {
+		token, claims, err := h.issueSessionToken(subject, []string{scopeRead}, "", 120)
+		if err != nil {
+			t.Fatalf("issue session token: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/auth/session/revoke", strings.NewReader(`{"token":"`+token+`"}`))
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("revoke %s: %d body=%s", subject, rr.Code, rr.Body.String())
+		}
+		revoked[claims.JTI] = claims.Exp
+	}
+	now := time.Now().Unix()
+	if _, err := h.revocations.Revoke("expired-session", now-5, now-10); err != nil {
+		t.Fatalf("revoke expired entry: %v", err)
+	}
+
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/revocations", nil)
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected non-admin token forbidden, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/revocations", nil)
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload struct {
+		Count       int `json:"count"`
+		Revocations []struct {
+			SessionID string `json:"session_id"`
+			ExpiresAt int64  `json:"expires_at"`
+		} `json:"revocations"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if payload.Count != 2 || len(payload.Revocations) != 2 {
+		t.Fatalf("expected two active revocations, got %s", rr.Body.String())
+	}
+	for _, entry := range payload.Revocations {
+		if exp, ok := revoked[entry.SessionID]; !ok || exp != entry.ExpiresAt {
+			t.Fatalf("unexpected revocation entry %#v in %s", entry, rr.Body.String())
+		}
+	}
+
+	custom, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge", RevocationStore: &sharedRevocationStore{entries: make(map[string]int64)}})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/revocations", nil)
+	req.Header.Set("Authorization", "Bearer bridge")
+	custom.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotImplemented {
+		t.Fatalf("expected 501 for a store without listing, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRequireCSRFForBrowsersOnSessionMutations(t *testing.T) {
+	runCalls := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/run" {
+			runCalls++
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:            core.URL,
+		BridgeToken:            "bridge",
+		CORSAllowedOrigins:     []string{"https://app.example.com"},
+		RequireCSRFForBrowsers: true,
+		Timeout:                5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rrIssue := httptest.NewRecorder()
+	reqIssue := httptest.NewRequest(http.MethodPost, "/auth/session", strings.NewReader(`{"subject":"web","scopes":["read","run"]}`))
+	reqIssue.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rrIssue, reqIssue)
+	if rrIssue.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /auth/session got %d body=%s", rrIssue.Code, rrIssue.Body.String())
+	}
+	var issued map[string]any
+	if err := json.Unmarshal(rrIssue.Body.Bytes(), &issued); err != nil {
+		t.Fatalf("unmarshal issue payload: %v", err)
+	}
+	sessionToken := toString(issued["token"])
+	csrfToken := toString(issued["csrf_token"])
+	if csrfToken == "" {
+		t.Fatalf("expected csrf_token in issue payload, got %#v", issued)
+	}
+
+	run := func(origin string, csrf string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"objective":"test"}`))
+		req.Header.Set("Authorization", "Bearer "+sessionToken)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	expectCode := func(rr *httptest.ResponseRecorder, code string) {
+		t.Helper()
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 got %d body=%s", rr.Code, rr.Body.String())
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		if payload["code"] != code {
+			t.Fatalf("expected code %q got %#v", code, payload)
+		}
+	}
+
+	expectCode(run("https://app.example.com", ""), "csrf_token_required")
+	expectCode(run("https://app.example.com", "not-the-token"), "csrf_token_invalid")
+	if runCalls != 0 {
+		t.Fatalf("expected rejected requests not to reach core, got %d", runCalls)
+	}
+	if rr := run("https://app.example.com", csrfToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected valid csrf token to pass, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := run("", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected non-browser request without Origin to skip csrf, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if runCalls != 2 {
+		t.Fatalf("expected 2 core /run calls, got %d", runCalls)
+	}
+}
@@ -0,0 +1,53 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// noteBodyTooLarge counts and logs a request body rejected for exceeding
+// maxRequestBodyBytes. readBody stops after limit+1 bytes, so the attempted size
+// is the declared Content-Length when known and a lower bound otherwise.
+func (h *Handler) noteBodyTooLarge(r *http.Request) {
+	pathClass := routeTemplate(r.URL.Path)
+	h.bodyTooLargeMu.Lock()
+	h.bodyTooLargeByPath[pathClass]++
+	h.bodyTooLargeMu.Unlock()
+
+	attempted := ">" + strconv.Itoa(maxRequestBodyBytes)
+	if r.ContentLength > maxRequestBodyBytes {
+		attempted = strconv.FormatInt(r.ContentLength, 10)
+	}
+	h.cfg.Logger.Printf(
+		"bridge body rejected reason=too_large method=%s path=%s route=%s client=%s attempted_bytes=%s limit_bytes=%d",
+		r.Method,
+		r.URL.Path,
+		pathClass,
+		h.clientRateKey(r),
+		attempted,
+		maxRequestBodyBytes,
+	)
+}
+
+// bodyTooLargeMetrics reports oversized-body rejections per route template, both as
+// path_class-labelled novaadapt_bridge_body_rejected_total samples and as
+// novaadapt_bridge_body_too_large_total.
+func (h *Handler) bodyTooLargeMetrics() string {
+	h.bodyTooLargeMu.Lock()
+	pathClasses := make([]string, 0, len(h.bodyTooLargeByPath))
+	for pathClass := range h.bodyTooLargeByPath {
+		pathClasses = append(pathClasses, pathClass)
+	}
+	sort.Strings(pathClasses)
+	var b strings.Builder
+	for _, pathClass := range pathClasses {
+		count := h.bodyTooLargeByPath[pathClass]
+		fmt.Fprintf(&b, "novaadapt_bridge_body_rejected_total{reason=\"too_large\",path_class=%q} %d\n", pathClass, count)
+		fmt.Fprintf(&b, "novaadapt_bridge_body_too_large_total{path_class=%q} %d\n", pathClass, count)
+	}
+	h.bodyTooLargeMu.Unlock()
+	return b.String()
+}
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ParseBodyFieldRenames parses "route:old=new" items such as "/run:goal=objective"
+// into Config.BodyFieldRenames. Repeating a route adds more renames for it.
+func ParseBodyFieldRenames(items []string) (map[string]map[string]string, error) {
+	out := make(map[string]map[string]string)
+	for _, item := range items {
+		route, rename, ok := strings.Cut(strings.TrimSpace(item), ":")
+		from, to, ok2 := strings.Cut(rename, "=")
+		route = strings.TrimSpace(route)
+		from = strings.TrimSpace(from)
+		to = strings.TrimSpace(to)
+		if !ok || !ok2 || !strings.HasPrefix(route, "/") || from == "" || to == "" || from == to {
+			return nil, fmt.Errorf("invalid body field rename %q (expected route:old=new)", item)
+		}
+		if out[route] == nil {
+			out[route] = make(map[string]string)
+		}
+		out[route][from] = to
+	}
+	return out, nil
+}
+
+// renameBodyFields rewrites top-level legacy keys in a JSON object body according
+// to Config.BodyFieldRenames for route. When a client already sends the new key, it
+// wins and the legacy key is dropped. Non-object bodies are returned unchanged.
+func (h *Handler) renameBodyFields(route string, body []byte) []byte {
+	renames := h.cfg.BodyFieldRenames[route]
+	if len(renames) == 0 || len(bytesTrimSpace(body)) == 0 {
+		return body
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return body
+	}
+	changed := false
+	for from, to := range renames {
+		value, ok := fields[from]
+		if !ok {
+			continue
+		}
+		delete(fields, from)
+		if _, exists := fields[to]; !exists {
+			fields[to] = value
+		}
+		changed = true
+	}
+	if !changed {
+		return body
+	}
+	rewritten, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const browserPathPrefix = "/browser/"
+
+// browserActionSet normalizes Config.AllowedBrowserActions. Nil means every action is allowed.
+func browserActionSet(actions []string) map[string]struct{} {
+	var out map[string]struct{}
+	for _, action := range actions {
+		action = strings.ToLower(strings.TrimSpace(action))
+		if action == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]struct{})
+		}
+		out[action] = struct{}{}
+	}
+	return out
+}
+
+// browserActionType returns the browser action a POST to path performs: the body
+// "type" for /browser/action, otherwise the dedicated endpoint name (e.g. "navigate").
+func browserActionType(path string, body map[string]any) string {
+	if path == "/browser/action" {
+		return strings.ToLower(strings.TrimSpace(toString(body["type"])))
+	}
+	return strings.TrimPrefix(path, browserPathPrefix)
+}
+
+// allowsBrowserAction reports whether a request may reach core under the browser
+// action allowlist, along with the action type it resolved.
+func (h *Handler) allowsBrowserAction(method string, path string, body map[string]any) (string, bool) {
+	if h.browserActions == nil || method != http.MethodPost || !strings.HasPrefix(path, browserPathPrefix) {
+		return "", true
+	}
+	action := browserActionType(path, body)
+	_, ok := h.browserActions[action]
+	return action, ok
+}
+
+// allowsBrowserActionBody is allowsBrowserAction for a raw HTTP request body.
+func (h *Handler) allowsBrowserActionBody(method string, path string, body []byte) (string, bool) {
+	if h.browserActions == nil {
+		return "", true
+	}
+	payload := map[string]any{}
+	_ = json.Unmarshal(body, &payload)
+	return h.allowsBrowserAction(method, path, payload)
+}
+
+func browserActionDeniedFrame(msg wsClientMessage, action string, requestID string) map[string]any {
+	return map[string]any{
+		"type":       "error",
+		"id":         msg.ID,
+		"error":      "browser action not allowed",
+		"action":     action,
+		"request_id": requestID,
+	}
+}
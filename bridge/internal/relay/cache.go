@@ -0,0 +1,286 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultCacheMaxEntries = 256
+
+type cachedResponse struct {
+	statusCode int
+	header     http.Header
+	raw        []byte
+	route      string
+	expiresAt  time.Time
+}
+
+// responseCache stores GET responses from core keyed by path+query, with TTLs
+// configured per route template and invalidation triggered by successful writes.
+type responseCache struct {
+	mu           sync.Mutex
+	ttls         map[string]time.Duration
+	invalidates  map[string][]string
+	maxEntries   int
+	entries      map[string]cachedResponse
+	hitsTotal    uint64
+	missesTotal  uint64
+	evictedTotal uint64
+	// keepExpired retains expired entries, until evicted for space or invalidated,
+	// so they can be served stale while core fails (Config.ServeStaleOnError).
+	keepExpired bool
+}
+
+func newResponseCache(ttls map[string]time.Duration, invalidates map[string][]string, maxEntries int) *responseCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	normalizedTTLs := make(map[string]time.Duration)
+	for route, ttl := range ttls {
+		route = strings.TrimSpace(route)
+		if route == "" || ttl <= 0 {
+			continue
+		}
+		normalizedTTLs[route] = ttl
+	}
+	normalizedInvalidates := make(map[string][]string)
+	for route, targets := range invalidates {
+		route = strings.TrimSpace(route)
+		if route == "" {
+			continue
+		}
+		for _, target := range targets {
+			if target = strings.TrimSpace(target); target != "" {
+				normalizedInvalidates[route] = append(normalizedInvalidates[route], target)
+			}
+		}
+	}
+	return &responseCache{
+		ttls:        normalizedTTLs,
+		invalidates: normalizedInvalidates,
+		maxEntries:  maxEntries,
+		entries:     make(map[string]cachedResponse),
+	}
+}
+
+func (c *responseCache) enabled() bool {
+	return c != nil && len(c.ttls) > 0
+}
+
+func (c *responseCache) ttlFor(route string) time.Duration {
+	if !c.enabled() {
+		return 0
+	}
+	return c.ttls[route]
+}
+
+func cacheKey(path string, rawQuery string) string {
+	if rawQuery == "" {
+		return path
+	}
+	return path + "?" + rawQuery
+}
+
+func (c *responseCache) get(key string, now time.Time) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if ok && now.Before(entry.expiresAt) {
+		c.hitsTotal++
+		return entry, true
+	}
+	if ok && !c.keepExpired {
+		delete(c.entries, key)
+	}
+	c.missesTotal++
+	return cachedResponse{}, false
+}
+
+// stale returns the cached entry for key regardless of its expiry.
+func (c *responseCache) stale(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	return entry, ok
+}
+
+func (c *responseCache) put(key string, route string, statusCode int, header http.Header, raw []byte, ttl time.Duration, now time.Time) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= c.maxEntries {
+		c.evictLocked(now)
+	}
+	stored := header.Clone()
+	stored.Del("Set-Cookie")
+	c.entries[key] = cachedResponse{
+		statusCode: statusCode,
+		header:     stored,
+		raw:        append([]byte(nil), raw...),
+		route:      route,
+		expiresAt:  now.Add(ttl),
+	}
+}
+
+// evictLocked drops expired entries, then the entry closest to expiry if still full.
+func (c *responseCache) evictLocked(now time.Time) {
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			c.evictedTotal++
+		}
+	}
+	if len(c.entries) < c.maxEntries {
+		return
+	}
+	oldestKey := ""
+	var oldest time.Time
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.expiresAt.Before(oldest) {
+			oldestKey = key
+			oldest = entry.expiresAt
+		}
+	}
+	if oldestKey != "" {
+		delete(c.entries, oldestKey)
+		c.evictedTotal++
+	}
+}
+
+// invalidateFor evicts cached entries affected by a successful write to writeRoute.
+// A write always invalidates its own route template plus any configured dependents.
+func (c *responseCache) invalidateFor(writeRoute string) int {
+	if !c.enabled() {
+		return 0
+	}
+	targets := map[string]struct{}{writeRoute: {}}
+	for _, target := range c.invalidates[writeRoute] {
+		targets[target] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, entry := range c.entries {
+		if _, ok := targets[entry.route]; ok {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	c.evictedTotal += uint64(removed)
+	return removed
+}
+
+// flush evicts every cached entry whose path starts with prefix; an empty prefix
+// clears the whole cache.
+func (c *responseCache) flush(prefix string) int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	c.evictedTotal += uint64(removed)
+	return removed
+}
+
+func (c *responseCache) stats() (entries int, hits uint64, misses uint64, evicted uint64) {
+	if c == nil {
+		return 0, 0, 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries), c.hitsTotal, c.missesTotal, c.evictedTotal
+}
+
+// handleCacheFlush serves POST /admin/cache/flush. An optional {"prefix": "/plans"}
+// body limits the flush to cached paths under that prefix.
+func (h *Handler) handleCacheFlush(body []byte, requestID string) (map[string]any, error) {
+	payload := map[string]any{}
+	if len(bytesTrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("request body must be valid JSON object")
+		}
+	}
+	prefix := strings.TrimSpace(toString(payload["prefix"]))
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("'prefix' must start with /")
+	}
+	return map[string]any{
+		"status":     "ok",
+		"prefix":     prefix,
+		"evicted":    h.cache.flush(prefix),
+		"request_id": requestID,
+	}, nil
+}
+
+// ParseCacheTTLs parses "route=seconds" pairs such as "/plans=5,/models=60".
+func ParseCacheTTLs(items []string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, item := range items {
+		route, rawTTL, ok := strings.Cut(strings.TrimSpace(item), "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid cache ttl entry %q (expected route=seconds)", item)
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(rawTTL), 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid cache ttl seconds for %q", route)
+		}
+		out[route] = time.Duration(seconds * float64(time.Second))
+	}
+	return out, nil
+}
+
+// ParseCacheInvalidations parses "write_route=cached_route|cached_route" pairs such as
+// "/plans/{id}/approve=/plans|/plans/{id}".
+func ParseCacheInvalidations(items []string) (map[string][]string, error) {
+	out := make(map[string][]string)
+	for _, item := range items {
+		route, rawTargets, ok := strings.Cut(strings.TrimSpace(item), "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid cache invalidation entry %q (expected route=target|target)", item)
+		}
+		for _, target := range strings.Split(rawTargets, "|") {
+			if target = strings.TrimSpace(target); target != "" {
+				out[route] = append(out[route], target)
+			}
+		}
+	}
+	return out, nil
+}
+
+// staleCacheResponse serves the last cached copy of a cacheable GET when core fails
+// and Config.ServeStaleOnError is on, marked with X-Cache: STALE and a Warning.
+func (h *Handler) staleCacheResponse(r *http.Request, key string, cacheTTL time.Duration, requestID string, started time.Time) (int, http.Header, any, bool) {
+	if !h.cfg.ServeStaleOnError || cacheTTL <= 0 {
+		return 0, nil, nil, false
+	}
+	entry, ok := h.cache.stale(key)
+	if !ok {
+		return 0, nil, nil, false
+	}
+	payload, ok := decodeAnyJSON(entry.raw)
+	if !ok {
+		return 0, nil, nil, false
+	}
+	header := entry.header.Clone()
+	header.Set("X-Cache", "STALE")
+	header.Set("Warning", `111 novaadapt-bridge "Revalidation Failed"`)
+	h.appendBridgeTiming(header, started)
+	h.setEventsPageHeaders(r, entry.statusCode, header, payload)
+	return entry.statusCode, header, attachRequestID(payload, requestID), true
+}
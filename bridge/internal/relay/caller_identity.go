@@ -0,0 +1,72 @@
+package relay
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Headers carrying the authenticated caller to core when Config.ForwardCallerIdentity is set.
+const (
+	coreSubjectHeader  = "X-Bridge-Subject"
+	coreScopesHeader   = "X-Bridge-Scopes"
+	coreDeviceIDHeader = "X-Bridge-Device-Id"
+)
+
+// Headers carrying the authenticated subject and device to core when
+// Config.ForwardSubjectHeader is set.
+const (
+	novaSubjectHeader = "X-Nova-Subject"
+	novaDeviceHeader  = "X-Nova-Device"
+)
+
+// sortedScopes returns auth's scopes in a stable order.
+func sortedScopes(auth authContext) []string {
+	scopes := make([]string, 0, len(auth.Scopes))
+	for scope := range auth.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// setCoreIdentityHeaders sets X-Bridge-Subject, X-Bridge-Scopes and X-Bridge-Device-ID
+// (ForwardCallerIdentity) and X-Nova-Subject and X-Nova-Device (ForwardSubjectHeader)
+// from auth. Client-supplied values are always discarded so callers cannot spoof the
+// identity core sees.
+func (h *Handler) setCoreIdentityHeaders(header http.Header, auth authContext) {
+	header.Del(coreSubjectHeader)
+	header.Del(coreScopesHeader)
+	header.Del(coreDeviceIDHeader)
+	header.Del(novaSubjectHeader)
+	header.Del(novaDeviceHeader)
+	subject := strings.TrimSpace(auth.Subject)
+	deviceID := strings.TrimSpace(auth.DeviceID)
+	if h.cfg.ForwardSubjectHeader {
+		if subject != "" {
+			header.Set(novaSubjectHeader, subject)
+		}
+		if deviceID != "" {
+			header.Set(novaDeviceHeader, deviceID)
+		}
+	}
+	if !h.cfg.ForwardCallerIdentity {
+		return
+	}
+	if subject != "" {
+		header.Set(coreSubjectHeader, subject)
+	}
+	header.Set(coreScopesHeader, strings.Join(sortedScopes(auth), ","))
+	if deviceID != "" {
+		header.Set(coreDeviceIDHeader, deviceID)
+	}
+}
+
+// identityCacheSuffix keys cached responses by caller identity when it is forwarded,
+// since core may then authorize or vary its response per caller.
+func (h *Handler) identityCacheSuffix(auth authContext) string {
+	if !h.cfg.ForwardCallerIdentity && !h.cfg.ForwardSubjectHeader {
+		return ""
+	}
+	return "~" + auth.Subject + "|" + strings.Join(sortedScopes(auth), ",") + "|" + auth.DeviceID
+}
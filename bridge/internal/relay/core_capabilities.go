@@ -0,0 +1,158 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCoreCapabilitiesRefresh = 5 * time.Minute
+	maxCoreOpenAPIBytes            = 4 << 20 // 4 MiB
+)
+
+// coreCapabilities holds the paths core advertises in /openapi.json.
+type coreCapabilities struct {
+	mu         sync.RWMutex
+	paths      [][]string
+	loaded     bool
+	fetchedAt  time.Time
+	refreshing int32
+}
+
+// supports reports whether p matches an advertised path template. Before the first
+// successful probe every path is treated as supported so a core outage at startup
+// does not turn into 501s.
+func (c *coreCapabilities) supports(p string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.loaded {
+		return true
+	}
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for _, template := range c.paths {
+		if matchPathTemplate(template, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *coreCapabilities) stale(now time.Time, refresh time.Duration) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return now.Sub(c.fetchedAt) >= refresh
+}
+
+func (c *coreCapabilities) store(paths [][]string, now time.Time) {
+	c.mu.Lock()
+	c.paths = paths
+	c.loaded = true
+	c.fetchedAt = now
+	c.mu.Unlock()
+}
+
+func (c *coreCapabilities) markAttempt(now time.Time) {
+	c.mu.Lock()
+	c.fetchedAt = now
+	c.mu.Unlock()
+}
+
+// matchPathTemplate matches OpenAPI template segments ("{id}" matches any one
+// non-empty segment) against request path segments.
+func matchPathTemplate(template []string, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, part := range template {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// coreSupportsPath gates forwarding on Config.ProbeCoreCapabilities, kicking off a
+// background refresh of the core spec once it is older than CoreCapabilitiesRefresh.
+func (h *Handler) coreSupportsPath(p string) bool {
+	if !h.cfg.ProbeCoreCapabilities {
+		return true
+	}
+	if p == "/openapi.json" {
+		return true
+	}
+	if h.coreCaps.stale(time.Now(), h.cfg.CoreCapabilitiesRefresh) &&
+		atomic.CompareAndSwapInt32(&h.coreCaps.refreshing, 0, 1) {
+		go func() {
+			defer atomic.StoreInt32(&h.coreCaps.refreshing, 0)
+			h.refreshCoreCapabilities()
+		}()
+	}
+	return h.coreCaps.supports(p)
+}
+
+// refreshCoreCapabilities fetches core /openapi.json and records its paths. Failures
+// keep the previously probed paths.
+func (h *Handler) refreshCoreCapabilities() {
+	now := time.Now()
+	paths, err := h.fetchCoreOpenAPIPaths()
+	if err != nil {
+		h.coreCaps.markAttempt(now)
+		h.cfg.Logger.Printf("WARN bridge core capability probe failed: %v", err)
+		return
+	}
+	h.coreCaps.store(paths, now)
+}
+
+func (h *Handler) fetchCoreOpenAPIPaths() ([][]string, error) {
+	replica := h.cores.pick(time.Now())
+	target, err := joinURL(replica.baseURL, "/openapi.json", "")
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Request-ID", normalizeRequestID(""))
+	if strings.TrimSpace(h.cfg.CoreToken) != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
+	}
+	resp, err := h.doCore(req, replica)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("core /openapi.json returned status %d", resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxCoreOpenAPIBytes))
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Paths map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		return nil, fmt.Errorf("invalid core openapi spec: %w", err)
+	}
+	if len(spec.Paths) == 0 {
+		return nil, fmt.Errorf("core openapi spec lists no paths")
+	}
+	paths := make([][]string, 0, len(spec.Paths))
+	for p := range spec.Paths {
+		paths = append(paths, strings.Split(strings.Trim(p, "/"), "/"))
+	}
+	return paths, nil
+}
@@ -0,0 +1,77 @@
+package relay
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// handleCorePing performs a one-off GET /health against every configured core
+// replica using the live client/TLS config, so operators can validate
+// provisioning without restarting the bridge. Replica health accounting is untouched.
+func (h *Handler) handleCorePing(requestID string) map[string]any {
+	results := make([]map[string]any, 0, len(h.cores.replicas))
+	allReachable := true
+	for _, replica := range h.cores.replicas {
+		result := h.pingCoreReplica(replica.baseURL, requestID)
+		if reachable, _ := result["reachable"].(bool); !reachable {
+			allReachable = false
+		}
+		results = append(results, result)
+	}
+	return map[string]any{
+		"ok":         allReachable,
+		"replicas":   results,
+		"request_id": requestID,
+	}
+}
+
+func (h *Handler) pingCoreReplica(baseURL string, requestID string) map[string]any {
+	result := map[string]any{"url": baseURL, "reachable": false}
+	target, err := joinURL(baseURL, "/health", "")
+	if err != nil {
+		result["error"] = "invalid core URL"
+		return result
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		result["error"] = "failed to create request"
+		return result
+	}
+	req.Header.Set("X-Request-ID", requestID)
+	if strings.TrimSpace(h.cfg.CoreToken) != "" {
+		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
+	}
+
+	started := time.Now()
+	resp, err := h.client.Do(req)
+	result["duration_ms"] = float64(time.Since(started).Microseconds()) / 1000.0
+	if err != nil {
+		result["error"] = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	result["reachable"] = true
+	result["status"] = resp.StatusCode
+	result["healthy"] = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if resp.TLS != nil {
+		result["tls"] = coreTLSDetails(resp.TLS)
+	}
+	return result
+}
+
+func coreTLSDetails(state *tls.ConnectionState) map[string]any {
+	details := map[string]any{
+		"version":      tls.VersionName(state.Version),
+		"cipher_suite": tls.CipherSuiteName(state.CipherSuite),
+		"server_name":  state.ServerName,
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		details["cert_subject"] = leaf.Subject.String()
+		details["cert_issuer"] = leaf.Issuer.String()
+		details["cert_not_after"] = leaf.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return details
+}
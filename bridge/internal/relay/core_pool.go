@@ -0,0 +1,176 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCoreReplicaFailureThreshold = 3
+	defaultCoreReplicaEjectDuration    = 30 * time.Second
+)
+
+type coreReplica struct {
+	baseURL             string
+	weight              int
+	currentWeight       int
+	consecutiveFailures int
+	ejectedUntil        time.Time
+	backoffUntil        time.Time
+	requestsTotal       uint64
+	failuresTotal       uint64
+}
+
+// corePool selects core replicas with smooth weighted round-robin and temporarily
+// ejects replicas after repeated transport failures.
+type corePool struct {
+	mu               sync.Mutex
+	replicas         []*coreReplica
+	failureThreshold int
+	ejectDuration    time.Duration
+}
+
+// parseCoreReplica parses "url" or "url|weight".
+func parseCoreReplica(raw string) (*coreReplica, error) {
+	value := strings.TrimSpace(raw)
+	weight := 1
+	if idx := strings.LastIndex(value, "|"); idx >= 0 {
+		parsed, err := strconv.Atoi(strings.TrimSpace(value[idx+1:]))
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid weight in core url %q", raw)
+		}
+		weight = parsed
+		value = strings.TrimSpace(value[:idx])
+	}
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid core base url: %w", err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("core base url must use http or https")
+	}
+	return &coreReplica{baseURL: value, weight: weight}, nil
+}
+
+func newCorePool(baseURLs []string, failureThreshold int, ejectDuration time.Duration) (*corePool, error) {
+	if failureThreshold <= 0 {
+		failureThreshold = defaultCoreReplicaFailureThreshold
+	}
+	if ejectDuration <= 0 {
+		ejectDuration = defaultCoreReplicaEjectDuration
+	}
+	pool := &corePool{failureThreshold: failureThreshold, ejectDuration: ejectDuration}
+	for _, raw := range baseURLs {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		replica, err := parseCoreReplica(raw)
+		if err != nil {
+			return nil, err
+		}
+		pool.replicas = append(pool.replicas, replica)
+	}
+	if len(pool.replicas) == 0 {
+		return nil, fmt.Errorf("core base url is required")
+	}
+	return pool, nil
+}
+
+func (p *corePool) anyTLS() bool {
+	for _, replica := range p.replicas {
+		if strings.HasPrefix(strings.ToLower(replica.baseURL), "https://") {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the next replica. When every replica is ejected it fails open to the
+// replica whose ejection ends soonest so a single-core bridge keeps retrying.
+func (p *corePool) pick(now time.Time) *coreReplica {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.replicas) == 1 {
+		p.replicas[0].requestsTotal++
+		return p.replicas[0]
+	}
+	var best *coreReplica
+	total := 0
+	for _, replica := range p.replicas {
+		if now.Before(replica.ejectedUntil) {
+			continue
+		}
+		replica.currentWeight += replica.weight
+		total += replica.weight
+		if best == nil || replica.currentWeight > best.currentWeight {
+			best = replica
+		}
+	}
+	if best == nil {
+		for _, replica := range p.replicas {
+			if best == nil || replica.ejectedUntil.Before(best.ejectedUntil) {
+				best = replica
+			}
+		}
+	} else {
+		best.currentWeight -= total
+	}
+	best.requestsTotal++
+	return best
+}
+
+func (p *corePool) report(replica *coreReplica, healthy bool, now time.Time) {
+	if replica == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if healthy {
+		replica.consecutiveFailures = 0
+		return
+	}
+	replica.failuresTotal++
+	replica.consecutiveFailures++
+	if replica.consecutiveFailures >= p.failureThreshold {
+		replica.ejectedUntil = now.Add(p.ejectDuration)
+		replica.consecutiveFailures = 0
+	}
+}
+
+func (p *corePool) snapshot(now time.Time) []map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]map[string]any, 0, len(p.replicas))
+	for _, replica := range p.replicas {
+		out = append(out, map[string]any{
+			"url":            replica.baseURL,
+			"weight":         replica.weight,
+			"ejected":        now.Before(replica.ejectedUntil),
+			"requests_total": replica.requestsTotal,
+			"failures_total": replica.failuresTotal,
+		})
+	}
+	return out
+}
+
+// doCore sends req to the chosen replica and records replica health. Transport
+// errors and gateway-class statuses count as replica failures. Requests with a
+// context deadline are bounded by it instead of Config.Timeout.
+func (h *Handler) doCore(req *http.Request, replica *coreReplica) (*http.Response, error) {
+	client := h.client
+	if _, ok := req.Context().Deadline(); ok {
+		client = h.deadlineClient
+	}
+	resp, err := client.Do(req)
+	healthy := err == nil &&
+		resp.StatusCode != http.StatusBadGateway &&
+		resp.StatusCode != http.StatusServiceUnavailable &&
+		resp.StatusCode != http.StatusGatewayTimeout
+	h.cores.report(replica, healthy, time.Now())
+	return resp, err
+}
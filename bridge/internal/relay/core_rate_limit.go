@@ -0,0 +1,81 @@
+package relay
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// maxCoreRetryAfter caps how long a core Retry-After may hold back requests to a
+// replica, so a bogus value cannot cut the bridge off from core indefinitely.
+const maxCoreRetryAfter = 5 * time.Minute
+
+// parseRetryAfter reads a Retry-After value in delay-seconds or HTTP-date form.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(0, at.Sub(now)), true
+}
+
+// noteCoreRateLimited counts a core 429 and, with Config.HonorCoreRetryAfter, holds
+// back further forwarded requests to replica until core's Retry-After elapses.
+func (h *Handler) noteCoreRateLimited(replica *coreReplica, header http.Header, now time.Time) {
+	atomic.AddUint64(&h.coreRateLimited, 1)
+	if !h.cfg.HonorCoreRetryAfter {
+		return
+	}
+	wait, ok := parseRetryAfter(header.Get("Retry-After"), now)
+	if !ok || wait <= 0 {
+		return
+	}
+	h.cores.backOff(replica, now.Add(min(wait, maxCoreRetryAfter)))
+}
+
+// coreRateLimitedPayload answers for core while replica is backing off, with the
+// remaining wait as Retry-After.
+func coreRateLimitedPayload(wait time.Duration, requestID string) (http.Header, map[string]any) {
+	header := make(http.Header)
+	header.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return header, map[string]any{
+		"error":      "Core API rate limited",
+		"code":       "core_rate_limited",
+		"request_id": requestID,
+	}
+}
+
+// backOff stops forwarding to replica until until.
+func (p *corePool) backOff(replica *coreReplica, until time.Time) {
+	if replica == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if until.After(replica.backoffUntil) {
+		replica.backoffUntil = until
+	}
+}
+
+// backoffRemaining reports how long replica is still backing off at now.
+func (p *corePool) backoffRemaining(replica *coreReplica, now time.Time) time.Duration {
+	if replica == nil {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return max(0, replica.backoffUntil.Sub(now))
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"math"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newCoreRetryBudget builds the token bucket shared by every retried core request.
+// It returns nil, which disables retries, when Config.CoreRetryBudgetRPS is <= 0.
+func newCoreRetryBudget(cfg Config) *rate.Limiter {
+	if cfg.CoreRetryBudgetRPS <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(cfg.CoreRetryBudgetRPS), cfg.CoreRetryBudgetBurst)
+}
+
+// isRetryableCoreResult reports transport failures and 502/503/504 responses, the
+// outcomes a retry on another replica can plausibly fix.
+func isRetryableCoreResult(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// doCoreWithRetry sends req to replica and, for GET requests only, retries a
+// retryable failure once on a freshly picked replica when the shared retry budget
+// has a token. An exhausted budget fails fast with the original result so retry
+// volume to core stays capped during widespread failure.
+func (h *Handler) doCoreWithRetry(req *http.Request, replica *coreReplica, corePath string, rawQuery string) (*http.Response, error) {
+	resp, err := h.doCore(req, replica)
+	if h.coreRetryBudget == nil || req.Method != http.MethodGet || !isRetryableCoreResult(resp, err) {
+		return resp, err
+	}
+	if !h.coreRetryBudget.Allow() {
+		atomic.AddUint64(&h.retriesDeniedTotal, 1)
+		return resp, err
+	}
+	retryReplica := h.cores.pick(time.Now())
+	target, buildErr := joinURL(retryReplica.baseURL, corePath, rawQuery)
+	if buildErr != nil {
+		return resp, err
+	}
+	retryReq, buildErr := http.NewRequestWithContext(req.Context(), http.MethodGet, target, nil)
+	if buildErr != nil {
+		return resp, err
+	}
+	retryReq.Header = req.Header.Clone()
+	if resp != nil {
+		resp.Body.Close()
+	}
+	atomic.AddUint64(&h.coreRetriesTotal, 1)
+	return h.doCore(retryReq, retryReplica)
+}
+
+// coreRetryBudgetSnapshot reports the retry budget for /health.
+func (h *Handler) coreRetryBudgetSnapshot() map[string]any {
+	if h.coreRetryBudget == nil {
+		return map[string]any{"enabled": false}
+	}
+	return map[string]any{
+		"enabled":          true,
+		"rps":              h.cfg.CoreRetryBudgetRPS,
+		"burst":            h.cfg.CoreRetryBudgetBurst,
+		"tokens_available": math.Floor(max(0, h.coreRetryBudget.Tokens())),
+		"retries_total":    atomic.LoadUint64(&h.coreRetriesTotal),
+		"denied_total":     atomic.LoadUint64(&h.retriesDeniedTotal),
+	}
+}
@@ -0,0 +1,43 @@
+package relay
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// parseCoreTLSMinVersion maps a CoreTLSMinVersion value to a tls version constant.
+// Empty keeps the TLS 1.2 default.
+func parseCoreTLSMinVersion(value string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), "tls") {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported core TLS minimum version %q (expected 1.2 or 1.3)", value)
+	}
+}
+
+// parseCoreTLSCipherSuites resolves IANA cipher suite names (e.g.
+// TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256) to their IDs. Only suites Go considers
+// secure are accepted. TLS 1.3 suites are not configurable and are ignored by crypto/tls.
+func parseCoreTLSCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var out []uint16
+	for _, name := range names {
+		trimmed := strings.ToUpper(strings.TrimSpace(name))
+		if trimmed == "" {
+			continue
+		}
+		id, ok := known[trimmed]
+		if !ok {
+			return nil, fmt.Errorf("unknown core TLS cipher suite %q", name)
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
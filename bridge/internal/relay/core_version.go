@@ -0,0 +1,38 @@
+package relay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// coreAcceptHeader resolves the Accept header sent to core. A client X-Core-Version
+// must name an entry in Config.CoreVersionAccept; otherwise Config.CoreAcceptHeader
+// (possibly empty, meaning no override) is used.
+func (h *Handler) coreAcceptHeader(clientVersion string) (string, error) {
+	clientVersion = strings.ToLower(strings.TrimSpace(clientVersion))
+	if clientVersion == "" {
+		return strings.TrimSpace(h.cfg.CoreAcceptHeader), nil
+	}
+	for version, accept := range h.cfg.CoreVersionAccept {
+		if strings.ToLower(strings.TrimSpace(version)) == clientVersion {
+			return strings.TrimSpace(accept), nil
+		}
+	}
+	return "", fmt.Errorf("unsupported X-Core-Version %q", clientVersion)
+}
+
+// ParseCoreVersionAccept parses "version=accept" pairs such as
+// "v2=application/vnd.novaadapt.v2+json".
+func ParseCoreVersionAccept(items []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range items {
+		version, accept, ok := strings.Cut(strings.TrimSpace(item), "=")
+		version = strings.ToLower(strings.TrimSpace(version))
+		accept = strings.TrimSpace(accept)
+		if !ok || version == "" || accept == "" {
+			return nil, fmt.Errorf("invalid core version entry %q (expected version=accept)", item)
+		}
+		out[version] = accept
+	}
+	return out, nil
+}
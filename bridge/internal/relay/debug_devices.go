@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requestDebug collects what a debug-device request log line reports.
+type requestDebug struct {
+	auth       authContext
+	coreStatus int
+}
+
+func (h *Handler) isDebugDevice(deviceID string) bool {
+	if len(h.debugDevices) == 0 || deviceID == "" {
+		return false
+	}
+	_, ok := h.debugDevices[deviceID]
+	return ok
+}
+
+// logDebugRequest writes the verbose request line for a Config.DebugDeviceIDs
+// device, independent of LogRequests and LogSampleRate.
+func (h *Handler) logDebugRequest(r *http.Request, requestID string, debug *requestDebug, statusCode int, started time.Time) {
+	scopes := make([]string, 0, len(debug.auth.Scopes))
+	for scope := range debug.auth.Scopes {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	access := "denied"
+	if h.canAccess(debug.auth, r.Method, r.URL.Path) {
+		access = "allowed"
+	}
+	h.cfg.Logger.Printf(
+		"bridge debug id=%s device=%s subject=%s token_type=%s scopes=%s access=%s remote=%s request=%q status=%d core_status=%d duration_ms=%.2f",
+		requestID,
+		debug.auth.DeviceID,
+		debug.auth.Subject,
+		debug.auth.TokenType,
+		strings.Join(scopes, ","),
+		access,
+		r.RemoteAddr,
+		r.Method+" "+debugRequestURI(r)+" "+r.Proto,
+		statusCode,
+		debug.coreStatus,
+		float64(time.Since(started).Microseconds())/1000.0,
+	)
+}
+
+// debugRequestURI is the request URI with credential query parameters redacted.
+func debugRequestURI(r *http.Request) string {
+	query := r.URL.Query()
+	for _, key := range []string{"token", "ticket", "resume"} {
+		if query.Has(key) {
+			query.Set(key, "REDACTED")
+		}
+	}
+	if len(query) == 0 {
+		return r.URL.EscapedPath()
+	}
+	return r.URL.EscapedPath() + "?" + query.Encode()
+}
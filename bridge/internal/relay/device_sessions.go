@@ -0,0 +1,75 @@
+package relay
+
+import (
+	"fmt"
+	"strings"
+)
+
+type deviceSessionEntry struct {
+	SessionID string `json:"session_id"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type deviceSessionStorePayload struct {
+	Version        int                           `json:"version"`
+	DeviceSessions map[string]deviceSessionEntry `json:"device_sessions"`
+}
+
+// setCurrentDeviceSession records sessionID as the only valid session for deviceID.
+func (h *Handler) setCurrentDeviceSession(deviceID string, sessionID string, expiresAt int64) error {
+	deviceID = strings.TrimSpace(deviceID)
+	if !h.cfg.SingleSessionPerDevice || deviceID == "" {
+		return nil
+	}
+	h.deviceSessionsMu.Lock()
+	defer h.deviceSessionsMu.Unlock()
+	previous, existed := h.deviceSessions[deviceID]
+	h.deviceSessions[deviceID] = deviceSessionEntry{SessionID: sessionID, ExpiresAt: expiresAt}
+	if err := persistDeviceSessions(strings.TrimSpace(h.cfg.DeviceSessionStorePath), h.deviceSessions); err != nil {
+		if existed {
+			h.deviceSessions[deviceID] = previous
+		} else {
+			delete(h.deviceSessions, deviceID)
+		}
+		return fmt.Errorf("failed to persist device session: %w", err)
+	}
+	return nil
+}
+
+// isSupersededDeviceSession reports whether a newer session has been issued for deviceID.
+func (h *Handler) isSupersededDeviceSession(deviceID string, sessionID string, now int64) bool {
+	deviceID = strings.TrimSpace(deviceID)
+	if !h.cfg.SingleSessionPerDevice || deviceID == "" {
+		return false
+	}
+	h.deviceSessionsMu.RLock()
+	current, ok := h.deviceSessions[deviceID]
+	h.deviceSessionsMu.RUnlock()
+	if !ok || (current.ExpiresAt > 0 && current.ExpiresAt <= now) {
+		return false
+	}
+	return current.SessionID != strings.TrimSpace(sessionID)
+}
+
+func loadDeviceSessions(path string, now int64) (map[string]deviceSessionEntry, error) {
+	out := make(map[string]deviceSessionEntry)
+	payload := deviceSessionStorePayload{}
+	if _, err := readJSONFile(path, &payload); err != nil {
+		return nil, err
+	}
+	for deviceID, entry := range payload.DeviceSessions {
+		trimmed := strings.TrimSpace(deviceID)
+		if trimmed == "" || strings.TrimSpace(entry.SessionID) == "" {
+			continue
+		}
+		if entry.ExpiresAt > 0 && entry.ExpiresAt <= now {
+			continue
+		}
+		out[trimmed] = entry
+	}
+	return out, nil
+}
+
+func persistDeviceSessions(path string, entries map[string]deviceSessionEntry) error {
+	return writeJSONFileAtomic(path, deviceSessionStorePayload{Version: 1, DeviceSessions: entries})
+}
@@ -0,0 +1,62 @@
+package relay
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const eventsListPath = "/events"
+
+// eventsNextLink returns an RFC 8288 Link header value whose next URL repeats the
+// /events query with since_id set to the highest event id in the page, or "" when
+// the page is empty or carries no ids.
+func eventsNextLink(r *http.Request, payload any) string {
+	items, ok := payload.([]any)
+	if !ok || len(items) == 0 {
+		return ""
+	}
+	highest := int64(-1)
+	for _, item := range items {
+		event, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if id, ok := asInt64(event["id"]); ok && id > highest {
+			highest = id
+		}
+	}
+	if highest < 0 {
+		return ""
+	}
+	query := r.URL.Query()
+	query.Set("since_id", strconv.FormatInt(highest, 10))
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return "<" + next.String() + `>; rel="next"`
+}
+
+// relayEventsTotalCount copies core's X-Total-Count onto header for /events when
+// Config.EventsPageLinks is enabled, since core response headers are otherwise
+// only relayed when listed in Config.ForwardedResponseHeaders.
+func (h *Handler) relayEventsTotalCount(r *http.Request, header http.Header, coreHeader http.Header) {
+	if !h.cfg.EventsPageLinks || r.Method != http.MethodGet || r.URL.Path != eventsListPath {
+		return
+	}
+	if total := coreHeader.Get("X-Total-Count"); total != "" {
+		header.Set("X-Total-Count", total)
+	}
+}
+
+// setEventsPageHeaders adds the /events next-page Link when Config.EventsPageLinks
+// is enabled.
+func (h *Handler) setEventsPageHeaders(r *http.Request, status int, header http.Header, payload any) {
+	if !h.cfg.EventsPageLinks || r.Method != http.MethodGet || r.URL.Path != eventsListPath {
+		return
+	}
+	if status < 200 || status >= 300 || header == nil {
+		return
+	}
+	if link := eventsNextLink(r, payload); link != "" {
+		header.Set("Link", link)
+	}
+}
@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// validateFallbackResponses rejects Config.FallbackResponses entries whose key is
+// not a route template or whose payload is not valid JSON.
+func validateFallbackResponses(fallbacks map[string]json.RawMessage) error {
+	for route, raw := range fallbacks {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("fallback response route %q must start with /", route)
+		}
+		if !json.Valid(raw) {
+			return fmt.Errorf("fallback response for %q is not valid JSON", route)
+		}
+	}
+	return nil
+}
+
+// fallbackResponse returns the canned Config.FallbackResponses payload for a GET
+// on route, marked with X-Bridge-Fallback: true. Callers only use it once core is
+// confirmed down: every replica ejected or the request failed to connect.
+func (h *Handler) fallbackResponse(r *http.Request, route string, requestID string, started time.Time) (int, http.Header, any, bool) {
+	if r.Method != http.MethodGet {
+		return 0, nil, nil, false
+	}
+	raw, ok := h.cfg.FallbackResponses[route]
+	if !ok {
+		return 0, nil, nil, false
+	}
+	payload, ok := decodeAnyJSON(raw)
+	if !ok {
+		return 0, nil, nil, false
+	}
+	header := http.Header{}
+	header.Set("X-Bridge-Fallback", "true")
+	h.appendBridgeTiming(header, started)
+	return http.StatusOK, header, attachRequestID(payload, requestID), true
+}
@@ -0,0 +1,87 @@
+package relay
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultGzipMinBytes is used when Config.GzipMinBytes is zero; smaller bodies
+// rarely shrink enough to pay for the gzip header and CPU.
+const defaultGzipMinBytes = 1024
+
+// gzipResponseWriter marks a response whose client sent Accept-Encoding: gzip.
+// Only writeJSON and writeRaw compress through it; everything else, including
+// streamed artifact downloads, passes straight through.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+}
+
+// validateGzipConfig applies the gzip defaults and rejects out-of-range values.
+func validateGzipConfig(cfg *Config) error {
+	if cfg.GzipMinBytes < 0 {
+		return fmt.Errorf("gzip min bytes must not be negative")
+	}
+	if cfg.GzipMinBytes == 0 {
+		cfg.GzipMinBytes = defaultGzipMinBytes
+	}
+	if cfg.GzipLevel == 0 {
+		cfg.GzipLevel = gzip.DefaultCompression
+	}
+	if cfg.GzipLevel != gzip.DefaultCompression && (cfg.GzipLevel < gzip.BestSpeed || cfg.GzipLevel > gzip.BestCompression) {
+		return fmt.Errorf("invalid gzip level %d (want 1-9)", cfg.GzipLevel)
+	}
+	return nil
+}
+
+// gzipWriterFor wraps w when gzip is enabled and the client accepts it. /ws is
+// never wrapped because the upgrade needs the underlying http.Hijacker.
+func (h *Handler) gzipWriterFor(w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+	if !h.cfg.GzipResponses || r.URL.Path == "/ws" || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		return w
+	}
+	return &gzipResponseWriter{ResponseWriter: w}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header lists gzip without q=0.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if weight, err := strconv.ParseFloat(strings.TrimSpace(q), 64); err == nil && weight == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeBody writes status and body, gzip-compressing bodies of at least
+// Config.GzipMinBytes for clients that accept it.
+func (h *Handler) writeBody(w http.ResponseWriter, status int, body []byte) {
+	if _, ok := w.(*gzipResponseWriter); ok && len(body) >= h.cfg.GzipMinBytes &&
+		status != http.StatusNoContent && status != http.StatusNotModified {
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, h.cfg.GzipLevel)
+		if err == nil {
+			_, _ = zw.Write(body)
+			if zw.Close() == nil {
+				w.Header().Set("Content-Encoding", "gzip")
+				w.Header().Add("Vary", "Accept-Encoding")
+				w.Header().Del("Content-Length")
+				w.WriteHeader(status)
+				_, _ = w.Write(buf.Bytes())
+				return
+			}
+		}
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
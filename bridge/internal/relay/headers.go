@@ -0,0 +1,202 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hopByHopHeaders are connection-scoped and must never be relayed (RFC 7230 section 6.1).
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// bridgeManagedResponseHeaders are always produced by the bridge itself and are
+// never copied from core responses.
+var bridgeManagedResponseHeaders = map[string]struct{}{
+	"Content-Length":   {},
+	"Content-Type":     {},
+	"Content-Encoding": {},
+	"Location":         {},
+	"Www-Authenticate": {},
+	"X-Request-Id":     {},
+}
+
+// bridgeManagedRequestHeaders are always set by the bridge on core requests and are
+// never copied from clients, even when listed in Config.ForwardedRequestHeaders.
+var bridgeManagedRequestHeaders = map[string]struct{}{
+	"Accept":          {},
+	"Authorization":   {},
+	"Content-Length":  {},
+	"Content-Type":    {},
+	"Host":            {},
+	"Idempotency-Key": {},
+	"X-Request-Id":    {},
+	"X-Tenant-Id":     {},
+}
+
+// defaultCoreErrorHeaders is used when Config.CoreErrorHeaders is empty.
+var defaultCoreErrorHeaders = []string{"X-Error-Code"}
+
+func canonicalHeaderSet(items []string) map[string]struct{} {
+	out := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		trimmed := strings.TrimSpace(item)
+		if trimmed == "" {
+			continue
+		}
+		out[http.CanonicalHeaderKey(trimmed)] = struct{}{}
+	}
+	return out
+}
+
+// hopByHopFor returns the configured hop-by-hop set plus any headers header nominates
+// via Connection.
+func (h *Handler) hopByHopFor(header http.Header) map[string]struct{} {
+	drop := make(map[string]struct{}, len(h.hopByHopHeaders))
+	for name := range h.hopByHopHeaders {
+		drop[name] = struct{}{}
+	}
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if trimmed := strings.TrimSpace(name); trimmed != "" {
+				drop[http.CanonicalHeaderKey(trimmed)] = struct{}{}
+			}
+		}
+	}
+	return drop
+}
+
+// copyForwardedRequestHeaders copies allowlisted client headers onto a core request,
+// never relaying hop-by-hop or bridge-managed headers.
+func (h *Handler) copyForwardedRequestHeaders(dst http.Header, src http.Header) {
+	if len(h.forwardReqHeaders) == 0 {
+		return
+	}
+	drop := h.hopByHopFor(src)
+	for name := range h.forwardReqHeaders {
+		if _, ok := drop[name]; ok {
+			continue
+		}
+		if _, ok := bridgeManagedRequestHeaders[name]; ok {
+			continue
+		}
+		for _, value := range src.Values(name) {
+			dst.Add(name, value)
+		}
+	}
+}
+
+// clientResponseHeaders returns the core response headers that may be relayed to
+// clients. Only headers listed in Config.ForwardedResponseHeaders are relayed, and
+// hop-by-hop, bridge-managed, CORS, and configured strip headers are removed even then.
+func (h *Handler) clientResponseHeaders(coreHeader http.Header) http.Header {
+	out := make(http.Header)
+	if len(coreHeader) == 0 || len(h.forwardHeaders) == 0 {
+		return out
+	}
+	drop := h.hopByHopFor(coreHeader)
+	for key := range h.forwardHeaders {
+		if _, ok := drop[key]; ok {
+			continue
+		}
+		if _, ok := bridgeManagedResponseHeaders[key]; ok {
+			continue
+		}
+		if _, ok := h.stripHeaders[key]; ok {
+			continue
+		}
+		if strings.HasPrefix(key, "Access-Control-") {
+			continue
+		}
+		if values := coreHeader.Values(key); len(values) > 0 {
+			out[key] = append([]string(nil), values...)
+		}
+	}
+	return out
+}
+
+// copyResponseHeaders adds relayed core headers without overriding headers the bridge already set.
+func copyResponseHeaders(dst http.Header, src http.Header) {
+	for name, values := range src {
+		if _, exists := dst[name]; exists {
+			continue
+		}
+		dst[name] = append([]string(nil), values...)
+	}
+}
+
+// streamTrailers returns the trailers core sent after a streaming response body
+// on p (the /stream routes), minus hop-by-hop and bridge-managed names. Other raw
+// routes never relay trailers.
+func streamTrailers(p string, trailer http.Header) http.Header {
+	if !strings.HasSuffix(p, "/stream") || len(trailer) == 0 {
+		return nil
+	}
+	blocked := canonicalHeaderSet(hopByHopHeaders)
+	var out http.Header
+	for name, values := range trailer {
+		canonical := http.CanonicalHeaderKey(name)
+		if _, skip := blocked[canonical]; skip {
+			continue
+		}
+		if _, skip := bridgeManagedResponseHeaders[canonical]; skip {
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if out == nil {
+			out = http.Header{}
+		}
+		out[canonical] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// appendBridgeTiming adds a bridge;dur=<ms> Server-Timing segment when Server-Timing
+// forwarding is enabled, so clients see latency attribution across both hops.
+func (h *Handler) appendBridgeTiming(header http.Header, started time.Time) {
+	if header == nil {
+		return
+	}
+	if _, ok := h.forwardHeaders["Server-Timing"]; !ok {
+		return
+	}
+	durationMS := float64(time.Since(started).Microseconds()) / 1000.0
+	header.Add("Server-Timing", fmt.Sprintf("bridge;dur=%.2f", durationMS))
+}
+
+// attachCoreStatus adds core's original status code, reason phrase and any
+// configured error headers to a non-2xx payload under "core_status".
+func (h *Handler) attachCoreStatus(payload any, resp *http.Response) any {
+	obj, ok := payload.(map[string]any)
+	if !ok {
+		return payload
+	}
+	coreStatus := map[string]any{
+		"code": resp.StatusCode,
+		"text": strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode))),
+	}
+	headers := make(map[string]string)
+	for name := range h.coreErrorHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	if len(headers) > 0 {
+		coreStatus["headers"] = headers
+	}
+	obj["core_status"] = coreStatus
+	return obj
+}
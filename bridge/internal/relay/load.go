@@ -0,0 +1,44 @@
+package relay
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+const (
+	bridgeLoadHeader = "X-Bridge-Load"
+
+	bridgeLoadLow    = "low"
+	bridgeLoadMedium = "medium"
+	bridgeLoadHigh   = "high"
+
+	// Utilization thresholds for the coarse X-Bridge-Load levels.
+	bridgeLoadMediumRatio = 0.5
+	bridgeLoadHighRatio   = 0.85
+)
+
+// bridgeLoadLevel derives a coarse load level from in-flight HTTP requests against
+// Config.LoadInflightCapacity and active websockets against Config.MaxWSConnections,
+// whichever is more utilized.
+func (h *Handler) bridgeLoadLevel() string {
+	ratio := float64(atomic.LoadInt64(&h.inflightRequests)) / float64(h.cfg.LoadInflightCapacity)
+	if maxWS := h.cfg.MaxWSConnections; maxWS > 0 {
+		ratio = max(ratio, float64(atomic.LoadInt64(&h.wsActiveConnections))/float64(maxWS))
+	}
+	switch {
+	case ratio >= bridgeLoadHighRatio:
+		return bridgeLoadHigh
+	case ratio >= bridgeLoadMediumRatio:
+		return bridgeLoadMedium
+	default:
+		return bridgeLoadLow
+	}
+}
+
+// setBridgeLoadHeader adds X-Bridge-Load when Config.BridgeLoadHeader is enabled.
+func (h *Handler) setBridgeLoadHeader(w http.ResponseWriter) {
+	if !h.cfg.BridgeLoadHeader {
+		return
+	}
+	w.Header().Set(bridgeLoadHeader, h.bridgeLoadLevel())
+}
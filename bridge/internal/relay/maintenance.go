@@ -0,0 +1,98 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultMaintenanceMessage = "Bridge is under maintenance"
+
+type maintenanceState struct {
+	Enabled    bool   `json:"enabled"`
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after"`
+}
+
+type maintenanceStorePayload struct {
+	Version     int              `json:"version"`
+	Maintenance maintenanceState `json:"maintenance"`
+}
+
+func (h *Handler) maintenanceActive() bool {
+	return atomic.LoadInt32(&h.maintenanceEnabled) == 1
+}
+
+func (h *Handler) maintenanceSnapshot() maintenanceState {
+	h.maintenanceMu.RLock()
+	defer h.maintenanceMu.RUnlock()
+	return h.maintenance
+}
+
+func (h *Handler) setMaintenance(state maintenanceState) error {
+	h.maintenanceMu.Lock()
+	defer h.maintenanceMu.Unlock()
+	if err := persistMaintenanceState(strings.TrimSpace(h.cfg.MaintenanceStorePath), state); err != nil {
+		return fmt.Errorf("failed to persist maintenance state: %w", err)
+	}
+	h.maintenance = state
+	if state.Enabled {
+		atomic.StoreInt32(&h.maintenanceEnabled, 1)
+	} else {
+		atomic.StoreInt32(&h.maintenanceEnabled, 0)
+	}
+	return nil
+}
+
+func (h *Handler) handleGetMaintenance(requestID string) map[string]any {
+	state := h.maintenanceSnapshot()
+	return map[string]any{
+		"enabled":     state.Enabled,
+		"message":     state.Message,
+		"retry_after": state.RetryAfter,
+		"request_id":  requestID,
+	}
+}
+
+func (h *Handler) handleSetMaintenance(body []byte, requestID string) (map[string]any, error) {
+	payload := map[string]any{}
+	if len(bytesTrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("request body must be valid JSON object")
+		}
+	}
+	enabled, ok := toBool(payload["enabled"])
+	if !ok {
+		return nil, fmt.Errorf("'enabled' is required")
+	}
+	state := maintenanceState{Enabled: enabled}
+	if enabled {
+		state.Message = strings.TrimSpace(toString(payload["message"]))
+		if state.Message == "" {
+			state.Message = defaultMaintenanceMessage
+		}
+		state.RetryAfter = toInt(payload["retry_after"])
+		if state.RetryAfter < 0 {
+			return nil, fmt.Errorf("'retry_after' must be >= 0")
+		}
+	}
+	if err := h.setMaintenance(state); err != nil {
+		return nil, err
+	}
+	out := h.handleGetMaintenance(requestID)
+	out["status"] = "ok"
+	return out, nil
+}
+
+func loadMaintenanceState(path string) (maintenanceState, error) {
+	payload := maintenanceStorePayload{}
+	if _, err := readJSONFile(path, &payload); err != nil {
+		return maintenanceState{}, err
+	}
+	return payload.Maintenance, nil
+}
+
+func persistMaintenanceState(path string, state maintenanceState) error {
+	return writeJSONFileAtomic(path, maintenanceStorePayload{Version: 1, Maintenance: state})
+}
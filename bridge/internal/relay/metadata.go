@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// coreMetadataHeaderPrefix carries session token metadata to core, one header per key.
+const coreMetadataHeaderPrefix = "X-Nova-Meta-"
+
+const (
+	maxSessionMetadataKeys        = 8
+	maxSessionMetadataKeyLength   = 32
+	maxSessionMetadataValueLength = 128
+)
+
+// parseSessionMetadata validates the optional /auth/session "metadata" object. Keys
+// become header name suffixes, so they are limited to letters, digits, and '-'.
+func parseSessionMetadata(raw any) (map[string]string, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("'metadata' must be an object of strings")
+	}
+	if len(obj) > maxSessionMetadataKeys {
+		return nil, fmt.Errorf("'metadata' supports at most %d keys", maxSessionMetadataKeys)
+	}
+	out := make(map[string]string, len(obj))
+	for key, value := range obj {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || len(key) > maxSessionMetadataKeyLength {
+			return nil, fmt.Errorf("metadata keys must be 1-%d characters", maxSessionMetadataKeyLength)
+		}
+		for _, c := range key {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return nil, fmt.Errorf("invalid metadata key %q", key)
+			}
+		}
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("metadata value for %q must be a string", key)
+		}
+		text = strings.TrimSpace(text)
+		if len(text) > maxSessionMetadataValueLength {
+			return nil, fmt.Errorf("metadata value for %q exceeds %d characters", key, maxSessionMetadataValueLength)
+		}
+		for _, c := range text {
+			if c < 0x20 || c == 0x7f {
+				return nil, fmt.Errorf("metadata value for %q contains control characters", key)
+			}
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("duplicate metadata key %q", key)
+		}
+		out[key] = text
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// setCoreMetadataHeaders forwards the token's metadata as X-Nova-Meta-<Key> headers.
+// Client-supplied X-Nova-Meta-* headers are always discarded.
+func setCoreMetadataHeaders(header http.Header, auth authContext) {
+	for name := range header {
+		if strings.HasPrefix(textproto.CanonicalMIMEHeaderKey(name), coreMetadataHeaderPrefix) {
+			header.Del(name)
+		}
+	}
+	for key, value := range auth.Metadata {
+		header.Set(coreMetadataHeaderPrefix+key, value)
+	}
+}
+
+// metadataCacheSuffix keys cached responses by session metadata, since core may vary
+// its response on the forwarded headers.
+func metadataCacheSuffix(auth authContext) string {
+	if len(auth.Metadata) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(auth.Metadata))
+	for key := range auth.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "|%s=%q", key, auth.Metadata[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package relay
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultPenaltyBoxDuration    = 10 * time.Minute
+	defaultPenaltyBoxStrikeDecay = time.Minute
+)
+
+// ratePenalty tracks rate-limit strikes for a client key. It outlives the
+// clientLimiter so an idle prune cannot reset a penalized client to a full bucket.
+type ratePenalty struct {
+	strikes    float64
+	lastStrike time.Time
+	until      time.Time
+}
+
+func (h *Handler) penaltyBoxEnabled() bool {
+	return h.cfg.PenaltyBoxStrikes > 0
+}
+
+// baseRateLimit returns the limiter rate and burst, reduced while a client is penalized.
+func (h *Handler) baseRateLimit(penalized bool) (rate.Limit, int) {
+	if !penalized {
+		return rate.Limit(h.cfg.RateLimitRPS), max(1, h.cfg.RateLimitBurst)
+	}
+	return rate.Limit(h.cfg.PenaltyBoxRPS), 1
+}
+
+func (h *Handler) isPenalizedLocked(key string, now time.Time) bool {
+	penalty, ok := h.penalties[key]
+	return ok && now.Before(penalty.until)
+}
+
+// decayedStrikes forgives one strike per PenaltyBoxStrikeDecay since the last strike.
+func (h *Handler) decayedStrikes(penalty *ratePenalty, now time.Time) float64 {
+	elapsed := now.Sub(penalty.lastStrike)
+	if elapsed <= 0 {
+		return penalty.strikes
+	}
+	forgiven := math.Floor(float64(elapsed) / float64(h.cfg.PenaltyBoxStrikeDecay))
+	return math.Max(0, penalty.strikes-forgiven)
+}
+
+// recordRateLimitStrikeLocked counts a new limit episode for key and moves it into
+// the penalty box once PenaltyBoxStrikes is reached.
+func (h *Handler) recordRateLimitStrikeLocked(key string, entry *clientLimiter, now time.Time) {
+	penalty, ok := h.penalties[key]
+	if !ok {
+		penalty = &ratePenalty{}
+		h.penalties[key] = penalty
+	}
+	penalty.strikes = h.decayedStrikes(penalty, now) + 1
+	penalty.lastStrike = now
+	if penalty.strikes < float64(h.cfg.PenaltyBoxStrikes) || now.Before(penalty.until) {
+		return
+	}
+	penalty.until = now.Add(h.cfg.PenaltyBoxDuration)
+	entry.penalized = true
+	limit, burst := h.baseRateLimit(true)
+	entry.limiter.SetLimitAt(now, limit)
+	entry.limiter.SetBurstAt(now, burst)
+}
+
+// prunePenaltiesLocked drops penalty entries whose strikes have fully decayed and whose box expired.
+func (h *Handler) prunePenaltiesLocked(now time.Time) {
+	for key, penalty := range h.penalties {
+		if now.Before(penalty.until) {
+			continue
+		}
+		if h.decayedStrikes(penalty, now) <= 0 {
+			delete(h.penalties, key)
+		}
+	}
+}
+
+func (h *Handler) penalizedClientCount(now time.Time) int {
+	h.rateLimitMu.Lock()
+	defer h.rateLimitMu.Unlock()
+	count := 0
+	for _, penalty := range h.penalties {
+		if now.Before(penalty.until) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,71 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// putRouteScope reports the scope required to PUT to p. PUT /plans/{id} is always
+// enabled; other routes must be listed in Config.PutRouteScopes by route template.
+func (h *Handler) putRouteScope(p string) (string, bool) {
+	if isPutForwardPath(p) {
+		return scopePlan, true
+	}
+	if len(h.cfg.PutRouteScopes) == 0 || isRawForwardPath(p) {
+		return "", false
+	}
+	route := routeTemplate(p)
+	if route == unmatchedRouteTemplate {
+		return "", false
+	}
+	scope, ok := h.cfg.PutRouteScopes[route]
+	return scope, ok
+}
+
+// allowsMethod reports whether forwarded requests to p may use method.
+func (h *Handler) allowsMethod(method string, p string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPost:
+		return true
+	case http.MethodPut:
+		_, ok := h.putRouteScope(p)
+		return ok
+	default:
+		return false
+	}
+}
+
+// canAccess is authContext.canAccess with configured PUT route scopes applied.
+func (h *Handler) canAccess(auth authContext, method string, p string) bool {
+	if strings.ToUpper(strings.TrimSpace(method)) == http.MethodPut {
+		if scope, ok := h.putRouteScope(p); ok {
+			return auth.hasScope(scope)
+		}
+	}
+	return auth.canAccess(method, p)
+}
+
+// ParsePutRouteScopes parses "route=scope" pairs such as "/plans/{id}/steps=plan".
+func ParsePutRouteScopes(items []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range items {
+		route, scope, ok := strings.Cut(strings.TrimSpace(item), "=")
+		route = strings.TrimSpace(route)
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !ok || route == "" || scope == "" {
+			return nil, fmt.Errorf("invalid put route entry %q (expected route=scope)", item)
+		}
+		out[route] = scope
+	}
+	return out, nil
+}
+
+func validatePutRouteScopes(routes map[string]string) error {
+	for route, scope := range routes {
+		if _, ok := bridgeScopeSet[scope]; !ok {
+			return fmt.Errorf("unknown scope %q for put route %s", scope, route)
+		}
+	}
+	return nil
+}
@@ -2,35 +2,63 @@ package relay
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	mathrand "math/rand/v2"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"golang.org/x/time/rate"
 )
 
+// Version is the bridge release reported to clients. Override at build time with
+// -ldflags "-X github.com/maddwiz/novaadapt/bridge/internal/relay.Version=...".
+var Version = "0.1.0"
+
 const maxRequestBodyBytes = 1 << 20 // 1 MiB
 
+const defaultMaxPathBytes = 2048
+
 const rateLimiterIdleTTL = 15 * time.Minute
 
+const defaultCORSMaxAge = 600 * time.Second
+
+const defaultHealthProbeTimeout = 5 * time.Second
+
+// Core redirect policies control how the bridge treats 3xx responses from core.
+const (
+	// CoreRedirectPassthrough returns the core 3xx status and Location to the client without following it.
+	CoreRedirectPassthrough = "passthrough"
+	// CoreRedirectError converts a core 3xx into a 502 that reports the redirect location.
+	CoreRedirectError = "error"
+	// CoreRedirectSameHost follows redirects that stay on the core host; cross-host redirects become 502s.
+	CoreRedirectSameHost = "same-host"
+)
+
 type clientLimiter struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+	limiter   *rate.Limiter
+	lastSeen  time.Time
+	limited   bool
+	penalized bool
 }
 
 type corsState int
@@ -91,78 +119,475 @@ var allowedPaths = map[string]struct{}{
 // Config controls bridge relay behavior.
 type Config struct {
 	CoreBaseURL string
-	BridgeToken string
-	CoreToken   string
+	// CoreBaseURLs optionally lists identical core replicas as "url" or "url|weight".
+	// Requests are spread with weighted round-robin; CoreBaseURL is used when empty.
+	CoreBaseURLs []string
+	// CoreReplicaFailureThreshold is the consecutive failure count that ejects a replica (default 3).
+	CoreReplicaFailureThreshold int
+	// CoreReplicaEjectDuration is how long an ejected replica is skipped (default 30s).
+	CoreReplicaEjectDuration time.Duration
+	BridgeToken              string
+	CoreToken                string
 	// CoreCAFile optionally sets a CA bundle PEM file for bridge->core TLS verification.
 	CoreCAFile string
 	// CoreClientCertFile and CoreClientKeyFile optionally enable mTLS client cert auth to core.
 	CoreClientCertFile string
 	CoreClientKeyFile  string
+	// CoreCAPEM, CoreClientCertPEM and CoreClientKeyPEM accept the same material as
+	// inline PEM strings and take precedence over the file paths.
+	CoreCAPEM         string
+	CoreClientCertPEM string
+	CoreClientKeyPEM  string
 	// CoreTLSServerName overrides SNI/hostname verification for bridge->core TLS.
 	CoreTLSServerName string
 	// CoreTLSInsecureSkipVerify disables core certificate verification. Only for local/dev use.
 	CoreTLSInsecureSkipVerify bool
+	// CoreTLSMinVersion sets the minimum bridge->core TLS version ("1.2" or "1.3"). Default: 1.2.
+	CoreTLSMinVersion string
+	// CoreTLSCipherSuites optionally restricts bridge->core TLS 1.2 cipher suites by IANA name.
+	CoreTLSCipherSuites []string
+	// CoreMaxIdleConns caps idle keep-alive connections kept across all cores (default 100).
+	CoreMaxIdleConns int
+	// CoreMaxIdleConnsPerHost caps idle keep-alive connections kept per core (default 64).
+	// Go's default of 2 forces concurrent requests to one core to keep redialing.
+	CoreMaxIdleConnsPerHost int
+	// CoreMaxConnsPerHost caps total connections per core. Zero means unlimited.
+	CoreMaxConnsPerHost int
+	// CoreRetryBudgetRPS enables one retry of forwarded GETs that fail with a transport
+	// error or 502/503/504, drawing from a token bucket of this many retries per second
+	// shared by all requests. When the budget is exhausted requests fail fast. <=0
+	// disables retries.
+	CoreRetryBudgetRPS float64
+	// CoreRetryBudgetBurst is the retry budget's bucket size. Default: ceil(CoreRetryBudgetRPS).
+	CoreRetryBudgetBurst int
+	// DisableHTTP2 makes servers built by NewServer speak only HTTP/1.1, even over TLS.
+	DisableHTTP2 bool
+	// RequireAuth makes NewHandler fail when neither BridgeToken nor SessionSigningKey is set,
+	// instead of starting in open-access mode.
+	RequireAuth bool
+	// OpenAccessAllowedPaths restricts open-access mode to these paths (exact paths or
+	// templates such as /plans/{id}); other paths return 403. Empty keeps full access.
+	OpenAccessAllowedPaths []string
+	// OnlyStaticTokenCanIssue restricts /auth/session, /auth/session/revoke and
+	// /auth/pair to the static BridgeToken, so admin session tokens cannot mint
+	// further tokens.
+	OnlyStaticTokenCanIssue bool
+	// SessionIssueRPS caps /auth/session and /auth/pair token issuance across all
+	// callers, independently of the per-client rate limit; excess requests get 429.
+	// <=0 disables the cap.
+	SessionIssueRPS float64
 	// SessionSigningKey signs scoped short-lived session tokens for websocket/browser clients.
 	SessionSigningKey string
+	// ForwardCallerIdentity sends the authenticated subject, scopes and device ID to core
+	// as X-Bridge-Subject, X-Bridge-Scopes and X-Bridge-Device-ID. Client-supplied
+	// copies of these headers are always stripped.
+	ForwardCallerIdentity bool
+	// ForwardSubjectHeader sends the authenticated subject and device ID to core as
+	// X-Nova-Subject and X-Nova-Device, so core's audit log can attribute actions to the
+	// end user. Client-supplied copies of these headers are always stripped.
+	ForwardSubjectHeader bool
+	// RequireTenant forwards each session token's tenant claim to core as X-Tenant-ID
+	// and rejects core-bound requests whose token has no tenant with 403.
+	RequireTenant bool
 	// SessionTokenTTL controls default issued session token lifetime.
 	SessionTokenTTL time.Duration
+	// MaxSessionTokenTTL caps the lifetime of tokens issued by POST /auth/session
+	// (default 24h). Pairing tokens keep their own 90 day cap.
+	MaxSessionTokenTTL time.Duration
+	// MinSessionTokenTTL is the shortest lifetime any issued session token gets
+	// (default 60s). NewHandler rejects a minimum above MaxSessionTokenTTL.
+	MinSessionTokenTTL time.Duration
+	// TokenExpiryLeeway tolerates client clock skew when checking session token expiry.
+	// Zero (default) rejects tokens as soon as they expire.
+	TokenExpiryLeeway time.Duration
 	// AllowedDeviceIDs optionally restricts requests to known device IDs via X-Device-ID.
 	// Empty means device allowlisting is disabled.
 	AllowedDeviceIDs []string
+	// EventsPageLinks adds a Link rel="next" header to GET /events array responses,
+	// pointing at the same query with since_id set to the page's highest event id.
+	EventsPageLinks bool
+	// DisableRootInfo makes GET / fall through to normal auth and 404 handling
+	// instead of serving the unauthenticated service/version summary.
+	DisableRootInfo bool
+	// AllowedBrowserActions optionally restricts browser automation to these action
+	// types (e.g. "navigate"), checked against /browser/action body "type" and the
+	// dedicated /browser/<action> endpoints. Empty allows every action.
+	AllowedBrowserActions []string
+	// AllowedTerminalCommands optionally restricts terminal sessions to these programs,
+	// checked against the first word (or argv element) of the /terminal/sessions body
+	// "command". Empty allows every command.
+	AllowedTerminalCommands []string
 	// CORSAllowedOrigins controls which browser origins may call cross-origin bridge APIs.
 	// Empty keeps cross-origin requests blocked; same-origin requests are always allowed.
 	CORSAllowedOrigins []string
+	// AllowedHosts rejects requests whose Host header is not listed with 421, so
+	// same-origin CORS inference cannot be fooled by a spoofed Host. Entries without a
+	// port match any port. Empty disables the check.
+	AllowedHosts []string
+	// CORSMaxAge controls Access-Control-Max-Age on CORS responses. Default: 600s.
+	CORSMaxAge time.Duration
+	// CORSAllowCredentials adds Access-Control-Allow-Credentials: true to CORS responses
+	// for cookie or otherwise credentialed browser requests. It cannot be combined with
+	// a "*" entry in CORSAllowedOrigins; NewHandler rejects that configuration.
+	CORSAllowCredentials bool
+	// RequireCSRFForBrowsers requires an X-CSRF-Token header matching the csrf_token
+	// returned by POST /auth/session on state-changing requests that carry an Origin
+	// header and a session token; mismatches get 403.
+	RequireCSRFForBrowsers bool
+	// GzipResponses gzip-compresses JSON and raw passthrough responses for clients
+	// sending Accept-Encoding: gzip.
+	GzipResponses bool
+	// GzipMinBytes is the smallest body compressed when GzipResponses is set
+	// (default 1024). Negative values are rejected.
+	GzipMinBytes int
+	// GzipLevel is the compress/gzip level, 1 (fastest) to 9 (smallest); 0 uses
+	// the library default.
+	GzipLevel int
 	// TrustedProxyCIDRs defines which remote client networks are allowed to set
 	// X-Forwarded-For / X-Forwarded-Proto headers.
 	TrustedProxyCIDRs []string
+	// RequireHTTPSForAuth rejects requests that present a bearer token over plain
+	// HTTP with 400 (code insecure_transport). The scheme honors X-Forwarded-Proto
+	// from TrustedProxyCIDRs. /health, /metrics and GET / are exempt.
+	RequireHTTPSForAuth bool
+	// AdminAllowedCIDRs restricts /admin/* and /auth/session* to client IPs (or
+	// networks) in this list, resolved through TrustedProxyCIDRs; other callers get
+	// 403 admin_ip_not_allowed even with admin scope. Empty disables the check.
+	AdminAllowedCIDRs []string
 	// RevocationStorePath optionally persists revoked session IDs across bridge restarts.
 	RevocationStorePath string
+	// RevocationStore optionally replaces the file-backed revocation store, e.g. with a
+	// backend shared by several bridge instances. RevocationStorePath is ignored when set.
+	RevocationStore RevocationStore
+	// AuditLogPath appends one JSON line per session token issuance and revocation.
+	// Token values are never written. Empty disables the audit log.
+	AuditLogPath string
+	// SessionIndexPath optionally persists the session ID -> (subject, device, expiry) index
+	// used for subject revocation. Expired entries are pruned on load.
+	SessionIndexPath string
+	// MaxIssuableScopes optionally limits which scopes /auth/session and /auth/pair may
+	// issue (e.g. omit "admin" to stop admin tokens minting further admin tokens).
+	// Empty leaves issuance unrestricted.
+	MaxIssuableScopes []string
+	// SingleSessionPerDevice makes each POST /auth/session issuance for a device invalidate
+	// that device's previously issued session token.
+	SingleSessionPerDevice bool
+	// DeviceSessionStorePath optionally persists the device -> current session map.
+	DeviceSessionStorePath string
+	// MaintenanceStorePath optionally persists the maintenance mode toggle across bridge restarts.
+	MaintenanceStorePath string
 	// RateLimitRPS limits requests per client key (remote IP / forwarded IP). <=0 disables.
 	RateLimitRPS float64
 	// RateLimitBurst configures token bucket burst size when RateLimitRPS is enabled.
 	RateLimitBurst int
+	// MaxTokenRateLimitRPS caps the rate_limit_rps claim a session token may carry to
+	// override RateLimitRPS for its holder. <=0 disables per-token overrides.
+	MaxTokenRateLimitRPS float64
+	// RequireClientRequestID rejects requests without an inbound X-Request-ID with 400
+	// request_id_required instead of generating one. /health, /metrics, and /ws
+	// (browsers cannot set upgrade headers) are exempt.
+	RequireClientRequestID bool
+	// AllowClientIPEcho adds an X-Bridge-Client-IP response header with the resolved client
+	// key used for rate limiting, and enables GET /debug/client-ip.
+	AllowClientIPEcho bool
+	// PenaltyBoxStrikes enables the rate-limit penalty box: a client that starts being
+	// rate limited this many times (strikes decay over PenaltyBoxStrikeDecay) is held to
+	// PenaltyBoxRPS for PenaltyBoxDuration, surviving idle limiter pruning. <=0 disables.
+	PenaltyBoxStrikes int
+	// PenaltyBoxRPS is the reduced per-client rate while penalized. Default: RateLimitRPS/10.
+	PenaltyBoxRPS float64
+	// PenaltyBoxDuration is how long a penalized client stays at the reduced rate. Default: 10m.
+	PenaltyBoxDuration time.Duration
+	// PenaltyBoxStrikeDecay is the interval after which one strike is forgiven. Default: 1m.
+	PenaltyBoxStrikeDecay time.Duration
+	// WSTicketTTL controls how long single-use /ws tickets from POST /auth/ws-ticket stay valid.
+	WSTicketTTL time.Duration
+	// WSHandshakeTimeout bounds the /ws upgrade handshake (gorilla's HandshakeTimeout).
+	// Default: 10s.
+	WSHandshakeTimeout time.Duration
+	// RejectAmbiguousWSAuth answers /ws with 400 (code ambiguous_ws_auth) when both an
+	// Authorization bearer header and a ?token= query parameter are sent and differ.
+	// By default the header wins silently.
+	RejectAmbiguousWSAuth bool
+	// WSBanner is an operational notice (e.g. "maintenance at 02:00 UTC") sent to each
+	// /ws connection as a {"type":"notice"} frame right after hello. Handler.SetWSBanner
+	// replaces it at runtime. Empty sends nothing.
+	WSBanner string
+	// WSSendQueueSize bounds each websocket connection's outbound queue. When full, the
+	// oldest audit event frame is dropped; command responses are never dropped. Default: 256.
+	WSSendQueueSize int
+	// WSMaxBacklogEvents fast-forwards a /ws connection whose since_id is more than this
+	// many events behind core's latest on its first poll, sending a backlog_skipped
+	// frame instead of replaying history. Clients opt into full replay with
+	// ?backfill=1. 0 disables the limit. Ignored by SharedAuditPump.
+	WSMaxBacklogEvents int
+	// WSFailFastWhenCoreDown answers websocket terminal, browser and command messages
+	// with a core_unavailable error frame while every core replica is ejected after
+	// repeated failures, instead of attempting a doomed core request.
+	WSFailFastWhenCoreDown bool
+	// SharedAuditPump serves websocket audit events from one core /events/stream poll
+	// loop per tenant (split further by forwarded caller identity and session metadata)
+	// instead of one per connection; each connection still filters by its own
+	// since_id. Per-connection poll_timeout/poll_interval are then ignored.
+	SharedAuditPump bool
 	// MaxWSConnections limits concurrent websocket sessions. 0 disables limit.
 	MaxWSConnections int
-	Timeout          time.Duration
-	LogRequests      bool
-	Logger           *log.Logger
+	// ValidationErrorRoutes opts route templates into rewriting core 422 bodies as
+	// {"error":"validation_failed","fields":{...}}. Each value is the dotted path of the
+	// field errors in core's body (default "errors"). Other routes pass 422s through.
+	ValidationErrorRoutes map[string]string
+	// ProbeCoreCapabilities fetches core /openapi.json at startup and every
+	// CoreCapabilitiesRefresh (default 5m); forwardable paths core does not advertise
+	// get 501 core_unsupported instead of core's 404.
+	ProbeCoreCapabilities   bool
+	CoreCapabilitiesRefresh time.Duration
+	// MaxInflightPerSubject caps concurrent core requests per token subject (scoped by
+	// tenant); extra requests get 429 instead of queueing. 0 disables the cap.
+	MaxInflightPerSubject int
+	// MaxTerminalSessionsPerSubject caps terminal sessions a token subject may start
+	// over /ws terminal_start or POST /terminal/sessions. Sessions are tracked until
+	// they are closed through the bridge or for one hour, so the cap is best effort.
+	// 0 disables the cap.
+	MaxTerminalSessionsPerSubject int
+	// BridgeLoadHeader adds an X-Bridge-Load: low|medium|high response header so
+	// clients can back off before hitting hard 429/503 limits.
+	BridgeLoadHeader bool
+	// LoadInflightCapacity is the in-flight HTTP request count treated as full load
+	// for X-Bridge-Load (default 64). It does not limit requests.
+	LoadInflightCapacity int
+	Timeout              time.Duration
+	LogRequests          bool
+	// LogSampleRate logs only this fraction (0..1) of successful requests when
+	// LogRequests is on; 4xx/5xx responses are always logged. >=1 logs every request.
+	// Zero means 1 unless LogSampleRateSet is true, in which case <=0 logs errors only.
+	LogSampleRate float64
+	// LogSampleRateSet marks LogSampleRate as explicitly configured, so 0 is honored.
+	LogSampleRateSet bool
+	// HealthProbeTimeout bounds the core request made by GET /health?deep=1,
+	// independently of Timeout, so slow cores fail LB probes fast. Default: 5s.
+	HealthProbeTimeout time.Duration
+	// MaxPathBytes caps the URL path length of HTTP requests and ws command paths;
+	// longer paths get 414 before any allowlist or forward logic. Default: 2048.
+	MaxPathBytes int
+	// CacheTTLs enables caching of successful GET responses per route template
+	// (e.g. "/plans" or "/plans/{id}"). Empty disables response caching.
+	CacheTTLs map[string]time.Duration
+	// RouteTimeouts overrides Timeout for forwarded requests per route template (e.g.
+	// "/run" or "/plans/{id}"), in either direction, via a context deadline.
+	RouteTimeouts map[string]time.Duration
+	// CacheInvalidations maps a write route template to cached route templates evicted
+	// when that write succeeds. A write always evicts its own route template.
+	CacheInvalidations map[string][]string
+	// CacheMaxEntries bounds the number of cached responses (default 256).
+	CacheMaxEntries int
+	// CoreRedirectPolicy is one of CoreRedirectPassthrough (default), CoreRedirectError,
+	// or CoreRedirectSameHost. Redirects to another host are never followed, so the
+	// core token is never sent off-host.
+	CoreRedirectPolicy string
+	// StrictCoreJSON turns a 2xx core response that is not valid JSON into a 502
+	// (code core_invalid_json). By default it is relayed as {"raw": ...} with core's status.
+	StrictCoreJSON bool
+	// ServeStaleOnError answers a cacheable GET (see CacheTTLs) with its last cached
+	// response, even if expired, when core is unreachable or returns 5xx, marked with
+	// X-Cache: STALE and a Warning header, instead of relaying the failure.
+	ServeStaleOnError bool
+	// FallbackResponses maps GET route templates (e.g. "/models") to canned JSON
+	// returned with 200 and X-Bridge-Fallback: true when core is down: every replica
+	// is ejected or the request could not reach core. Core error responses are still
+	// relayed, and a stale cached copy (ServeStaleOnError) is preferred.
+	FallbackResponses map[string]json.RawMessage
+	// HonorCoreRetryAfter makes a core 429 with Retry-After pause forwarding to that
+	// replica: until the delay (capped at 5 minutes) elapses, forwarded requests get a
+	// local 429 (code core_rate_limited) instead of reaching core. Core's Retry-After
+	// is relayed on its 429s either way.
+	HonorCoreRetryAfter bool
+	// StripResponseHeaders lists core response headers (e.g. Server, X-Internal-Node)
+	// that are never relayed to clients, even when listed in ForwardedResponseHeaders.
+	// Hop-by-hop headers are always stripped.
+	StripResponseHeaders []string
+	// CoreAcceptHeader is sent as Accept on outbound core JSON requests (e.g.
+	// "application/vnd.novaadapt.v2+json"). Empty sends no override.
+	CoreAcceptHeader string
+	// CoreVersionAccept maps client X-Core-Version values to the Accept header sent to core.
+	// Versions outside this allowlist are rejected with 400.
+	CoreVersionAccept map[string]string
+	// ForwardedRequestHeaders lists client request headers copied onto core requests.
+	// Hop-by-hop and bridge-managed headers (Authorization, Content-Type, ...) are never copied.
+	ForwardedRequestHeaders []string
+	// HopByHopHeaders adds header names treated as hop-by-hop, on top of the RFC 7230
+	// set, and stripped in both directions.
+	HopByHopHeaders []string
+	// ForwardedResponseHeaders lists the core response headers relayed to clients; all
+	// others are withheld. Server-Timing also gets a bridge;dur=<ms> segment appended,
+	// and Set-Cookie is dropped from cacheable responses.
+	ForwardedResponseHeaders []string
+	// CoreErrorHeaders lists core response headers echoed in the core_status object
+	// of non-2xx forwarded responses, alongside core's status code and reason phrase.
+	// Empty uses X-Error-Code.
+	CoreErrorHeaders []string
+	// PutRouteScopes enables PUT on additional forwarded route templates (e.g.
+	// "/plans/{id}/steps") and maps each to the scope it requires. PUT /plans/{id}
+	// is always enabled with plan scope; empty enables nothing else.
+	PutRouteScopes map[string]string
+	// BodyFieldRenames maps a route template to top-level JSON body keys renamed
+	// before forwarding (e.g. {"/run": {"goal": "objective"}}) so legacy clients keep
+	// working after core renames a field.
+	BodyFieldRenames map[string]map[string]string
+	// ResponseTransformer optionally rewrites forwarded core responses (e.g. to redact
+	// or add fields) before they are cached and written. It runs on every forwarded
+	// JSON response, so it must be fast and free of side effects; an error turns the
+	// response into 502. Nil leaves responses untouched.
+	ResponseTransformer func(path string, status int, body []byte) (int, []byte, error)
+	// DebugDeviceIDs gets requests and /ws connections from these device IDs a verbose
+	// "bridge debug" log line (request line with credentials redacted, subject, scopes,
+	// access decision, core status, timing) even when LogRequests is off.
+	DebugDeviceIDs []string
+	// DisableLogRouteTemplate drops the normalized route template (e.g. /plans/{id}/approve)
+	// from request logs, which include it by default.
+	DisableLogRouteTemplate bool
+	// LogJSON writes request log lines as JSON objects (msg, id, method, path, route,
+	// status, duration_ms) instead of key=value text.
+	LogJSON bool
+	Logger  *log.Logger
 }
 
 // Handler is an HTTP handler that secures and forwards requests to NovaAdapt core.
 type Handler struct {
 	cfg    Config
 	client *http.Client
+	// deadlineClient shares client's transport without its Timeout; it serves
+	// requests whose context carries their own deadline.
+	deadlineClient *http.Client
+	cores          *corePool
 
 	requestsTotal       uint64
 	unauthorizedTotal   uint64
 	upstreamErrorsTotal uint64
+	bodyTooLargeTotal   uint64
+	bodyBadJSONTotal    uint64
+	idempotencyReplays  uint64
+	coreRateLimited     uint64
+	coreRetriesTotal    uint64
+	retriesDeniedTotal  uint64
+	coreRetryBudget     *rate.Limiter
+	sessionIssueLimit   *rate.Limiter
 	rateLimitedTotal    uint64
 	sessionIssuedTotal  uint64
 	sessionRevokedTotal uint64
 	wsRejectedTotal     uint64
+	wsDroppedTotal      uint64
+	wsPumpErrorsTotal   uint64
 	wsActiveConnections int64
+	inflightRequests    int64
+	subjectInflightMu   sync.Mutex
+	subjectInflight     map[string]int
+	terminalSessionsMu  sync.Mutex
+	terminalSessions    map[string]trackedTerminalSession
 	allowedDevicesMu    sync.RWMutex
 	allowedDevices      map[string]struct{}
+	debugDevices        map[string]struct{}
+	browserActions      map[string]struct{}
+	terminalCommands    map[string]struct{}
 	corsAllowedOrigins  map[string]struct{}
 	corsAllowAll        bool
+	allowedHosts        map[string]struct{}
 	trustedProxies      []*net.IPNet
-	revokedSessionsMu   sync.RWMutex
-	revokedSessions     map[string]int64
+	adminNetworks       []*net.IPNet
+	auditLogMu          sync.Mutex
+	revocations         RevocationStore
+	sessionIndexMu      sync.RWMutex
+	sessionIndex        map[string]sessionIndexEntry
+	deviceSessionsMu    sync.RWMutex
+	deviceSessions      map[string]deviceSessionEntry
 	rateLimitMu         sync.Mutex
 	rateLimiters        map[string]*clientLimiter
+	penalties           map[string]*ratePenalty
+	maintenanceEnabled  int32
+	maintenanceMu       sync.RWMutex
+	maintenance         maintenanceState
+	routeRequestsMu     sync.Mutex
+	routeRequests       map[string]uint64
+	authFailuresMu      sync.Mutex
+	authFailures        map[string]uint64
+	bodyTooLargeMu      sync.Mutex
+	bodyTooLargeByPath  map[string]uint64
+	cache               *responseCache
+	wsBanner            atomic.Value
+	wsUpgrader          *websocket.Upgrader
+	wsTicketsMu         sync.Mutex
+	wsTickets           map[string]wsTicket
+	auditPollersMu      sync.Mutex
+	auditPollers        map[string]*sharedAuditPoller
+	hopByHopHeaders     map[string]struct{}
+	stripHeaders        map[string]struct{}
+	issuableScopes      map[string]struct{}
+	forwardHeaders      map[string]struct{}
+	forwardReqHeaders   map[string]struct{}
+	coreErrorHeaders    map[string]struct{}
+	logSample           func() float64
+	coreCaps            coreCapabilities
+	wsAuthBackoff       time.Duration
 }
 
 // NewHandler creates a configured bridge relay handler.
 func NewHandler(cfg Config) (*Handler, error) {
+	coreBaseURLs := cfg.CoreBaseURLs
+	if len(coreBaseURLs) == 0 {
+		coreBaseURLs = []string{cfg.CoreBaseURL}
+	}
+	if strings.TrimSpace(cfg.CoreBaseURL) == "" && len(coreBaseURLs) > 0 {
+		if first, err := parseCoreReplica(coreBaseURLs[0]); err == nil {
+			cfg.CoreBaseURL = first.baseURL
+		}
+	}
 	if strings.TrimSpace(cfg.CoreBaseURL) == "" {
 		return nil, fmt.Errorf("core base url is required")
 	}
 	if cfg.Timeout <= 0 {
 		cfg.Timeout = 30 * time.Second
 	}
+	if cfg.HealthProbeTimeout <= 0 {
+		cfg.HealthProbeTimeout = defaultHealthProbeTimeout
+	}
+	if cfg.MaxPathBytes <= 0 {
+		cfg.MaxPathBytes = defaultMaxPathBytes
+	}
+	if len(cfg.CoreErrorHeaders) == 0 {
+		cfg.CoreErrorHeaders = defaultCoreErrorHeaders
+	}
+	if cfg.CoreRetryBudgetRPS > 0 && cfg.CoreRetryBudgetBurst <= 0 {
+		cfg.CoreRetryBudgetBurst = max(1, int(math.Ceil(cfg.CoreRetryBudgetRPS)))
+	}
+	if cfg.CoreMaxIdleConns <= 0 {
+		cfg.CoreMaxIdleConns = 100
+	}
+	if cfg.CoreMaxIdleConnsPerHost <= 0 {
+		cfg.CoreMaxIdleConnsPerHost = 64
+	}
+	if cfg.CoreMaxConnsPerHost < 0 {
+		cfg.CoreMaxConnsPerHost = 0
+	}
 	if cfg.RateLimitBurst <= 0 {
 		cfg.RateLimitBurst = 20
 	}
+	if cfg.PenaltyBoxRPS <= 0 {
+		cfg.PenaltyBoxRPS = cfg.RateLimitRPS / 10
+	}
+	if cfg.PenaltyBoxDuration <= 0 {
+		cfg.PenaltyBoxDuration = defaultPenaltyBoxDuration
+	}
+	if cfg.PenaltyBoxStrikeDecay <= 0 {
+		cfg.PenaltyBoxStrikeDecay = defaultPenaltyBoxStrikeDecay
+	}
+	if cfg.CoreCapabilitiesRefresh <= 0 {
+		cfg.CoreCapabilitiesRefresh = defaultCoreCapabilitiesRefresh
+	}
+	if cfg.LoadInflightCapacity <= 0 {
+		cfg.LoadInflightCapacity = 64
+	}
+	if cfg.LogSampleRate == 0 && !cfg.LogSampleRateSet {
+		cfg.LogSampleRate = 1
+	}
 	if cfg.MaxWSConnections < 0 {
 		cfg.MaxWSConnections = 0
 	}
@@ -172,17 +597,52 @@ func NewHandler(cfg Config) (*Handler, error) {
 	if cfg.SessionTokenTTL <= 0 {
 		cfg.SessionTokenTTL = 15 * time.Minute
 	}
+	if err := validateGzipConfig(&cfg); err != nil {
+		return nil, err
+	}
+	if err := validateFallbackResponses(cfg.FallbackResponses); err != nil {
+		return nil, err
+	}
+	if cfg.MaxSessionTokenTTL <= 0 {
+		cfg.MaxSessionTokenTTL = defaultSessionMaxTTLSeconds * time.Second
+	}
+	if cfg.MinSessionTokenTTL <= 0 {
+		cfg.MinSessionTokenTTL = defaultSessionMinTTLSeconds * time.Second
+	}
+	if cfg.MinSessionTokenTTL > cfg.MaxSessionTokenTTL {
+		return nil, fmt.Errorf("min session token ttl %s exceeds max session token ttl %s", cfg.MinSessionTokenTTL, cfg.MaxSessionTokenTTL)
+	}
+	if cfg.CORSMaxAge <= 0 {
+		cfg.CORSMaxAge = defaultCORSMaxAge
+	}
+	if cfg.WSTicketTTL <= 0 {
+		cfg.WSTicketTTL = defaultWSTicketTTL
+	}
+	if cfg.WSHandshakeTimeout <= 0 {
+		cfg.WSHandshakeTimeout = defaultWSHandshakeTimeout
+	}
 	if cfg.Logger == nil {
 		cfg.Logger = log.Default()
 	}
-	coreURL, err := url.Parse(strings.TrimSpace(cfg.CoreBaseURL))
-	if err != nil {
-		return nil, fmt.Errorf("invalid core base url: %w", err)
+	if authModeFor(cfg) == authModeOpen {
+		if cfg.RequireAuth {
+			return nil, fmt.Errorf("auth is required but neither bridge token nor session signing key is configured")
+		}
+		cfg.Logger.Printf("WARN bridge auth_mode=open: no bridge token or session signing key configured; all requests are authorized with admin scope")
+	}
+	cfg.CoreRedirectPolicy = strings.ToLower(strings.TrimSpace(cfg.CoreRedirectPolicy))
+	switch cfg.CoreRedirectPolicy {
+	case "":
+		cfg.CoreRedirectPolicy = CoreRedirectPassthrough
+	case CoreRedirectPassthrough, CoreRedirectError, CoreRedirectSameHost:
+	default:
+		return nil, fmt.Errorf("invalid core redirect policy %q", cfg.CoreRedirectPolicy)
 	}
-	if coreURL.Scheme != "http" && coreURL.Scheme != "https" {
-		return nil, fmt.Errorf("core base url must use http or https")
+	cores, err := newCorePool(coreBaseURLs, cfg.CoreReplicaFailureThreshold, cfg.CoreReplicaEjectDuration)
+	if err != nil {
+		return nil, err
 	}
-	coreClient, err := buildCoreHTTPClient(cfg, coreURL.Scheme == "https")
+	coreClient, err := buildCoreHTTPClient(cfg, cores.anyTLS())
 	if err != nil {
 		return nil, err
 	}
@@ -194,6 +654,12 @@ func NewHandler(cfg Config) (*Handler, error) {
 		}
 		allowedDevices[trimmed] = struct{}{}
 	}
+	debugDevices := make(map[string]struct{})
+	for _, item := range cfg.DebugDeviceIDs {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			debugDevices[trimmed] = struct{}{}
+		}
+	}
 	corsAllowedOrigins := make(map[string]struct{})
 	corsAllowAll := false
 	for _, item := range cfg.CORSAllowedOrigins {
@@ -207,48 +673,165 @@ func NewHandler(cfg Config) (*Handler, error) {
 		}
 		corsAllowedOrigins[canonicalOrigin(trimmed)] = struct{}{}
 	}
-	revokedSessions, err := loadRevocationEntries(strings.TrimSpace(cfg.RevocationStorePath), time.Now().Unix())
-	if err != nil {
+	if corsAllowAll && cfg.CORSAllowCredentials {
+		return nil, fmt.Errorf("cors allow credentials cannot be combined with a \"*\" allowed origin")
+	}
+	allowedHosts := make(map[string]struct{})
+	for _, item := range cfg.AllowedHosts {
+		trimmed := strings.ToLower(strings.TrimSpace(item))
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			trimmed = strings.Trim(trimmed, "[]")
+		}
+		allowedHosts[trimmed] = struct{}{}
+	}
+	revocations := cfg.RevocationStore
+	if revocations == nil {
+		revocations = newFileRevocationStore(cfg.RevocationStorePath)
+	}
+	if err := revocations.Load(time.Now().Unix()); err != nil {
 		return nil, fmt.Errorf("failed to load revocation store: %w", err)
 	}
+	sessionIndex, err := loadSessionIndex(strings.TrimSpace(cfg.SessionIndexPath), time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session index: %w", err)
+	}
+	deviceSessions, err := loadDeviceSessions(strings.TrimSpace(cfg.DeviceSessionStorePath), time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device session store: %w", err)
+	}
+	var issuableScopes []string
+	if len(cfg.MaxIssuableScopes) > 0 {
+		issuableScopes = normalizeScopes(cfg.MaxIssuableScopes)
+		if err := validateScopes(issuableScopes); err != nil {
+			return nil, fmt.Errorf("invalid max issuable scopes: %w", err)
+		}
+	}
+	if len(cfg.PutRouteScopes) > 0 {
+		putRoutes := make(map[string]string, len(cfg.PutRouteScopes))
+		for route, scope := range cfg.PutRouteScopes {
+			putRoutes[strings.TrimSpace(route)] = strings.ToLower(strings.TrimSpace(scope))
+		}
+		if err := validatePutRouteScopes(putRoutes); err != nil {
+			return nil, fmt.Errorf("invalid put route scopes: %w", err)
+		}
+		cfg.PutRouteScopes = putRoutes
+	}
 	trustedProxies, err := parseTrustedProxyCIDRs(cfg.TrustedProxyCIDRs)
 	if err != nil {
 		return nil, fmt.Errorf("invalid trusted proxy cidr config: %w", err)
 	}
-	return &Handler{
+	adminNetworks, err := parseTrustedProxyCIDRs(cfg.AdminAllowedCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin allowed cidr config: %w", err)
+	}
+	maintenance, err := loadMaintenanceState(strings.TrimSpace(cfg.MaintenanceStorePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load maintenance store: %w", err)
+	}
+	h := &Handler{
 		cfg:                cfg,
 		client:             coreClient,
+		deadlineClient:     withoutClientTimeout(coreClient),
+		cores:              cores,
 		allowedDevices:     allowedDevices,
+		debugDevices:       debugDevices,
 		corsAllowedOrigins: corsAllowedOrigins,
 		corsAllowAll:       corsAllowAll,
+		allowedHosts:       allowedHosts,
 		trustedProxies:     trustedProxies,
-		revokedSessions:    revokedSessions,
+		adminNetworks:      adminNetworks,
+		revocations:        revocations,
+		sessionIndex:       sessionIndex,
+		deviceSessions:     deviceSessions,
 		rateLimiters:       make(map[string]*clientLimiter),
-	}, nil
+		penalties:          make(map[string]*ratePenalty),
+		maintenance:        maintenance,
+		routeRequests:      make(map[string]uint64),
+		authFailures:       make(map[string]uint64),
+		bodyTooLargeByPath: make(map[string]uint64),
+		subjectInflight:    make(map[string]int),
+		terminalSessions:   make(map[string]trackedTerminalSession),
+		coreRetryBudget:    newCoreRetryBudget(cfg),
+		sessionIssueLimit:  newSessionIssueLimiter(cfg),
+		cache:              newResponseCache(cfg.CacheTTLs, cfg.CacheInvalidations, cfg.CacheMaxEntries),
+		wsUpgrader:         newWSUpgrader(cfg.WSHandshakeTimeout),
+		wsTickets:          make(map[string]wsTicket),
+		auditPollers:       make(map[string]*sharedAuditPoller),
+		hopByHopHeaders:    canonicalHeaderSet(append(append([]string(nil), hopByHopHeaders...), cfg.HopByHopHeaders...)),
+		stripHeaders:       canonicalHeaderSet(cfg.StripResponseHeaders),
+		forwardHeaders:     canonicalHeaderSet(cfg.ForwardedResponseHeaders),
+		forwardReqHeaders:  canonicalHeaderSet(cfg.ForwardedRequestHeaders),
+		coreErrorHeaders:   canonicalHeaderSet(cfg.CoreErrorHeaders),
+		issuableScopes:     make(map[string]struct{}, len(issuableScopes)),
+		logSample:          mathrand.Float64,
+		browserActions:     browserActionSet(cfg.AllowedBrowserActions),
+		terminalCommands:   terminalCommandSet(cfg.AllowedTerminalCommands),
+		wsAuthBackoff:      wsPumpRetryDelay,
+	}
+	for _, scope := range issuableScopes {
+		h.issuableScopes[scope] = struct{}{}
+	}
+	h.cache.keepExpired = cfg.ServeStaleOnError
+	h.SetWSBanner(cfg.WSBanner)
+	if maintenance.Enabled {
+		h.maintenanceEnabled = 1
+	}
+	if cfg.ProbeCoreCapabilities {
+		h.refreshCoreCapabilities()
+	}
+	return h, nil
 }
 
 // ServeHTTP handles bridge requests.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	atomic.AddUint64(&h.requestsTotal, 1)
+	atomic.AddInt64(&h.inflightRequests, 1)
+	defer atomic.AddInt64(&h.inflightRequests, -1)
 
 	started := time.Now()
+	w = h.gzipWriterFor(w, r)
 	requestID := normalizeRequestID(r.Header.Get("X-Request-ID"))
 	w.Header().Set("X-Request-ID", requestID)
+	h.setBridgeLoadHeader(w)
+	if h.cfg.AllowClientIPEcho {
+		w.Header().Set("X-Bridge-Client-IP", h.clientRateKey(r))
+	}
+	route := routeTemplate(r.URL.Path)
+	if route != unmatchedRouteTemplate {
+		h.recordRouteRequest(route)
+	}
 
 	statusCode := http.StatusOK
+	var debug *requestDebug
 	defer func() {
-		if h.cfg.LogRequests {
-			h.cfg.Logger.Printf(
-				"bridge request id=%s method=%s path=%s status=%d duration_ms=%.2f",
-				requestID,
-				r.Method,
-				r.URL.Path,
-				statusCode,
-				float64(time.Since(started).Microseconds())/1000.0,
-			)
+		if debug != nil {
+			h.logDebugRequest(r, requestID, debug, statusCode, started)
+		}
+		if !h.shouldLogRequest(statusCode) {
+			return
 		}
+		h.logRequest(r, requestID, route, statusCode, started)
 	}()
 
+	if !h.isHostAllowed(r.Host) {
+		statusCode = http.StatusMisdirectedRequest
+		h.writeJSON(w, statusCode, map[string]any{"error": "Host not allowed", "code": "host_not_allowed", "request_id": requestID})
+		return
+	}
+	if len(r.URL.Path) > h.cfg.MaxPathBytes {
+		statusCode = http.StatusRequestURITooLong
+		h.writeJSON(w, statusCode, map[string]any{"error": "Request path too long", "code": "path_too_long", "request_id": requestID})
+		return
+	}
+	if isSuspiciousPath(r.URL.Path) {
+		statusCode = http.StatusBadRequest
+		h.writeJSON(w, statusCode, map[string]any{"error": "Invalid request path", "code": "invalid_path", "request_id": requestID})
+		return
+	}
+
 	corsState := h.applyCORSHeaders(w, r)
 	if corsState == corsDenied {
 		statusCode = http.StatusForbidden
@@ -272,6 +855,20 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.writeMetrics(w)
 		return
 	}
+	if r.URL.Path == "/" && r.Method == http.MethodGet && !h.cfg.DisableRootInfo {
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, rootInfoPayload(requestID))
+		return
+	}
+	if h.missingClientRequestID(r) {
+		statusCode = http.StatusBadRequest
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "X-Request-ID header is required", "code": "request_id_required", "request_id": requestID},
+		)
+		return
+	}
 	if h.isRateLimited(r, started) {
 		atomic.AddUint64(&h.rateLimitedTotal, 1)
 		statusCode = http.StatusTooManyRequests
@@ -280,9 +877,41 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.adminNetworkAllows(h.clientRateKey(r), r.URL.Path) {
+		statusCode = http.StatusForbidden
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Client network not allowed for admin routes", "code": "admin_ip_not_allowed", "request_id": requestID},
+		)
+		return
+	}
+	if h.cfg.RequireHTTPSForAuth && h.requestScheme(r) != "https" && extractRequestToken(r) != "" {
+		statusCode = http.StatusBadRequest
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Bearer tokens require HTTPS", "code": "insecure_transport", "request_id": requestID},
+		)
+		return
+	}
+	if h.cfg.RejectAmbiguousWSAuth && ambiguousWSAuth(r) {
+		statusCode = http.StatusBadRequest
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Conflicting Authorization header and token query parameter", "code": "ambiguous_ws_auth", "request_id": requestID},
+		)
+		return
+	}
+
 	auth := h.authenticate(r)
+	if h.isDebugDevice(auth.DeviceID) {
+		debug = &requestDebug{auth: auth}
+	}
 	if !auth.Authorized {
 		atomic.AddUint64(&h.unauthorizedTotal, 1)
+		h.recordAuthFailure(auth.FailureReason)
 		statusCode = http.StatusUnauthorized
 		h.writeJSONWithStatus(
 			w,
@@ -292,8 +921,147 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	if !h.openAccessAllows(auth, r.URL.Path) {
+		statusCode = http.StatusForbidden
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Path not available in open-access mode", "code": "open_access_forbidden", "request_id": requestID},
+		)
+		return
+	}
 
-	if r.URL.Path == "/auth/session" {
+	if code := h.csrfCheck(r, auth); code != "" {
+		statusCode = http.StatusForbidden
+		h.writeJSON(w, statusCode, map[string]any{"error": "Missing or invalid CSRF token", "code": code, "request_id": requestID})
+		return
+	}
+
+	if h.maintenanceActive() && !auth.hasScope(scopeAdmin) {
+		state := h.maintenanceSnapshot()
+		statusCode = http.StatusServiceUnavailable
+		if state.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+		}
+		h.writeJSON(w, statusCode, map[string]any{"error": state.Message, "maintenance": true, "request_id": requestID})
+		return
+	}
+
+	if r.URL.Path == "/admin/maintenance" {
+		if !auth.hasScope(scopeAdmin) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			statusCode = http.StatusOK
+			h.writeJSON(w, statusCode, h.handleGetMaintenance(requestID))
+			return
+		case http.MethodPost:
+			body, err := h.readBody(r)
+			if err != nil {
+				statusCode = readBodyErrorStatus(err)
+				h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
+				return
+			}
+			payload, err := h.handleSetMaintenance(body, requestID)
+			if err != nil {
+				statusCode = http.StatusBadRequest
+				h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
+				return
+			}
+			statusCode = http.StatusOK
+			h.writeJSON(w, statusCode, payload)
+			return
+		default:
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+	}
+
+	if r.URL.Path == "/debug/client-ip" {
+		if !h.cfg.AllowClientIPEcho {
+			statusCode = http.StatusNotFound
+			h.writeJSON(w, statusCode, map[string]any{"error": "Not found", "request_id": requestID})
+			return
+		}
+		if r.Method != http.MethodGet {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeRead) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, map[string]any{
+			"client_ip":     h.clientRateKey(r),
+			"remote_addr":   r.RemoteAddr,
+			"trusted_proxy": h.isTrustedProxy(r),
+			"forwarded_for": strings.TrimSpace(r.Header.Get("X-Forwarded-For")),
+			"request_id":    requestID,
+		})
+		return
+	}
+
+	if r.URL.Path == "/admin/core/ping" {
+		if r.Method != http.MethodPost {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeAdmin) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, h.handleCorePing(requestID))
+		return
+	}
+
+	if r.URL.Path == "/admin/revocations" {
+		if r.Method != http.MethodGet {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeAdmin) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		var payload map[string]any
+		statusCode, payload = h.revocationsPayload(requestID)
+		h.writeJSON(w, statusCode, payload)
+		return
+	}
+
+	if r.URL.Path == "/admin/ratelimit/flush" {
+		if r.Method != http.MethodPost {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeAdmin) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, map[string]any{
+			"status":     "ok",
+			"flushed":    h.flushRateLimiters(),
+			"request_id": requestID,
+		})
+		return
+	}
+
+	if r.URL.Path == "/admin/cache/flush" {
 		if r.Method != http.MethodPost {
 			statusCode = http.StatusMethodNotAllowed
 			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
@@ -305,11 +1073,59 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		body, err := h.readBody(r)
+		if err != nil {
+			statusCode = readBodyErrorStatus(err)
+			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
+			return
+		}
+		payload, err := h.handleCacheFlush(body, requestID)
 		if err != nil {
 			statusCode = http.StatusBadRequest
 			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 			return
 		}
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, payload)
+		return
+	}
+
+	if r.URL.Path == "/auth/session" {
+		if r.Method != http.MethodPost {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeAdmin) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		if h.requiresStaticIssuer(auth) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(
+				w,
+				statusCode,
+				map[string]any{"error": "Bridge token required", "code": "static_token_required", "request_id": requestID},
+			)
+			return
+		}
+		if !h.sessionIssueAllowed() {
+			atomic.AddUint64(&h.rateLimitedTotal, 1)
+			statusCode = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", "1")
+			h.writeJSON(
+				w,
+				statusCode,
+				map[string]any{"error": "Session issuance rate limit exceeded", "code": "session_issue_rate_limited", "request_id": requestID},
+			)
+			return
+		}
+		body, err := h.readBody(r)
+		if err != nil {
+			statusCode = readBodyErrorStatus(err)
+			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
+			return
+		}
 		issued, err := h.handleIssueSessionToken(body, auth, requestID)
 		if err != nil {
 			statusCode = http.StatusBadRequest
@@ -321,6 +1137,27 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.writeJSON(w, statusCode, issued)
 		return
 	}
+	if r.URL.Path == "/auth/ws-ticket" {
+		if r.Method != http.MethodPost {
+			statusCode = http.StatusMethodNotAllowed
+			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
+			return
+		}
+		if !auth.hasScope(scopeRead) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
+			return
+		}
+		issued, err := h.handleIssueWSTicket(auth, requestID)
+		if err != nil {
+			statusCode = http.StatusInternalServerError
+			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
+			return
+		}
+		statusCode = http.StatusOK
+		h.writeJSON(w, statusCode, issued)
+		return
+	}
 	if r.URL.Path == "/auth/session/revoke" {
 		if r.Method != http.MethodPost {
 			statusCode = http.StatusMethodNotAllowed
@@ -332,13 +1169,22 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
 			return
 		}
+		if h.requiresStaticIssuer(auth) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(
+				w,
+				statusCode,
+				map[string]any{"error": "Bridge token required", "code": "static_token_required", "request_id": requestID},
+			)
+			return
+		}
 		body, err := h.readBody(r)
 		if err != nil {
-			statusCode = http.StatusBadRequest
+			statusCode = readBodyErrorStatus(err)
 			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 			return
 		}
-		revoked, err := h.handleRevokeSessionToken(body, requestID)
+		revoked, err := h.handleRevokeSessionToken(body, auth, requestID)
 		if err != nil {
 			statusCode = http.StatusBadRequest
 			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
@@ -360,9 +1206,29 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
 			return
 		}
+		if h.requiresStaticIssuer(auth) {
+			statusCode = http.StatusForbidden
+			h.writeJSON(
+				w,
+				statusCode,
+				map[string]any{"error": "Bridge token required", "code": "static_token_required", "request_id": requestID},
+			)
+			return
+		}
+		if !h.sessionIssueAllowed() {
+			atomic.AddUint64(&h.rateLimitedTotal, 1)
+			statusCode = http.StatusTooManyRequests
+			w.Header().Set("Retry-After", "1")
+			h.writeJSON(
+				w,
+				statusCode,
+				map[string]any{"error": "Session issuance rate limit exceeded", "code": "session_issue_rate_limited", "request_id": requestID},
+			)
+			return
+		}
 		body, err := h.readBody(r)
 		if err != nil {
-			statusCode = http.StatusBadRequest
+			statusCode = readBodyErrorStatus(err)
 			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 			return
 		}
@@ -390,7 +1256,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case http.MethodPost:
 			body, err := h.readBody(r)
 			if err != nil {
-				statusCode = http.StatusBadRequest
+				statusCode = readBodyErrorStatus(err)
 				h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 				return
 			}
@@ -422,7 +1288,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 		body, err := h.readBody(r)
 		if err != nil {
-			statusCode = http.StatusBadRequest
+			statusCode = readBodyErrorStatus(err)
 			h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 			return
 		}
@@ -437,6 +1303,14 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if isArtifactDownloadPath(r.URL.Path) {
+		statusCode = h.handleArtifactDownload(w, r, requestID, auth)
+		if statusCode >= 500 {
+			atomic.AddUint64(&h.upstreamErrorsTotal, 1)
+		}
+		return
+	}
+
 	if r.URL.Path == "/ws" {
 		statusCode = h.handleWebSocket(w, r, requestID, auth)
 		if statusCode >= 500 {
@@ -451,28 +1325,62 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !auth.canAccess(r.Method, r.URL.Path) {
+	if !h.canAccess(auth, r.Method, r.URL.Path) {
 		statusCode = http.StatusForbidden
 		h.writeJSON(w, statusCode, map[string]any{"error": "Forbidden", "request_id": requestID})
 		return
 	}
 
+	if h.missingTenant(auth) {
+		statusCode = http.StatusForbidden
+		h.writeJSON(w, statusCode, map[string]any{"error": "Tenant required", "code": "tenant_required", "request_id": requestID})
+		return
+	}
+
+	if !h.coreSupportsPath(r.URL.Path) {
+		statusCode = http.StatusNotImplemented
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Core does not support this endpoint", "code": "core_unsupported", "path": r.URL.Path, "request_id": requestID},
+		)
+		return
+	}
+
+	releaseSubjectSlot, ok := h.acquireSubjectSlot(auth)
+	if !ok {
+		atomic.AddUint64(&h.rateLimitedTotal, 1)
+		statusCode = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", "1")
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Too many concurrent requests", "code": "subject_concurrency_limited", "request_id": requestID},
+		)
+		return
+	}
+	defer releaseSubjectSlot()
+
 	if isRawForwardPath(r.URL.Path) {
 		if r.Method != http.MethodGet {
 			statusCode = http.StatusMethodNotAllowed
 			h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
 			return
 		}
-		rawStatus, rawContentType, rawBody := h.forwardRaw(r, requestID)
+		rawStatus, rawHeaders, rawContentType, rawBody, rawTrailers := h.forwardRaw(r, requestID, auth)
 		statusCode = rawStatus
+		if debug != nil {
+			debug.coreStatus = rawStatus
+		}
 		if rawStatus >= 500 {
 			atomic.AddUint64(&h.upstreamErrorsTotal, 1)
 		}
-		h.writeRaw(w, rawStatus, rawContentType, rawBody)
+		copyResponseHeaders(w.Header(), rawHeaders)
+		h.writeRaw(w, rawStatus, rawContentType, rawBody, rawTrailers)
 		return
 	}
 
-	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+	if !h.allowsMethod(r.Method, r.URL.Path) {
 		statusCode = http.StatusMethodNotAllowed
 		h.writeJSON(w, statusCode, map[string]any{"error": "Method not allowed", "request_id": requestID})
 		return
@@ -480,18 +1388,134 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	body, err := h.readBody(r)
 	if err != nil {
-		statusCode = http.StatusBadRequest
+		statusCode = readBodyErrorStatus(err)
 		h.writeJSON(w, statusCode, map[string]any{"error": err.Error(), "request_id": requestID})
 		return
 	}
+	if action, ok := h.allowsBrowserActionBody(r.Method, r.URL.Path, body); !ok {
+		statusCode = http.StatusForbidden
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Browser action not allowed", "code": "browser_action_not_allowed", "action": action, "request_id": requestID},
+		)
+		return
+	}
+	if command, ok := h.allowsTerminalCommandBody(r.Method, r.URL.Path, body); !ok {
+		statusCode = http.StatusForbidden
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{"error": "Terminal command not allowed", "code": "terminal_command_not_allowed", "command": command, "request_id": requestID},
+		)
+		return
+	}
 
-	statusCode, payload := h.forward(r, requestID, body)
+	if isTerminalStartRequest(r.Method, r.URL.Path) && h.terminalSessionLimitReached(auth, time.Now()) {
+		statusCode = http.StatusTooManyRequests
+		h.writeJSON(
+			w,
+			statusCode,
+			map[string]any{
+				"error":      "Terminal session limit reached",
+				"code":       "terminal_session_limit",
+				"limit":      h.cfg.MaxTerminalSessionsPerSubject,
+				"request_id": requestID,
+			},
+		)
+		return
+	}
+
+	statusCode, coreHeaders, payload := h.forward(r, requestID, body, auth)
+	if debug != nil {
+		debug.coreStatus = statusCode
+	}
+	h.trackTerminalRequest(r, auth, statusCode, payload)
 	if statusCode >= 500 {
 		atomic.AddUint64(&h.upstreamErrorsTotal, 1)
 	}
+	copyResponseHeaders(w.Header(), coreHeaders)
+	if isRedirectStatus(statusCode) {
+		if obj, ok := payload.(map[string]any); ok {
+			if location := toString(obj["location"]); location != "" {
+				w.Header().Set("Location", location)
+			}
+		}
+	}
 	h.writeJSON(w, statusCode, payload)
 }
 
+// requestLogEntry is the LogJSON form of a request log line.
+type requestLogEntry struct {
+	Msg        string  `json:"msg"`
+	ID         string  `json:"id"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Route      string  `json:"route,omitempty"`
+	Status     int     `json:"status"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// logRequest writes the per-request log line, as key=value text or, with LogJSON,
+// a JSON object.
+func (h *Handler) logRequest(r *http.Request, requestID string, route string, statusCode int, started time.Time) {
+	durationMS := float64(time.Since(started).Microseconds()) / 1000.0
+	if h.cfg.DisableLogRouteTemplate {
+		route = ""
+	}
+	if h.cfg.LogJSON {
+		encoded, err := json.Marshal(requestLogEntry{
+			Msg:        "bridge request",
+			ID:         requestID,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Route:      route,
+			Status:     statusCode,
+			DurationMS: math.Round(durationMS*100) / 100,
+		})
+		if err == nil {
+			h.cfg.Logger.Print(string(encoded))
+			return
+		}
+	}
+	if route != "" {
+		h.cfg.Logger.Printf(
+			"bridge request id=%s method=%s path=%s route=%s status=%d duration_ms=%.2f",
+			requestID,
+			r.Method,
+			r.URL.Path,
+			route,
+			statusCode,
+			durationMS,
+		)
+		return
+	}
+	h.cfg.Logger.Printf(
+		"bridge request id=%s method=%s path=%s status=%d duration_ms=%.2f",
+		requestID,
+		r.Method,
+		r.URL.Path,
+		statusCode,
+		durationMS,
+	)
+}
+
+// shouldLogRequest applies LogSampleRate to successful responses; errors and
+// denials are always logged.
+func (h *Handler) shouldLogRequest(statusCode int) bool {
+	if !h.cfg.LogRequests {
+		return false
+	}
+	rate := h.cfg.LogSampleRate
+	if statusCode >= 400 || rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return h.logSample() < rate
+}
+
 func (h *Handler) healthPayload(requestID string, deep bool) (int, any) {
 	payload := map[string]any{
 		"ok":         true,
@@ -499,17 +1523,26 @@ func (h *Handler) healthPayload(requestID string, deep bool) (int, any) {
 		"request_id": requestID,
 	}
 	payload["bridge"] = h.bridgeHealthSnapshot()
+	maintenance := h.maintenanceSnapshot()
+	payload["maintenance"] = map[string]any{
+		"enabled":     maintenance.Enabled,
+		"message":     maintenance.Message,
+		"retry_after": maintenance.RetryAfter,
+	}
 	if !deep {
 		return http.StatusOK, payload
 	}
 
-	target, err := joinURL(h.cfg.CoreBaseURL, "/health", "")
+	replica := h.cores.pick(time.Now())
+	target, err := joinURL(replica.baseURL, "/health", "")
 	if err != nil {
 		payload["ok"] = false
 		payload["core"] = map[string]any{"reachable": false, "error": "invalid core URL"}
 		return http.StatusBadGateway, payload
 	}
-	req, err := http.NewRequest(http.MethodGet, target, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.HealthProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
 		payload["ok"] = false
 		payload["core"] = map[string]any{"reachable": false, "error": "failed to create request"}
@@ -518,7 +1551,7 @@ func (h *Handler) healthPayload(requestID string, deep bool) (int, any) {
 	if strings.TrimSpace(h.cfg.CoreToken) != "" {
 		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
 	}
-	resp, err := h.client.Do(req)
+	resp, err := h.doCore(req, replica)
 	if err != nil {
 		payload["ok"] = false
 		payload["core"] = map[string]any{"reachable": false, "error": err.Error()}
@@ -530,6 +1563,7 @@ func (h *Handler) healthPayload(requestID string, deep bool) (int, any) {
 		"reachable": resp.StatusCode < 500,
 		"status":    resp.StatusCode,
 		"healthy":   coreHealthy,
+		"url":       replica.baseURL,
 	}
 	if !coreHealthy {
 		payload["ok"] = false
@@ -539,27 +1573,34 @@ func (h *Handler) healthPayload(requestID string, deep bool) (int, any) {
 }
 
 func (h *Handler) bridgeHealthSnapshot() map[string]any {
-	h.revokedSessionsMu.RLock()
-	revokedCount := len(h.revokedSessions)
-	h.revokedSessionsMu.RUnlock()
+	revokedCount := h.revocations.Prune(time.Now().Unix())
 
 	h.rateLimitMu.Lock()
 	trackedClients := len(h.rateLimiters)
 	h.rateLimitMu.Unlock()
 	allowedDeviceCount := h.allowedDeviceCount()
+	cacheEntries, _, _, _ := h.cache.stats()
 
 	return map[string]any{
+		"cache_enabled":            h.cache.enabled(),
+		"cache_entries":            cacheEntries,
+		"auth_mode":                authModeFor(h.cfg),
 		"rate_limit_rps":           h.cfg.RateLimitRPS,
 		"rate_limit_burst":         h.cfg.RateLimitBurst,
 		"rate_limit_clients":       trackedClients,
+		"rate_limit_penalized":     h.penalizedClientCount(time.Now()),
 		"ws_max_connections":       h.cfg.MaxWSConnections,
 		"ws_active_connections":    atomic.LoadInt64(&h.wsActiveConnections),
+		"ws_tickets_pending":       h.wsTicketCount(),
 		"revoked_sessions":         revokedCount,
 		"revocation_store_path":    strings.TrimSpace(h.cfg.RevocationStorePath),
-		"core_tls_enabled":         strings.HasPrefix(strings.ToLower(strings.TrimSpace(h.cfg.CoreBaseURL)), "https://"),
-		"core_mtls_enabled":        strings.TrimSpace(h.cfg.CoreClientCertFile) != "",
+		"session_index_path":       strings.TrimSpace(h.cfg.SessionIndexPath),
+		"core_tls_enabled":         h.cores.anyTLS(),
+		"core_replicas":            h.cores.snapshot(time.Now()),
+		"core_mtls_enabled":        strings.TrimSpace(h.cfg.CoreClientCertFile) != "" || strings.TrimSpace(h.cfg.CoreClientCertPEM) != "",
 		"device_allowlist_count":   allowedDeviceCount,
 		"device_allowlist_enabled": allowedDeviceCount > 0,
+		"core_retry_budget":        h.coreRetryBudgetSnapshot(),
 	}
 }
 
@@ -753,8 +1794,28 @@ func isRawForwardPath(p string) bool {
 	return strings.HasPrefix(p, "/plans/") && strings.HasSuffix(p, "/stream")
 }
 
+// isPutForwardPath reports whether p accepts idempotent create-or-replace PUTs.
+func isPutForwardPath(p string) bool {
+	if !strings.HasPrefix(p, "/plans/") {
+		return false
+	}
+	id := strings.TrimSpace(strings.TrimPrefix(p, "/plans/"))
+	return id != "" && !strings.Contains(id, "/")
+}
+
+// errRequestBodyTooLarge is returned by readBody for bodies over maxRequestBodyBytes.
+var errRequestBodyTooLarge = errors.New("request body too large")
+
+// readBodyErrorStatus maps a readBody error to 413 for oversized bodies and 400 otherwise.
+func readBodyErrorStatus(err error) int {
+	if errors.Is(err, errRequestBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
 func (h *Handler) readBody(r *http.Request) ([]byte, error) {
-	if r.Method != http.MethodPost {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
 		return nil, nil
 	}
 	if r.Body == nil {
@@ -766,35 +1827,94 @@ func (h *Handler) readBody(r *http.Request) ([]byte, error) {
 		return nil, fmt.Errorf("failed to read request body")
 	}
 	if len(raw) > maxRequestBodyBytes {
-		return nil, fmt.Errorf("request body too large")
+		atomic.AddUint64(&h.bodyTooLargeTotal, 1)
+		h.noteBodyTooLarge(r)
+		return nil, errRequestBodyTooLarge
 	}
 	if len(bytes.TrimSpace(raw)) == 0 {
 		return []byte("{}"), nil
 	}
 	var tmp map[string]any
 	if err := json.Unmarshal(raw, &tmp); err != nil {
+		atomic.AddUint64(&h.bodyBadJSONTotal, 1)
 		return nil, fmt.Errorf("request body must be valid JSON object")
 	}
 	return raw, nil
 }
 
-func (h *Handler) forward(r *http.Request, requestID string, body []byte) (int, any) {
-	target, err := joinURL(h.cfg.CoreBaseURL, r.URL.Path, r.URL.RawQuery)
+func (h *Handler) forward(r *http.Request, requestID string, body []byte, auth authContext) (int, http.Header, any) {
+	started := time.Now()
+	accept, err := h.coreAcceptHeader(r.Header.Get("X-Core-Version"))
+	if err != nil {
+		return http.StatusBadRequest, nil, map[string]any{"error": err.Error(), "request_id": requestID}
+	}
+	route := routeTemplate(r.URL.Path)
+	key := cacheKey(r.URL.Path, r.URL.RawQuery)
+	if accept != "" {
+		key += "#" + accept
+	}
+	if h.cfg.RequireTenant {
+		key += "@" + auth.Tenant
+	}
+	key += metadataCacheSuffix(auth)
+	key += h.identityCacheSuffix(auth)
+	cacheTTL := time.Duration(0)
+	if r.Method == http.MethodGet {
+		cacheTTL = h.cache.ttlFor(route)
+	}
+	if cacheTTL > 0 {
+		if entry, ok := h.cache.get(key, time.Now()); ok {
+			if payload, ok := decodeAnyJSON(entry.raw); ok {
+				header := entry.header.Clone()
+				h.appendBridgeTiming(header, started)
+				h.setEventsPageHeaders(r, entry.statusCode, header, payload)
+				return entry.statusCode, header, attachRequestID(payload, requestID)
+			}
+		}
+	}
+
+	if _, down := h.cores.unavailableFor(time.Now()); down && h.cfg.FallbackResponses[route] != nil {
+		if status, header, payload, ok := h.staleCacheResponse(r, key, cacheTTL, requestID, started); ok {
+			return status, header, payload
+		}
+		if status, header, payload, ok := h.fallbackResponse(r, route, requestID, started); ok {
+			return status, header, payload
+		}
+	}
+	replica := h.cores.pick(time.Now())
+	if wait := h.cores.backoffRemaining(replica, time.Now()); wait > 0 {
+		header, payload := coreRateLimitedPayload(wait, requestID)
+		return http.StatusTooManyRequests, header, payload
+	}
+	target, err := joinURL(replica.baseURL, r.URL.Path, r.URL.RawQuery)
 	if err != nil {
-		return http.StatusBadGateway, map[string]any{"error": "Failed to build core URL", "request_id": requestID}
+		return http.StatusBadGateway, nil, map[string]any{"error": "Failed to build core URL", "request_id": requestID}
 	}
 
 	var reqBody io.Reader
-	if r.Method == http.MethodPost {
-		reqBody = bytes.NewReader(body)
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		reqBody = bytes.NewReader(h.renameBodyFields(route, body))
 	}
 
-	req, err := http.NewRequest(r.Method, target, reqBody)
+	ctx := context.Background()
+	if timeout := h.cfg.RouteTimeouts[route]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, reqBody)
 	if err != nil {
-		return http.StatusBadGateway, map[string]any{"error": "Failed to create core request", "request_id": requestID}
+		return http.StatusBadGateway, nil, map[string]any{"error": "Failed to create core request", "request_id": requestID}
 	}
+	h.copyForwardedRequestHeaders(req.Header, r.Header)
+	h.setCoreTenantHeader(req.Header, auth)
+	setCoreMetadataHeaders(req.Header, auth)
+	h.setCoreIdentityHeaders(req.Header, auth)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Request-ID", requestID)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
 	if idem := strings.TrimSpace(r.Header.Get("Idempotency-Key")); idem != "" {
 		req.Header.Set("Idempotency-Key", idem)
 	}
@@ -802,58 +1922,163 @@ func (h *Handler) forward(r *http.Request, requestID string, body []byte) (int,
 		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
 	}
 
-	resp, err := h.client.Do(req)
+	resp, err := h.doCoreWithRetry(req, replica, r.URL.Path, r.URL.RawQuery)
 	if err != nil {
-		return http.StatusBadGateway, map[string]any{"error": fmt.Sprintf("Core API unreachable: %v", err), "request_id": requestID}
+		if status, header, payload, ok := h.staleCacheResponse(r, key, cacheTTL, requestID, started); ok {
+			return status, header, payload
+		}
+		if status, header, payload, ok := h.fallbackResponse(r, route, requestID, started); ok {
+			return status, header, payload
+		}
+		return http.StatusBadGateway, nil, map[string]any{"error": fmt.Sprintf("Core API unreachable: %v", err), "request_id": requestID}
 	}
 	defer resp.Body.Close()
 
 	raw, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return http.StatusBadGateway, map[string]any{"error": "Failed to read core response", "request_id": requestID}
+		if status, header, payload, ok := h.staleCacheResponse(r, key, cacheTTL, requestID, started); ok {
+			return status, header, payload
+		}
+		return http.StatusBadGateway, nil, map[string]any{"error": "Failed to read core response", "request_id": requestID}
+	}
+	if resp.StatusCode >= 500 {
+		if status, header, payload, ok := h.staleCacheResponse(r, key, cacheTTL, requestID, started); ok {
+			return status, header, payload
+		}
+	}
+	if isRedirectStatus(resp.StatusCode) {
+		status, redirectPayload := h.coreRedirectPayload(resp, requestID)
+		return status, nil, redirectPayload
+	}
+	header := h.clientResponseHeaders(resp.Header)
+	h.relayEventsTotalCount(r, header, resp.Header)
+	if cacheTTL > 0 {
+		// A cookie set for one caller must never be replayed to others from the cache.
+		header.Del("Set-Cookie")
+	}
+	h.recordIdempotencyReplay(resp.Header)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		h.noteCoreRateLimited(replica, resp.Header, time.Now())
+		// Clients must see core's Retry-After even if it is otherwise stripped.
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			header.Set("Retry-After", retryAfter)
+		}
+	}
+	statusCode, raw, err := h.transformResponse(r.URL.Path, resp.StatusCode, raw)
+	if err != nil {
+		h.cfg.Logger.Printf("WARN bridge response transform failed id=%s path=%s: %v", requestID, r.URL.Path, err)
+		return http.StatusBadGateway, nil, map[string]any{
+			"error":      "Response transform failed",
+			"code":       "response_transform_failed",
+			"request_id": requestID,
+		}
 	}
 
 	payload, ok := decodeAnyJSON(raw)
 	if !ok {
+		if h.rejectsInvalidCoreJSON(statusCode) {
+			return http.StatusBadGateway, nil, invalidCoreJSONPayload(statusCode, requestID)
+		}
 		payload = map[string]any{"raw": string(raw), "request_id": requestID}
 	} else {
 		payload = attachRequestID(payload, requestID)
+		payload = h.normalizeValidationError(route, statusCode, payload, requestID)
+	}
+	if statusCode < 200 || statusCode >= 300 {
+		payload = h.attachCoreStatus(payload, resp)
 	}
 
-	return resp.StatusCode, payload
+	if statusCode >= 200 && statusCode < 300 {
+		if cacheTTL > 0 && ok {
+			h.cache.put(key, route, statusCode, header, raw, cacheTTL, time.Now())
+		}
+		if r.Method != http.MethodGet {
+			h.cache.invalidateFor(route)
+		}
+	}
+
+	h.appendBridgeTiming(header, started)
+	h.setEventsPageHeaders(r, statusCode, header, payload)
+	return statusCode, header, payload
 }
 
-func (h *Handler) forwardRaw(r *http.Request, requestID string) (int, string, []byte) {
-	target, err := joinURL(h.cfg.CoreBaseURL, r.URL.Path, r.URL.RawQuery)
+func (h *Handler) forwardRaw(r *http.Request, requestID string, auth authContext) (int, http.Header, string, []byte, http.Header) {
+	started := time.Now()
+	replica := h.cores.pick(time.Now())
+	target, err := joinURL(replica.baseURL, r.URL.Path, r.URL.RawQuery)
 	if err != nil {
 		payload, _ := json.Marshal(map[string]any{"error": "Failed to build core URL", "request_id": requestID})
-		return http.StatusBadGateway, "application/json", payload
+		return http.StatusBadGateway, nil, "application/json", payload, nil
 	}
 	req, err := http.NewRequest(http.MethodGet, target, nil)
 	if err != nil {
 		payload, _ := json.Marshal(map[string]any{"error": "Failed to create core request", "request_id": requestID})
-		return http.StatusBadGateway, "application/json", payload
+		return http.StatusBadGateway, nil, "application/json", payload, nil
 	}
+	h.copyForwardedRequestHeaders(req.Header, r.Header)
+	h.setCoreTenantHeader(req.Header, auth)
+	setCoreMetadataHeaders(req.Header, auth)
+	h.setCoreIdentityHeaders(req.Header, auth)
 	req.Header.Set("X-Request-ID", requestID)
 	if strings.TrimSpace(h.cfg.CoreToken) != "" {
 		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
 	}
-	resp, err := h.client.Do(req)
+	resp, err := h.doCore(req, replica)
 	if err != nil {
 		payload, _ := json.Marshal(map[string]any{"error": fmt.Sprintf("Core API unreachable: %v", err), "request_id": requestID})
-		return http.StatusBadGateway, "application/json", payload
+		return http.StatusBadGateway, nil, "application/json", payload, nil
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		payload, _ := json.Marshal(map[string]any{"error": "Failed to read core response", "request_id": requestID})
-		return http.StatusBadGateway, "application/json", payload
+		return http.StatusBadGateway, nil, "application/json", payload, nil
+	}
+	if isRedirectStatus(resp.StatusCode) {
+		status, redirectPayload := h.coreRedirectPayload(resp, requestID)
+		payload, _ := json.Marshal(redirectPayload)
+		return status, nil, "application/json", payload, nil
 	}
 	contentType := resp.Header.Get("Content-Type")
 	if contentType == "" {
 		contentType = "text/html; charset=utf-8"
 	}
-	return resp.StatusCode, contentType, body
+	header := h.clientResponseHeaders(resp.Header)
+	h.appendBridgeTiming(header, started)
+	return resp.StatusCode, header, contentType, body, streamTrailers(r.URL.Path, resp.Trailer)
+}
+
+func isRedirectStatus(status int) bool {
+	return status >= 300 && status < 400 && status != http.StatusNotModified
+}
+
+// coreRedirectPayload maps an unfollowed core redirect to the client-facing status and payload.
+func (h *Handler) coreRedirectPayload(resp *http.Response, requestID string) (int, map[string]any) {
+	location := strings.TrimSpace(resp.Header.Get("Location"))
+	if h.cfg.CoreRedirectPolicy == CoreRedirectPassthrough {
+		return resp.StatusCode, map[string]any{"location": location, "request_id": requestID}
+	}
+	return http.StatusBadGateway, map[string]any{
+		"error":       "Core API returned a redirect",
+		"core_status": resp.StatusCode,
+		"location":    location,
+		"request_id":  requestID,
+	}
+}
+
+// coreCheckRedirect never follows redirects unless policy allows same-host hops;
+// the last 3xx response is returned to the caller instead.
+func coreCheckRedirect(policy string) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if policy != CoreRedirectSameHost || len(via) == 0 || len(via) >= 10 {
+			return http.ErrUseLastResponse
+		}
+		origin := via[0].URL
+		if !strings.EqualFold(req.URL.Scheme, origin.Scheme) || !strings.EqualFold(req.URL.Host, origin.Host) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
 }
 
 func joinURL(base, requestPath, rawQuery string) (string, error) {
@@ -866,17 +2091,47 @@ func joinURL(base, requestPath, rawQuery string) (string, error) {
 	return u.String(), nil
 }
 
+// decodeAnyJSON decodes core JSON keeping numbers as json.Number so large
+// integer ids (beyond 2^53) survive the round-trip to clients unchanged.
 func decodeAnyJSON(raw []byte) (any, bool) {
 	if len(bytes.TrimSpace(raw)) == 0 {
 		return map[string]any{}, true
 	}
-	var payload any
-	if err := json.Unmarshal(raw, &payload); err != nil {
+	payload, err := unmarshalUseNumber(raw)
+	if err != nil {
 		return nil, false
 	}
 	return payload, true
 }
 
+func unmarshalUseNumber(raw []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var payload any
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected trailing data after JSON value")
+	}
+	return payload, nil
+}
+
+// rejectsInvalidCoreJSON reports whether an undecodable core body with status must
+// become a 502 instead of the {"raw": ...} wrapper.
+func (h *Handler) rejectsInvalidCoreJSON(status int) bool {
+	return h.cfg.StrictCoreJSON && status >= 200 && status < 300
+}
+
+func invalidCoreJSONPayload(coreStatus int, requestID string) map[string]any {
+	return map[string]any{
+		"error":       "Core API returned invalid JSON",
+		"code":        "core_invalid_json",
+		"core_status": coreStatus,
+		"request_id":  requestID,
+	}
+}
+
 func attachRequestID(payload any, requestID string) any {
 	if obj, ok := payload.(map[string]any); ok {
 		if _, exists := obj["request_id"]; !exists {
@@ -887,6 +2142,18 @@ func attachRequestID(payload any, requestID string) any {
 	return payload
 }
 
+// missingClientRequestID reports whether Config.RequireClientRequestID rejects r.
+func (h *Handler) missingClientRequestID(r *http.Request) bool {
+	if !h.cfg.RequireClientRequestID {
+		return false
+	}
+	switch r.URL.Path {
+	case "/health", "/metrics", "/ws":
+		return false
+	}
+	return strings.TrimSpace(r.Header.Get("X-Request-ID")) == ""
+}
+
 func normalizeRequestID(current string) string {
 	id := strings.TrimSpace(current)
 	if id != "" {
@@ -909,10 +2176,13 @@ func (h *Handler) applyCORSHeaders(w http.ResponseWriter, r *http.Request) corsS
 	}
 	w.Header().Set("Vary", "Origin")
 	w.Header().Set("Access-Control-Allow-Origin", origin)
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Device-ID, X-Request-ID, Idempotency-Key")
-	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotency-Key, X-Idempotency-Replayed")
-	w.Header().Set("Access-Control-Max-Age", "600")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-Device-ID, X-Request-ID, Idempotency-Key, X-Core-Version, X-CSRF-Token")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotency-Key, X-Idempotency-Replayed, X-Bridge-Fallback, X-Bridge-Load, X-Bridge-Client-IP")
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(h.cfg.CORSMaxAge/time.Second)))
+	if h.cfg.CORSAllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
 	return corsAllowed
 }
 
@@ -927,6 +2197,24 @@ func (h *Handler) isOriginAllowed(r *http.Request, origin string) bool {
 	return ok
 }
 
+// isHostAllowed checks host against Config.AllowedHosts, matching either the exact
+// host:port or the bare hostname.
+func (h *Handler) isHostAllowed(host string) bool {
+	if len(h.allowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(strings.TrimSpace(host))
+	if _, ok := h.allowedHosts[host]; ok {
+		return true
+	}
+	hostname := host
+	if split, _, err := net.SplitHostPort(host); err == nil {
+		hostname = split
+	}
+	_, ok := h.allowedHosts[strings.Trim(hostname, "[]")]
+	return ok
+}
+
 func isSameOrigin(r *http.Request, origin string, scheme string) bool {
 	expectedOrigin := scheme + "://" + r.Host
 	return canonicalOrigin(origin) == canonicalOrigin(expectedOrigin)
@@ -1009,38 +2297,63 @@ func buildCoreHTTPClient(cfg Config, coreTLS bool) (*http.Client, error) {
 	caFile := strings.TrimSpace(cfg.CoreCAFile)
 	clientCertFile := strings.TrimSpace(cfg.CoreClientCertFile)
 	clientKeyFile := strings.TrimSpace(cfg.CoreClientKeyFile)
+	caPEM := strings.TrimSpace(cfg.CoreCAPEM)
+	clientCertPEM := strings.TrimSpace(cfg.CoreClientCertPEM)
+	clientKeyPEM := strings.TrimSpace(cfg.CoreClientKeyPEM)
 	serverName := strings.TrimSpace(cfg.CoreTLSServerName)
 
 	if (clientCertFile == "") != (clientKeyFile == "") {
 		return nil, fmt.Errorf("both core client cert and key files must be provided together")
 	}
-	useCustomTLS := coreTLS || caFile != "" || clientCertFile != "" || serverName != "" || cfg.CoreTLSInsecureSkipVerify
+	if (clientCertPEM == "") != (clientKeyPEM == "") {
+		return nil, fmt.Errorf("both core client cert and key PEM must be provided together")
+	}
+	minVersion, err := parseCoreTLSMinVersion(cfg.CoreTLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseCoreTLSCipherSuites(cfg.CoreTLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	useCustomTLS := coreTLS || caFile != "" || clientCertFile != "" || caPEM != "" || clientCertPEM != "" ||
+		serverName != "" || cfg.CoreTLSInsecureSkipVerify
 	if !useCustomTLS {
-		return &http.Client{Timeout: cfg.Timeout}, nil
+		return newCoreHTTPClient(cfg, nil), nil
 	}
 
 	tlsConfig := &tls.Config{
-		MinVersion:         tls.VersionTLS12,
+		MinVersion:         minVersion,
+		CipherSuites:       cipherSuites,
 		InsecureSkipVerify: cfg.CoreTLSInsecureSkipVerify,
 	}
 	if serverName != "" {
 		tlsConfig.ServerName = serverName
 	}
-	if caFile != "" {
+	if caPEM != "" {
+		roots, err := coreRootCAs([]byte(caPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse core CA PEM")
+		}
+		tlsConfig.RootCAs = roots
+	} else if caFile != "" {
 		pemBytes, err := os.ReadFile(caFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read core CA file: %w", err)
 		}
-		roots, err := x509.SystemCertPool()
-		if err != nil || roots == nil {
-			roots = x509.NewCertPool()
-		}
-		if ok := roots.AppendCertsFromPEM(pemBytes); !ok {
+		roots, err := coreRootCAs(pemBytes)
+		if err != nil {
 			return nil, fmt.Errorf("failed to parse core CA file")
 		}
 		tlsConfig.RootCAs = roots
 	}
-	if clientCertFile != "" && clientKeyFile != "" {
+	if clientCertPEM != "" && clientKeyPEM != "" {
+		clientCert, err := tls.X509KeyPair([]byte(clientCertPEM), []byte(clientKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse core client certificate PEM: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
+	} else if clientCertFile != "" && clientKeyFile != "" {
 		clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load core client certificate: %w", err)
@@ -1048,6 +2361,24 @@ func buildCoreHTTPClient(cfg Config, coreTLS bool) (*http.Client, error) {
 		tlsConfig.Certificates = []tls.Certificate{clientCert}
 	}
 
+	return newCoreHTTPClient(cfg, tlsConfig), nil
+}
+
+// coreRootCAs returns the system roots plus the certificates in pemBytes.
+func coreRootCAs(pemBytes []byte) (*x509.CertPool, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		roots = x509.NewCertPool()
+	}
+	if ok := roots.AppendCertsFromPEM(pemBytes); !ok {
+		return nil, fmt.Errorf("no certificates found in PEM")
+	}
+	return roots, nil
+}
+
+// newCoreHTTPClient builds the bridge->core client with an explicit pooled transport
+// so HTTP and HTTPS cores share the same connection limits.
+func newCoreHTTPClient(cfg Config, tlsConfig *tls.Config) *http.Client {
 	transport := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -1055,16 +2386,19 @@ func buildCoreHTTPClient(cfg Config, coreTLS bool) (*http.Client, error) {
 			KeepAlive: 30 * time.Second,
 		}).DialContext,
 		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
+		MaxIdleConns:          cfg.CoreMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.CoreMaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.CoreMaxConnsPerHost,
 		IdleConnTimeout:       90 * time.Second,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
 		TLSClientConfig:       tlsConfig,
 	}
 	return &http.Client{
-		Timeout:   cfg.Timeout,
-		Transport: transport,
-	}, nil
+		Timeout:       cfg.Timeout,
+		Transport:     transport,
+		CheckRedirect: coreCheckRedirect(cfg.CoreRedirectPolicy),
+	}
 }
 
 func (h *Handler) clientRateKey(r *http.Request) string {
@@ -1090,8 +2424,27 @@ func (h *Handler) clientRateKey(r *http.Request) string {
 	return ""
 }
 
+// canonicalOrigin normalizes an origin for comparison: lower-cased scheme and host,
+// default ports dropped, and IPv6 literals in their canonical bracketed form (so
+// http://[0:0:0:0:0:0:0:1]:9797 equals http://[::1]:9797).
 func canonicalOrigin(origin string) string {
-	return strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+	trimmed := strings.TrimRight(strings.ToLower(strings.TrimSpace(origin)), "/")
+	parsed, err := url.Parse(trimmed)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return trimmed
+	}
+	hostname := parsed.Hostname()
+	if ip := net.ParseIP(hostname); ip != nil && strings.Contains(hostname, ":") {
+		hostname = "[" + ip.String() + "]"
+	}
+	port := parsed.Port()
+	if (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port == "" {
+		return parsed.Scheme + "://" + hostname
+	}
+	return parsed.Scheme + "://" + hostname + ":" + port
 }
 
 func (h *Handler) publicBridgeURLs(r *http.Request) (string, string) {
@@ -1120,6 +2473,10 @@ func (h *Handler) isRateLimited(r *http.Request, now time.Time) bool {
 	if key == "" {
 		key = "unknown"
 	}
+	overrideRPS := 0.0
+	if tokenKey, rps, ok := h.tokenRateLimit(r, now); ok {
+		key, overrideRPS = tokenKey, rps
+	}
 
 	h.rateLimitMu.Lock()
 	defer h.rateLimitMu.Unlock()
@@ -1130,15 +2487,43 @@ func (h *Handler) isRateLimited(r *http.Request, now time.Time) bool {
 		}
 	}
 
+	penalized := false
+	if h.penaltyBoxEnabled() {
+		h.prunePenaltiesLocked(now)
+		penalized = h.isPenalizedLocked(key, now)
+	}
+
 	entry, ok := h.rateLimiters[key]
 	if !ok {
+		limit, burst := h.clientRateLimit(penalized, overrideRPS)
 		entry = &clientLimiter{
-			limiter: rate.NewLimiter(rate.Limit(h.cfg.RateLimitRPS), max(1, h.cfg.RateLimitBurst)),
+			limiter:   rate.NewLimiter(limit, burst),
+			penalized: penalized,
 		}
 		h.rateLimiters[key] = entry
+	} else if entry.penalized != penalized {
+		limit, burst := h.clientRateLimit(penalized, overrideRPS)
+		entry.limiter.SetLimitAt(now, limit)
+		entry.limiter.SetBurstAt(now, burst)
+		entry.penalized = penalized
 	}
 	entry.lastSeen = now
-	return !entry.limiter.Allow()
+	allowed := entry.limiter.AllowN(now, 1)
+	if !allowed && !entry.limited && h.penaltyBoxEnabled() {
+		h.recordRateLimitStrikeLocked(key, entry, now)
+	}
+	entry.limited = !allowed
+	return !allowed
+}
+
+// flushRateLimiters drops all tracked per-client limiter state and returns the number of clients flushed.
+func (h *Handler) flushRateLimiters() int {
+	h.rateLimitMu.Lock()
+	defer h.rateLimitMu.Unlock()
+	flushed := len(h.rateLimiters)
+	h.rateLimiters = make(map[string]*clientLimiter)
+	h.penalties = make(map[string]*ratePenalty)
+	return flushed
 }
 
 func (h *Handler) writeJSON(w http.ResponseWriter, status int, payload any) {
@@ -1155,8 +2540,52 @@ func (h *Handler) writeJSONWithStatus(w http.ResponseWriter, status int, payload
 	if unauthorized {
 		w.Header().Set("WWW-Authenticate", "Bearer")
 	}
-	w.WriteHeader(status)
-	_, _ = w.Write(encoded)
+	h.writeBody(w, status, encoded)
+}
+
+func (h *Handler) recordRouteRequest(route string) {
+	h.routeRequestsMu.Lock()
+	h.routeRequests[route]++
+	h.routeRequestsMu.Unlock()
+}
+
+func (h *Handler) routeRequestsMetrics() string {
+	h.routeRequestsMu.Lock()
+	routes := make([]string, 0, len(h.routeRequests))
+	for route := range h.routeRequests {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	var b strings.Builder
+	for _, route := range routes {
+		fmt.Fprintf(&b, "novaadapt_bridge_route_requests_total{route=%q} %d\n", route, h.routeRequests[route])
+	}
+	h.routeRequestsMu.Unlock()
+	return b.String()
+}
+
+func (h *Handler) recordAuthFailure(reason string) {
+	if reason == "" {
+		reason = authFailureBadFormat
+	}
+	h.authFailuresMu.Lock()
+	h.authFailures[reason]++
+	h.authFailuresMu.Unlock()
+}
+
+func (h *Handler) authFailuresMetrics() string {
+	h.authFailuresMu.Lock()
+	reasons := make([]string, 0, len(h.authFailures))
+	for reason := range h.authFailures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	var b strings.Builder
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "novaadapt_bridge_auth_failures_total{reason=%q} %d\n", reason, h.authFailures[reason])
+	}
+	h.authFailuresMu.Unlock()
+	return b.String()
 }
 
 func (h *Handler) writeMetrics(w http.ResponseWriter) {
@@ -1168,6 +2597,8 @@ func (h *Handler) writeMetrics(w http.ResponseWriter) {
 			"novaadapt_bridge_session_issued_total %d\n"+
 			"novaadapt_bridge_session_revoked_total %d\n"+
 			"novaadapt_bridge_ws_rejected_total %d\n"+
+			"novaadapt_bridge_ws_frames_dropped_total %d\n"+
+			"novaadapt_bridge_ws_pump_errors_total %d\n"+
 			"novaadapt_bridge_ws_active_connections %d\n"+
 			"novaadapt_bridge_device_allowlist_count %d\n"+
 			"novaadapt_bridge_upstream_errors_total %d\n",
@@ -1177,16 +2608,55 @@ func (h *Handler) writeMetrics(w http.ResponseWriter) {
 		atomic.LoadUint64(&h.sessionIssuedTotal),
 		atomic.LoadUint64(&h.sessionRevokedTotal),
 		atomic.LoadUint64(&h.wsRejectedTotal),
+		atomic.LoadUint64(&h.wsDroppedTotal),
+		atomic.LoadUint64(&h.wsPumpErrorsTotal),
 		atomic.LoadInt64(&h.wsActiveConnections),
 		allowedDeviceCount,
 		atomic.LoadUint64(&h.upstreamErrorsTotal),
 	)
+	_, cacheHits, cacheMisses, cacheEvicted := h.cache.stats()
+	body += fmt.Sprintf(
+		"novaadapt_bridge_cache_hits_total %d\n"+
+			"novaadapt_bridge_cache_misses_total %d\n"+
+			"novaadapt_bridge_cache_evictions_total %d\n",
+		cacheHits,
+		cacheMisses,
+		cacheEvicted,
+	)
+	body += h.routeRequestsMetrics()
+	body += h.authFailuresMetrics()
+	body += h.bodyTooLargeMetrics()
+	body += fmt.Sprintf(
+		"novaadapt_bridge_core_retries_total %d\n"+
+			"novaadapt_bridge_core_retry_budget_exhausted_total %d\n",
+		atomic.LoadUint64(&h.coreRetriesTotal),
+		atomic.LoadUint64(&h.retriesDeniedTotal),
+	)
+	body += fmt.Sprintf(
+		"novaadapt_bridge_body_rejected_total{reason=\"too_large\"} %d\n"+
+			"novaadapt_bridge_body_rejected_total{reason=\"invalid_json\"} %d\n",
+		atomic.LoadUint64(&h.bodyTooLargeTotal),
+		atomic.LoadUint64(&h.bodyBadJSONTotal),
+	)
+	body += fmt.Sprintf(
+		"novaadapt_bridge_idempotency_replays_total %d\n"+
+			"novaadapt_bridge_core_rate_limited_total %d\n",
+		atomic.LoadUint64(&h.idempotencyReplays),
+		atomic.LoadUint64(&h.coreRateLimited),
+	)
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
 	_, _ = w.Write([]byte(body))
 }
 
-func (h *Handler) writeRaw(w http.ResponseWriter, status int, contentType string, body []byte) {
+// writeRaw writes body and then any trailers, which are announced up front in the
+// Trailer header.
+func (h *Handler) writeRaw(w http.ResponseWriter, status int, contentType string, body []byte, trailers http.Header) {
 	w.Header().Set("Content-Type", contentType)
-	w.WriteHeader(status)
-	_, _ = w.Write(body)
+	for name := range trailers {
+		w.Header().Add("Trailer", name)
+	}
+	h.writeBody(w, status, body)
+	for name, values := range trailers {
+		w.Header()[name] = values
+	}
 }
@@ -1,12 +1,24 @@
 package relay
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/gorilla/websocket"
 )
 
 func TestHealthNoAuth(t *testing.T) {
@@ -108,6 +120,38 @@ func TestHealthDeepFailsOnCoreUnauthorized(t *testing.T) {
 	}
 }
 
+func TestHealthDeepUsesProbeTimeout(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(3 * time.Second):
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:        core.URL,
+		BridgeToken:        "secret",
+		Timeout:            10 * time.Second,
+		HealthProbeTimeout: 100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	started := time.Now()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health?deep=1", nil))
+	elapsed := time.Since(started)
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected 502 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if elapsed > time.Second {
+		t.Fatalf("expected deep health to fail within the probe timeout, took %s", elapsed)
+	}
+}
+
 func TestIsForwardedPathIncludesControlAnythingAndTemplates(t *testing.T) {
 	paths := []string{
 		"/agents/templates",
@@ -629,397 +673,3132 @@ func TestRejectLargeBody(t *testing.T) {
 	req.Header.Set("Authorization", "Bearer secret")
 	h.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusBadRequest {
-		t.Fatalf("expected 400 got %d body=%s", rr.Code, rr.Body.String())
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") != "" {
+		t.Fatalf("expected no Retry-After on 413, got %q", rr.Header().Get("Retry-After"))
 	}
-}
 
-func TestMetricsEndpoint(t *testing.T) {
-	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		switch r.URL.Path {
-		case "/models":
-			_, _ = w.Write([]byte(`[{"name":"local"}]`))
-		default:
-			w.WriteHeader(http.StatusNotFound)
-			_, _ = w.Write([]byte(`{"error":"not found"}`))
-		}
-	}))
-	defer core.Close()
+	rrInvalid := httptest.NewRecorder()
+	reqInvalid := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"payload":`))
+	reqInvalid.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrInvalid, reqInvalid)
+	if rrInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed JSON got %d body=%s", rrInvalid.Code, rrInvalid.Body.String())
+	}
+}
 
-	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+func TestBodyRejectionMetricsByReason(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret"})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
-	// Unauthorized request increments unauthorized counter.
-	rrUnauth := httptest.NewRecorder()
-	reqUnauth := httptest.NewRequest(http.MethodGet, "/models", nil)
-	h.ServeHTTP(rrUnauth, reqUnauth)
-	if rrUnauth.Code != http.StatusUnauthorized {
-		t.Fatalf("expected 401 got %d", rrUnauth.Code)
-	}
-
-	// Authorized request increments total counter.
-	rrAuth := httptest.NewRecorder()
-	reqAuth := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqAuth.Header.Set("Authorization", "Bearer secret")
-	h.ServeHTTP(rrAuth, reqAuth)
-	if rrAuth.Code != http.StatusOK {
-		t.Fatalf("expected 200 got %d", rrAuth.Code)
+	post := func(body string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
 	}
+	post(`{"payload":"` + strings.Repeat("a", maxRequestBodyBytes+5) + `"}`)
+	post(`{"payload":`)
+	post(`[1,2,3]`)
 
-	rrMetrics := httptest.NewRecorder()
-	reqMetrics := httptest.NewRequest(http.MethodGet, "/metrics", nil)
-	h.ServeHTTP(rrMetrics, reqMetrics)
-	if rrMetrics.Code != http.StatusOK {
-		t.Fatalf("expected 200 got %d", rrMetrics.Code)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	metrics := rr.Body.String()
+	if !strings.Contains(metrics, `novaadapt_bridge_body_rejected_total{reason="too_large"} 1`) {
+		t.Fatalf("expected too_large body rejection counter, got:\n%s", metrics)
 	}
-	metrics := rrMetrics.Body.String()
-	if !strings.Contains(metrics, "novaadapt_bridge_requests_total") {
-		t.Fatalf("expected requests metric, got: %s", metrics)
+	if !strings.Contains(metrics, `novaadapt_bridge_body_rejected_total{reason="invalid_json"} 2`) {
+		t.Fatalf("expected invalid_json body rejection counter, got:\n%s", metrics)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_unauthorized_total") {
-		t.Fatalf("expected unauthorized metric, got: %s", metrics)
+}
+
+func TestBodyTooLargeLoggedByPathClass(t *testing.T) {
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Logger: log.New(&logs, "", 0)})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_rate_limited_total") {
-		t.Fatalf("expected rate limited metric, got: %s", metrics)
+
+	oversized := `{"payload":"` + strings.Repeat("a", maxRequestBodyBytes+5) + `"}`
+	post := func(path string, knownLength bool) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(oversized))
+		req.Header.Set("Authorization", "Bearer secret")
+		if !knownLength {
+			req.ContentLength = -1
+		}
+		h.ServeHTTP(rr, req)
+		return rr.Code
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_session_issued_total") {
-		t.Fatalf("expected session issued metric, got: %s", metrics)
+	if code := post("/run", true); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", code)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_session_revoked_total") {
-		t.Fatalf("expected session revoked metric, got: %s", metrics)
+	if code := post("/plans/plan-1/approve", false); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", code)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_ws_rejected_total") {
-		t.Fatalf("expected ws rejected metric, got: %s", metrics)
+
+	logged := logs.String()
+	wantRun := "route=/run client=192.0.2.1 attempted_bytes=" + strconv.Itoa(len(oversized)) + " limit_bytes=" + strconv.Itoa(maxRequestBodyBytes)
+	if !strings.Contains(logged, wantRun) {
+		t.Fatalf("expected declared size in rejection log, got:\n%s", logged)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_ws_active_connections") {
-		t.Fatalf("expected ws active connections metric, got: %s", metrics)
+	if !strings.Contains(logged, "path=/plans/plan-1/approve route=/plans/{id}/approve client=192.0.2.1 attempted_bytes=>"+strconv.Itoa(maxRequestBodyBytes)) {
+		t.Fatalf("expected lower-bound size for unknown length in rejection log, got:\n%s", logged)
 	}
-	if !strings.Contains(metrics, "novaadapt_bridge_device_allowlist_count") {
-		t.Fatalf("expected device allowlist metric, got: %s", metrics)
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	metrics := rr.Body.String()
+	for _, want := range []string{
+		`novaadapt_bridge_body_rejected_total{reason="too_large",path_class="/run"} 1`,
+		`novaadapt_bridge_body_rejected_total{reason="too_large",path_class="/plans/{id}/approve"} 1`,
+		`novaadapt_bridge_body_too_large_total{path_class="/run"} 1`,
+		`novaadapt_bridge_body_too_large_total{path_class="/plans/{id}/approve"} 1`,
+		`novaadapt_bridge_body_rejected_total{reason="too_large"} 2`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Fatalf("expected %s in metrics, got:\n%s", want, metrics)
+		}
 	}
 }
 
-func TestDeviceAllowlist(t *testing.T) {
+func TestCoreRetryBudgetCapsRetries(t *testing.T) {
+	var coreCalls int32
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/models" {
-			_, _ = w.Write([]byte(`[{"name":"local"}]`))
-			return
-		}
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write([]byte(`{"error":"not found"}`))
+		atomic.AddInt32(&coreCalls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"error":"core down"}`))
 	}))
 	defer core.Close()
 
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:      core.URL,
-			BridgeToken:      "secret",
-			AllowedDeviceIDs: []string{"iphone-1", "halo-1"},
-			Timeout:          5 * time.Second,
-			LogRequests:      false,
-		},
-	)
+	h, err := NewHandler(Config{
+		CoreBaseURL:          core.URL,
+		BridgeToken:          "secret",
+		CoreRetryBudgetRPS:   0.001,
+		CoreRetryBudgetBurst: 2,
+		Timeout:              5 * time.Second,
+	})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
-	rrMissing := httptest.NewRecorder()
-	reqMissing := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqMissing.Header.Set("Authorization", "Bearer secret")
-	h.ServeHTTP(rrMissing, reqMissing)
-	if rrMissing.Code != http.StatusUnauthorized {
-		t.Fatalf("expected 401 for missing device id, got %d", rrMissing.Code)
+	for i := 0; i < 4; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Fatalf("expected core 503 to be relayed, got %d body=%s", rr.Code, rr.Body.String())
+		}
+	}
+	if calls := atomic.LoadInt32(&coreCalls); calls != 6 {
+		t.Fatalf("expected 4 requests plus 2 budgeted retries, got %d core calls", calls)
 	}
 
-	rrWrong := httptest.NewRecorder()
-	reqWrong := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqWrong.Header.Set("Authorization", "Bearer secret")
-	reqWrong.Header.Set("X-Device-ID", "unknown")
-	h.ServeHTTP(rrWrong, reqWrong)
-	if rrWrong.Code != http.StatusUnauthorized {
-		t.Fatalf("expected 401 for unknown device id, got %d", rrWrong.Code)
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"objective":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if calls := atomic.LoadInt32(&coreCalls); calls != 7 {
+		t.Fatalf("expected POST not to be retried, got %d core calls", calls)
 	}
 
-	rrAllowed := httptest.NewRecorder()
-	reqAllowed := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqAllowed.Header.Set("Authorization", "Bearer secret")
-	reqAllowed.Header.Set("X-Device-ID", "iphone-1")
-	h.ServeHTTP(rrAllowed, reqAllowed)
-	if rrAllowed.Code != http.StatusOK {
-		t.Fatalf("expected 200 for allowed device id, got %d body=%s", rrAllowed.Code, rrAllowed.Body.String())
+	budget := h.bridgeHealthSnapshot()["core_retry_budget"].(map[string]any)
+	if budget["enabled"] != true || budget["retries_total"] != uint64(2) || budget["denied_total"] != uint64(2) ||
+		budget["tokens_available"] != float64(0) {
+		t.Fatalf("unexpected retry budget health %#v", budget)
 	}
 }
 
-func TestCORSPreflightAllowedOrigin(t *testing.T) {
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:        "http://example.com",
-			BridgeToken:        "secret",
-			CORSAllowedOrigins: []string{"http://127.0.0.1:8088"},
-			Timeout:            5 * time.Second,
-		},
-	)
+func TestEventsPageLinkPointsAtHighestEventID(t *testing.T) {
+	var gotQuery string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", "57")
+		_, _ = w.Write([]byte(`[{"id":42,"category":"plan"},{"id":41,"category":"plan"},{"id":40,"category":"run"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", EventsPageLinks: true})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodOptions, "/auth/session", nil)
-	req.Host = "127.0.0.1:9797"
-	req.Header.Set("Origin", "http://127.0.0.1:8088")
-	req.Header.Set("Access-Control-Request-Method", "POST")
+	req := httptest.NewRequest(http.MethodGet, "/events?limit=3&category=plan&since_id=10", nil)
+	req.Header.Set("Authorization", "Bearer secret")
 	h.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusNoContent {
-		t.Fatalf("expected 204 got %d body=%s", rr.Code, rr.Body.String())
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
 	}
-	if rr.Header().Get("Access-Control-Allow-Origin") != "http://127.0.0.1:8088" {
-		t.Fatalf("expected allow origin header, got %s", rr.Header().Get("Access-Control-Allow-Origin"))
+	if gotQuery != "limit=3&category=plan&since_id=10" {
+		t.Fatalf("expected query forwarded unchanged, got %q", gotQuery)
 	}
-	if !strings.Contains(rr.Header().Get("Access-Control-Allow-Methods"), "POST") {
-		t.Fatalf("expected POST allowed method, got %s", rr.Header().Get("Access-Control-Allow-Methods"))
+	if got := rr.Header().Get("Link"); got != `</events?category=plan&limit=3&since_id=42>; rel="next"` {
+		t.Fatalf("unexpected Link header %q", got)
+	}
+	if got := rr.Header().Get("X-Total-Count"); got != "57" {
+		t.Fatalf("expected X-Total-Count relayed, got %q", got)
 	}
 }
 
-func TestCORSBlocksDisallowedOrigin(t *testing.T) {
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:        "http://example.com",
-			BridgeToken:        "secret",
-			CORSAllowedOrigins: []string{"http://127.0.0.1:8088"},
-			Timeout:            5 * time.Second,
-		},
-	)
+func TestEventsPageLinkOmittedForEmptyPageOrWhenDisabled(t *testing.T) {
+	body := `[]`
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	defer core.Close()
+
+	enabled, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", EventsPageLinks: true})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	disabled, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret"})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/health", nil)
-	req.Host = "127.0.0.1:9797"
-	req.Header.Set("Origin", "http://evil.example")
-	h.ServeHTTP(rr, req)
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	enabled.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Link"); got != "" {
+		t.Fatalf("expected no Link for empty page, got %q", got)
+	}
 
-	if rr.Code != http.StatusForbidden {
-		t.Fatalf("expected 403 got %d body=%s", rr.Code, rr.Body.String())
+	body = `[{"id":7}]`
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	disabled.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Link"); got != "" {
+		t.Fatalf("expected no Link when disabled, got %q", got)
 	}
 }
 
-func TestCORSSameOriginAllowedWithoutConfig(t *testing.T) {
-	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+func TestRequireClientRequestID(t *testing.T) {
+	var coreRequestIDs []string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		coreRequestIDs = append(coreRequestIDs, r.Header.Get("X-Request-ID"))
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", RequireClientRequestID: true})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/health", nil)
-	req.Host = "bridge.local:9797"
-	req.Header.Set("Origin", "http://bridge.local:9797")
+	req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
 	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "request_id_required") {
+		t.Fatalf("expected 400 request_id_required, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(coreRequestIDs) != 0 {
+		t.Fatalf("expected rejected request not to reach core")
+	}
 
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-ID", "client-rid-1")
+	h.ServeHTTP(rr, req)
 	if rr.Code != http.StatusOK {
-		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+		t.Fatalf("expected 200 with X-Request-ID, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(coreRequestIDs) != 1 || coreRequestIDs[0] != "client-rid-1" {
+		t.Fatalf("expected client request id forwarded to core, got %#v", coreRequestIDs)
+	}
+
+	for _, path := range []string{"/health", "/metrics"} {
+		rr = httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected %s exempt, got %d body=%s", path, rr.Code, rr.Body.String())
+		}
 	}
 }
 
-func TestCORSSpoofedForwardedProtoDeniedWithoutTrustedProxy(t *testing.T) {
-	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+func TestBridgeLoadHeaderReflectsLoad(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:          "http://example.com",
+		BridgeToken:          "secret",
+		BridgeLoadHeader:     true,
+		LoadInflightCapacity: 10,
+		MaxWSConnections:     4,
+	})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
-	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/health", nil)
-	req.Host = "bridge.local:9797"
-	req.RemoteAddr = "203.0.113.10:1234"
-	req.Header.Set("Origin", "https://bridge.local:9797")
-	req.Header.Set("X-Forwarded-Proto", "https")
-	h.ServeHTTP(rr, req)
+	loadFor := func() string {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+		return rr.Header().Get("X-Bridge-Load")
+	}
+	if got := loadFor(); got != "low" {
+		t.Fatalf("expected low load when idle, got %q", got)
+	}
 
-	if rr.Code != http.StatusForbidden {
-		t.Fatalf("expected 403 got %d body=%s", rr.Code, rr.Body.String())
+	// Simulate 5 other in-flight requests; the probe itself makes 6 of 10.
+	atomic.AddInt64(&h.inflightRequests, 5)
+	if got := loadFor(); got != "medium" {
+		t.Fatalf("expected medium load at 6/10 in flight, got %q", got)
 	}
-}
+	atomic.AddInt64(&h.inflightRequests, -5)
 
-func TestCORSSameOriginViaTrustedProxyForwardedProtoAllowed(t *testing.T) {
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:       "http://example.com",
-			BridgeToken:       "secret",
-			TrustedProxyCIDRs: []string{"203.0.113.0/24"},
-			Timeout:           5 * time.Second,
-		},
-	)
+	atomic.StoreInt64(&h.wsActiveConnections, 4)
+	if got := loadFor(); got != "high" {
+		t.Fatalf("expected high load with websockets at capacity, got %q", got)
+	}
+
+	disabled, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret"})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
-
 	rr := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/health", nil)
-	req.Host = "bridge.local:9797"
-	req.RemoteAddr = "203.0.113.10:1234"
-	req.Header.Set("Origin", "https://bridge.local:9797")
-	req.Header.Set("X-Forwarded-Proto", "https")
-	h.ServeHTTP(rr, req)
-
-	if rr.Code != http.StatusOK {
-		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	disabled.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if got := rr.Header().Get("X-Bridge-Load"); got != "" {
+		t.Fatalf("expected no load header when disabled, got %q", got)
 	}
 }
 
-func TestRateLimitPerClient(t *testing.T) {
+func TestMaxInflightPerSubjectRejectsOverBudget(t *testing.T) {
+	release := make(chan struct{})
+	arrived := make(chan struct{}, 4)
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/models" {
-			_, _ = w.Write([]byte(`[{"name":"local"}]`))
-			return
-		}
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write([]byte(`{"error":"not found"}`))
+		arrived <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte(`[]`))
 	}))
 	defer core.Close()
 
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:    core.URL,
-			BridgeToken:    "secret",
-			RateLimitRPS:   1.0,
-			RateLimitBurst: 1,
-			Timeout:        5 * time.Second,
-		},
-	)
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", MaxInflightPerSubject: 2, Timeout: 5 * time.Second})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
-
-	first := httptest.NewRecorder()
-	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqFirst.Header.Set("Authorization", "Bearer secret")
-	reqFirst.RemoteAddr = "203.0.113.10:1234"
-	h.ServeHTTP(first, reqFirst)
-	if first.Code != http.StatusOK {
-		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	slowToken, _, err := h.issueSessionToken("slow-client", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	otherToken, _, err := h.issueSessionToken("other-client", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	get := func(token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- get(slowToken).Code
+		}()
+	}
+	<-arrived
+	<-arrived
+
+	if rr := get(slowToken); rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "subject_concurrency_limited") {
+		t.Fatalf("expected 429 for third concurrent request, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	otherDone := make(chan int, 1)
+	go func() { otherDone <- get(otherToken).Code }()
+	<-arrived
+	close(release)
+	if code := <-otherDone; code != http.StatusOK {
+		t.Fatalf("expected other subject to be unaffected, got %d", code)
+	}
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Fatalf("expected in-budget requests to succeed, got %d", code)
+		}
 	}
 
-	second := httptest.NewRecorder()
-	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqSecond.Header.Set("Authorization", "Bearer secret")
-	reqSecond.RemoteAddr = "203.0.113.10:1234"
-	h.ServeHTTP(second, reqSecond)
-	if second.Code != http.StatusTooManyRequests {
-		t.Fatalf("expected second request 429 got %d body=%s", second.Code, second.Body.String())
+	if rr := get(slowToken); rr.Code != http.StatusOK {
+		t.Fatalf("expected slot released after completion, got %d", rr.Code)
 	}
-	if second.Header().Get("Retry-After") != "1" {
-		t.Fatalf("expected retry-after header on rate-limited response")
+	h.subjectInflightMu.Lock()
+	defer h.subjectInflightMu.Unlock()
+	if len(h.subjectInflight) != 0 {
+		t.Fatalf("expected idle subjects cleaned up, got %#v", h.subjectInflight)
 	}
+}
 
-	otherClient := httptest.NewRecorder()
-	reqOtherClient := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqOtherClient.Header.Set("Authorization", "Bearer secret")
-	reqOtherClient.RemoteAddr = "203.0.113.11:5678"
-	h.ServeHTTP(otherClient, reqOtherClient)
-	if otherClient.Code != http.StatusOK {
-		t.Fatalf("expected different client to pass rate limit, got %d body=%s", otherClient.Code, otherClient.Body.String())
+func TestProbeCoreCapabilitiesRejectsUnadvertisedPath(t *testing.T) {
+	var swarmCalls int
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openapi.json":
+			_, _ = w.Write([]byte(`{"openapi":"3.0.0","paths":{"/run":{},"/plans/{id}/approve":{}}}`))
+		case "/swarm/run":
+			swarmCalls++
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"Not found"}`))
+		default:
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", ProbeCoreCapabilities: true})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("/swarm/run")
+	if rr.Code != http.StatusNotImplemented || !strings.Contains(rr.Body.String(), "core_unsupported") {
+		t.Fatalf("expected 501 core_unsupported, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if swarmCalls != 0 {
+		t.Fatalf("expected unsupported path not to reach core")
+	}
+	if rr := post("/run"); rr.Code != http.StatusOK {
+		t.Fatalf("expected advertised /run to forward, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/plans/plan-1/approve"); rr.Code != http.StatusOK {
+		t.Fatalf("expected templated path to match, got %d body=%s", rr.Code, rr.Body.String())
 	}
 }
 
-func TestRateLimitDoesNotTrustForwardedForByDefault(t *testing.T) {
+func TestBodyFieldRenamesRewriteLegacyFields(t *testing.T) {
+	var gotBody string
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/models" {
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r.Body)
+		gotBody = buf.String()
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	renames, err := ParseBodyFieldRenames([]string{"/run:goal=objective"})
+	if err != nil {
+		t.Fatalf("parse body field renames: %v", err)
+	}
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", BodyFieldRenames: renames})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"goal":"open notes","max_steps":12345678901234567}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if gotBody != `{"max_steps":12345678901234567,"objective":"open notes"}` {
+		t.Fatalf("expected legacy goal renamed to objective, core got %s", gotBody)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/run_async", strings.NewReader(`{"goal":"open notes"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if gotBody != `{"goal":"open notes"}` {
+		t.Fatalf("expected unconfigured route body unchanged, core got %s", gotBody)
+	}
+}
+
+func TestValidationErrorRoutesNormalizeCore422(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		switch r.URL.Path {
+		case "/run":
+			_, _ = w.Write([]byte(`{"detail":[{"loc":["body","objective"],"msg":"field required"},{"field":"strategy","message":"unknown strategy"}]}`))
+		default:
+			_, _ = w.Write([]byte(`{"errors":{"name":"too long"}}`))
+		}
+	}))
+	defer core.Close()
+
+	routes, err := ParseValidationErrorRoutes([]string{"/run=detail"})
+	if err != nil {
+		t.Fatalf("parse validation routes: %v", err)
+	}
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", ValidationErrorRoutes: routes})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-ID", "rid-422")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	fields, _ := payload["fields"].(map[string]any)
+	if payload["error"] != "validation_failed" || payload["request_id"] != "rid-422" ||
+		fields["body.objective"] != "field required" || fields["strategy"] != "unknown strategy" {
+		t.Fatalf("unexpected validation envelope %#v", payload)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/run_async", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if !strings.Contains(rr.Body.String(), `"errors"`) || strings.Contains(rr.Body.String(), "validation_failed") {
+		t.Fatalf("expected unconfigured route to pass 422 through, got %s", rr.Body.String())
+	}
+}
+
+func runConcurrentCoreBurst(t *testing.T, h *Handler, n int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			h.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCoreConnectionPoolReusesConnectionsUnderConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	newConns := 0
+	inFlight := 0
+	maxInFlight := 0
+	core := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	core.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			newConns++
+			mu.Unlock()
+		}
+	}
+	core.Start()
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	transport, ok := h.client.Transport.(*http.Transport)
+	if !ok || transport.MaxIdleConnsPerHost != 64 {
+		t.Fatalf("expected explicit pooled transport for plain HTTP core, got %#v", h.client.Transport)
+	}
+
+	const burst = 16
+	runConcurrentCoreBurst(t, h, burst)
+	runConcurrentCoreBurst(t, h, burst)
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight < burst/2 {
+		t.Fatalf("expected concurrent core requests, max in flight=%d", maxInFlight)
+	}
+	if newConns > burst {
+		t.Fatalf("expected second burst to reuse pooled connections, dialed %d for %d requests", newConns, 2*burst)
+	}
+}
+
+func TestCoreMaxConnsPerHostLimitsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight := 0
+	maxInFlight := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:         core.URL,
+		BridgeToken:         "secret",
+		Timeout:             5 * time.Second,
+		CoreMaxConnsPerHost: 3,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	runConcurrentCoreBurst(t, h, 12)
+	mu.Lock()
+	defer mu.Unlock()
+	if maxInFlight > 3 {
+		t.Fatalf("expected at most 3 concurrent core requests, got %d", maxInFlight)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
 			_, _ = w.Write([]byte(`[{"name":"local"}]`))
-			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
 		}
-		w.WriteHeader(http.StatusNotFound)
 	}))
 	defer core.Close()
 
-	h, err := NewHandler(
-		Config{
-			CoreBaseURL:    core.URL,
-			BridgeToken:    "secret",
-			RateLimitRPS:   1.0,
-			RateLimitBurst: 1,
-			Timeout:        5 * time.Second,
-		},
-	)
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
-	first := httptest.NewRecorder()
-	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqFirst.Header.Set("Authorization", "Bearer secret")
-	reqFirst.Header.Set("X-Forwarded-For", "198.51.100.50")
-	reqFirst.RemoteAddr = "203.0.113.10:1234"
-	h.ServeHTTP(first, reqFirst)
-	if first.Code != http.StatusOK {
-		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	// Unauthorized request increments unauthorized counter.
+	rrUnauth := httptest.NewRecorder()
+	reqUnauth := httptest.NewRequest(http.MethodGet, "/models", nil)
+	h.ServeHTTP(rrUnauth, reqUnauth)
+	if rrUnauth.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 got %d", rrUnauth.Code)
 	}
 
-	second := httptest.NewRecorder()
-	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqSecond.Header.Set("Authorization", "Bearer secret")
-	reqSecond.Header.Set("X-Forwarded-For", "198.51.100.50")
-	reqSecond.RemoteAddr = "203.0.113.11:5678"
-	h.ServeHTTP(second, reqSecond)
-	if second.Code != http.StatusOK {
-		t.Fatalf("expected second request from different socket client to pass, got %d body=%s", second.Code, second.Body.String())
+	// Authorized request increments total counter.
+	rrAuth := httptest.NewRecorder()
+	reqAuth := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqAuth.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrAuth, reqAuth)
+	if rrAuth.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rrAuth.Code)
+	}
+
+	rrMetrics := httptest.NewRecorder()
+	reqMetrics := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	h.ServeHTTP(rrMetrics, reqMetrics)
+	if rrMetrics.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rrMetrics.Code)
+	}
+	metrics := rrMetrics.Body.String()
+	if !strings.Contains(metrics, "novaadapt_bridge_requests_total") {
+		t.Fatalf("expected requests metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_unauthorized_total") {
+		t.Fatalf("expected unauthorized metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_rate_limited_total") {
+		t.Fatalf("expected rate limited metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_session_issued_total") {
+		t.Fatalf("expected session issued metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_session_revoked_total") {
+		t.Fatalf("expected session revoked metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_ws_rejected_total") {
+		t.Fatalf("expected ws rejected metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_ws_active_connections") {
+		t.Fatalf("expected ws active connections metric, got: %s", metrics)
+	}
+	if !strings.Contains(metrics, "novaadapt_bridge_device_allowlist_count") {
+		t.Fatalf("expected device allowlist metric, got: %s", metrics)
 	}
 }
 
-func TestRateLimitTrustsForwardedForFromTrustedProxy(t *testing.T) {
+func TestDeviceAllowlist(t *testing.T) {
 	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/models" {
 			_, _ = w.Write([]byte(`[{"name":"local"}]`))
 			return
 		}
 		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
 	}))
 	defer core.Close()
 
 	h, err := NewHandler(
 		Config{
-			CoreBaseURL:       core.URL,
-			BridgeToken:       "secret",
-			TrustedProxyCIDRs: []string{"203.0.113.0/24"},
-			RateLimitRPS:      1.0,
-			RateLimitBurst:    1,
-			Timeout:           5 * time.Second,
+			CoreBaseURL:      core.URL,
+			BridgeToken:      "secret",
+			AllowedDeviceIDs: []string{"iphone-1", "halo-1"},
+			Timeout:          5 * time.Second,
+			LogRequests:      false,
 		},
 	)
 	if err != nil {
 		t.Fatalf("new handler: %v", err)
 	}
 
-	first := httptest.NewRecorder()
-	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqFirst.Header.Set("Authorization", "Bearer secret")
-	reqFirst.Header.Set("X-Forwarded-For", "198.51.100.77")
-	reqFirst.RemoteAddr = "203.0.113.10:1234"
-	h.ServeHTTP(first, reqFirst)
-	if first.Code != http.StatusOK {
-		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	rrMissing := httptest.NewRecorder()
+	reqMissing := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqMissing.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrMissing, reqMissing)
+	if rrMissing.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for missing device id, got %d", rrMissing.Code)
 	}
 
-	second := httptest.NewRecorder()
-	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
-	reqSecond.Header.Set("Authorization", "Bearer secret")
-	reqSecond.Header.Set("X-Forwarded-For", "198.51.100.77")
-	reqSecond.RemoteAddr = "203.0.113.11:5678"
-	h.ServeHTTP(second, reqSecond)
-	if second.Code != http.StatusTooManyRequests {
-		t.Fatalf("expected second request 429 due to shared forwarded client IP, got %d body=%s", second.Code, second.Body.String())
+	rrWrong := httptest.NewRecorder()
+	reqWrong := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqWrong.Header.Set("Authorization", "Bearer secret")
+	reqWrong.Header.Set("X-Device-ID", "unknown")
+	h.ServeHTTP(rrWrong, reqWrong)
+	if rrWrong.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown device id, got %d", rrWrong.Code)
 	}
-}
 
-func TestInvalidTrustedProxyCIDRRejected(t *testing.T) {
-	_, err := NewHandler(Config{
-		CoreBaseURL:       "http://example.com",
-		BridgeToken:       "secret",
-		TrustedProxyCIDRs: []string{"not-a-cidr"},
+	rrAllowed := httptest.NewRecorder()
+	reqAllowed := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqAllowed.Header.Set("Authorization", "Bearer secret")
+	reqAllowed.Header.Set("X-Device-ID", "iphone-1")
+	h.ServeHTTP(rrAllowed, reqAllowed)
+	if rrAllowed.Code != http.StatusOK {
+		t.Fatalf("expected 200 for allowed device id, got %d body=%s", rrAllowed.Code, rrAllowed.Body.String())
+	}
+}
+
+func TestCORSPreflightAllowedOrigin(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:        "http://example.com",
+			BridgeToken:        "secret",
+			CORSAllowedOrigins: []string{"http://127.0.0.1:8088"},
+			Timeout:            5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/auth/session", nil)
+	req.Host = "127.0.0.1:9797"
+	req.Header.Set("Origin", "http://127.0.0.1:8088")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "http://127.0.0.1:8088" {
+		t.Fatalf("expected allow origin header, got %s", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if !strings.Contains(rr.Header().Get("Access-Control-Allow-Methods"), "POST") {
+		t.Fatalf("expected POST allowed method, got %s", rr.Header().Get("Access-Control-Allow-Methods"))
+	}
+	for _, header := range []string{"X-Bridge-Fallback", "X-Bridge-Load", "X-Bridge-Client-IP"} {
+		if !strings.Contains(rr.Header().Get("Access-Control-Expose-Headers"), header) {
+			t.Fatalf("expected %s exposed, got %s", header, rr.Header().Get("Access-Control-Expose-Headers"))
+		}
+	}
+}
+
+func TestCORSPreflightUsesConfiguredMaxAge(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:        "http://example.com",
+			BridgeToken:        "secret",
+			CORSAllowedOrigins: []string{"http://127.0.0.1:8088"},
+			CORSMaxAge:         45 * time.Second,
+			Timeout:            5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/auth/session", nil)
+	req.Host = "127.0.0.1:9797"
+	req.Header.Set("Origin", "http://127.0.0.1:8088")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Access-Control-Max-Age") != "45" {
+		t.Fatalf("expected configured max age, got %q", rr.Header().Get("Access-Control-Max-Age"))
+	}
+}
+
+func TestCORSAllowCredentialsPreflight(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:          "http://example.com",
+			BridgeToken:          "secret",
+			CORSAllowedOrigins:   []string{"http://127.0.0.1:8088"},
+			CORSAllowCredentials: true,
+			Timeout:              5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/auth/session", nil)
+	req.Host = "127.0.0.1:9797"
+	req.Header.Set("Origin", "http://127.0.0.1:8088")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected credentials allowed, got %#v", rr.Header())
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "http://127.0.0.1:8088" {
+		t.Fatalf("expected exact origin echoed, got %q", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	_, err = NewHandler(
+		Config{
+			CoreBaseURL:          "http://example.com",
+			BridgeToken:          "secret",
+			CORSAllowedOrigins:   []string{"http://127.0.0.1:8088", "*"},
+			CORSAllowCredentials: true,
+		},
+	)
+	if err == nil || !strings.Contains(err.Error(), "credentials") {
+		t.Fatalf("expected wildcard origin with credentials to be rejected, got %v", err)
+	}
+}
+
+func TestCORSOmitsCredentialsByDefault(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", CORSAllowedOrigins: []string{"*"}})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodOptions, "/auth/session", nil)
+	req.Header.Set("Origin", "http://127.0.0.1:8088")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent || rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("expected no credentials header by default, got %d %#v", rr.Code, rr.Header())
+	}
+}
+
+func TestCORSBlocksDisallowedOrigin(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:        "http://example.com",
+			BridgeToken:        "secret",
+			CORSAllowedOrigins: []string{"http://127.0.0.1:8088"},
+			Timeout:            5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "127.0.0.1:9797"
+	req.Header.Set("Origin", "http://evil.example")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAllowedHostsRejectsSpoofedHost(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:  "http://example.com",
+			BridgeToken:  "secret",
+			AllowedHosts: []string{"bridge.local"},
+			Timeout:      5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "bridge.local:9797"
+	req.Header.Set("Origin", "http://bridge.local:9797")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Access-Control-Allow-Origin") != "http://bridge.local:9797" {
+		t.Fatalf("expected allowed host to pass, got %d headers=%v", rr.Code, rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "evil.example"
+	req.Header.Set("Origin", "http://evil.example")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMisdirectedRequest || !strings.Contains(rr.Body.String(), `"code":"host_not_allowed"`) {
+		t.Fatalf("expected 421 for spoofed host, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected no CORS headers for spoofed host, got %q", rr.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestMaxPathBytesRejectsOversizedPath(t *testing.T) {
+	var coreCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&coreCalls, 1)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", MaxPathBytes: 64, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans/"+strings.Repeat("a", 64), nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestURITooLong || !strings.Contains(rr.Body.String(), `"code":"path_too_long"`) {
+		t.Fatalf("expected 414 for oversized path, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if atomic.LoadInt64(&coreCalls) != 0 {
+		t.Fatalf("expected oversized path not to reach core")
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/plans/plan-1", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected normal path to pass, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRejectsPathTraversalAndNullBytes(t *testing.T) {
+	var coreCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&coreCalls, 1)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	for _, target := range []string{"/plans/../admin/maintenance", "/plans/%2e%2e/models", "/plans/plan%00-1", "/.."} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), `"code":"invalid_path"`) {
+			t.Fatalf("expected 400 invalid_path for %s, got %d body=%s", target, rr.Code, rr.Body.String())
+		}
+	}
+	if atomic.LoadInt64(&coreCalls) != 0 {
+		t.Fatalf("expected traversal attempts not to reach core")
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/plans/plan..v2", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected normal path with dots in a segment to be forwarded, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if atomic.LoadInt64(&coreCalls) != 1 {
+		t.Fatalf("expected one core call, got %d", atomic.LoadInt64(&coreCalls))
+	}
+}
+
+func TestCORSSameOriginAllowedWithoutConfig(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "bridge.local:9797"
+	req.Header.Set("Origin", "http://bridge.local:9797")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCORSSameOriginHandlesIPv6Hosts(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:        "http://example.com",
+			BridgeToken:        "secret",
+			CORSAllowedOrigins: []string{"http://[0:0:0:0:0:0:0:2]:8088"},
+			AllowedHosts:       []string{"[::1]", "bridge.local"},
+			Timeout:            5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	cases := []struct {
+		host   string
+		origin string
+		want   int
+	}{
+		{host: "[::1]:9797", origin: "http://[::1]:9797", want: http.StatusOK},
+		{host: "[::1]:9797", origin: "http://[0:0:0:0:0:0:0:1]:9797/", want: http.StatusOK},
+		{host: "[::1]", origin: "http://[::1]:80", want: http.StatusOK},
+		{host: "[::1]:9797", origin: "http://[::2]:8088", want: http.StatusOK},
+		{host: "[::1]:9797", origin: "http://[::1]:9798", want: http.StatusForbidden},
+		{host: "[::1]:9797", origin: "http://[::2]:9797", want: http.StatusForbidden},
+		{host: "[::1]:9797", origin: "https://[::1]:9797", want: http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Host = tc.host
+		req.Header.Set("Origin", tc.origin)
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("host=%s origin=%s: expected %d got %d body=%s", tc.host, tc.origin, tc.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestCORSSpoofedForwardedProtoDeniedWithoutTrustedProxy(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "bridge.local:9797"
+	req.RemoteAddr = "203.0.113.10:1234"
+	req.Header.Set("Origin", "https://bridge.local:9797")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCORSSameOriginViaTrustedProxyForwardedProtoAllowed(t *testing.T) {
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:       "http://example.com",
+			BridgeToken:       "secret",
+			TrustedProxyCIDRs: []string{"203.0.113.0/24"},
+			Timeout:           5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Host = "bridge.local:9797"
+	req.RemoteAddr = "203.0.113.10:1234"
+	req.Header.Set("Origin", "https://bridge.local:9797")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRateLimitPerClient(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:    core.URL,
+			BridgeToken:    "secret",
+			RateLimitRPS:   1.0,
+			RateLimitBurst: 1,
+			Timeout:        5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	first := httptest.NewRecorder()
+	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqFirst.Header.Set("Authorization", "Bearer secret")
+	reqFirst.RemoteAddr = "203.0.113.10:1234"
+	h.ServeHTTP(first, reqFirst)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	}
+
+	second := httptest.NewRecorder()
+	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqSecond.Header.Set("Authorization", "Bearer secret")
+	reqSecond.RemoteAddr = "203.0.113.10:1234"
+	h.ServeHTTP(second, reqSecond)
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request 429 got %d body=%s", second.Code, second.Body.String())
+	}
+	if second.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected retry-after header on rate-limited response")
+	}
+
+	otherClient := httptest.NewRecorder()
+	reqOtherClient := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqOtherClient.Header.Set("Authorization", "Bearer secret")
+	reqOtherClient.RemoteAddr = "203.0.113.11:5678"
+	h.ServeHTTP(otherClient, reqOtherClient)
+	if otherClient.Code != http.StatusOK {
+		t.Fatalf("expected different client to pass rate limit, got %d body=%s", otherClient.Code, otherClient.Body.String())
+	}
+}
+
+func TestRateLimitTokenClaimOverridesClientRPS(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:          core.URL,
+			BridgeToken:          "secret",
+			RateLimitRPS:         1.0,
+			RateLimitBurst:       2,
+			MaxTokenRateLimitRPS: 20,
+			Timeout:              5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	issued, err := h.handleIssueSessionToken([]byte(`{"scopes":["read"],"rate_limit_rps":500}`), authContext{Subject: "admin"}, "rid")
+	if err != nil {
+		t.Fatalf("issue elevated token: %v", err)
+	}
+	elevatedToken := toString(issued["token"])
+	claims, err := h.verifySessionToken(elevatedToken)
+	if err != nil || claims.RateLimitRPS != 20 {
+		t.Fatalf("expected rate_limit_rps capped at 20, got %v err=%v", claims.RateLimitRPS, err)
+	}
+
+	send := func(token string) int {
+		limited := 0
+		for i := 0; i < 10; i++ {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/models", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.RemoteAddr = "203.0.113.10:1234"
+			h.ServeHTTP(rr, req)
+			if rr.Code == http.StatusTooManyRequests {
+				limited++
+			}
+		}
+		return limited
+	}
+	if limited := send(elevatedToken); limited != 0 {
+		t.Fatalf("expected elevated token to sustain 10 requests, got %d limited", limited)
+	}
+	if limited := send("secret"); limited == 0 {
+		t.Fatalf("expected default client on the same address to be rate limited")
+	}
+
+	if _, err := h.handleIssueSessionToken([]byte(`{"rate_limit_rps":-1}`), authContext{Subject: "admin"}, "rid"); err == nil {
+		t.Fatalf("expected negative rate_limit_rps to be rejected")
+	}
+}
+
+func TestRateLimitDoesNotTrustForwardedForByDefault(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:    core.URL,
+			BridgeToken:    "secret",
+			RateLimitRPS:   1.0,
+			RateLimitBurst: 1,
+			Timeout:        5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	first := httptest.NewRecorder()
+	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqFirst.Header.Set("Authorization", "Bearer secret")
+	reqFirst.Header.Set("X-Forwarded-For", "198.51.100.50")
+	reqFirst.RemoteAddr = "203.0.113.10:1234"
+	h.ServeHTTP(first, reqFirst)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	}
+
+	second := httptest.NewRecorder()
+	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqSecond.Header.Set("Authorization", "Bearer secret")
+	reqSecond.Header.Set("X-Forwarded-For", "198.51.100.50")
+	reqSecond.RemoteAddr = "203.0.113.11:5678"
+	h.ServeHTTP(second, reqSecond)
+	if second.Code != http.StatusOK {
+		t.Fatalf("expected second request from different socket client to pass, got %d body=%s", second.Code, second.Body.String())
+	}
+}
+
+func TestRateLimitTrustsForwardedForFromTrustedProxy(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL:       core.URL,
+			BridgeToken:       "secret",
+			TrustedProxyCIDRs: []string{"203.0.113.0/24"},
+			RateLimitRPS:      1.0,
+			RateLimitBurst:    1,
+			Timeout:           5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	first := httptest.NewRecorder()
+	reqFirst := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqFirst.Header.Set("Authorization", "Bearer secret")
+	reqFirst.Header.Set("X-Forwarded-For", "198.51.100.77")
+	reqFirst.RemoteAddr = "203.0.113.10:1234"
+	h.ServeHTTP(first, reqFirst)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected first request 200 got %d body=%s", first.Code, first.Body.String())
+	}
+
+	second := httptest.NewRecorder()
+	reqSecond := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqSecond.Header.Set("Authorization", "Bearer secret")
+	reqSecond.Header.Set("X-Forwarded-For", "198.51.100.77")
+	reqSecond.RemoteAddr = "203.0.113.11:5678"
+	h.ServeHTTP(second, reqSecond)
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request 429 due to shared forwarded client IP, got %d body=%s", second.Code, second.Body.String())
+	}
+}
+
+func TestInvalidTrustedProxyCIDRRejected(t *testing.T) {
+	_, err := NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		BridgeToken:       "secret",
+		TrustedProxyCIDRs: []string{"not-a-cidr"},
+	})
+	if err == nil {
+		t.Fatalf("expected invalid trusted proxy cidr to fail handler init")
+	}
+}
+
+func TestMaintenanceModeBlocksNonAdminAndPersists(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	storePath := filepath.Join(t.TempDir(), "maintenance.json")
+	cfg := Config{
+		CoreBaseURL:          core.URL,
+		BridgeToken:          "secret",
+		MaintenanceStorePath: storePath,
+		Timeout:              5 * time.Second,
+	}
+	h, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rrToggle := httptest.NewRecorder()
+	reqToggle := httptest.NewRequest(
+		http.MethodPost,
+		"/admin/maintenance",
+		strings.NewReader(`{"enabled":true,"message":"upgrading core","retry_after":300}`),
+	)
+	reqToggle.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrToggle, reqToggle)
+	if rrToggle.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rrToggle.Code, rrToggle.Body.String())
+	}
+
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	rrBlocked := httptest.NewRecorder()
+	reqBlocked := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqBlocked.Header.Set("Authorization", "Bearer "+readToken)
+	h.ServeHTTP(rrBlocked, reqBlocked)
+	if rrBlocked.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 got %d body=%s", rrBlocked.Code, rrBlocked.Body.String())
+	}
+	if rrBlocked.Header().Get("Retry-After") != "300" {
+		t.Fatalf("expected Retry-After 300, got %q", rrBlocked.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rrBlocked.Body.String(), "upgrading core") {
+		t.Fatalf("expected maintenance message, got %s", rrBlocked.Body.String())
+	}
+
+	rrAdmin := httptest.NewRecorder()
+	reqAdmin := httptest.NewRequest(http.MethodGet, "/models", nil)
+	reqAdmin.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrAdmin, reqAdmin)
+	if rrAdmin.Code != http.StatusOK {
+		t.Fatalf("expected admin bypass 200 got %d body=%s", rrAdmin.Code, rrAdmin.Body.String())
+	}
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	_, wsResp, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer " + readToken}})
+	if err == nil || wsResp == nil || wsResp.StatusCode != http.StatusServiceUnavailable {
+		status := 0
+		if wsResp != nil {
+			status = wsResp.StatusCode
+		}
+		t.Fatalf("expected non-admin /ws upgrade refused with 503, got status=%d err=%v", status, err)
+	}
+	adminConn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil {
+		t.Fatalf("expected admin /ws upgrade during maintenance, got %v", err)
+	}
+	_ = adminConn.Close()
+
+	restarted, err := NewHandler(cfg)
+	if err != nil {
+		t.Fatalf("new handler after restart: %v", err)
+	}
+	rrHealth := httptest.NewRecorder()
+	restarted.ServeHTTP(rrHealth, httptest.NewRequest(http.MethodGet, "/health", nil))
+	var health map[string]any
+	if err := json.Unmarshal(rrHealth.Body.Bytes(), &health); err != nil {
+		t.Fatalf("unmarshal health: %v", err)
+	}
+	maintenance, ok := health["maintenance"].(map[string]any)
+	if !ok || maintenance["enabled"] != true {
+		t.Fatalf("expected persisted maintenance state in health, got %#v", health["maintenance"])
+	}
+}
+
+func TestRequestLogIncludesRouteTemplate(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"abc123","status":"executed"}`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL:   core.URL,
+		BridgeToken:   "secret",
+		Timeout:       5 * time.Second,
+		LogRequests:   true,
+		LogSampleRate: 1,
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plans/abc123/approve", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(logs.String(), "route=/plans/{id}/approve ") {
+		t.Fatalf("expected collapsed route template in log, got %q", logs.String())
+	}
+
+	rrMetrics := httptest.NewRecorder()
+	h.ServeHTTP(rrMetrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rrMetrics.Body.String(), `novaadapt_bridge_route_requests_total{route="/plans/{id}/approve"} 1`) {
+		t.Fatalf("expected route template metric, got %s", rrMetrics.Body.String())
+	}
+}
+
+func TestRequestLogJSONIncludesRouteTemplate(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"abc123","status":"executed"}`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL:   core.URL,
+		BridgeToken:   "secret",
+		Timeout:       5 * time.Second,
+		LogRequests:   true,
+		LogSampleRate: 1,
+		LogJSON:       true,
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plans/abc123/approve", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &entry); err != nil {
+		t.Fatalf("expected one JSON log line, got %q: %v", logs.String(), err)
+	}
+	if entry["msg"] != "bridge request" || entry["path"] != "/plans/abc123/approve" ||
+		entry["route"] != "/plans/{id}/approve" || entry["status"] != float64(http.StatusOK) {
+		t.Fatalf("unexpected JSON log entry %#v", entry)
+	}
+}
+
+func TestRouteTemplateCollapsesIdentifiers(t *testing.T) {
+	cases := map[string]string{
+		"/models":                                "/models",
+		"/jobs/job-1":                            "/jobs/{id}",
+		"/jobs/job-1/stream":                     "/jobs/{id}/stream",
+		"/terminal/sessions/term1/output":        "/terminal/sessions/{id}/output",
+		"/agents/templates/shared/share-token-1": "/agents/templates/shared/{share_token}",
+		"/control/artifacts/art-1/preview":       "/control/artifacts/{artifact_id}/preview",
+		"/plugins/novabridge/call":               "/plugins/{name}/call",
+		"/auth/session":                          "/auth/session",
+		"/admin/cache/flush":                     "/admin/cache/flush",
+		"/admin/revocations":                     "/admin/revocations",
+		"/":                                      "/",
+		"/definitely/not/a/route":                unmatchedRouteTemplate,
+		"/plans/plan1/x7f3a9":                    unmatchedRouteTemplate,
+		"/plans/plan1/approve/extra":             unmatchedRouteTemplate,
+		"/jobs/job-1/cancel":                     "/jobs/{id}/cancel",
+	}
+	for input, expected := range cases {
+		if got := routeTemplate(input); got != expected {
+			t.Fatalf("routeTemplate(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
+
+func TestRouteRequestsMetricIgnoresUnmatchedPaths(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://127.0.0.1:1", BridgeToken: "secret", Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/plans/plan1/random-%d", i), nil))
+	}
+	h.routeRequestsMu.Lock()
+	defer h.routeRequestsMu.Unlock()
+	if len(h.routeRequests) != 0 {
+		t.Fatalf("expected unmatched paths not to create route series, got %#v", h.routeRequests)
+	}
+}
+
+func TestResponseCacheInvalidatedByWrites(t *testing.T) {
+	listCalls := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/plans" && r.Method == http.MethodGet:
+			listCalls++
+			_, _ = w.Write([]byte(`[{"id":"plan1"}]`))
+		case r.URL.Path == "/plans" && r.Method == http.MethodPost:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":"plan2"}`))
+		case r.URL.Path == "/plans/plan1/approve":
+			_, _ = w.Write([]byte(`{"id":"plan1","status":"executed"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:        core.URL,
+		BridgeToken:        "secret",
+		Timeout:            5 * time.Second,
+		CacheTTLs:          map[string]time.Duration{"/plans": time.Minute},
+		CacheInvalidations: map[string][]string{"/plans/{id}/approve": {"/plans"}},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		var req *http.Request
+		if body == "" {
+			req = httptest.NewRequest(method, path, nil)
+		} else {
+			req = httptest.NewRequest(method, path, strings.NewReader(body))
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	do(http.MethodGet, "/plans", "")
+	do(http.MethodGet, "/plans", "")
+	if listCalls != 1 {
+		t.Fatalf("expected cached list after first GET, got %d core calls", listCalls)
+	}
+
+	if rr := do(http.MethodPost, "/plans", `{"objective":"new"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	do(http.MethodGet, "/plans", "")
+	if listCalls != 2 {
+		t.Fatalf("expected create to invalidate list cache, got %d core calls", listCalls)
+	}
+
+	do(http.MethodPost, "/plans/plan1/approve", `{}`)
+	do(http.MethodGet, "/plans", "")
+	if listCalls != 3 {
+		t.Fatalf("expected configured dependency to invalidate list cache, got %d core calls", listCalls)
+	}
+}
+
+func TestAdminCacheFlushRefreshesCachedResponse(t *testing.T) {
+	var coreCalls int32
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&coreCalls, 1)
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"version":%d}`, n)))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "secret",
+		Timeout:     5 * time.Second,
+		CacheTTLs:   map[string]time.Duration{"/plans": time.Minute, "/models": time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	do := func(method string, path string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	do(http.MethodGet, "/plans", "")
+	do(http.MethodGet, "/models", "")
+	if rr := do(http.MethodGet, "/plans", ""); !strings.Contains(rr.Body.String(), `"version":1`) {
+		t.Fatalf("expected cached plans response, got %s", rr.Body.String())
+	}
+
+	rr := do(http.MethodPost, "/admin/cache/flush", `{"prefix":"/plans"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"evicted":1`) {
+		t.Fatalf("expected prefix flush to evict 1 entry, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/plans", ""); !strings.Contains(rr.Body.String(), `"version":3`) {
+		t.Fatalf("expected plans to be refetched after flush, got %s", rr.Body.String())
+	}
+	if rr := do(http.MethodGet, "/models", ""); !strings.Contains(rr.Body.String(), `"version":2`) {
+		t.Fatalf("expected models to stay cached after prefix flush, got %s", rr.Body.String())
+	}
+
+	rr = do(http.MethodPost, "/admin/cache/flush", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"evicted":2`) {
+		t.Fatalf("expected full flush to evict 2 entries, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRateLimitFlushAllowsClientToProceed(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:    core.URL,
+		BridgeToken:    "secret",
+		RateLimitRPS:   0.01,
+		RateLimitBurst: 1,
+		Timeout:        5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	doModels := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.RemoteAddr = "203.0.113.10:1234"
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := doModels(); code != http.StatusOK {
+		t.Fatalf("expected first request 200 got %d", code)
+	}
+	if code := doModels(); code != http.StatusTooManyRequests {
+		t.Fatalf("expected second request 429 got %d", code)
+	}
+
+	rrFlush := httptest.NewRecorder()
+	reqFlush := httptest.NewRequest(http.MethodPost, "/admin/ratelimit/flush", nil)
+	reqFlush.Header.Set("Authorization", "Bearer secret")
+	reqFlush.RemoteAddr = "203.0.113.20:1234"
+	h.ServeHTTP(rrFlush, reqFlush)
+	if rrFlush.Code != http.StatusOK {
+		t.Fatalf("expected flush 200 got %d body=%s", rrFlush.Code, rrFlush.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rrFlush.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal flush payload: %v", err)
+	}
+	if flushed, _ := payload["flushed"].(float64); flushed != 2 {
+		t.Fatalf("expected 2 flushed clients, got %#v", payload["flushed"])
+	}
+
+	if code := doModels(); code != http.StatusOK {
+		t.Fatalf("expected request after flush 200 got %d", code)
+	}
+}
+
+func TestForwardPreservesLargeIntegerIDs(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":9007199254740993,"jobs":[{"id":18446744073709551615}]}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/jobs/9007199254740993", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, `"id":9007199254740993`) || !strings.Contains(body, `"id":18446744073709551615`) {
+		t.Fatalf("expected large integer ids preserved exactly, got %s", body)
+	}
+	if value, ok := asInt64(json.Number("9007199254740993")); !ok || value != 9007199254740993 {
+		t.Fatalf("expected asInt64 to parse json.Number, got %d ok=%v", value, ok)
+	}
+}
+
+func TestCoreRedirectIsNotFollowedAcrossHosts(t *testing.T) {
+	leakedAuth := ""
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leakedAuth = r.Header.Get("Authorization")
+		_, _ = w.Write([]byte(`{"external":true}`))
+	}))
+	defer external.Close()
+
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			http.Redirect(w, r, external.URL+"/models", http.StatusFound)
+		case "/plans":
+			http.Redirect(w, r, "/plans/", http.StatusMovedPermanently)
+		case "/plans/":
+			_, _ = w.Write([]byte(`[{"id":"plan1"}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	cases := []struct {
+		policy         string
+		path           string
+		expectedStatus int
+	}{
+		{policy: "", path: "/models", expectedStatus: http.StatusFound},
+		{policy: CoreRedirectError, path: "/models", expectedStatus: http.StatusBadGateway},
+		{policy: CoreRedirectSameHost, path: "/models", expectedStatus: http.StatusBadGateway},
+		{policy: CoreRedirectSameHost, path: "/plans", expectedStatus: http.StatusOK},
+	}
+	for _, tc := range cases {
+		h, err := NewHandler(Config{
+			CoreBaseURL:        core.URL,
+			BridgeToken:        "secret",
+			CoreToken:          "coresecret",
+			CoreRedirectPolicy: tc.policy,
+			Timeout:            5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.expectedStatus {
+			t.Fatalf("policy=%q path=%s expected %d got %d body=%s", tc.policy, tc.path, tc.expectedStatus, rr.Code, rr.Body.String())
+		}
+		if tc.expectedStatus == http.StatusFound && rr.Header().Get("Location") != external.URL+"/models" {
+			t.Fatalf("expected passthrough Location header, got %q", rr.Header().Get("Location"))
+		}
+	}
+	if leakedAuth != "" {
+		t.Fatalf("expected core token never sent to redirect target, got %q", leakedAuth)
+	}
+
+	if _, err := NewHandler(Config{CoreBaseURL: core.URL, CoreRedirectPolicy: "follow-anything"}); err == nil {
+		t.Fatalf("expected invalid redirect policy to be rejected")
+	}
+}
+
+func TestCoreReplicasWeightedAndEjectFailing(t *testing.T) {
+	var mu sync.Mutex
+	hits := map[string]int{}
+	newReplica := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			hits[name]++
+			mu.Unlock()
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+		}))
+	}
+	replicaA := newReplica("a")
+	defer replicaA.Close()
+	replicaB := newReplica("b")
+	defer replicaB.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURLs: []string{replicaA.URL + "|3", replicaB.URL + "|1"},
+		BridgeToken:  "secret",
+		Timeout:      5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	doModels := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	for i := 0; i < 8; i++ {
+		if code := doModels(); code != http.StatusOK {
+			t.Fatalf("expected 200 got %d", code)
+		}
+	}
+	if hits["a"] != 6 || hits["b"] != 2 {
+		t.Fatalf("expected 6/2 weighted split, got %#v", hits)
+	}
+
+	replicaB.Close()
+	for i := 0; i < 12; i++ {
+		doModels()
+	}
+	hits = map[string]int{}
+	for i := 0; i < 4; i++ {
+		if code := doModels(); code != http.StatusOK {
+			t.Fatalf("expected healthy replica to serve after ejection, got %d", code)
+		}
+	}
+	if hits["a"] != 4 {
+		t.Fatalf("expected all traffic on healthy replica after ejection, got %#v", hits)
+	}
+}
+
+func TestStripResponseHeadersFromCore(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Internal-Node", "core-7")
+		w.Header().Set("Server", "core/1.2")
+		w.Header().Set("X-Core-Version", "1.2")
+		if r.URL.Path == "/dashboard" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(`<html></html>`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:              core.URL,
+		BridgeToken:              "secret",
+		StripResponseHeaders:     []string{"x-internal-node", "Server"},
+		ForwardedResponseHeaders: []string{"X-Internal-Node", "Server", "X-Core-Version", "X-Kept", "X-Hop-Custom", "Transfer-Encoding", "X-Request-Id"},
+		Timeout:                  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	for _, path := range []string{"/models", "/dashboard"} {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 got %d body=%s", path, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Internal-Node") != "" || rr.Header().Get("Server") != "" {
+			t.Fatalf("%s: expected configured headers stripped, got %#v", path, rr.Header())
+		}
+		if rr.Header().Get("X-Core-Version") != "1.2" {
+			t.Fatalf("%s: expected allowlisted core header relayed, got %#v", path, rr.Header())
+		}
+	}
+
+	relayed := h.clientResponseHeaders(http.Header{
+		"Connection":        {"X-Hop-Custom"},
+		"X-Hop-Custom":      {"1"},
+		"Transfer-Encoding": {"chunked"},
+		"X-Request-Id":      {"core-rid"},
+		"X-Kept":            {"yes"},
+	})
+	if len(relayed) != 1 || relayed.Get("X-Kept") != "yes" {
+		t.Fatalf("expected only end-to-end headers relayed, got %#v", relayed)
+	}
+}
+
+func TestCoreResponseHeadersWithheldByDefault(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "core_session=alice; Path=/")
+		w.Header().Set("Server", "core/1.2")
+		w.Header().Set("X-Internal-Node", "core-7")
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "secret",
+		CacheTTLs:   map[string]time.Duration{"/models": time.Minute},
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+		}
+		for _, name := range []string{"Set-Cookie", "Server", "X-Internal-Node"} {
+			if rr.Header().Get(name) != "" {
+				t.Fatalf("request %d: expected core %s withheld, got %#v", i, name, rr.Header())
+			}
+		}
+	}
+	h.cache.mu.Lock()
+	defer h.cache.mu.Unlock()
+	if len(h.cache.entries) != 1 {
+		t.Fatalf("expected /models cached, got %d entries", len(h.cache.entries))
+	}
+	for key, entry := range h.cache.entries {
+		if len(entry.header) != 0 {
+			t.Fatalf("expected no core headers cached for %s, got %#v", key, entry.header)
+		}
+	}
+
+	// Even an allowlisted Set-Cookie is never cached or replayed on cacheable routes.
+	allowed, err := NewHandler(Config{
+		CoreBaseURL:              core.URL,
+		BridgeToken:              "secret",
+		CacheTTLs:                map[string]time.Duration{"/models": time.Minute},
+		ForwardedResponseHeaders: []string{"Set-Cookie"},
+		Timeout:                  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	allowed.ServeHTTP(rr, req)
+	if rr.Header().Get("Set-Cookie") != "" {
+		t.Fatalf("expected Set-Cookie dropped from cacheable response, got %#v", rr.Header())
+	}
+}
+
+func TestServerTimingForwardedOnlyWhenAllowlisted(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server-Timing", "db;dur=12.5")
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	serverTiming := func(cfg Config) []string {
+		h, err := NewHandler(cfg)
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+		}
+		return rr.Header().Values("Server-Timing")
+	}
+
+	cfg := Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second}
+	if values := serverTiming(cfg); len(values) != 0 {
+		t.Fatalf("expected Server-Timing withheld by default, got %#v", values)
+	}
+
+	cfg.ForwardedResponseHeaders = []string{"server-timing"}
+	values := serverTiming(cfg)
+	if len(values) != 2 || values[0] != "db;dur=12.5" || !strings.HasPrefix(values[1], "bridge;dur=") {
+		t.Fatalf("expected core timing plus bridge segment, got %#v", values)
+	}
+}
+
+func TestCoreAcceptHeaderAndClientVersionOverride(t *testing.T) {
+	var mu sync.Mutex
+	var accepts []string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		accepts = append(accepts, r.Header.Get("Accept"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:       core.URL,
+		BridgeToken:       "secret",
+		CoreAcceptHeader:  "application/vnd.novaadapt.v1+json",
+		CoreVersionAccept: map[string]string{"v2": "application/vnd.novaadapt.v2+json"},
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	request := func(version string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		if version != "" {
+			req.Header.Set("X-Core-Version", version)
+		}
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := request(""); code != http.StatusOK {
+		t.Fatalf("expected 200 with default accept, got %d", code)
+	}
+	if code := request("V2"); code != http.StatusOK {
+		t.Fatalf("expected 200 with pinned version, got %d", code)
+	}
+	if code := request("v9"); code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown core version, got %d", code)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(accepts) != 2 || accepts[0] != "application/vnd.novaadapt.v1+json" || accepts[1] != "application/vnd.novaadapt.v2+json" {
+		t.Fatalf("unexpected core Accept headers: %#v", accepts)
+	}
+}
+
+func TestRateLimitPenaltyBoxSurvivesIdlePrune(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:        "http://example.com",
+		BridgeToken:        "secret",
+		RateLimitRPS:       1,
+		RateLimitBurst:     1,
+		PenaltyBoxStrikes:  2,
+		PenaltyBoxRPS:      0.01,
+		PenaltyBoxDuration: time.Hour,
+		Timeout:            5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	request := func(remote string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.RemoteAddr = remote
+		return req
+	}
+	abuser := "10.0.0.1:1234"
+	normal := "10.0.0.2:1234"
+	start := time.Now()
+
+	// Two separate limit episodes earn two strikes.
+	for _, offset := range []time.Duration{0, 2 * time.Second} {
+		if h.isRateLimited(request(abuser), start.Add(offset)) {
+			t.Fatalf("expected first request at +%s allowed", offset)
+		}
+		if !h.isRateLimited(request(abuser), start.Add(offset)) {
+			t.Fatalf("expected burst overflow at +%s limited", offset)
+		}
+		if !h.isRateLimited(request(abuser), start.Add(offset)) {
+			t.Fatalf("expected continued overflow at +%s limited", offset)
+		}
+	}
+	// A bursty but well-behaved client only earns one strike.
+	if h.isRateLimited(request(normal), start) || !h.isRateLimited(request(normal), start) {
+		t.Fatalf("expected normal client burst then limit")
+	}
+
+	// After the idle TTL the limiters are pruned, but the penalty persists.
+	later := start.Add(rateLimiterIdleTTL + time.Minute)
+	if h.isRateLimited(request(abuser), later) {
+		t.Fatalf("expected penalized client to get one request after idle")
+	}
+	if !h.isRateLimited(request(abuser), later.Add(2*time.Second)) {
+		t.Fatalf("expected penalized client held to reduced rate after idle prune")
+	}
+	if h.isRateLimited(request(normal), later) || h.isRateLimited(request(normal), later.Add(2*time.Second)) {
+		t.Fatalf("expected normal client unaffected by penalty box")
+	}
+}
+
+func TestClientIPEchoHeaderAndDebugEndpoint(t *testing.T) {
+	h, err := NewHandler(Config{
+		CoreBaseURL:       "http://example.com",
+		BridgeToken:       "secret",
+		TrustedProxyCIDRs: []string{"203.0.113.0/24"},
+		AllowClientIPEcho: true,
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/debug/client-ip", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Forwarded-For", "198.51.100.77, 203.0.113.10")
+	req.RemoteAddr = "203.0.113.10:1234"
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Bridge-Client-IP") != "198.51.100.77" {
+		t.Fatalf("expected resolved client ip header, got %q", rr.Header().Get("X-Bridge-Client-IP"))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if payload["client_ip"] != "198.51.100.77" || payload["trusted_proxy"] != true {
+		t.Fatalf("unexpected debug payload: %#v", payload)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/debug/client-ip", nil)
+	req.Header.Set("X-Forwarded-For", "198.51.100.77")
+	req.RemoteAddr = "192.0.2.5:1234"
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || rr.Header().Get("X-Bridge-Client-IP") != "192.0.2.5" {
+		t.Fatalf("expected untrusted peer address echoed on 401, got %d %q", rr.Code, rr.Header().Get("X-Bridge-Client-IP"))
+	}
+
+	disabled, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/debug/client-ip", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	disabled.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || rr.Header().Get("X-Bridge-Client-IP") != "" {
+		t.Fatalf("expected echo disabled by default, got %d %q", rr.Code, rr.Header().Get("X-Bridge-Client-IP"))
+	}
+}
+
+func TestHopByHopHeadersNeverLeak(t *testing.T) {
+	var received http.Header
+	var mu sync.Mutex
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = r.Header.Clone()
+		mu.Unlock()
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Core-Hop", "1")
+		w.Header().Set("Connection", "X-Nominated")
+		w.Header().Set("X-Nominated", "1")
+		w.Header().Set("X-Core-Kept", "yes")
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:              core.URL,
+		BridgeToken:              "secret",
+		HopByHopHeaders:          []string{"X-Core-Hop", "X-Client-Hop"},
+		ForwardedRequestHeaders:  []string{"X-Client-Kept", "X-Client-Hop", "X-Nominated-Req", "Proxy-Authorization", "Te", "Authorization"},
+		ForwardedResponseHeaders: []string{"Keep-Alive", "X-Core-Hop", "Connection", "X-Nominated", "X-Core-Kept"},
+		Timeout:                  5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Connection", "X-Nominated-Req")
+	req.Header.Set("X-Nominated-Req", "1")
+	req.Header.Set("X-Client-Hop", "1")
+	req.Header.Set("X-Client-Kept", "yes")
+	req.Header.Set("Proxy-Authorization", "Basic abc")
+	req.Header.Set("Te", "trailers")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"X-Nominated-Req", "X-Client-Hop", "Proxy-Authorization", "Te"} {
+		if received.Get(name) != "" {
+			t.Fatalf("expected request hop-by-hop header %s stripped, got %#v", name, received)
+		}
+	}
+	if received.Get("X-Client-Kept") != "yes" || received.Get("Authorization") == "Bearer secret" {
+		t.Fatalf("expected allowlisted header forwarded and client auth never relayed, got %#v", received)
+	}
+	for _, name := range []string{"Keep-Alive", "X-Core-Hop", "Connection", "X-Nominated"} {
+		if rr.Header().Get(name) != "" {
+			t.Fatalf("expected response hop-by-hop header %s stripped, got %#v", name, rr.Header())
+		}
+	}
+	if rr.Header().Get("X-Core-Kept") != "yes" {
+		t.Fatalf("expected end-to-end response header relayed, got %#v", rr.Header())
+	}
+}
+
+func TestStrictCoreJSONRejectsMalformedSuccess(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"plans":[`))
+	}))
+	defer core.Close()
+
+	for _, tc := range []struct {
+		name   string
+		strict bool
+		status int
+		field  string
+	}{
+		{name: "wrapper", strict: false, status: http.StatusOK, field: "raw"},
+		{name: "strict", strict: true, status: http.StatusBadGateway, field: "code"},
+	} {
+		h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", StrictCoreJSON: tc.strict, Timeout: 5 * time.Second})
+		if err != nil {
+			t.Fatalf("%s: new handler: %v", tc.name, err)
+		}
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.status {
+			t.Fatalf("%s: expected %d got %d body=%s", tc.name, tc.status, rr.Code, rr.Body.String())
+		}
+		var payload map[string]any
+		if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+			t.Fatalf("%s: decode response: %v", tc.name, err)
+		}
+		if _, ok := payload[tc.field]; !ok {
+			t.Fatalf("%s: expected %q in payload, got %#v", tc.name, tc.field, payload)
+		}
+		if tc.strict && payload["code"] != "core_invalid_json" {
+			t.Fatalf("%s: expected core_invalid_json code, got %#v", tc.name, payload["code"])
+		}
+	}
+}
+
+func TestRequestLogSamplingAlwaysLogsErrors(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL:   core.URL,
+		BridgeToken:   "secret",
+		Timeout:       5 * time.Second,
+		LogRequests:   true,
+		LogSampleRate: 0.01,
+		Logger:        log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	h.logSample = func() float64 { return 0.99 }
+
+	rrOK := httptest.NewRecorder()
+	reqOK := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	reqOK.Header.Set("Authorization", "Bearer secret")
+	reqOK.Header.Set("X-Request-ID", "rid-sampled-out")
+	h.ServeHTTP(rrOK, reqOK)
+	if rrOK.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rrOK.Code, rrOK.Body.String())
+	}
+
+	reqDenied := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	reqDenied.Header.Set("X-Request-ID", "rid-denied")
+	h.ServeHTTP(httptest.NewRecorder(), reqDenied)
+
+	reqMissing := httptest.NewRequest(http.MethodGet, "/nope", nil)
+	reqMissing.Header.Set("Authorization", "Bearer secret")
+	reqMissing.Header.Set("X-Request-ID", "rid-missing")
+	h.ServeHTTP(httptest.NewRecorder(), reqMissing)
+
+	output := logs.String()
+	if strings.Contains(output, "rid-sampled-out") {
+		t.Fatalf("expected successful request to be sampled out, got %q", output)
+	}
+	if !strings.Contains(output, "id=rid-denied ") || !strings.Contains(output, "status=401") {
+		t.Fatalf("expected unauthorized request to be logged, got %q", output)
+	}
+	if !strings.Contains(output, "id=rid-missing ") || !strings.Contains(output, "status=404") {
+		t.Fatalf("expected not-found request to be logged, got %q", output)
+	}
+
+	h.logSample = func() float64 { return 0.001 }
+	reqKept := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	reqKept.Header.Set("Authorization", "Bearer secret")
+	reqKept.Header.Set("X-Request-ID", "rid-sampled-in")
+	h.ServeHTTP(httptest.NewRecorder(), reqKept)
+	if !strings.Contains(logs.String(), "rid-sampled-in") {
+		t.Fatalf("expected sampled-in request to be logged, got %q", logs.String())
+	}
+}
+
+func TestRequestLogSampleRateZeroLogsErrorsOnly(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"boom"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL:      core.URL,
+		BridgeToken:      "secret",
+		Timeout:          5 * time.Second,
+		LogRequests:      true,
+		LogSampleRate:    0,
+		LogSampleRateSet: true,
+		Logger:           log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	h.logSample = func() float64 { return 0 }
+
+	for requestID, path := range map[string]string{"rid-ok": "/plans", "rid-failed": "/models"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Request-ID", requestID)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	output := logs.String()
+	if strings.Contains(output, "rid-ok") {
+		t.Fatalf("expected 200 to be dropped at rate 0, got %q", output)
+	}
+	if !strings.Contains(output, "id=rid-failed ") || !strings.Contains(output, "status=500") {
+		t.Fatalf("expected 500 to be logged at rate 0, got %q", output)
+	}
+}
+
+func TestRequestLogSampleRateUnsetLogsSuccesses(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"plans":[]}`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "secret",
+		Timeout:     5 * time.Second,
+		LogRequests: true,
+		Logger:      log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	h.logSample = func() float64 { return 0.99 }
+
+	req := httptest.NewRequest(http.MethodGet, "/plans", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-ID", "rid-ok")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(logs.String(), "id=rid-ok ") || !strings.Contains(logs.String(), "status=200") {
+		t.Fatalf("expected 200 logged when LogSampleRate is unset, got %q", logs.String())
+	}
+}
+
+func TestArtifactDownloadStreamsBinary(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/control/artifacts/0f3c9a1b2c/preview" {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(png)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"Artifact preview not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/artifacts/0f3c9a1b2c", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if got := rr.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("expected image/png content type, got %q", got)
+	}
+	if !bytes.Equal(rr.Body.Bytes(), png) {
+		t.Fatalf("expected artifact bytes relayed unchanged, got %q", rr.Body.Bytes())
+	}
+
+	rrInvalid := httptest.NewRecorder()
+	reqInvalid := httptest.NewRequest(http.MethodGet, "/artifacts/..%2Fsecrets", nil)
+	reqInvalid.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rrInvalid, reqInvalid)
+	if rrInvalid.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for invalid artifact id, got %d body=%s", rrInvalid.Code, rrInvalid.Body.String())
+	}
+
+	noReadToken, _, err := h.issueSessionToken("runner", []string{scopeRun}, "", 120)
+	if err != nil {
+		t.Fatalf("issue run token: %v", err)
+	}
+	rrForbidden := httptest.NewRecorder()
+	reqForbidden := httptest.NewRequest(http.MethodGet, "/artifacts/0f3c9a1b2c", nil)
+	reqForbidden.Header.Set("Authorization", "Bearer "+noReadToken)
+	h.ServeHTTP(rrForbidden, reqForbidden)
+	if rrForbidden.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 without read scope, got %d body=%s", rrForbidden.Code, rrForbidden.Body.String())
+	}
+}
+
+func TestIdempotencyReplaysAreCounted(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotency-Key", r.Header.Get("Idempotency-Key"))
+		w.Header().Set("X-Idempotency-Replayed", "true")
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run_async", strings.NewReader(`{"objective":"x"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Idempotency-Key", "idem-1")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	result, err := h.coreJSONRequest(authContext{Authorized: true}, http.MethodPost, "/run_async", "", "rid", "idem-2", map[string]any{})
+	if err != nil || !result.ReplayDetected {
+		t.Fatalf("expected replay to be detected, got %#v err=%v", result, err)
+	}
+
+	metrics := httptest.NewRecorder()
+	h.ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(metrics.Body.String(), "novaadapt_bridge_idempotency_replays_total 2\n") {
+		t.Fatalf("expected two counted replays, got %s", metrics.Body.String())
+	}
+}
+
+func TestResponseTransformerRedactsField(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"name":"local","api_key":"sk-secret"}`))
+	}))
+	defer core.Close()
+
+	var seenPath string
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "secret",
+		Timeout:     5 * time.Second,
+		ResponseTransformer: func(path string, status int, body []byte) (int, []byte, error) {
+			seenPath = path
+			var payload map[string]any
+			if err := json.Unmarshal(body, &payload); err != nil {
+				return status, body, nil
+			}
+			payload["api_key"] = "[redacted]"
+			redacted, err := json.Marshal(payload)
+			return status, redacted, err
+		},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "sk-secret") || !strings.Contains(rr.Body.String(), `"api_key":"[redacted]"`) {
+		t.Fatalf("expected api_key to be redacted, got %s", rr.Body.String())
+	}
+	if seenPath != "/models" {
+		t.Fatalf("expected transformer to see /models, got %q", seenPath)
+	}
+}
+
+func TestRouteTimeoutsOverrideGlobalTimeout(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:   core.URL,
+		BridgeToken:   "secret",
+		Timeout:       100 * time.Millisecond,
+		RouteTimeouts: map[string]time.Duration{"/run": 2 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/run", strings.NewReader(`{"objective":"slow"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected slow /run within its route timeout to succeed, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/run_async", strings.NewReader(`{"objective":"slow"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadGateway {
+		t.Fatalf("expected the global timeout to apply to /run_async, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRootPathReturnsServiceInfoWithoutAuth(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode root info: %v", err)
+	}
+	if payload["service"] != "novaadapt-bridge-go" || payload["version"] != Version {
+		t.Fatalf("expected service name and version, got %#v", payload)
+	}
+	endpoints, ok := payload["endpoints"].(map[string]any)
+	if !ok || endpoints["/health"] == nil || endpoints["/ws"] == nil {
+		t.Fatalf("expected endpoint summary, got %#v", payload["endpoints"])
+	}
+
+	h, err = NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "secret", DisableRootInfo: true, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code == http.StatusOK {
+		t.Fatalf("expected root info to be disabled, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestForwardErrorIncludesCoreStatus(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/models" {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		// Hijack to send a non-standard reason phrase, which net/http never writes.
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		body := `{"error":"plan is locked"}`
+		fmt.Fprintf(
+			buf,
+			"HTTP/1.1 409 Plan Locked\r\nContent-Type: application/json\r\nX-Error-Code: PLAN_LOCKED\r\nX-Core-Shard: s2\r\nX-Other: ignored\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s",
+			len(body),
+			body,
+		)
+		_ = buf.Flush()
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:      core.URL,
+		BridgeToken:      "secret",
+		CoreErrorHeaders: []string{"x-error-code", "X-Core-Shard"},
+		Timeout:          5 * time.Second,
 	})
-	if err == nil {
-		t.Fatalf("expected invalid trusted proxy cidr to fail handler init")
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/plans/p1/approve", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("X-Request-ID", "rid-core-status")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if payload["request_id"] != "rid-core-status" || payload["error"] != "plan is locked" {
+		t.Fatalf("unexpected payload %#v", payload)
+	}
+	coreStatus, _ := payload["core_status"].(map[string]any)
+	if toInt(coreStatus["code"]) != http.StatusConflict || coreStatus["text"] != "Plan Locked" {
+		t.Fatalf("unexpected core_status %#v", payload["core_status"])
+	}
+	headers, _ := coreStatus["headers"].(map[string]any)
+	if len(headers) != 2 || headers["X-Error-Code"] != "PLAN_LOCKED" || headers["X-Core-Shard"] != "s2" {
+		t.Fatalf("unexpected core_status headers %#v", coreStatus["headers"])
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/models", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "core_status") {
+		t.Fatalf("expected no core_status on success, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCoreRateLimitPropagatesRetryAfter(t *testing.T) {
+	var hits atomic.Int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":"slow down"}`))
+	}))
+	defer core.Close()
+
+	doModels := func(h *Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	passthrough, err := NewHandler(Config{
+		CoreBaseURL:          core.URL,
+		BridgeToken:          "secret",
+		StripResponseHeaders: []string{"Retry-After"},
+		Timeout:              5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		rr := doModels(passthrough)
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+			t.Fatalf("expected core 429 with Retry-After relayed, got %d headers=%#v", rr.Code, rr.Header())
+		}
+		if !strings.Contains(rr.Body.String(), "slow down") {
+			t.Fatalf("expected core body relayed, got %s", rr.Body.String())
+		}
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("expected both requests to reach core without HonorCoreRetryAfter, got %d", hits.Load())
+	}
+
+	hits.Store(0)
+	h, err := NewHandler(Config{
+		CoreBaseURL:         core.URL,
+		BridgeToken:         "secret",
+		HonorCoreRetryAfter: true,
+		Timeout:             5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if rr := doModels(h); rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected core 429 relayed, got %d headers=%#v", rr.Code, rr.Header())
+	}
+	rr := doModels(h)
+	if rr.Code != http.StatusTooManyRequests || !strings.Contains(rr.Body.String(), "core_rate_limited") {
+		t.Fatalf("expected local 429 while backing off, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if wait, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || wait <= 0 || wait > 30 {
+		t.Fatalf("expected remaining Retry-After, got %q", rr.Header().Get("Retry-After"))
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("expected core to be held back after its 429, got %d hits", hits.Load())
+	}
+
+	metrics := httptest.NewRecorder()
+	h.ServeHTTP(metrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(metrics.Body.String(), "novaadapt_bridge_core_rate_limited_total 1\n") {
+		t.Fatalf("expected core rate limited metric, got %s", metrics.Body.String())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if wait, ok := parseRetryAfter("12", now); !ok || wait != 12*time.Second {
+		t.Fatalf("expected 12s, got %v %v", wait, ok)
+	}
+	if wait, ok := parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now); !ok || wait != 90*time.Second {
+		t.Fatalf("expected 90s from HTTP-date, got %v %v", wait, ok)
+	}
+	for _, value := range []string{"", "-1", "soon"} {
+		if _, ok := parseRetryAfter(value, now); ok {
+			t.Fatalf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestDebugDeviceLogsVerboselyWithoutRequestLogging(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer core.Close()
+
+	var logs bytes.Buffer
+	h, err := NewHandler(Config{
+		CoreBaseURL:    core.URL,
+		BridgeToken:    "bridge",
+		DebugDeviceIDs: []string{"dbg-1"},
+		Timeout:        5 * time.Second,
+		Logger:         log.New(&logs, "", 0),
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	do := func(target string, deviceID string) {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Authorization", "Bearer bridge")
+		if deviceID != "" {
+			req.Header.Set("X-Device-ID", deviceID)
+		}
+		h.ServeHTTP(rr, req)
+	}
+
+	do("/models?limit=5", "other-device")
+	do("/models", "")
+	if logs.Len() != 0 {
+		t.Fatalf("expected no logs for non-debug devices, got %q", logs.String())
+	}
+
+	do("/models?limit=5", "dbg-1")
+	line := logs.String()
+	for _, want := range []string{
+		"bridge debug ",
+		"device=dbg-1",
+		"subject=bridge-static-token",
+		"access=allowed",
+		`request="GET /models?limit=5 HTTP/1.1"`,
+		"status=200 core_status=200",
+		"duration_ms=",
+	} {
+		if !strings.Contains(line, want) {
+			t.Fatalf("expected %q in debug log, got %q", want, line)
+		}
+	}
+
+	logs.Reset()
+	do("/ws?device_id=dbg-1&token=bridge", "")
+	if line := logs.String(); !strings.Contains(line, "token=REDACTED") || strings.Contains(line, "token=bridge") {
+		t.Fatalf("expected /ws token redacted in debug log, got %q", line)
+	}
+}
+
+func TestServeStaleOnErrorFallsBackToCachedModels(t *testing.T) {
+	var failing atomic.Bool
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"core down"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name":"local"}]`))
+	}))
+
+	newBridge := func(serveStale bool) *Handler {
+		h, err := NewHandler(Config{
+			CoreBaseURL:       core.URL,
+			BridgeToken:       "secret",
+			CacheTTLs:         map[string]time.Duration{"/models": 20 * time.Millisecond},
+			ServeStaleOnError: serveStale,
+			Timeout:           5 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("new handler: %v", err)
+		}
+		return h
+	}
+	doModels := func(h *Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/models", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	h, strict := newBridge(true), newBridge(false)
+	for _, bridge := range []*Handler{h, strict} {
+		if rr := doModels(bridge); rr.Code != http.StatusOK || rr.Header().Get("X-Cache") != "" {
+			t.Fatalf("expected fresh models, got %d headers=%#v", rr.Code, rr.Header())
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	failing.Store(true)
+
+	if rr := doModels(strict); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected core 503 relayed without ServeStaleOnError, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	assertStale := func(rr *httptest.ResponseRecorder) {
+		t.Helper()
+		if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"name":"local"`) {
+			t.Fatalf("expected stale models, got %d body=%s", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Cache") != "STALE" || !strings.HasPrefix(rr.Header().Get("Warning"), "111 ") {
+			t.Fatalf("expected stale markers, got %#v", rr.Header())
+		}
+	}
+	assertStale(doModels(h))
+
+	core.Close()
+	assertStale(doModels(h))
+}
+
+func TestTerminalSessionCapAppliesToHTTPStarts(t *testing.T) {
+	var started int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/terminal/sessions":
+			id := atomic.AddInt64(&started, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"id":"term%d","open":true}`, id)
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			_, _ = w.Write([]byte(`{"closed":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:                   core.URL,
+		BridgeToken:                   "bridge",
+		MaxTerminalSessionsPerSubject: 1,
+		Timeout:                       5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	post := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"command":"bash"}`))
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("/terminal/sessions"); rr.Code != http.StatusCreated {
+		t.Fatalf("expected first start to reach core, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	rr := post("/terminal/sessions")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the cap is reached, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if payload["code"] != "terminal_session_limit" || payload["limit"] != float64(1) {
+		t.Fatalf("unexpected limit payload: %#v", payload)
+	}
+	if got := atomic.LoadInt64(&started); got != 1 {
+		t.Fatalf("expected capped start not to reach core, got %d starts", got)
+	}
+
+	if rr := post("/terminal/sessions/term1/close"); rr.Code != http.StatusOK {
+		t.Fatalf("expected close 200, got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := post("/terminal/sessions"); rr.Code != http.StatusCreated {
+		t.Fatalf("expected close to free a slot, got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStreamRoutesRelayCoreTrailers(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/jobs/job-1/stream", "/dashboard":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			w.Header().Set("Trailer", "X-Checksum")
+			_, _ = w.Write([]byte("event: end\ndata: {\"id\":\"job-1\"}\n\n"))
+			w.Header().Set("X-Checksum", "sha256:abc")
+		case "/jobs/job-2/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: end\ndata: {\"id\":\"job-2\"}\n\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	get := func(path string) (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer bridge")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("get %s: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		return resp, string(body)
+	}
+
+	resp, body := get("/jobs/job-1/stream")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "event: end") {
+		t.Fatalf("unexpected stream response %d body=%q", resp.StatusCode, body)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "sha256:abc" {
+		t.Fatalf("expected relayed X-Checksum trailer, got %q (trailer=%#v)", got, resp.Trailer)
+	}
+
+	resp, body = get("/jobs/job-2/stream")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "job-2") {
+		t.Fatalf("unexpected stream response %d body=%q", resp.StatusCode, body)
+	}
+	if len(resp.Trailer) != 0 || resp.Header.Get("Trailer") != "" {
+		t.Fatalf("expected no trailers without core trailers, got %#v", resp.Trailer)
+	}
+
+	resp, _ = get("/dashboard")
+	if len(resp.Trailer) != 0 {
+		t.Fatalf("expected non-stream raw route to drop trailers, got %#v", resp.Trailer)
+	}
+}
+
+func TestGzipResponsesHonorMinBytesAndLevel(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/models":
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+		case "/plans":
+			_, _ = fmt.Fprintf(w, `{"plans":[],"note":%q}`, strings.Repeat("x", 2048))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:   core.URL,
+		BridgeToken:   "bridge",
+		GzipResponses: true,
+		GzipMinBytes:  512,
+		GzipLevel:     gzip.BestSpeed,
+		Timeout:       5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer bridge")
+		req.Header.Set("Accept-Encoding", "gzip")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	small := get("/models")
+	if small.Code != http.StatusOK || small.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected small body uncompressed, got %d encoding=%q", small.Code, small.Header().Get("Content-Encoding"))
+	}
+
+	large := get("/plans")
+	if large.Code != http.StatusOK || large.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected large body gzipped, got %d encoding=%q", large.Code, large.Header().Get("Content-Encoding"))
+	}
+	compressed := large.Body.Bytes()
+	// Byte 9 of the gzip header (XFL) is 4 for BestSpeed and 2 for BestCompression.
+	if len(compressed) < 10 || compressed[8] != 4 {
+		t.Fatalf("expected BestSpeed gzip header, got % x", compressed[:10])
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !strings.Contains(string(plain), `"plans":[]`) {
+		t.Fatalf("unexpected decompressed body %q", plain)
+	}
+
+	for _, cfg := range []Config{
+		{CoreBaseURL: core.URL, BridgeToken: "bridge", GzipMinBytes: -1},
+		{CoreBaseURL: core.URL, BridgeToken: "bridge", GzipLevel: 10},
+	} {
+		if _, err := NewHandler(cfg); err == nil || !strings.Contains(err.Error(), "gzip") {
+			t.Fatalf("expected invalid gzip config %+v to be rejected, got %v", cfg, err)
+		}
+	}
+}
+
+func TestFallbackResponsesServedWhenCoreDown(t *testing.T) {
+	var coreCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&coreCalls, 1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:       core.URL,
+		BridgeToken:       "bridge",
+		FallbackResponses: map[string]json.RawMessage{"/models": json.RawMessage(`{"models":[],"degraded":true}`)},
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	do := func(method string, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer bridge")
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do(http.MethodGet, "/models")
+	if rr.Code != http.StatusOK || rr.Header().Get("X-Bridge-Fallback") != "true" {
+		t.Fatalf("expected fallback 200, got %d headers=%#v body=%s", rr.Code, rr.Header(), rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if payload["degraded"] != true || payload["request_id"] == "" {
+		t.Fatalf("unexpected fallback payload %#v", payload)
+	}
+
+	if rr := do(http.MethodGet, "/plans"); rr.Code != http.StatusBadGateway || rr.Header().Get("X-Bridge-Fallback") != "" {
+		t.Fatalf("expected 502 without a configured fallback, got %d", rr.Code)
+	}
+
+	// Once repeated failures eject the only replica, fallbacks skip core entirely.
+	for i := 0; i < 3; i++ {
+		_ = do(http.MethodGet, "/plans")
+	}
+	if _, down := h.cores.unavailableFor(time.Now()); !down {
+		t.Fatalf("expected core replica to be ejected")
+	}
+	before := atomic.LoadInt64(&coreCalls)
+	if rr := do(http.MethodGet, "/models"); rr.Code != http.StatusOK || rr.Header().Get("X-Bridge-Fallback") != "true" {
+		t.Fatalf("expected fallback while core is ejected, got %d", rr.Code)
+	}
+	if got := atomic.LoadInt64(&coreCalls); got != before {
+		t.Fatalf("expected fallback without contacting core, got %d extra calls", got-before)
+	}
+
+	if _, err := NewHandler(Config{
+		CoreBaseURL:       core.URL,
+		BridgeToken:       "bridge",
+		FallbackResponses: map[string]json.RawMessage{"/models": json.RawMessage(`{`)},
+	}); err == nil {
+		t.Fatalf("expected invalid fallback JSON to be rejected")
+	}
+}
+
+func TestTerminalSessionHTTPCloseOnlyFreesOwnSlot(t *testing.T) {
+	var started int64
+	var closeStatus int64 = http.StatusOK
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/terminal/sessions":
+			id := atomic.AddInt64(&started, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"id":"term%d","open":true}`, id)
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			w.WriteHeader(int(atomic.LoadInt64(&closeStatus)))
+			_, _ = w.Write([]byte(`{"closed":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:                   core.URL,
+		BridgeToken:                   "bridge",
+		MaxTerminalSessionsPerSubject: 1,
+		Timeout:                       5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	tokens := map[string]string{}
+	for _, subject := range []string{"alice", "bob"} {
+		token, _, err := h.issueSessionToken(subject, []string{scopeRead, scopeRun}, "", 120)
+		if err != nil {
+			t.Fatalf("issue %s token: %v", subject, err)
+		}
+		tokens[subject] = token
+	}
+	post := func(subject string, path string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"command":"bash"}`))
+		req.Header.Set("Authorization", "Bearer "+tokens[subject])
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := post("alice", "/terminal/sessions"); code != http.StatusCreated {
+		t.Fatalf("expected first start to succeed, got %d", code)
+	}
+	_ = post("bob", "/terminal/sessions/term1/close")
+	if code := post("alice", "/terminal/sessions"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected another subject's close not to free the slot, got %d", code)
+	}
+	atomic.StoreInt64(&closeStatus, http.StatusForbidden)
+	_ = post("alice", "/terminal/sessions/term1/close")
+	if code := post("alice", "/terminal/sessions"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected a rejected close not to free the slot, got %d", code)
+	}
+	atomic.StoreInt64(&closeStatus, http.StatusOK)
+	_ = post("alice", "/terminal/sessions/term1/close")
+	if code := post("alice", "/terminal/sessions"); code != http.StatusCreated {
+		t.Fatalf("expected the owner's close to free the slot, got %d", code)
 	}
 }
@@ -1,6 +1,7 @@
 package relay
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"encoding/pem"
 	"net/http"
@@ -44,6 +45,40 @@ func TestNewHandlerRejectsMissingCoreCAFile(t *testing.T) {
 	}
 }
 
+func TestNewHandlerRejectsInvalidCoreTLSPolicy(t *testing.T) {
+	_, err := NewHandler(Config{
+		CoreBaseURL:       "https://core.example.com",
+		BridgeToken:       "secret",
+		CoreTLSMinVersion: "1.1",
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported core TLS minimum version") {
+		t.Fatalf("expected invalid min version error, got %v", err)
+	}
+
+	_, err = NewHandler(Config{
+		CoreBaseURL:         "https://core.example.com",
+		BridgeToken:         "secret",
+		CoreTLSCipherSuites: []string{"TLS_NOT_A_REAL_SUITE"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unknown core TLS cipher suite") {
+		t.Fatalf("expected unknown cipher error, got %v", err)
+	}
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:         "https://core.example.com",
+		BridgeToken:         "secret",
+		CoreTLSMinVersion:   "1.3",
+		CoreTLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	transport, ok := h.client.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig.MinVersion != tls.VersionTLS13 || len(transport.TLSClientConfig.CipherSuites) != 1 {
+		t.Fatalf("expected TLS 1.3 policy on core transport, got %#v", h.client.Transport)
+	}
+}
+
 func TestHealthDeepHTTPSFailsWithoutTrustedCA(t *testing.T) {
 	core := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/health" {
@@ -125,3 +160,138 @@ func TestHealthDeepHTTPSWithCustomCAFile(t *testing.T) {
 		t.Fatalf("expected reachable=true: %#v", corePayload)
 	}
 }
+
+func TestAdminCorePingReportsTLSDetails(t *testing.T) {
+	core := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			_, _ = w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer core.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: core.Certificate().Raw})
+	caFile := filepath.Join(t.TempDir(), "core-ca.pem")
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatalf("write core ca file: %v", err)
+	}
+	h, err := NewHandler(Config{
+		CoreBaseURL:       core.URL,
+		BridgeToken:       "secret",
+		CoreCAFile:        caFile,
+		CoreTLSMinVersion: "1.3",
+		Timeout:           5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/core/ping", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("unmarshal ping payload: %v", err)
+	}
+	replicas, _ := payload["replicas"].([]any)
+	if payload["ok"] != true || len(replicas) != 1 {
+		t.Fatalf("expected one reachable replica, got %#v", payload)
+	}
+	result, _ := replicas[0].(map[string]any)
+	tlsDetails, _ := result["tls"].(map[string]any)
+	if result["reachable"] != true || result["healthy"] != true || tlsDetails["version"] != "TLS 1.3" {
+		t.Fatalf("unexpected ping result: %#v", result)
+	}
+	if tlsDetails["cert_not_after"] == "" || result["duration_ms"] == nil {
+		t.Fatalf("expected cert expiry and timing, got %#v", result)
+	}
+
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/admin/core/ping", nil)
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-admin, got %d", rr.Code)
+	}
+}
+
+func TestNewServerDisableHTTP2ClearsNextProto(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://core.example.com", BridgeToken: "secret"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if server := NewServer(":0", h); server.TLSNextProto != nil {
+		t.Fatalf("expected default HTTP/2 negotiation, got %#v", server.TLSNextProto)
+	}
+
+	h, err = NewHandler(Config{CoreBaseURL: "http://core.example.com", BridgeToken: "secret", DisableHTTP2: true})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := NewServer(":0", h)
+	if server.TLSNextProto == nil || len(server.TLSNextProto) != 0 {
+		t.Fatalf("expected empty non-nil TLSNextProto, got %#v", server.TLSNextProto)
+	}
+}
+
+func TestHealthDeepHTTPSWithInlineCAPEM(t *testing.T) {
+	core := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: core.Certificate().Raw})
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL: core.URL,
+			BridgeToken: "secret",
+			Timeout:     5 * time.Second,
+			CoreCAFile:  "/tmp/non-existent-core-ca.pem",
+			CoreCAPEM:   string(caPEM),
+		},
+	)
+	if err != nil {
+		t.Fatalf("expected inline PEM to take precedence over the file path: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/health?deep=1", nil)
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestNewHandlerRejectsPartialInlineClientCertPEM(t *testing.T) {
+	_, err := NewHandler(
+		Config{
+			CoreBaseURL:       "https://core.example.com",
+			BridgeToken:       "secret",
+			CoreClientCertPEM: "-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n",
+		},
+	)
+	if err == nil || !strings.Contains(err.Error(), "both core client cert and key PEM must be provided together") {
+		t.Fatalf("expected partial inline PEM error, got %v", err)
+	}
+
+	_, err = NewHandler(
+		Config{
+			CoreBaseURL:       "https://core.example.com",
+			BridgeToken:       "secret",
+			CoreClientCertPEM: "not a cert",
+			CoreClientKeyPEM:  "not a key",
+		},
+	)
+	if err == nil || !strings.Contains(err.Error(), "failed to parse core client certificate PEM") {
+		t.Fatalf("expected invalid inline PEM error, got %v", err)
+	}
+}
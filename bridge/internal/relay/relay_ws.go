@@ -10,7 +10,6 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -20,29 +19,82 @@ import (
 const (
 	defaultWSPollTimeoutSeconds  = 20.0
 	defaultWSPollIntervalSeconds = 0.25
+	wsMaxMessageBytes            = maxRequestBodyBytes
+	wsMaxEventsPerPoll           = 500
 )
 
-var wsUpgrader = websocket.Upgrader{
-	CheckOrigin: func(_ *http.Request) bool {
-		// Authorization is enforced at the bridge; allow non-browser and mobile origins.
-		return true
-	},
+// wsClientMessageTypes lists every type accepted by handleWSClientMessage and is
+// reported by the "capabilities" message. Keep in sync with the switch below.
+var wsClientMessageTypes = []string{
+	"ping",
+	"diag",
+	"capabilities",
+	"health",
+	"set_since_id",
+	"ack_events",
+	"set_entity_filter",
+	"terminal_list",
+	"terminal_start",
+	"terminal_poll",
+	"terminal_input",
+	"terminal_close",
+	"browser_status",
+	"browser_pages",
+	"browser_action",
+	"browser_navigate",
+	"browser_click",
+	"browser_fill",
+	"browser_extract_text",
+	"browser_screenshot",
+	"browser_wait_for_selector",
+	"browser_evaluate_js",
+	"browser_close",
+	"subscribe_plan",
+	"unsubscribe_plan",
+	"command",
+	"batch",
+}
+
+// defaultWSHandshakeTimeout is used when Config.WSHandshakeTimeout is zero.
+const defaultWSHandshakeTimeout = 10 * time.Second
+
+// newWSUpgrader returns the handler's upgrader. handshakeTimeout becomes gorilla's
+// HandshakeTimeout, a deadline on the upgraded connection while the handshake
+// response is written, so a client that stalls mid-upgrade cannot pin a goroutine.
+func newWSUpgrader(handshakeTimeout time.Duration) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		HandshakeTimeout: handshakeTimeout,
+		CheckOrigin: func(_ *http.Request) bool {
+			// ServeHTTP already rejects an Origin outside Config.CORSAllowedOrigins (or the
+			// bridge's own origin) with 403 before the upgrade; requests without Origin are
+			// non-browser clients and rely on token auth.
+			return true
+		},
+	}
 }
 
 type wsClientMessage struct {
-	Type           string         `json:"type"`
-	ID             string         `json:"id,omitempty"`
-	Method         string         `json:"method,omitempty"`
-	Path           string         `json:"path,omitempty"`
-	Query          string         `json:"query,omitempty"`
-	Body           map[string]any `json:"body,omitempty"`
-	IdempotencyKey string         `json:"idempotency_key,omitempty"`
-	AcceptBinary   bool           `json:"accept_binary,omitempty"`
-	SinceID        *int64         `json:"since_id,omitempty"`
-	SessionID      string         `json:"session_id,omitempty"`
-	SinceSeq       *int64         `json:"since_seq,omitempty"`
-	Limit          *int           `json:"limit,omitempty"`
-	Input          string         `json:"input,omitempty"`
+	Type           string            `json:"type"`
+	ID             string            `json:"id,omitempty"`
+	Method         string            `json:"method,omitempty"`
+	Path           string            `json:"path,omitempty"`
+	Query          string            `json:"query,omitempty"`
+	Body           map[string]any    `json:"body,omitempty"`
+	IdempotencyKey string            `json:"idempotency_key,omitempty"`
+	AcceptBinary   bool              `json:"accept_binary,omitempty"`
+	SinceID        *int64            `json:"since_id,omitempty"`
+	SessionID      string            `json:"session_id,omitempty"`
+	SinceSeq       *int64            `json:"since_seq,omitempty"`
+	Limit          *int              `json:"limit,omitempty"`
+	Input          string            `json:"input,omitempty"`
+	PlanID         string            `json:"plan_id,omitempty"`
+	Payload        any               `json:"payload,omitempty"`
+	EntityID       string            `json:"entity_id,omitempty"`
+	EntityType     string            `json:"entity_type,omitempty"`
+	LastID         *int64            `json:"last_id,omitempty"`
+	Commands       []wsClientMessage `json:"commands,omitempty"`
+	Parallel       bool              `json:"parallel,omitempty"`
+	MaxParallel    *int              `json:"max_parallel,omitempty"`
 }
 
 type wsSSEEvent struct {
@@ -50,18 +102,6 @@ type wsSSEEvent struct {
 	Data  map[string]any
 }
 
-type wsJSONWriter struct {
-	conn *websocket.Conn
-	mu   sync.Mutex
-}
-
-func (w *wsJSONWriter) write(payload map[string]any) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-	_ = w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-	return w.conn.WriteJSON(payload)
-}
-
 func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request, requestID string, auth authContext) int {
 	if r.Method != http.MethodGet {
 		h.writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": "Method not allowed", "request_id": requestID})
@@ -71,6 +111,33 @@ func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request, reques
 		h.writeJSON(w, http.StatusForbidden, map[string]any{"error": "Forbidden", "request_id": requestID})
 		return http.StatusForbidden
 	}
+	if h.missingTenant(auth) {
+		h.writeJSON(w, http.StatusForbidden, map[string]any{"error": "Tenant required", "code": "tenant_required", "request_id": requestID})
+		return http.StatusForbidden
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		// Plain HTTP clients (e.g. curl) get an explanation instead of gorilla's bare 400.
+		w.Header().Set("Upgrade", "websocket")
+		h.writeJSON(
+			w,
+			http.StatusUpgradeRequired,
+			map[string]any{
+				"error":      "Upgrade Required",
+				"detail":     "/ws is a WebSocket endpoint; connect with a WebSocket client (Connection: Upgrade, Upgrade: websocket)",
+				"request_id": requestID,
+			},
+		)
+		return http.StatusUpgradeRequired
+	}
+	var resume *wsResumeClaims
+	if token := strings.TrimSpace(r.URL.Query().Get("resume")); token != "" {
+		claims, err := h.verifyWSResumeToken(token, auth)
+		if err != nil {
+			h.writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error(), "request_id": requestID})
+			return http.StatusBadRequest
+		}
+		resume = &claims
+	}
 	if !h.tryAcquireWSConnection() {
 		atomic.AddUint64(&h.wsRejectedTotal, 1)
 		h.writeJSON(
@@ -82,55 +149,114 @@ func (h *Handler) handleWebSocket(w http.ResponseWriter, r *http.Request, reques
 	}
 	defer h.releaseWSConnection()
 
-	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	conn, err := h.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return http.StatusBadRequest
 	}
-	writer := &wsJSONWriter{conn: conn}
-
-	if err := writer.write(
-		map[string]any{
-			"type":       "hello",
-			"request_id": requestID,
-			"service":    "novaadapt-bridge-go",
-		},
-	); err != nil {
-		_ = conn.Close()
-		return http.StatusSwitchingProtocols
+	conn.SetReadLimit(wsMaxMessageBytes)
+	// A resumed connection keeps its connection_id so client and server logs
+	// correlate across reconnects.
+	connectionID := normalizeRequestID("")
+	if resume != nil && resume.ConnectionID != "" {
+		connectionID = resume.ConnectionID
 	}
+	writer := newWSJSONWriter(conn, h.cfg.WSSendQueueSize, &h.wsDroppedTotal, connectionID)
 
 	var lastEventID int64 = max64(0, parseInt64OrDefault(r.URL.Query().Get("since_id"), 0))
-	pollTimeoutSeconds := clampFloat(
-		parseFloatOrDefault(r.URL.Query().Get("poll_timeout"), defaultWSPollTimeoutSeconds),
-		1.0,
-		120.0,
-	)
-	pollIntervalSeconds := clampFloat(
-		parseFloatOrDefault(r.URL.Query().Get("poll_interval"), defaultWSPollIntervalSeconds),
-		0.05,
-		5.0,
-	)
+	pollTimeoutSeconds := parseFloatOrDefault(r.URL.Query().Get("poll_timeout"), defaultWSPollTimeoutSeconds)
+	pollIntervalSeconds := parseFloatOrDefault(r.URL.Query().Get("poll_interval"), defaultWSPollIntervalSeconds)
+	if resume != nil {
+		lastEventID = max64(0, resume.SinceID)
+		pollTimeoutSeconds = resume.PollTimeout
+		pollIntervalSeconds = resume.PollInterval
+	}
+	backfill := r.URL.Query().Get("backfill") == "1"
+	eventFilter := newWSEventFilter(r.URL.Query().Get("entity_id"), r.URL.Query().Get("entity_type"))
+	if resume != nil {
+		eventFilter.set(resume.EntityID, resume.EntityType)
+	}
+	pollTimeoutSeconds = clampFloat(pollTimeoutSeconds, 1.0, 120.0)
+	pollIntervalSeconds = clampFloat(pollIntervalSeconds, 0.05, 5.0)
+	requireAck := r.URL.Query().Get("require_ack") == "1"
+	ackTimeoutSeconds := clampFloat(parseFloatOrDefault(r.URL.Query().Get("ack_timeout"), defaultWSAckTimeoutSeconds), 0.1, 120.0)
+	ackTimeout := time.Duration(ackTimeoutSeconds * float64(time.Second))
 
 	done := make(chan struct{})
+	planStreams := newWSPlanStreams(done, pollTimeoutSeconds, pollIntervalSeconds)
+	resumeState := wsResumeState(connectionID, lastEventID, planStreams, eventFilter)
+	var restoredPlans []string
+	if resume != nil {
+		restoredPlans = resumablePlans(auth, resume.Plans)
+		resumeState.Plans = restoredPlans
+	}
+
+	hello := map[string]any{
+		"type":          "hello",
+		"request_id":    requestID,
+		"connection_id": connectionID,
+		"service":       "novaadapt-bridge-go",
+		"since_id":      lastEventID,
+		"resumed":       resume != nil,
+	}
+	if resume != nil {
+		hello["restored_plans"] = restoredPlans
+	}
+	if token := h.issueWSResumeToken(auth, resumeState); token != "" {
+		hello["resume_token"] = token
+	}
+	if err := writer.write(hello); err != nil {
+		_ = conn.Close()
+		writer.close()
+		return http.StatusSwitchingProtocols
+	}
+	if notice := h.wsBannerFrame(requestID); notice != nil {
+		if err := writer.write(notice); err != nil {
+			_ = conn.Close()
+			writer.close()
+			return http.StatusSwitchingProtocols
+		}
+	}
+	for _, planID := range restoredPlans {
+		h.startPlanStream(auth, writer, requestID, planID, planStreams)
+	}
+
+	healthThrottle := &wsHealthThrottle{}
+	var acks *wsAckTracker
+	if requireAck {
+		acks = newWSAckTracker()
+	}
 	pumpDone := make(chan struct{})
-	go func() {
-		defer close(pumpDone)
-		h.wsAuditPump(done, writer, requestID, &lastEventID, pollTimeoutSeconds, pollIntervalSeconds)
-	}()
+	// The shared pump fans one poll out to every connection, so connections that
+	// acknowledge events always get their own pump.
+	if h.cfg.SharedAuditPump && !requireAck {
+		unsubscribe := h.subscribeSharedAudit(auth, writer, requestID, &lastEventID, eventFilter)
+		go func() {
+			defer close(pumpDone)
+			<-done
+			unsubscribe()
+		}()
+	} else {
+		go func() {
+			defer close(pumpDone)
+			h.wsAuditPump(auth, done, writer, requestID, &lastEventID, pollTimeoutSeconds, pollIntervalSeconds, backfill, eventFilter, acks, ackTimeout)
+		}()
+	}
 
 	for {
 		var msg wsClientMessage
 		if err := conn.ReadJSON(&msg); err != nil {
 			break
 		}
-		if err := h.handleWSClientMessage(writer, requestID, &lastEventID, msg, auth); err != nil {
+		if err := h.handleWSClientMessage(writer, requestID, &lastEventID, msg, auth, planStreams, eventFilter, healthThrottle, acks); err != nil {
 			break
 		}
 	}
 
 	close(done)
 	_ = conn.Close()
+	planStreams.closeAll()
 	<-pumpDone
+	writer.close()
 	return http.StatusSwitchingProtocols
 }
 
@@ -160,13 +286,20 @@ func (h *Handler) releaseWSConnection() {
 }
 
 func (h *Handler) wsAuditPump(
+	auth authContext,
 	done <-chan struct{},
 	writer *wsJSONWriter,
 	requestID string,
 	lastEventID *int64,
 	pollTimeoutSeconds float64,
 	pollIntervalSeconds float64,
+	backfill bool,
+	eventFilter *wsEventFilter,
+	acks *wsAckTracker,
+	ackTimeout time.Duration,
 ) {
+	backoff := h.newWSPumpBackoff()
+	checkBacklog := true
 	for {
 		select {
 		case <-done:
@@ -175,46 +308,98 @@ func (h *Handler) wsAuditPump(
 		}
 
 		currentSinceID := atomic.LoadInt64(lastEventID)
-		events, nextSinceID, err := h.pollAuditEvents(
+		events, nextSinceID, latestID, err := h.pollAuditEvents(
+			auth,
 			requestID,
 			currentSinceID,
 			pollTimeoutSeconds,
 			pollIntervalSeconds,
 		)
 		if err != nil {
-			if writeErr := writer.write(
-				map[string]any{
-					"type":       "error",
-					"source":     "events",
-					"error":      err.Error(),
-					"request_id": requestID,
-				},
-			); writeErr != nil {
+			h.recordWSPumpError()
+			delay, notify, stop := backoff.failure(err)
+			if stop {
 				return
 			}
+			if notify {
+				if writeErr := writer.write(wsPumpErrorFrame(err, requestID)); writeErr != nil {
+					return
+				}
+			}
 			select {
 			case <-done:
 				return
-			case <-time.After(500 * time.Millisecond):
+			case <-time.After(delay):
 			}
 			continue
 		}
+		backoff.reset()
+
+		floorID := currentSinceID
+		if checkBacklog {
+			checkBacklog = false
+			if skipTo, skipped := h.wsBacklogSkip(currentSinceID, latestID, backfill); skipped > 0 {
+				if err := writer.write(
+					map[string]any{
+						"type":       "backlog_skipped",
+						"skipped":    skipped,
+						"since_id":   skipTo,
+						"latest_id":  latestID,
+						"request_id": requestID,
+					},
+				); err != nil {
+					return
+				}
+				events = auditEventsAfter(events, skipTo)
+				nextSinceID = max64(nextSinceID, skipTo)
+				floorID = skipTo
+			}
+		}
 
-		if nextSinceID > currentSinceID {
+		// With require_ack=1 the cursor only moves once the client acknowledges
+		// the batch, so unacknowledged events are polled and delivered again.
+		if acks == nil && nextSinceID > currentSinceID {
 			atomic.StoreInt64(lastEventID, nextSinceID)
 		}
+		if acks != nil {
+			acks.expect(floorID, nextSinceID)
+		}
 
+		delivered := 0
 		for _, item := range events {
-			if err := writer.write(
-				map[string]any{
-					"type":       "event",
-					"event":      item.Event,
-					"data":       item.Data,
-					"request_id": requestID,
-				},
-			); err != nil {
+			if !eventFilter.matches(item.Data) {
+				continue
+			}
+			frame := map[string]any{
+				"type":       "event",
+				"event":      item.Event,
+				"data":       item.Data,
+				"request_id": requestID,
+			}
+			write := writer.writeDroppable
+			if acks != nil {
+				write = writer.write
+			}
+			if err := write(frame); err != nil {
 				return
 			}
+			delivered++
+		}
+
+		if acks != nil && nextSinceID > currentSinceID {
+			ackedID := nextSinceID
+			if delivered > 0 {
+				if err := writer.write(
+					map[string]any{"type": "ack_required", "last_id": nextSinceID, "request_id": requestID},
+				); err != nil {
+					return
+				}
+				ackedID, _ = acks.wait(done, ackTimeout)
+			}
+			if ackedID > currentSinceID {
+				atomic.StoreInt64(lastEventID, ackedID)
+			}
+			continue
 		}
 
 		if len(events) == 0 {
@@ -233,11 +418,30 @@ func (h *Handler) handleWSClientMessage(
 	lastEventID *int64,
 	msg wsClientMessage,
 	auth authContext,
+	planStreams *wsPlanStreams,
+	eventFilter *wsEventFilter,
+	healthThrottle *wsHealthThrottle,
+	acks *wsAckTracker,
 ) error {
 	msgType := strings.ToLower(strings.TrimSpace(msg.Type))
+	if frame := h.wsCoreUnavailableFrame(msgType, msg, requestID); frame != nil {
+		return writer.write(frame)
+	}
 	switch msgType {
 	case "ping":
-		return writer.write(map[string]any{"type": "pong", "id": msg.ID, "request_id": requestID})
+		pong := map[string]any{"type": "pong", "id": msg.ID, "request_id": requestID}
+		// Refresh the resume token so a reconnect restores the current cursor,
+		// plan subscriptions and entity filter.
+		if token := h.issueWSResumeToken(auth, wsResumeState(writer.connectionID, atomic.LoadInt64(lastEventID), planStreams, eventFilter)); token != "" {
+			pong["resume_token"] = token
+		}
+		return writer.write(pong)
+	case "diag":
+		return writer.write(wsDiagResult(writer, msg, requestID))
+	case "capabilities":
+		return writer.write(h.wsCapabilitiesPayload(msg.ID, requestID))
+	case "health":
+		return h.handleWSHealth(writer, requestID, msg, auth, healthThrottle)
 	case "set_since_id":
 		if msg.SinceID == nil {
 			return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": "'since_id' is required", "request_id": requestID})
@@ -245,6 +449,14 @@ func (h *Handler) handleWSClientMessage(
 		next := max64(0, *msg.SinceID)
 		atomic.StoreInt64(lastEventID, next)
 		return writer.write(map[string]any{"type": "ack", "id": msg.ID, "request_id": requestID, "since_id": next})
+	case "ack_events":
+		return h.handleWSAckEvents(writer, requestID, msg, acks)
+	case "set_entity_filter":
+		eventFilter.set(msg.EntityID, msg.EntityType)
+		entityID, entityType := eventFilter.snapshot()
+		return writer.write(
+			map[string]any{"type": "ack", "id": msg.ID, "request_id": requestID, "entity_id": entityID, "entity_type": entityType},
+		)
 	case "terminal_list":
 		return h.handleWSTerminalList(writer, requestID, msg, auth)
 	case "terminal_start":
@@ -284,8 +496,14 @@ func (h *Handler) handleWSClientMessage(
 		return h.handleWSBrowserPost(writer, requestID, msg, auth, "/browser/evaluate_js", "browser_evaluate_js_result")
 	case "browser_close":
 		return h.handleWSBrowserPost(writer, requestID, msg, auth, "/browser/close", "browser_closed")
+	case "subscribe_plan":
+		return h.handleWSSubscribePlan(writer, requestID, msg, auth, planStreams)
+	case "unsubscribe_plan":
+		return h.handleWSUnsubscribePlan(writer, requestID, msg, planStreams)
 	case "command":
 		return h.handleWSCommand(writer, requestID, msg, auth)
+	case "batch":
+		return h.handleWSBatch(writer, requestID, msg, auth)
 	default:
 		return writer.write(
 			map[string]any{
@@ -298,6 +516,27 @@ func (h *Handler) handleWSClientMessage(
 	}
 }
 
+func (h *Handler) wsCapabilitiesPayload(id string, requestID string) map[string]any {
+	types := make([]string, len(wsClientMessageTypes))
+	copy(types, wsClientMessageTypes)
+	return map[string]any{
+		"type":          "capabilities",
+		"id":            id,
+		"message_types": types,
+		"binary":        true,
+		"compression":   h.wsUpgrader.EnableCompression,
+		"limits": map[string]any{
+			"max_message_bytes":   wsMaxMessageBytes,
+			"max_events_per_poll": wsMaxEventsPerPoll,
+			"max_backlog_events":  h.cfg.WSMaxBacklogEvents,
+			"max_batch_commands":  wsMaxBatchCommands,
+		},
+		"service":    "novaadapt-bridge-go",
+		"version":    Version,
+		"request_id": requestID,
+	}
+}
+
 func (h *Handler) handleWSTerminalList(
 	writer *wsJSONWriter,
 	requestID string,
@@ -320,6 +559,7 @@ func (h *Handler) handleWSTerminalList(
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodGet,
 		path,
 		"",
@@ -363,9 +603,25 @@ func (h *Handler) handleWSTerminalStart(
 			},
 		)
 	}
+	if command, ok := h.allowsTerminalCommand(http.MethodPost, path, msg.Body); !ok {
+		return writer.write(terminalCommandDeniedFrame(msg, command, requestID))
+	}
+	if h.terminalSessionLimitReached(auth, time.Now()) {
+		return writer.write(
+			map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      "terminal session limit reached",
+				"code":       "terminal_session_limit",
+				"limit":      h.cfg.MaxTerminalSessionsPerSubject,
+				"request_id": requestID,
+			},
+		)
+	}
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodPost,
 		path,
 		"",
@@ -376,6 +632,7 @@ func (h *Handler) handleWSTerminalStart(
 	if err != nil {
 		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": err.Error(), "request_id": requestID})
 	}
+	h.trackTerminalSession(auth, coreResult, time.Now())
 
 	return writer.write(
 		map[string]any{
@@ -428,6 +685,7 @@ func (h *Handler) handleWSTerminalPoll(
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodGet,
 		path,
 		query,
@@ -491,6 +749,7 @@ func (h *Handler) handleWSTerminalInput(
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodPost,
 		path,
 		"",
@@ -542,6 +801,7 @@ func (h *Handler) handleWSTerminalClose(
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodPost,
 		path,
 		"",
@@ -552,6 +812,7 @@ func (h *Handler) handleWSTerminalClose(
 	if err != nil {
 		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": err.Error(), "request_id": requestID})
 	}
+	h.releaseTerminalSession(auth, sessionID, coreResult.StatusCode)
 
 	return writer.write(
 		map[string]any{
@@ -590,6 +851,7 @@ func (h *Handler) handleWSBrowserGet(
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodGet,
 		path,
 		"",
@@ -615,6 +877,20 @@ func (h *Handler) handleWSBrowserGet(
 	)
 }
 
+// wsDiagResult echoes a "diag" payload with connection details without calling core.
+func wsDiagResult(writer *wsJSONWriter, msg wsClientMessage, requestID string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"type":        "diag_result",
+		"id":          msg.ID,
+		"payload":     msg.Payload,
+		"server_time": now.UTC().Format(time.RFC3339Nano),
+		"subprotocol": writer.conn.Subprotocol(),
+		"uptime_ms":   now.Sub(writer.openedAt).Milliseconds(),
+		"request_id":  requestID,
+	}
+}
+
 func (h *Handler) handleWSBrowserPost(
 	writer *wsJSONWriter,
 	requestID string,
@@ -640,9 +916,13 @@ func (h *Handler) handleWSBrowserPost(
 	if body == nil {
 		body = map[string]any{}
 	}
+	if action, ok := h.allowsBrowserAction(http.MethodPost, path, body); !ok {
+		return writer.write(browserActionDeniedFrame(msg, action, requestID))
+	}
 
 	commandRequestID := normalizeRequestID("")
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		http.MethodPost,
 		path,
 		"",
@@ -671,6 +951,12 @@ func (h *Handler) handleWSBrowserPost(
 }
 
 func (h *Handler) handleWSCommand(writer *wsJSONWriter, requestID string, msg wsClientMessage, auth authContext) error {
+	return writer.write(h.wsCommandFrame(requestID, msg, auth))
+}
+
+// wsCommandFrame runs one "command" message and returns its command_result or
+// error frame.
+func (h *Handler) wsCommandFrame(requestID string, msg wsClientMessage, auth authContext) map[string]any {
 	method := strings.ToUpper(strings.TrimSpace(msg.Method))
 	if method == "" {
 		if msg.Body != nil {
@@ -679,8 +965,8 @@ func (h *Handler) handleWSCommand(writer *wsJSONWriter, requestID string, msg ws
 			method = http.MethodGet
 		}
 	}
-	if method != http.MethodGet && method != http.MethodPost {
-		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": "method must be GET or POST", "request_id": requestID})
+	if method != http.MethodGet && method != http.MethodPost && method != http.MethodPut {
+		return map[string]any{"type": "error", "id": msg.ID, "error": "method must be GET, POST, or PUT", "request_id": requestID}
 	}
 
 	path := normalizeWSPath(msg.Path)
@@ -691,73 +977,107 @@ func (h *Handler) handleWSCommand(writer *wsJSONWriter, requestID string, msg ws
 		}
 		path = path[:idx]
 	}
+	if len(path) > h.cfg.MaxPathBytes {
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      "path too long",
+			"code":       "path_too_long",
+			"request_id": requestID,
+		}
+	}
+	if isSuspiciousPath(path) {
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      "invalid path",
+			"code":       "invalid_path",
+			"request_id": requestID,
+		}
+	}
+	if method == http.MethodPut && !h.allowsMethod(method, path) {
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      "PUT is not enabled for path",
+			"path":       path,
+			"request_id": requestID,
+		}
+	}
 	if !isForwardedPath(path) || isRawForwardPath(path) || path == "/ws" {
-		return writer.write(
-			map[string]any{
-				"type":       "error",
-				"id":         msg.ID,
-				"error":      "path is not command-forwardable",
-				"path":       path,
-				"request_id": requestID,
-			},
-		)
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      "path is not command-forwardable",
+			"path":       path,
+			"request_id": requestID,
+		}
 	}
-	if !auth.canAccess(method, path) {
-		return writer.write(
-			map[string]any{
-				"type":       "error",
-				"id":         msg.ID,
-				"error":      "forbidden by token scope",
-				"path":       path,
-				"method":     method,
-				"request_id": requestID,
-			},
-		)
+	if !h.canAccess(auth, method, path) {
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      "forbidden by token scope",
+			"path":       path,
+			"method":     method,
+			"request_id": requestID,
+		}
+	}
+	if action, ok := h.allowsBrowserAction(method, path, msg.Body); !ok {
+		return browserActionDeniedFrame(msg, action, requestID)
+	}
+	if command, ok := h.allowsTerminalCommand(method, path, msg.Body); !ok {
+		return terminalCommandDeniedFrame(msg, command, requestID)
 	}
 
 	commandRequestID := normalizeRequestID("")
 	if msg.AcceptBinary {
 		if method != http.MethodGet {
-			return writer.write(
-				map[string]any{
-					"type":       "error",
-					"id":         msg.ID,
-					"error":      "binary command forwarding only supports GET",
-					"request_id": requestID,
-				},
-			)
+			return map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      "binary command forwarding only supports GET",
+				"request_id": requestID,
+			}
 		}
-		coreResult, err := h.coreRawRequest(path, query, commandRequestID)
+		releaseSubjectSlot, ok := h.acquireSubjectSlot(auth)
+		if !ok {
+			return map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      errSubjectConcurrencyLimited.Error(),
+				"request_id": requestID,
+			}
+		}
+		coreResult, err := h.coreRawRequest(auth, path, query, commandRequestID)
+		releaseSubjectSlot()
 		if err != nil {
-			return writer.write(
-				map[string]any{
-					"type":       "error",
-					"id":         msg.ID,
-					"error":      err.Error(),
-					"request_id": requestID,
-				},
-			)
+			return map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      err.Error(),
+				"request_id": requestID,
+			}
 		}
-		return writer.write(
-			map[string]any{
-				"type":   "command_result",
-				"id":     msg.ID,
-				"status": coreResult.StatusCode,
-				"payload": map[string]any{
-					"content_type": coreResult.ContentType,
-					"body_base64":  base64.StdEncoding.EncodeToString(coreResult.Payload),
-					"size_bytes":   len(coreResult.Payload),
-					"request_id":   requestID,
-				},
-				"core_request":    commandRequestID,
-				"core_request_id": coreResult.CoreRequestID,
-				"idempotency_key": "",
-				"replayed":        false,
-				"request_id":      requestID,
+		return map[string]any{
+			"type":   "command_result",
+			"id":     msg.ID,
+			"status": coreResult.StatusCode,
+			"payload": map[string]any{
+				"content_type": coreResult.ContentType,
+				"body_base64":  base64.StdEncoding.EncodeToString(coreResult.Payload),
+				"size_bytes":   len(coreResult.Payload),
+				"request_id":   requestID,
 			},
-		)
+			"core_request":    commandRequestID,
+			"core_request_id": coreResult.CoreRequestID,
+			"idempotency_key": "",
+			"replayed":        false,
+			"request_id":      requestID,
+		}
 	}
 	coreResult, err := h.coreJSONRequest(
+		auth,
 		method,
 		path,
 		query,
@@ -766,63 +1086,71 @@ func (h *Handler) handleWSCommand(writer *wsJSONWriter, requestID string, msg ws
 		msg.Body,
 	)
 	if err != nil {
-		return writer.write(
-			map[string]any{
-				"type":       "error",
-				"id":         msg.ID,
-				"error":      err.Error(),
-				"request_id": requestID,
-			},
-		)
+		return map[string]any{
+			"type":       "error",
+			"id":         msg.ID,
+			"error":      err.Error(),
+			"request_id": requestID,
+		}
+	}
+	return map[string]any{
+		"type":            "command_result",
+		"id":              msg.ID,
+		"status":          coreResult.StatusCode,
+		"payload":         coreResult.Payload,
+		"core_request":    commandRequestID,
+		"core_request_id": coreResult.CoreRequestID,
+		"idempotency_key": coreResult.IdempotencyKey,
+		"replayed":        coreResult.ReplayDetected,
+		"request_id":      requestID,
 	}
-	return writer.write(
-		map[string]any{
-			"type":            "command_result",
-			"id":              msg.ID,
-			"status":          coreResult.StatusCode,
-			"payload":         coreResult.Payload,
-			"core_request":    commandRequestID,
-			"core_request_id": coreResult.CoreRequestID,
-			"idempotency_key": coreResult.IdempotencyKey,
-			"replayed":        coreResult.ReplayDetected,
-			"request_id":      requestID,
-		},
-	)
 }
 
 func (h *Handler) pollAuditEvents(
+	auth authContext,
 	requestID string,
 	sinceID int64,
 	timeoutSeconds float64,
 	intervalSeconds float64,
-) ([]wsSSEEvent, int64, error) {
+) ([]wsSSEEvent, int64, int64, error) {
 	query := fmt.Sprintf(
 		"timeout=%s&interval=%s&since_id=%d",
 		formatFloat(timeoutSeconds),
 		formatFloat(intervalSeconds),
 		max64(0, sinceID),
 	)
-	rawResult, err := h.coreRawRequest("/events/stream", query, requestID)
+	rawResult, err := h.coreRawRequest(auth, "/events/stream", query, requestID)
 	if err != nil {
-		return nil, sinceID, err
+		return nil, sinceID, sinceID, err
 	}
 	if rawResult.StatusCode != http.StatusOK {
-		return nil, sinceID, fmt.Errorf("events stream failed with status %d: %s", rawResult.StatusCode, string(rawResult.Payload))
+		return nil, sinceID, sinceID, &coreStatusError{
+			StatusCode: rawResult.StatusCode,
+			msg:        fmt.Sprintf("events stream failed with status %d: %s", rawResult.StatusCode, string(rawResult.Payload)),
+		}
 	}
 
 	parsed := parseSSE(rawResult.Payload)
-	out := make([]wsSSEEvent, 0, len(parsed))
+	out := make([]wsSSEEvent, 0, min(len(parsed), wsMaxEventsPerPoll))
 	nextSinceID := sinceID
+	latestID := sinceID
 	for _, item := range parsed {
 		if item.Event != "audit" {
 			continue
 		}
+		value, hasID := asInt64(item.Data["id"])
+		if hasID && value > latestID {
+			latestID = value
+		}
+		if len(out) >= wsMaxEventsPerPoll {
+			continue
+		}
 		out = append(out, item)
-		if value, ok := asInt64(item.Data["id"]); ok && value > nextSinceID {
+		if hasID && value > nextSinceID {
 			nextSinceID = value
 		}
 	}
-	return out, nextSinceID, nil
+	return out, nextSinceID, latestID, nil
 }
 
 type coreJSONResult struct {
@@ -834,6 +1162,7 @@ type coreJSONResult struct {
 }
 
 func (h *Handler) coreJSONRequest(
+	auth authContext,
 	method string,
 	corePath string,
 	rawQuery string,
@@ -841,13 +1170,20 @@ func (h *Handler) coreJSONRequest(
 	idempotencyKey string,
 	body map[string]any,
 ) (coreJSONResult, error) {
-	target, err := joinURL(h.cfg.CoreBaseURL, corePath, rawQuery)
+	releaseSubjectSlot, ok := h.acquireSubjectSlot(auth)
+	if !ok {
+		return coreJSONResult{StatusCode: http.StatusTooManyRequests}, errSubjectConcurrencyLimited
+	}
+	defer releaseSubjectSlot()
+
+	replica := h.cores.pick(time.Now())
+	target, err := joinURL(replica.baseURL, corePath, rawQuery)
 	if err != nil {
 		return coreJSONResult{StatusCode: http.StatusBadGateway}, fmt.Errorf("failed to build core URL: %w", err)
 	}
 
 	var reqBody io.Reader
-	if method == http.MethodPost {
+	if method == http.MethodPost || method == http.MethodPut {
 		if body == nil {
 			body = map[string]any{}
 		}
@@ -862,8 +1198,14 @@ func (h *Handler) coreJSONRequest(
 	if err != nil {
 		return coreJSONResult{StatusCode: http.StatusBadGateway}, fmt.Errorf("failed to create core request: %w", err)
 	}
+	h.setCoreTenantHeader(req.Header, auth)
+	setCoreMetadataHeaders(req.Header, auth)
+	h.setCoreIdentityHeaders(req.Header, auth)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Request-ID", requestID)
+	if accept := strings.TrimSpace(h.cfg.CoreAcceptHeader); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
 	if strings.TrimSpace(idempotencyKey) != "" {
 		req.Header.Set("Idempotency-Key", strings.TrimSpace(idempotencyKey))
 	}
@@ -871,7 +1213,7 @@ func (h *Handler) coreJSONRequest(
 		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
 	}
 
-	resp, err := h.client.Do(req)
+	resp, err := h.doCore(req, replica)
 	if err != nil {
 		return coreJSONResult{StatusCode: http.StatusBadGateway}, fmt.Errorf("core API unreachable: %w", err)
 	}
@@ -881,9 +1223,24 @@ func (h *Handler) coreJSONRequest(
 	if err != nil {
 		return coreJSONResult{StatusCode: http.StatusBadGateway}, fmt.Errorf("failed to read core response: %w", err)
 	}
+	if isRedirectStatus(resp.StatusCode) {
+		status, payload := h.coreRedirectPayload(resp, requestID)
+		return coreJSONResult{
+			StatusCode:    status,
+			Payload:       payload,
+			CoreRequestID: strings.TrimSpace(resp.Header.Get("X-Request-ID")),
+		}, nil
+	}
 
 	payload, ok := decodeAnyJSON(raw)
 	if !ok {
+		if h.rejectsInvalidCoreJSON(resp.StatusCode) {
+			return coreJSONResult{
+				StatusCode:    http.StatusBadGateway,
+				Payload:       invalidCoreJSONPayload(resp.StatusCode, requestID),
+				CoreRequestID: strings.TrimSpace(resp.Header.Get("X-Request-ID")),
+			}, nil
+		}
 		payload = map[string]any{"raw": string(raw), "request_id": requestID}
 	} else {
 		payload = attachRequestID(payload, requestID)
@@ -893,11 +1250,21 @@ func (h *Handler) coreJSONRequest(
 		Payload:        payload,
 		CoreRequestID:  strings.TrimSpace(resp.Header.Get("X-Request-ID")),
 		IdempotencyKey: strings.TrimSpace(resp.Header.Get("Idempotency-Key")),
-		ReplayDetected: strings.EqualFold(strings.TrimSpace(resp.Header.Get("X-Idempotency-Replayed")), "true"),
+		ReplayDetected: h.recordIdempotencyReplay(resp.Header),
 	}
 	return result, nil
 }
 
+// recordIdempotencyReplay reports whether core answered from its idempotency store
+// (X-Idempotency-Replayed: true) and counts it in idempotencyReplays.
+func (h *Handler) recordIdempotencyReplay(header http.Header) bool {
+	if !strings.EqualFold(strings.TrimSpace(header.Get("X-Idempotency-Replayed")), "true") {
+		return false
+	}
+	atomic.AddUint64(&h.idempotencyReplays, 1)
+	return true
+}
+
 type coreRawResult struct {
 	StatusCode    int
 	ContentType   string
@@ -906,11 +1273,13 @@ type coreRawResult struct {
 }
 
 func (h *Handler) coreRawRequest(
+	auth authContext,
 	corePath string,
 	rawQuery string,
 	requestID string,
 ) (coreRawResult, error) {
-	target, err := joinURL(h.cfg.CoreBaseURL, corePath, rawQuery)
+	replica := h.cores.pick(time.Now())
+	target, err := joinURL(replica.baseURL, corePath, rawQuery)
 	if err != nil {
 		return coreRawResult{StatusCode: http.StatusBadGateway, ContentType: "application/json"}, fmt.Errorf("failed to build core URL: %w", err)
 	}
@@ -918,12 +1287,15 @@ func (h *Handler) coreRawRequest(
 	if err != nil {
 		return coreRawResult{StatusCode: http.StatusBadGateway, ContentType: "application/json"}, fmt.Errorf("failed to create core request: %w", err)
 	}
+	h.setCoreTenantHeader(req.Header, auth)
+	setCoreMetadataHeaders(req.Header, auth)
+	h.setCoreIdentityHeaders(req.Header, auth)
 	req.Header.Set("X-Request-ID", requestID)
 	if strings.TrimSpace(h.cfg.CoreToken) != "" {
 		req.Header.Set("Authorization", "Bearer "+h.cfg.CoreToken)
 	}
 
-	resp, err := h.client.Do(req)
+	resp, err := h.doCore(req, replica)
 	if err != nil {
 		return coreRawResult{StatusCode: http.StatusBadGateway, ContentType: "application/json"}, fmt.Errorf("core API unreachable: %w", err)
 	}
@@ -976,8 +1348,8 @@ func parseSSE(raw []byte) []wsSSEEvent {
 }
 
 func parseSSEData(raw string) map[string]any {
-	var parsed any
-	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+	parsed, err := unmarshalUseNumber([]byte(raw))
+	if err != nil {
 		return map[string]any{"raw": raw}
 	}
 	if obj, ok := parsed.(map[string]any); ok {
@@ -2,10 +2,15 @@ package relay
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -1003,6 +1008,464 @@ func TestWebSocketConnectionLimit(t *testing.T) {
 	}
 }
 
+func TestWebSocketAuditPumpBacksOffOnCoreAuthFailure(t *testing.T) {
+	var eventCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			atomic.AddInt64(&eventCalls, 1)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(
+		Config{
+			CoreBaseURL: core.URL,
+			BridgeToken: "bridge",
+			CoreToken:   "stale",
+			Timeout:     5 * time.Second,
+		},
+	)
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	h.wsAuthBackoff = 10 * time.Millisecond
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0&poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	authError := mustReadWSMessageByType(t, conn, "auth_error", 2*time.Second)
+	if toInt(authError["core_status"]) != http.StatusUnauthorized {
+		t.Fatalf("expected core_status 401, got %#v", authError)
+	}
+
+	// 10ms, 20ms, 40ms, 80ms, 160ms of backoff, then the pump gives up.
+	deadline := time.Now().Add(time.Second)
+	frames := map[string]int{}
+	for time.Now().Before(deadline) {
+		_ = conn.SetReadDeadline(deadline)
+		var msg map[string]any
+		if err := conn.ReadJSON(&msg); err != nil {
+			break
+		}
+		frames[toString(msg["type"])]++
+	}
+	if frames["auth_error"] != 0 || frames["error"] != 0 {
+		t.Fatalf("expected a single auth_error frame, got extra frames %#v", frames)
+	}
+	if calls := atomic.LoadInt64(&eventCalls); calls != wsPumpAuthMaxRetries {
+		t.Fatalf("expected pump to stop after %d core polls, got %d", wsPumpAuthMaxRetries, calls)
+	}
+
+	rrMetrics := httptest.NewRecorder()
+	h.ServeHTTP(rrMetrics, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rrMetrics.Body.String(), "novaadapt_bridge_ws_pump_errors_total 6") {
+		t.Fatalf("expected ws pump error metric, got: %s", rrMetrics.Body.String())
+	}
+}
+
+func TestWebSocketBrowserActionAllowlist(t *testing.T) {
+	var coreActions []string
+	var mu sync.Mutex
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		default:
+			mu.Lock()
+			coreActions = append(coreActions, r.URL.Path)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:           core.URL,
+		BridgeToken:           "bridge",
+		AllowedBrowserActions: []string{"Navigate"},
+		Timeout:               5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0&poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]any{
+		"type": "browser_action",
+		"id":   "allowed",
+		"body": map[string]any{"type": "navigate", "target": "https://example.com"},
+	}); err != nil {
+		t.Fatalf("write browser_action: %v", err)
+	}
+	allowed := mustReadWSMessageByType(t, conn, "browser_action_result", 2*time.Second)
+	if allowed["id"] != "allowed" || toInt(allowed["status"]) != http.StatusOK {
+		t.Fatalf("expected navigate to be forwarded, got %#v", allowed)
+	}
+
+	denied := []map[string]any{
+		{"type": "browser_action", "id": "eval-action", "body": map[string]any{"type": "evaluate_js", "script": "1"}},
+		{"type": "browser_evaluate_js", "id": "eval-endpoint", "body": map[string]any{"script": "1"}},
+		{"type": "command", "id": "eval-command", "method": "POST", "path": "/browser/action", "body": map[string]any{"type": "evaluate_js"}},
+	}
+	for _, msg := range denied {
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatalf("write %s: %v", msg["id"], err)
+		}
+		frame := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+		if frame["id"] != msg["id"] || frame["error"] != "browser action not allowed" || frame["action"] != "evaluate_js" {
+			t.Fatalf("expected browser action rejection for %s, got %#v", msg["id"], frame)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/browser/action", strings.NewReader(`{"type":"evaluate_js","script":"1"}`))
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "browser_action_not_allowed") {
+		t.Fatalf("expected 403 for HTTP evaluate_js, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(coreActions) != 1 || coreActions[0] != "/browser/action" {
+		t.Fatalf("expected only the allowed action to reach core, got %#v", coreActions)
+	}
+}
+
+func TestBrowserActionAllowlistDefaultsAndMissingType(t *testing.T) {
+	open, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if _, ok := open.allowsBrowserAction(http.MethodPost, "/browser/action", map[string]any{"type": "evaluate_js"}); !ok {
+		t.Fatalf("expected every action allowed without AllowedBrowserActions")
+	}
+
+	restricted, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge", AllowedBrowserActions: []string{"navigate"}})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if _, ok := restricted.allowsBrowserAction(http.MethodPost, "/browser/action", map[string]any{"type": " NAVIGATE "}); !ok {
+		t.Fatalf("expected action types to match case-insensitively")
+	}
+	if action, ok := restricted.allowsBrowserAction(http.MethodPost, "/browser/action", map[string]any{}); ok || action != "" {
+		t.Fatalf("expected a missing action type to be rejected, got action=%q ok=%v", action, ok)
+	}
+	if _, ok := restricted.allowsBrowserAction(http.MethodGet, "/browser/status", nil); !ok {
+		t.Fatalf("expected read-only browser routes to bypass the allowlist")
+	}
+}
+
+func TestWebSocketTerminalCommandAllowlist(t *testing.T) {
+	var coreBodies []string
+	var mu sync.Mutex
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		default:
+			raw, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			coreBodies = append(coreBodies, string(raw))
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"session_id":"term1"}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:             core.URL,
+		BridgeToken:             "bridge",
+		AllowedTerminalCommands: []string{"bash"},
+		Timeout:                 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0&poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]any{
+		"type": "terminal_start",
+		"id":   "allowed",
+		"body": map[string]any{"command": "bash -l"},
+	}); err != nil {
+		t.Fatalf("write terminal_start: %v", err)
+	}
+	allowed := mustReadWSMessageByType(t, conn, "terminal_started", 2*time.Second)
+	if allowed["id"] != "allowed" || toInt(allowed["status"]) != http.StatusOK {
+		t.Fatalf("expected bash to be forwarded, got %#v", allowed)
+	}
+
+	denied := []map[string]any{
+		{"type": "terminal_start", "id": "rm-start", "body": map[string]any{"command": "rm -rf /"}},
+		{"type": "command", "id": "rm-command", "method": "POST", "path": "/terminal/sessions", "body": map[string]any{"command": []any{"rm", "-rf", "/"}}},
+	}
+	for _, msg := range denied {
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatalf("write %s: %v", msg["id"], err)
+		}
+		frame := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+		if frame["id"] != msg["id"] || frame["error"] != "terminal command not allowed" || frame["command"] != "rm" {
+			t.Fatalf("expected terminal command rejection for %s, got %#v", msg["id"], frame)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/terminal/sessions", strings.NewReader(`{"command":"rm -rf /"}`))
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "terminal_command_not_allowed") {
+		t.Fatalf("expected 403 for HTTP rm, got %d body=%s", rr.Code, rr.Body.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(coreBodies) != 1 || !strings.Contains(coreBodies[0], "bash") {
+		t.Fatalf("expected only the bash session to reach core, got %#v", coreBodies)
+	}
+}
+
+func TestWebSocketResumeTokenRestoresCursor(t *testing.T) {
+	var mu sync.Mutex
+	var sinceIDs []string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			mu.Lock()
+			sinceIDs = append(sinceIDs, r.URL.Query().Get("since_id"))
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?poll_timeout=2&poll_interval=0.2"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL+"&since_id=0", headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	hello := mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+	if toString(hello["resume_token"]) == "" || hello["resumed"] != false {
+		t.Fatalf("expected fresh hello with resume token, got %#v", hello)
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "set_since_id", "id": "cursor", "since_id": 77}); err != nil {
+		t.Fatalf("write set_since_id: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "ack", 2*time.Second)
+	if err := conn.WriteJSON(map[string]any{"type": "ping", "id": "p1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	pong := mustReadWSMessageByType(t, conn, "pong", 2*time.Second)
+	resumeToken := toString(pong["resume_token"])
+	if resumeToken == "" {
+		t.Fatalf("expected refreshed resume token on pong, got %#v", pong)
+	}
+	_ = conn.Close()
+
+	mu.Lock()
+	sinceIDs = nil
+	mu.Unlock()
+	resumed, _, err := websocket.DefaultDialer.Dial(baseURL+"&since_id=0&resume="+resumeToken, headers)
+	if err != nil {
+		t.Fatalf("dial resumed websocket: %v", err)
+	}
+	defer resumed.Close()
+	resumedHello := mustReadWSMessageByType(t, resumed, "hello", 2*time.Second)
+	if resumedHello["resumed"] != true || toInt(resumedHello["since_id"]) != 77 {
+		t.Fatalf("expected resumed hello at since_id 77, got %#v", resumedHello)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		polled := len(sinceIDs) > 0
+		mu.Unlock()
+		if polled {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	mu.Lock()
+	if len(sinceIDs) == 0 || sinceIDs[0] != "77" {
+		mu.Unlock()
+		t.Fatalf("expected resumed pump to poll since_id=77, got %#v", sinceIDs)
+	}
+	mu.Unlock()
+
+	tampered := resumeToken[:len(resumeToken)-2] + "xx"
+	_, resp, err := websocket.DefaultDialer.Dial(baseURL+"&resume="+tampered, headers)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for tampered resume token, got err=%v resp=%#v", err, resp)
+	}
+	if _, err := h.verifySessionToken("na1." + strings.TrimPrefix(resumeToken, wsResumeTokenPrefix)); err == nil {
+		t.Fatalf("expected resume token not to verify as a session token")
+	}
+}
+
+func TestWebSocketBacklogFastForwardsUnlessBackfill(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		sinceID := parseInt64OrDefault(r.URL.Query().Get("since_id"), 0)
+		var b strings.Builder
+		for id := sinceID + 1; id <= 100; id++ {
+			fmt.Fprintf(&b, "event: audit\ndata: {\"id\":%d}\n\n", id)
+		}
+		if sinceID >= 100 {
+			time.Sleep(100 * time.Millisecond)
+			b.WriteString("event: timeout\ndata: {}\n\n")
+		}
+		_, _ = w.Write([]byte(b.String()))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", WSMaxBacklogEvents: 10, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	skipped := mustReadWSMessageByType(t, conn, "backlog_skipped", 2*time.Second)
+	if toInt(skipped["skipped"]) != 90 || toInt(skipped["since_id"]) != 90 || toInt(skipped["latest_id"]) != 100 {
+		t.Fatalf("unexpected backlog_skipped frame %#v", skipped)
+	}
+	event := mustReadWSMessageByType(t, conn, "event", 2*time.Second)
+	if data, _ := event["data"].(map[string]any); toInt(data["id"]) != 91 {
+		t.Fatalf("expected first event after skip to be id 91, got %#v", event)
+	}
+	_ = conn.Close()
+
+	backfill, _, err := websocket.DefaultDialer.Dial(baseURL+"&backfill=1", headers)
+	if err != nil {
+		t.Fatalf("dial backfill websocket: %v", err)
+	}
+	defer backfill.Close()
+	event = mustReadWSMessageByType(t, backfill, "event", 2*time.Second)
+	if data, _ := event["data"].(map[string]any); toInt(data["id"]) != 1 {
+		t.Fatalf("expected backfill to replay from id 1, got %#v", event)
+	}
+}
+
+func TestWebSocketEntityFilterLimitsAuditEvents(t *testing.T) {
+	entities := []string{"", "plan-1", "plan-2", "plan-1", "plan-2", "plan-1", "plan-2"}
+	var published atomic.Int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		sinceID := parseInt64OrDefault(r.URL.Query().Get("since_id"), 0)
+		var b strings.Builder
+		for id := sinceID + 1; id <= published.Load(); id++ {
+			fmt.Fprintf(&b, "event: audit\ndata: {\"id\":%d,\"entity_type\":\"plan\",\"entity_id\":%q}\n\n", id, entities[id])
+		}
+		if b.Len() == 0 {
+			time.Sleep(50 * time.Millisecond)
+			b.WriteString("event: timeout\ndata: {}\n\n")
+		}
+		_, _ = w.Write([]byte(b.String()))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?entity_type=plan&entity_id=plan-1"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	eventID := func() int {
+		event := mustReadWSMessageByType(t, conn, "event", 2*time.Second)
+		data, _ := event["data"].(map[string]any)
+		return toInt(data["id"])
+	}
+	published.Store(4)
+	if first, second := eventID(), eventID(); first != 1 || second != 3 {
+		t.Fatalf("expected only plan-1 events 1 and 3, got %d and %d", first, second)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "set_entity_filter", "id": "f1", "entity_type": "plan", "entity_id": "plan-2"}); err != nil {
+		t.Fatalf("write set_entity_filter: %v", err)
+	}
+	ack := mustReadWSMessageByType(t, conn, "ack", 2*time.Second)
+	if ack["entity_id"] != "plan-2" {
+		t.Fatalf("unexpected filter ack %#v", ack)
+	}
+	published.Store(6)
+	if next := eventID(); next != 6 {
+		t.Fatalf("expected plan-2 event 6 after filter change, got %d", next)
+	}
+}
+
 func mustReadWSMessageByType(
 	t *testing.T,
 	conn *websocket.Conn,
@@ -1030,3 +1493,1385 @@ func mustReadWSMessageByType(
 	t.Fatalf("timed out waiting for websocket message type=%s", typ)
 	return nil
 }
+
+func TestWebSocketTicketIsSingleUse(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/auth/ws-ticket", nil)
+	if err != nil {
+		t.Fatalf("new ticket request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+readToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("issue ticket: %v", err)
+	}
+	var issued map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&issued); err != nil {
+		t.Fatalf("decode ticket: %v", err)
+	}
+	_ = resp.Body.Close()
+	ticket, _ := issued["ticket"].(string)
+	if resp.StatusCode != http.StatusOK || ticket == "" {
+		t.Fatalf("expected issued ticket, got status=%d payload=%#v", resp.StatusCode, issued)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?ticket=" + ticket
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket with ticket: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+	_ = conn.Close()
+
+	_, resp, err = websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil {
+		t.Fatalf("expected reused ticket to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for reused ticket, got %#v", resp)
+	}
+}
+
+func TestWebSocketDiagEchoesPayload(t *testing.T) {
+	var coreCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		atomic.AddInt64(&coreCalls, 1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	if err := conn.WriteJSON(map[string]any{
+		"type":    "diag",
+		"id":      "diag-1",
+		"payload": map[string]any{"seq": 7, "note": "latency probe"},
+	}); err != nil {
+		t.Fatalf("write diag: %v", err)
+	}
+	result := mustReadWSMessageByType(t, conn, "diag_result", 2*time.Second)
+	if result["id"] != "diag-1" {
+		t.Fatalf("expected diag id, got %#v", result)
+	}
+	payload, ok := result["payload"].(map[string]any)
+	if !ok || toInt(payload["seq"]) != 7 || payload["note"] != "latency probe" {
+		t.Fatalf("expected echoed payload, got %#v", result["payload"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, toString(result["server_time"])); err != nil {
+		t.Fatalf("expected RFC3339 server_time, got %#v", result["server_time"])
+	}
+	if _, ok := result["uptime_ms"].(float64); !ok {
+		t.Fatalf("expected uptime_ms, got %#v", result["uptime_ms"])
+	}
+	if _, ok := result["subprotocol"]; !ok {
+		t.Fatalf("expected subprotocol field, got %#v", result)
+	}
+	if atomic.LoadInt64(&coreCalls) != 0 {
+		t.Fatalf("expected diag not to call core")
+	}
+}
+
+func TestWebSocketCapabilitiesListsHandledTypes(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=" + readToken
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	if err := conn.WriteJSON(map[string]any{"type": "capabilities", "id": "caps-1"}); err != nil {
+		t.Fatalf("write capabilities: %v", err)
+	}
+	caps := mustReadWSMessageByType(t, conn, "capabilities", 2*time.Second)
+	types, ok := caps["message_types"].([]any)
+	if !ok || len(types) != len(wsClientMessageTypes) {
+		t.Fatalf("expected message types list, got %#v", caps["message_types"])
+	}
+	if caps["version"] != Version {
+		t.Fatalf("expected version %q, got %#v", Version, caps["version"])
+	}
+	limits, ok := caps["limits"].(map[string]any)
+	if !ok || limits["max_message_bytes"] == nil || limits["max_events_per_poll"] == nil {
+		t.Fatalf("expected limits in capabilities, got %#v", caps["limits"])
+	}
+
+	// Every advertised type must be routed by handleWSClientMessage.
+	for _, typ := range wsClientMessageTypes {
+		id := "probe-" + typ
+		if err := conn.WriteJSON(map[string]any{"type": typ, "id": id, "session_id": "term1", "input": "x", "since_id": 0}); err != nil {
+			t.Fatalf("write %s: %v", typ, err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for response to %s", typ)
+			}
+			_ = conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				continue
+			}
+			if msg["id"] != id {
+				continue
+			}
+			if errText, _ := msg["error"].(string); strings.HasPrefix(errText, "unsupported message type") {
+				t.Fatalf("advertised type %s is not handled", typ)
+			}
+			break
+		}
+	}
+}
+
+func TestWebSocketSubscribePlanStreamsPlanEvents(t *testing.T) {
+	var mu sync.Mutex
+	planPolls := 0
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case "/plans/plan-1/stream":
+			mu.Lock()
+			planPolls++
+			poll := planPolls
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			if poll == 1 {
+				_, _ = w.Write([]byte("event: plan\ndata: {\"id\":\"plan-1\",\"status\":\"executing\"}\n\nevent: timeout\ndata: {\"id\":\"plan-1\"}\n\n"))
+				return
+			}
+			_, _ = w.Write([]byte("event: plan\ndata: {\"id\":\"plan-1\",\"status\":\"executing\"}\n\nevent: plan\ndata: {\"id\":\"plan-1\",\"status\":\"executed\"}\n\nevent: end\ndata: {\"id\":\"plan-1\",\"status\":\"executed\"}\n\n"))
+		default:
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=bridge&poll_interval=0.05"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	if err := conn.WriteJSON(map[string]any{"type": "subscribe_plan", "id": "sub-1", "plan_id": "plan-1"}); err != nil {
+		t.Fatalf("write subscribe_plan: %v", err)
+	}
+	var statuses []string
+	for {
+		msg := mustReadWSMessageByType(t, conn, "plan_event", 3*time.Second)
+		if msg["plan_id"] != "plan-1" {
+			t.Fatalf("unexpected plan event: %#v", msg)
+		}
+		if msg["event"] == "end" {
+			break
+		}
+		data, _ := msg["data"].(map[string]any)
+		statuses = append(statuses, toString(data["status"]))
+	}
+	if len(statuses) != 2 || statuses[0] != "executing" || statuses[1] != "executed" {
+		t.Fatalf("expected deduplicated plan snapshots, got %#v", statuses)
+	}
+}
+
+func TestWebSocketSlowReaderDropsAuditFramesNotCommands(t *testing.T) {
+	blob := strings.Repeat("x", 64*1024)
+	var modelsCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			time.Sleep(10 * time.Millisecond)
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			var b strings.Builder
+			for i := 0; i < 32; i++ {
+				b.WriteString("event: audit\ndata: {\"id\":" + strconv.Itoa(i+1) + ",\"blob\":\"" + blob + "\"}\n\n")
+			}
+			_, _ = w.Write([]byte(b.String()))
+		case "/models":
+			atomic.AddInt64(&modelsCalls, 1)
+			_, _ = w.Write([]byte(`[{"name":"local"}]`))
+		default:
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:     core.URL,
+		BridgeToken:     "bridge",
+		WSSendQueueSize: 4,
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=bridge"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	// Stop reading so audit frames back up behind the slow client.
+	time.Sleep(300 * time.Millisecond)
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		if err := conn.WriteJSON(map[string]any{"type": "command", "id": id, "method": "GET", "path": "/models"}); err != nil {
+			t.Fatalf("write %s: %v", id, err)
+		}
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt64(&modelsCalls) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected both commands processed while reader is slow, got %d", atomic.LoadInt64(&modelsCalls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadUint64(&h.wsDroppedTotal) == 0 {
+		t.Fatalf("expected audit frames dropped under backpressure")
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, id := range []string{"cmd-1", "cmd-2"} {
+		for {
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read waiting for %s: %v", id, err)
+			}
+			if msg["type"] == "command_result" && msg["id"] == id {
+				break
+			}
+		}
+	}
+}
+
+func TestWebSocketCommandForwardsConfiguredPut(t *testing.T) {
+	var putBody string
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		if r.Method == http.MethodPut && r.URL.Path == "/plans/plan1/steps" {
+			raw, _ := io.ReadAll(r.Body)
+			putBody = string(raw)
+			_, _ = w.Write([]byte(`{"replaced":true}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"not found"}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:    core.URL,
+		BridgeToken:    "bridge",
+		PutRouteScopes: map[string]string{"/plans/{id}/steps": scopePlan},
+		Timeout:        5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	readToken, _, err := h.issueSessionToken("reader", []string{scopeRead}, "", 120)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=bridge"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	if err := conn.WriteJSON(map[string]any{
+		"type":   "command",
+		"id":     "put-disabled",
+		"method": "PUT",
+		"path":   "/plans/plan1/approve",
+		"body":   map[string]any{"execute": true},
+	}); err != nil {
+		t.Fatalf("write disabled put command: %v", err)
+	}
+	disabled := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+	if disabled["id"] != "put-disabled" {
+		t.Fatalf("expected error for unconfigured PUT, got %#v", disabled)
+	}
+
+	if err := conn.WriteJSON(map[string]any{
+		"type":   "command",
+		"id":     "put-1",
+		"method": "PUT",
+		"path":   "/plans/plan1/steps",
+		"body":   map[string]any{"steps": []any{}},
+	}); err != nil {
+		t.Fatalf("write put command: %v", err)
+	}
+	result := mustReadWSMessageByType(t, conn, "command_result", 2*time.Second)
+	if status, _ := result["status"].(float64); int(status) != http.StatusOK {
+		t.Fatalf("expected 200 command_result, got %#v", result)
+	}
+	if putBody != `{"steps":[]}` {
+		t.Fatalf("expected PUT body forwarded to core, got %q", putBody)
+	}
+
+	readConn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?token="+readToken, nil)
+	if err != nil {
+		t.Fatalf("dial websocket with read token: %v", err)
+	}
+	defer readConn.Close()
+	_ = mustReadWSMessageByType(t, readConn, "hello", 2*time.Second)
+	if err := readConn.WriteJSON(map[string]any{
+		"type":   "command",
+		"id":     "put-forbidden",
+		"method": "PUT",
+		"path":   "/plans/plan1/steps",
+		"body":   map[string]any{"steps": []any{}},
+	}); err != nil {
+		t.Fatalf("write forbidden put command: %v", err)
+	}
+	forbidden := mustReadWSMessageByType(t, readConn, "error", 2*time.Second)
+	if forbidden["error"] != "forbidden by token scope" {
+		t.Fatalf("expected scope error for read token PUT, got %#v", forbidden)
+	}
+}
+
+func TestWebSocketPlainGetReturnsUpgradeRequired(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://example.com", BridgeToken: "bridge"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Authorization", "Bearer bridge")
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUpgradeRequired {
+		t.Fatalf("expected 426 got %d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Upgrade") != "websocket" {
+		t.Fatalf("expected Upgrade: websocket header, got %q", rr.Header().Get("Upgrade"))
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("decode 426 body: %v", err)
+	}
+	if payload["error"] != "Upgrade Required" || payload["detail"] == nil {
+		t.Fatalf("expected explanatory 426 payload, got %#v", payload)
+	}
+	if active := atomic.LoadInt64(&h.wsActiveConnections); active != 0 {
+		t.Fatalf("expected no websocket slot held, got %d", active)
+	}
+}
+
+func TestWebSocketSharedAuditPumpPollsCoreOnce(t *testing.T) {
+	var inFlight, maxInFlight int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/stream" {
+			_, _ = w.Write([]byte(`{"ok":true}`))
+			return
+		}
+		current := atomic.AddInt64(&inFlight, 1)
+		defer atomic.AddInt64(&inFlight, -1)
+		for {
+			seen := atomic.LoadInt64(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt64(&maxInFlight, seen, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		if r.URL.Query().Get("since_id") == "0" {
+			_, _ = w.Write([]byte("event: audit\ndata: {\"id\":1,\"category\":\"run\"}\n\n"))
+			return
+		}
+		_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", SharedAuditPump: true, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?token=bridge"
+	first, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial first websocket: %v", err)
+	}
+	defer first.Close()
+	second, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial second websocket: %v", err)
+	}
+	defer second.Close()
+
+	for name, conn := range map[string]*websocket.Conn{"first": first, "second": second} {
+		event := mustReadWSMessageByType(t, conn, "event", 3*time.Second)
+		data, _ := event["data"].(map[string]any)
+		if id, _ := data["id"].(float64); id != 1 {
+			t.Fatalf("%s: expected audit event id 1, got %#v", name, event)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if got := atomic.LoadInt64(&maxInFlight); got != 1 {
+		t.Fatalf("expected a single shared core poll loop, saw %d concurrent polls", got)
+	}
+
+	h.auditPollersMu.Lock()
+	pollers := len(h.auditPollers)
+	h.auditPollersMu.Unlock()
+	if pollers != 1 {
+		t.Fatalf("expected one shared poller, got %d", pollers)
+	}
+}
+
+func TestWebSocketSharedAuditPumpSeparatesForwardedIdentities(t *testing.T) {
+	var mu sync.Mutex
+	subjects := map[string]int{}
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		subject := r.Header.Get("X-Bridge-Subject")
+		mu.Lock()
+		subjects[subject]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		if r.URL.Query().Get("since_id") == "0" {
+			_, _ = fmt.Fprintf(w, "event: audit\ndata: {\"id\":1,\"category\":%q}\n\n", subject)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:           core.URL,
+		BridgeToken:           "bridge",
+		SharedAuditPump:       true,
+		ForwardCallerIdentity: true,
+		Timeout:               5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	conns := map[string]*websocket.Conn{}
+	for _, subject := range []string{"alice", "bob"} {
+		token, _, err := h.issueSessionToken(subject, []string{scopeRead}, "", 120)
+		if err != nil {
+			t.Fatalf("issue %s token: %v", subject, err)
+		}
+		headers := http.Header{}
+		headers.Set("Authorization", "Bearer "+token)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", headers)
+		if err != nil {
+			t.Fatalf("dial %s websocket: %v", subject, err)
+		}
+		defer conn.Close()
+		conns[subject] = conn
+	}
+
+	for subject, conn := range conns {
+		event := mustReadWSMessageByType(t, conn, "event", 3*time.Second)
+		data, _ := event["data"].(map[string]any)
+		if data["category"] != subject {
+			t.Fatalf("%s: expected audit events polled with its own identity, got %#v", subject, event)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if subjects["alice"] == 0 || subjects["bob"] == 0 || subjects[""] != 0 {
+		t.Fatalf("expected core to see each subject's identity on /events/stream, got %#v", subjects)
+	}
+}
+
+func TestWebSocketHealthProbesCoreAndRateLimits(t *testing.T) {
+	var healthCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case "/health":
+			atomic.AddInt64(&healthCalls, 1)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"ok":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	if err := conn.WriteJSON(map[string]any{"type": "health", "id": "health-1"}); err != nil {
+		t.Fatalf("write health: %v", err)
+	}
+	result := mustReadWSMessageByType(t, conn, "health_result", 2*time.Second)
+	if result["id"] != "health-1" || toInt(result["status"]) != http.StatusOK {
+		t.Fatalf("unexpected health_result: %#v", result)
+	}
+	health, ok := result["health"].(map[string]any)
+	if !ok || health["ok"] != true {
+		t.Fatalf("expected healthy payload, got %#v", result["health"])
+	}
+	coreHealth, ok := health["core"].(map[string]any)
+	if !ok || coreHealth["healthy"] != true {
+		t.Fatalf("expected core probe result, got %#v", health["core"])
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "health", "id": "health-2"}); err != nil {
+		t.Fatalf("write health: %v", err)
+	}
+	limited := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+	if limited["id"] != "health-2" || toInt(limited["retry_after"]) < 1 {
+		t.Fatalf("expected rate limited error, got %#v", limited)
+	}
+	if got := atomic.LoadInt64(&healthCalls); got != 1 {
+		t.Fatalf("expected one core health probe, got %d", got)
+	}
+}
+
+func TestWebSocketTerminalSessionCapPerSubject(t *testing.T) {
+	var started int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case r.URL.Path == "/terminal/sessions":
+			id := atomic.AddInt64(&started, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"id":"term%d","open":true}`, id)
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			_, _ = w.Write([]byte(`{"closed":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:                   core.URL,
+		BridgeToken:                   "bridge",
+		MaxTerminalSessionsPerSubject: 2,
+		Timeout:                       5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0&poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err := conn.WriteJSON(map[string]any{"type": "terminal_start", "id": fmt.Sprintf("start-%d", i), "body": map[string]any{"command": "bash"}}); err != nil {
+			t.Fatalf("write terminal_start: %v", err)
+		}
+		_ = mustReadWSMessageByType(t, conn, "terminal_started", 2*time.Second)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "terminal_start", "id": "start-3", "body": map[string]any{"command": "bash"}}); err != nil {
+		t.Fatalf("write terminal_start: %v", err)
+	}
+	limited := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+	if limited["id"] != "start-3" || limited["code"] != "terminal_session_limit" {
+		t.Fatalf("expected terminal session limit error, got %#v", limited)
+	}
+	if got := atomic.LoadInt64(&started); got != 2 {
+		t.Fatalf("expected capped start not to reach core, got %d starts", got)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "terminal_close", "id": "close-1", "session_id": "term1"}); err != nil {
+		t.Fatalf("write terminal_close: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "terminal_closed", 2*time.Second)
+	if err := conn.WriteJSON(map[string]any{"type": "terminal_start", "id": "start-4", "body": map[string]any{"command": "bash"}}); err != nil {
+		t.Fatalf("write terminal_start: %v", err)
+	}
+	if started := mustReadWSMessageByType(t, conn, "terminal_started", 2*time.Second); started["id"] != "start-4" {
+		t.Fatalf("expected close to free a slot, got %#v", started)
+	}
+}
+
+func TestWebSocketTerminalCloseOnlyFreesOwnSlot(t *testing.T) {
+	var started int64
+	var closeStatus int64 = http.StatusOK
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case r.URL.Path == "/terminal/sessions":
+			id := atomic.AddInt64(&started, 1)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"id":"term%d","open":true}`, id)
+		case strings.HasSuffix(r.URL.Path, "/close"):
+			w.WriteHeader(int(atomic.LoadInt64(&closeStatus)))
+			_, _ = w.Write([]byte(`{"closed":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:                   core.URL,
+		BridgeToken:                   "bridge",
+		MaxTerminalSessionsPerSubject: 1,
+		Timeout:                       5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	dial := func(subject string) *websocket.Conn {
+		token, _, err := h.issueSessionToken(subject, []string{scopeRead, scopeRun}, "", 120)
+		if err != nil {
+			t.Fatalf("issue %s token: %v", subject, err)
+		}
+		headers := http.Header{}
+		headers.Set("Authorization", "Bearer "+token)
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?since_id=0&poll_timeout=1&poll_interval=0.1", headers)
+		if err != nil {
+			t.Fatalf("dial %s websocket: %v", subject, err)
+		}
+		return conn
+	}
+	alice := dial("alice")
+	defer alice.Close()
+	bob := dial("bob")
+	defer bob.Close()
+
+	start := func(id string) map[string]any {
+		if err := alice.WriteJSON(map[string]any{"type": "terminal_start", "id": id, "body": map[string]any{"command": "bash"}}); err != nil {
+			t.Fatalf("write terminal_start: %v", err)
+		}
+		_ = alice.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for {
+			var frame map[string]any
+			if err := alice.ReadJSON(&frame); err != nil {
+				t.Fatalf("read reply to %s: %v", id, err)
+			}
+			if frame["id"] == id {
+				return frame
+			}
+		}
+	}
+	closeAs := func(conn *websocket.Conn, id string) {
+		if err := conn.WriteJSON(map[string]any{"type": "terminal_close", "id": id, "session_id": "term1"}); err != nil {
+			t.Fatalf("write terminal_close: %v", err)
+		}
+		_ = mustReadWSMessageByType(t, conn, "terminal_closed", 2*time.Second)
+	}
+
+	if frame := start("start-1"); frame["type"] != "terminal_started" {
+		t.Fatalf("expected first start to succeed, got %#v", frame)
+	}
+	closeAs(bob, "bob-close")
+	if frame := start("start-2"); frame["code"] != "terminal_session_limit" {
+		t.Fatalf("expected another subject's close not to free the slot, got %#v", frame)
+	}
+	atomic.StoreInt64(&closeStatus, http.StatusForbidden)
+	closeAs(alice, "alice-close-denied")
+	if frame := start("start-3"); frame["code"] != "terminal_session_limit" {
+		t.Fatalf("expected a rejected close not to free the slot, got %#v", frame)
+	}
+	atomic.StoreInt64(&closeStatus, http.StatusOK)
+	closeAs(alice, "alice-close")
+	if frame := start("start-4"); frame["type"] != "terminal_started" {
+		t.Fatalf("expected the owner's close to free the slot, got %#v", frame)
+	}
+}
+
+func TestWebSocketResumeTokenRestoresSubscriptions(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case "/plans/plan-1/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: plan\ndata: {\"id\":\"plan-1\",\"status\":\"executing\"}\n\nevent: timeout\ndata: {\"id\":\"plan-1\"}\n\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?poll_timeout=2&poll_interval=0.05"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+	if err := conn.WriteJSON(map[string]any{"type": "subscribe_plan", "id": "sub-1", "plan_id": "plan-1"}); err != nil {
+		t.Fatalf("write subscribe_plan: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "plan_event", 3*time.Second)
+	if err := conn.WriteJSON(map[string]any{"type": "set_entity_filter", "id": "filter-1", "entity_type": "plan", "entity_id": "plan-1"}); err != nil {
+		t.Fatalf("write set_entity_filter: %v", err)
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "ping", "id": "p1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	resumeToken := toString(mustReadWSMessageByType(t, conn, "pong", 2*time.Second)["resume_token"])
+	if resumeToken == "" {
+		t.Fatalf("expected resume token on pong")
+	}
+	_ = conn.Close()
+
+	resumed, _, err := websocket.DefaultDialer.Dial(baseURL+"&resume="+resumeToken, headers)
+	if err != nil {
+		t.Fatalf("dial resumed websocket: %v", err)
+	}
+	defer resumed.Close()
+	hello := mustReadWSMessageByType(t, resumed, "hello", 2*time.Second)
+	plans, _ := hello["restored_plans"].([]any)
+	if hello["resumed"] != true || len(plans) != 1 || plans[0] != "plan-1" {
+		t.Fatalf("expected plan-1 to be restored, got %#v", hello)
+	}
+	event := mustReadWSMessageByType(t, resumed, "plan_event", 3*time.Second)
+	if event["plan_id"] != "plan-1" {
+		t.Fatalf("expected restored plan stream, got %#v", event)
+	}
+
+	if err := resumed.WriteJSON(map[string]any{"type": "set_entity_filter", "id": "filter-2", "entity_id": "plan-1"}); err != nil {
+		t.Fatalf("write set_entity_filter: %v", err)
+	}
+	ack := mustReadWSMessageByType(t, resumed, "ack", 2*time.Second)
+	if ack["entity_id"] != "plan-1" {
+		t.Fatalf("unexpected ack: %#v", ack)
+	}
+	claims, err := h.verifyWSResumeToken(toString(hello["resume_token"]), authContext{Subject: "bridge-static-token"})
+	if err != nil {
+		t.Fatalf("verify hello resume token: %v", err)
+	}
+	if claims.EntityType != "plan" || claims.EntityID != "plan-1" || len(claims.Plans) != 1 {
+		t.Fatalf("expected hello token to carry restored state, got %#v", claims)
+	}
+}
+
+func TestWebSocketFailFastWhenCoreDown(t *testing.T) {
+	var coreCalls int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events/stream" {
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+			return
+		}
+		atomic.AddInt64(&coreCalls, 1)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", WSFailFastWhenCoreDown: true, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	// Force the breaker open: the only replica is ejected.
+	h.cores.mu.Lock()
+	h.cores.replicas[0].ejectedUntil = time.Now().Add(10 * time.Second)
+	h.cores.mu.Unlock()
+
+	for _, msg := range []map[string]any{
+		{"type": "command", "id": "cmd-1", "method": "GET", "path": "/models"},
+		{"type": "terminal_list", "id": "term-1"},
+		{"type": "browser_status", "id": "browser-1"},
+	} {
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatalf("write %s: %v", msg["id"], err)
+		}
+		frame := mustReadWSMessageByType(t, conn, "error", 2*time.Second)
+		if frame["id"] != msg["id"] || frame["code"] != "core_unavailable" {
+			t.Fatalf("expected core_unavailable for %s, got %#v", msg["id"], frame)
+		}
+		if wait := toInt(frame["retry_after_ms"]); wait <= 0 || wait > 10000 {
+			t.Fatalf("expected retry_after_ms within the ejection window, got %#v", frame["retry_after_ms"])
+		}
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "ping", "id": "p1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "pong", 2*time.Second)
+	if got := atomic.LoadInt64(&coreCalls); got != 0 {
+		t.Fatalf("expected no core requests while core is down, got %d", got)
+	}
+
+	h.cores.mu.Lock()
+	h.cores.replicas[0].ejectedUntil = time.Time{}
+	h.cores.mu.Unlock()
+	if err := conn.WriteJSON(map[string]any{"type": "command", "id": "cmd-2", "method": "GET", "path": "/models"}); err != nil {
+		t.Fatalf("write command: %v", err)
+	}
+	if result := mustReadWSMessageByType(t, conn, "command_result", 2*time.Second); result["id"] != "cmd-2" {
+		t.Fatalf("expected command to be forwarded once core recovers, got %#v", result)
+	}
+}
+
+func TestWebSocketRequireAckRedeliversUntilAcknowledged(t *testing.T) {
+	var published atomic.Int64
+	published.Store(2)
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/events/stream" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		sinceID := parseInt64OrDefault(r.URL.Query().Get("since_id"), 0)
+		var b strings.Builder
+		for id := sinceID + 1; id <= published.Load(); id++ {
+			fmt.Fprintf(&b, "event: audit\ndata: {\"id\":%d}\n\n", id)
+		}
+		if b.Len() == 0 {
+			time.Sleep(50 * time.Millisecond)
+			b.WriteString("event: timeout\ndata: {}\n\n")
+		}
+		_, _ = w.Write([]byte(b.String()))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?backfill=1&require_ack=1&ack_timeout=0.3"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+	_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+
+	readBatch := func() []int {
+		var ids []int
+		for {
+			if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+				t.Fatalf("set read deadline: %v", err)
+			}
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read websocket: %v", err)
+			}
+			switch msg["type"] {
+			case "event":
+				data, _ := msg["data"].(map[string]any)
+				ids = append(ids, toInt(data["id"]))
+			case "ack_required":
+				if got := toInt(msg["last_id"]); got != ids[len(ids)-1] {
+					t.Fatalf("ack_required last_id=%d after events %v", got, ids)
+				}
+				return ids
+			}
+		}
+	}
+
+	if ids := readBatch(); fmt.Sprint(ids) != "[1 2]" {
+		t.Fatalf("unexpected first batch %v", ids)
+	}
+	// No ack: the same batch comes back after ack_timeout.
+	if ids := readBatch(); fmt.Sprint(ids) != "[1 2]" {
+		t.Fatalf("expected redelivery of [1 2], got %v", ids)
+	}
+
+	if err := conn.WriteJSON(map[string]any{"type": "ack_events", "id": "a1", "last_id": 2}); err != nil {
+		t.Fatalf("write ack_events: %v", err)
+	}
+	ack := mustReadWSMessageByType(t, conn, "ack", 2*time.Second)
+	if ack["id"] != "a1" || toInt(ack["last_id"]) != 2 {
+		t.Fatalf("unexpected ack %#v", ack)
+	}
+
+	published.Store(3)
+	if ids := readBatch(); fmt.Sprint(ids) != "[3]" {
+		t.Fatalf("expected only new event 3 after ack, got %v", ids)
+	}
+}
+
+func TestWebSocketOriginFollowsCORSAllowlist(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		_, _ = w.Write([]byte("event: timeout\ndata: {}\n\n"))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:        core.URL,
+		BridgeToken:        "bridge",
+		CORSAllowedOrigins: []string{"https://app.example.com"},
+		Timeout:            5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	dial := func(origin string) (*websocket.Conn, *http.Response, error) {
+		headers := http.Header{}
+		headers.Set("Authorization", "Bearer bridge")
+		if origin != "" {
+			headers.Set("Origin", origin)
+		}
+		return websocket.DefaultDialer.Dial(wsURL, headers)
+	}
+
+	for _, origin := range []string{"https://app.example.com", ""} {
+		conn, _, err := dial(origin)
+		if err != nil {
+			t.Fatalf("origin %q: expected upgrade, got %v", origin, err)
+		}
+		_ = mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+		conn.Close()
+	}
+
+	conn, resp, err := dial("https://evil.example.com")
+	if err == nil {
+		conn.Close()
+		t.Fatalf("expected disallowed origin to be rejected")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for disallowed origin, got resp=%v err=%v", resp, err)
+	}
+}
+
+func TestWebSocketBannerNoticeFollowsHello(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		_, _ = w.Write([]byte("event: timeout\ndata: {}\n\n"))
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL: core.URL,
+		BridgeToken: "bridge",
+		WSBanner:    "maintenance at 02:00 UTC",
+		Timeout:     5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	// firstFramesAfterPing returns the types of the frames up to and including pong.
+	firstFramesAfterPing := func() []string {
+		headers := http.Header{}
+		headers.Set("Authorization", "Bearer bridge")
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", headers)
+		if err != nil {
+			t.Fatalf("dial websocket: %v", err)
+		}
+		defer conn.Close()
+		if err := conn.WriteJSON(map[string]any{"type": "ping", "id": "p1"}); err != nil {
+			t.Fatalf("write ping: %v", err)
+		}
+		var types []string
+		for len(types) == 0 || types[len(types)-1] != "pong" {
+			if err := conn.SetReadDeadline(time.Now().Add(2 * time.Second)); err != nil {
+				t.Fatalf("set read deadline: %v", err)
+			}
+			var msg map[string]any
+			if err := conn.ReadJSON(&msg); err != nil {
+				t.Fatalf("read websocket: %v", err)
+			}
+			if msg["type"] == "notice" && msg["message"] != "maintenance at 02:00 UTC" {
+				t.Fatalf("unexpected notice %#v", msg)
+			}
+			types = append(types, toString(msg["type"]))
+		}
+		return types
+	}
+
+	if types := firstFramesAfterPing(); strings.Join(types, ",") != "hello,notice,pong" {
+		t.Fatalf("expected notice right after hello, got %v", types)
+	}
+	h.SetWSBanner("")
+	if types := firstFramesAfterPing(); strings.Join(types, ",") != "hello,pong" {
+		t.Fatalf("expected no notice without a banner, got %v", types)
+	}
+}
+
+func TestWebSocketBatchKeepsOrderWithMixedResults(t *testing.T) {
+	var inflight, peak atomic.Int64
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {}\n\n"))
+		case "/plans/slow-a", "/plans/slow-b":
+			current := inflight.Add(1)
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(150 * time.Millisecond)
+			inflight.Add(-1)
+			_, _ = w.Write([]byte(`{"id":"` + strings.TrimPrefix(r.URL.Path, "/plans/") + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"not found"}`))
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	readToken, _, err := h.issueSessionTokenWithLimit("reader", []string{scopeRead}, "", "", nil, 0, 120, defaultSessionMaxTTLSeconds)
+	if err != nil {
+		t.Fatalf("issue read token: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+readToken)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	commands := []map[string]any{
+		{"id": "a", "method": "GET", "path": "/plans/slow-a"},
+		{"id": "missing", "method": "GET", "path": "/plans/missing"},
+		{"id": "approve", "method": "POST", "path": "/plans/p1/approve", "body": map[string]any{}},
+		{"id": "b", "method": "GET", "path": "/plans/slow-b"},
+		{"id": "delete", "method": "DELETE", "path": "/plans/p1"},
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "batch", "id": "batch-1", "parallel": true, "max_parallel": 3, "commands": commands}); err != nil {
+		t.Fatalf("write batch: %v", err)
+	}
+	result := mustReadWSMessageByType(t, conn, "batch_result", 3*time.Second)
+	if result["id"] != "batch-1" || toInt(result["succeeded"]) != 2 || toInt(result["failed"]) != 3 || toInt(result["parallel"]) != 3 {
+		t.Fatalf("unexpected batch summary %#v", result)
+	}
+	entries, _ := result["results"].([]any)
+	if len(entries) != len(commands) {
+		t.Fatalf("expected %d results, got %#v", len(commands), result["results"])
+	}
+	for i, raw := range entries {
+		entry, _ := raw.(map[string]any)
+		if entry["id"] != commands[i]["id"] {
+			t.Fatalf("result %d out of order: %#v", i, entry)
+		}
+	}
+	status := func(i int) int { return toInt(entries[i].(map[string]any)["status"]) }
+	errorText := func(i int) any { return entries[i].(map[string]any)["error"] }
+	if status(0) != http.StatusOK || status(3) != http.StatusOK || status(1) != http.StatusNotFound {
+		t.Fatalf("unexpected statuses %#v", entries)
+	}
+	if errorText(2) != "forbidden by token scope" || errorText(4) != "method must be GET, POST, or PUT" {
+		t.Fatalf("expected per-entry errors, got %#v and %#v", entries[2], entries[4])
+	}
+	if peak.Load() < 2 {
+		t.Fatalf("expected slow reads to overlap in a parallel batch, peak=%d", peak.Load())
+	}
+
+	peak.Store(0)
+	if err := conn.WriteJSON(map[string]any{"type": "batch", "id": "batch-2", "commands": []map[string]any{commands[0], commands[3]}}); err != nil {
+		t.Fatalf("write sequential batch: %v", err)
+	}
+	sequential := mustReadWSMessageByType(t, conn, "batch_result", 3*time.Second)
+	if sequential["id"] != "batch-2" || toInt(sequential["parallel"]) != 1 || toInt(sequential["succeeded"]) != 2 {
+		t.Fatalf("expected sequential batch-2, got %#v", sequential)
+	}
+	if peak.Load() != 1 {
+		t.Fatalf("expected sequential batches to run one command at a time, peak=%d", peak.Load())
+	}
+}
+
+func TestWebSocketCommandForwardsSubjectHeaderFromToken(t *testing.T) {
+	var mu sync.Mutex
+	var gotHeaders http.Header
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		case "/run":
+			mu.Lock()
+			gotHeaders = r.Header.Clone()
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"status":"ok"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{
+		CoreBaseURL:             core.URL,
+		BridgeToken:             "bridge",
+		ForwardCallerIdentity:   true,
+		ForwardSubjectHeader:    true,
+		ForwardedRequestHeaders: []string{"X-Bridge-Subject", "X-Bridge-Device-ID", "X-Nova-Subject", "X-Nova-Device"},
+		Timeout:                 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	token, _, err := h.issueSessionToken("operator", []string{scopeRead, scopeRun}, "phone-1", 120)
+	if err != nil {
+		t.Fatalf("issue session token: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?since_id=0&poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+	headers.Set("X-Device-ID", "phone-1")
+	headers.Set("X-Bridge-Subject", "root")
+	headers.Set("X-Nova-Subject", "root")
+	headers.Set("X-Nova-Device", "spoofed")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteJSON(map[string]any{"type": "command", "id": "run-1", "method": "POST", "path": "/run", "body": map[string]any{"objective": "x"}}); err != nil {
+		t.Fatalf("write command: %v", err)
+	}
+	_ = mustReadWSMessageByType(t, conn, "command_result", 2*time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gotHeaders.Get("X-Bridge-Subject") != "operator" || gotHeaders.Get("X-Bridge-Device-ID") != "phone-1" {
+		t.Fatalf("expected caller identity from token on ws command, got %#v", gotHeaders)
+	}
+	if gotHeaders.Get("X-Nova-Subject") != "operator" || gotHeaders.Get("X-Nova-Device") != "phone-1" {
+		t.Fatalf("expected X-Nova subject headers from token on ws command, got %#v", gotHeaders)
+	}
+}
+
+func TestWebSocketConnectionIDStampedOnFramesAndKeptOnResume(t *testing.T) {
+	core := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events/stream":
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			_, _ = w.Write([]byte("event: timeout\ndata: {\"request_id\":\"rid\"}\n\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer core.Close()
+
+	h, err := NewHandler(Config{CoreBaseURL: core.URL, BridgeToken: "bridge", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	baseURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?poll_timeout=1&poll_interval=0.1"
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer bridge")
+	conn, _, err := websocket.DefaultDialer.Dial(baseURL, headers)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	hello := mustReadWSMessageByType(t, conn, "hello", 2*time.Second)
+	connectionID := toString(hello["connection_id"])
+	if connectionID == "" || connectionID == toString(hello["request_id"]) {
+		t.Fatalf("expected a dedicated connection_id in hello, got %#v", hello)
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "ping", "id": "p1"}); err != nil {
+		t.Fatalf("write ping: %v", err)
+	}
+	pong := mustReadWSMessageByType(t, conn, "pong", 2*time.Second)
+	if pong["connection_id"] != connectionID {
+		t.Fatalf("expected pong to carry connection_id %q, got %#v", connectionID, pong)
+	}
+	if err := conn.WriteJSON(map[string]any{"type": "no_such_type", "id": "bad-1"}); err != nil {
+		t.Fatalf("write unknown type: %v", err)
+	}
+	if frame := mustReadWSMessageByType(t, conn, "error", 2*time.Second); frame["connection_id"] != connectionID {
+		t.Fatalf("expected error frame to carry connection_id %q, got %#v", connectionID, frame)
+	}
+	resumeToken := toString(pong["resume_token"])
+	_ = conn.Close()
+
+	other, _, err := websocket.DefaultDialer.Dial(baseURL, headers)
+	if err != nil {
+		t.Fatalf("dial second websocket: %v", err)
+	}
+	defer other.Close()
+	if otherHello := mustReadWSMessageByType(t, other, "hello", 2*time.Second); otherHello["connection_id"] == connectionID {
+		t.Fatalf("expected a new connection to get its own connection_id")
+	}
+
+	resumed, _, err := websocket.DefaultDialer.Dial(baseURL+"&resume="+resumeToken, headers)
+	if err != nil {
+		t.Fatalf("dial resumed websocket: %v", err)
+	}
+	defer resumed.Close()
+	if resumedHello := mustReadWSMessageByType(t, resumed, "hello", 2*time.Second); resumedHello["connection_id"] != connectionID {
+		t.Fatalf("expected resumed connection to keep connection_id %q, got %#v", connectionID, resumedHello)
+	}
+}
+
+func TestWSHandshakeTimeoutWiredToUpgrader(t *testing.T) {
+	h, err := NewHandler(Config{CoreBaseURL: "http://127.0.0.1:8787", BridgeToken: "bridge"})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if h.wsUpgrader.HandshakeTimeout != defaultWSHandshakeTimeout {
+		t.Fatalf("expected default handshake timeout %s, got %s", defaultWSHandshakeTimeout, h.wsUpgrader.HandshakeTimeout)
+	}
+
+	h, err = NewHandler(Config{CoreBaseURL: "http://127.0.0.1:8787", BridgeToken: "bridge", WSHandshakeTimeout: 3 * time.Second})
+	if err != nil {
+		t.Fatalf("new handler: %v", err)
+	}
+	if h.wsUpgrader.HandshakeTimeout != 3*time.Second {
+		t.Fatalf("expected configured handshake timeout, got %s", h.wsUpgrader.HandshakeTimeout)
+	}
+	if h.wsUpgrader.CheckOrigin == nil || !h.wsUpgrader.CheckOrigin(httptest.NewRequest(http.MethodGet, "/ws", nil)) {
+		t.Fatalf("expected upgrader to defer origin checks to ServeHTTP")
+	}
+}
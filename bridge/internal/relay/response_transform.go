@@ -0,0 +1,10 @@
+package relay
+
+// transformResponse passes a core response through Config.ResponseTransformer. A nil
+// transformer returns status and body unchanged.
+func (h *Handler) transformResponse(path string, status int, body []byte) (int, []byte, error) {
+	if h.cfg.ResponseTransformer == nil {
+		return status, body, nil
+	}
+	return h.cfg.ResponseTransformer(path, status, body)
+}
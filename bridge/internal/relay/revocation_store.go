@@ -0,0 +1,177 @@
+package relay
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevocationStore records revoked session token IDs (JTIs). The default keeps them
+// in memory and, when Config.RevocationStorePath is set, persists them to a JSON
+// file. Multi-instance deployments can plug in a shared backend through
+// Config.RevocationStore so a revocation on one bridge is honored by all of them.
+// Times are unix seconds; an expiresAt of 0 never expires. Implementations must be
+// safe for concurrent use.
+type RevocationStore interface {
+	// Load is called once by NewHandler before any other method; an error fails
+	// handler construction.
+	Load(now int64) error
+	// Revoke marks sessionID revoked until expiresAt and reports whether it was
+	// already revoked. An error means the revocation was not recorded.
+	Revoke(sessionID string, expiresAt int64, now int64) (bool, error)
+	// IsRevoked reports whether sessionID is revoked at now. It is called on every
+	// authenticated session request, so it should be fast.
+	IsRevoked(sessionID string, now int64) bool
+	// Prune drops entries expired at now and returns how many remain.
+	Prune(now int64) int
+}
+
+// RevocationLister is optionally implemented by a RevocationStore to enumerate its
+// entries for GET /admin/revocations. Stores without it answer that route with 501.
+type RevocationLister interface {
+	// List prunes entries expired at now and returns the rest as session ID to
+	// expiresAt.
+	List(now int64) map[string]int64
+}
+
+type revocationStorePayload struct {
+	Version         int              `json:"version"`
+	RevokedSessions map[string]int64 `json:"revoked_sessions"`
+}
+
+// fileRevocationStore is the default RevocationStore. An empty path keeps
+// revocations in memory only.
+type fileRevocationStore struct {
+	path    string
+	mu      sync.RWMutex
+	entries map[string]int64
+}
+
+func newFileRevocationStore(path string) *fileRevocationStore {
+	return &fileRevocationStore{path: strings.TrimSpace(path), entries: make(map[string]int64)}
+}
+
+func (s *fileRevocationStore) Load(now int64) error {
+	entries, err := loadRevocationEntries(s.path, now)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.entries = entries
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fileRevocationStore) Revoke(sessionID string, expiresAt int64, now int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	currentExpiry, exists := s.entries[sessionID]
+	alreadyRevoked := exists && currentExpiry > now
+	s.entries[sessionID] = expiresAt
+	if err := writeJSONFileAtomic(s.path, revocationStorePayload{Version: 1, RevokedSessions: s.entries}); err != nil {
+		if exists {
+			s.entries[sessionID] = currentExpiry
+		} else {
+			delete(s.entries, sessionID)
+		}
+		return false, err
+	}
+	return alreadyRevoked, nil
+}
+
+func (s *fileRevocationStore) IsRevoked(sessionID string, now int64) bool {
+	s.mu.RLock()
+	expiresAt, exists := s.entries[sessionID]
+	s.mu.RUnlock()
+	if !exists {
+		return false
+	}
+	if expiresAt > 0 && expiresAt <= now {
+		s.mu.Lock()
+		if current, ok := s.entries[sessionID]; ok && current <= now {
+			delete(s.entries, sessionID)
+		}
+		s.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+func (s *fileRevocationStore) Prune(now int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	return len(s.entries)
+}
+
+func (s *fileRevocationStore) List(now int64) map[string]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	out := make(map[string]int64, len(s.entries))
+	for sessionID, expiresAt := range s.entries {
+		out[sessionID] = expiresAt
+	}
+	return out
+}
+
+func (s *fileRevocationStore) pruneLocked(now int64) {
+	for sessionID, expiresAt := range s.entries {
+		if expiresAt > 0 && expiresAt <= now {
+			delete(s.entries, sessionID)
+		}
+	}
+}
+
+func loadRevocationEntries(path string, now int64) (map[string]int64, error) {
+	out := make(map[string]int64)
+	payload := revocationStorePayload{}
+	found, err := readJSONFile(path, &payload)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return out, nil
+	}
+	for sessionID, expiresAt := range payload.RevokedSessions {
+		trimmed := strings.TrimSpace(sessionID)
+		if trimmed == "" {
+			continue
+		}
+		if expiresAt > 0 && expiresAt <= now {
+			continue
+		}
+		out[trimmed] = expiresAt
+	}
+	return out, nil
+}
+
+// revocationsPayload serves GET /admin/revocations.
+func (h *Handler) revocationsPayload(requestID string) (int, map[string]any) {
+	lister, ok := h.revocations.(RevocationLister)
+	if !ok {
+		return http.StatusNotImplemented, map[string]any{
+			"error":      "Revocation store does not support listing",
+			"code":       "revocation_listing_unsupported",
+			"request_id": requestID,
+		}
+	}
+	entries := lister.List(time.Now().Unix())
+	sessionIDs := make([]string, 0, len(entries))
+	for sessionID := range entries {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	sort.Strings(sessionIDs)
+	revocations := make([]map[string]any, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		revocations = append(revocations, map[string]any{"session_id": sessionID, "expires_at": entries[sessionID]})
+	}
+	return http.StatusOK, map[string]any{
+		"revocations": revocations,
+		"count":       len(revocations),
+		"request_id":  requestID,
+	}
+}
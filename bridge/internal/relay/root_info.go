@@ -0,0 +1,17 @@
+package relay
+
+// rootInfoPayload is served at GET / without auth so operators can identify the
+// bridge with a quick curl. It carries no configuration or runtime state.
+func rootInfoPayload(requestID string) map[string]any {
+	return map[string]any{
+		"service": "novaadapt-bridge-go",
+		"version": Version,
+		"endpoints": map[string]string{
+			"/health":       "liveness; ?deep=1 also probes core",
+			"/metrics":      "Prometheus metrics",
+			"/ws":           "websocket event stream and commands",
+			"/auth/session": "issue scoped session tokens (admin)",
+		},
+		"request_id": requestID,
+	}
+}
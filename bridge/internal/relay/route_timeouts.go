@@ -0,0 +1,35 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRouteTimeouts parses "route=seconds" pairs such as "/run=300,/plans/{id}=10".
+func ParseRouteTimeouts(items []string) (map[string]time.Duration, error) {
+	out := make(map[string]time.Duration)
+	for _, item := range items {
+		route, rawTimeout, ok := strings.Cut(strings.TrimSpace(item), "=")
+		route = strings.TrimSpace(route)
+		if !ok || route == "" {
+			return nil, fmt.Errorf("invalid route timeout entry %q (expected route=seconds)", item)
+		}
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(rawTimeout), 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid route timeout seconds for %q", route)
+		}
+		out[route] = time.Duration(seconds * float64(time.Second))
+	}
+	return out, nil
+}
+
+// withoutClientTimeout copies client with no overall timeout, for requests whose
+// context deadline already bounds them.
+func withoutClientTimeout(client *http.Client) *http.Client {
+	copied := *client
+	copied.Timeout = 0
+	return &copied
+}
@@ -0,0 +1,94 @@
+package relay
+
+import "strings"
+
+const unmatchedRouteTemplate = "unmatched"
+
+var bridgeLocalRoutes = map[string]struct{}{
+	"/":                      {},
+	"/health":                {},
+	"/metrics":               {},
+	"/ws":                    {},
+	"/auth/session":          {},
+	"/auth/ws-ticket":        {},
+	"/auth/session/revoke":   {},
+	"/auth/pair":             {},
+	"/auth/devices":          {},
+	"/auth/devices/remove":   {},
+	"/admin/maintenance":     {},
+	"/admin/ratelimit/flush": {},
+	"/admin/core/ping":       {},
+	"/admin/cache/flush":     {},
+	"/admin/revocations":     {},
+	"/debug/client-ip":       {},
+	"/events/stream":         {},
+}
+
+// routeTemplatePrefixes maps dynamic route prefixes to the placeholder used for
+// their first path segment and the sub-routes that may follow it. More specific
+// prefixes must come first.
+var routeTemplatePrefixes = []struct {
+	prefix      string
+	placeholder string
+	suffixes    []string
+}{
+	{prefix: "/agents/templates/shared/", placeholder: "{share_token}"},
+	{prefix: "/agents/templates/", placeholder: "{template_id}", suffixes: []string{"share", "launch"}},
+	{prefix: "/control/artifacts/", placeholder: "{artifact_id}", suffixes: []string{"preview"}},
+	{prefix: "/terminal/sessions/", placeholder: "{id}", suffixes: []string{"output", "input", "close"}},
+	{prefix: "/plugins/", placeholder: "{name}", suffixes: []string{"health", "call"}},
+	{prefix: "/jobs/", placeholder: "{id}", suffixes: []string{"cancel", "stream"}},
+	{prefix: "/plans/", placeholder: "{id}", suffixes: []string{
+		"approve", "approve_async", "reject", "retry_failed", "retry_failed_async", "steps", "stream", "undo",
+	}},
+}
+
+// routeTemplate collapses identifier segments so logs and metrics stay low-cardinality,
+// e.g. /plans/abc123/approve -> /plans/{id}/approve.
+func routeTemplate(p string) string {
+	if _, ok := bridgeLocalRoutes[p]; ok {
+		return p
+	}
+	if _, ok := allowedPaths[p]; ok {
+		return p
+	}
+	if isArtifactDownloadPath(p) {
+		return artifactRouteTemplate
+	}
+	if !isForwardedPath(p) {
+		return unmatchedRouteTemplate
+	}
+	for _, item := range routeTemplatePrefixes {
+		if !strings.HasPrefix(p, item.prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(p, item.prefix)
+		parts := strings.SplitN(rest, "/", 2)
+		if len(parts) == 1 {
+			return item.prefix + item.placeholder
+		}
+		// Unknown sub-routes collapse to one label so clients cannot mint new series.
+		for _, suffix := range item.suffixes {
+			if parts[1] == suffix {
+				return item.prefix + item.placeholder + "/" + suffix
+			}
+		}
+		return unmatchedRouteTemplate
+	}
+	return unmatchedRouteTemplate
+}
+
+// isSuspiciousPath reports whether p has a ".." segment or a NUL byte. Such paths
+// are rejected outright rather than left to path.Join cleaning, which could map
+// e.g. /plans/../admin onto a different route than the one authorized.
+func isSuspiciousPath(p string) bool {
+	if strings.ContainsRune(p, 0) {
+		return true
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return true
+		}
+	}
+	return false
+}
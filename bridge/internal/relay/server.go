@@ -0,0 +1,17 @@
+package relay
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// NewServer returns the bridge's listener for handler on addr. HTTP/2 is negotiated
+// over TLS by default; Config.DisableHTTP2 sets an empty non-nil TLSNextProto so
+// the server only speaks HTTP/1.1.
+func NewServer(addr string, handler *Handler) *http.Server {
+	server := &http.Server{Addr: addr, Handler: handler}
+	if handler.cfg.DisableHTTP2 {
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	return server
+}
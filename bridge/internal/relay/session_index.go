@@ -0,0 +1,104 @@
+package relay
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+type sessionIndexEntry struct {
+	Subject   string `json:"subject"`
+	DeviceID  string `json:"device_id,omitempty"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type sessionIndexStorePayload struct {
+	Version  int                          `json:"version"`
+	Sessions map[string]sessionIndexEntry `json:"sessions"`
+}
+
+// recordIssuedSession indexes an issued session so it can later be revoked by subject.
+func (h *Handler) recordIssuedSession(claims sessionTokenClaims) error {
+	sessionID := strings.TrimSpace(claims.JTI)
+	if sessionID == "" {
+		return nil
+	}
+	now := time.Now().Unix()
+	h.sessionIndexMu.Lock()
+	defer h.sessionIndexMu.Unlock()
+	pruneExpiredSessionIndexLocked(h.sessionIndex, now)
+	h.sessionIndex[sessionID] = sessionIndexEntry{
+		Subject:   claims.Sub,
+		DeviceID:  claims.DeviceID,
+		ExpiresAt: claims.Exp,
+	}
+	if err := persistSessionIndex(strings.TrimSpace(h.cfg.SessionIndexPath), h.sessionIndex); err != nil {
+		delete(h.sessionIndex, sessionID)
+		return fmt.Errorf("failed to persist session index: %w", err)
+	}
+	return nil
+}
+
+// sessionsForSubject returns the live indexed sessions issued to subject.
+func (h *Handler) sessionsForSubject(subject string, now int64) map[string]sessionIndexEntry {
+	subject = strings.TrimSpace(subject)
+	out := make(map[string]sessionIndexEntry)
+	h.sessionIndexMu.RLock()
+	defer h.sessionIndexMu.RUnlock()
+	for sessionID, entry := range h.sessionIndex {
+		if entry.Subject != subject {
+			continue
+		}
+		if entry.ExpiresAt > 0 && entry.ExpiresAt <= now {
+			continue
+		}
+		out[sessionID] = entry
+	}
+	return out
+}
+
+// revokeSubjectSessions revokes every live indexed session issued to subject.
+func (h *Handler) revokeSubjectSessions(subject string) ([]string, error) {
+	sessions := h.sessionsForSubject(subject, time.Now().Unix())
+	revoked := make([]string, 0, len(sessions))
+	for sessionID := range sessions {
+		revoked = append(revoked, sessionID)
+	}
+	sort.Strings(revoked)
+	for _, sessionID := range revoked {
+		if _, err := h.revokeSession(sessionID, sessions[sessionID].ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+	return revoked, nil
+}
+
+func pruneExpiredSessionIndexLocked(entries map[string]sessionIndexEntry, now int64) {
+	for sessionID, entry := range entries {
+		if entry.ExpiresAt > 0 && entry.ExpiresAt <= now {
+			delete(entries, sessionID)
+		}
+	}
+}
+
+func loadSessionIndex(path string, now int64) (map[string]sessionIndexEntry, error) {
+	out := make(map[string]sessionIndexEntry)
+	payload := sessionIndexStorePayload{}
+	if _, err := readJSONFile(path, &payload); err != nil {
+		return nil, err
+	}
+	for sessionID, entry := range payload.Sessions {
+		trimmed := strings.TrimSpace(sessionID)
+		if trimmed == "" {
+			continue
+		}
+		out[trimmed] = entry
+	}
+	pruneExpiredSessionIndexLocked(out, now)
+	return out, nil
+}
+
+func persistSessionIndex(path string, entries map[string]sessionIndexEntry) error {
+	return writeJSONFileAtomic(path, sessionIndexStorePayload{Version: 1, Sessions: entries})
+}
@@ -0,0 +1,22 @@
+package relay
+
+import (
+	"math"
+
+	"golang.org/x/time/rate"
+)
+
+// newSessionIssueLimiter builds the token bucket shared by every token-minting
+// endpoint. It returns nil, which disables the limit, when Config.SessionIssueRPS
+// is <= 0.
+func newSessionIssueLimiter(cfg Config) *rate.Limiter {
+	if cfg.SessionIssueRPS <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(cfg.SessionIssueRPS), max(1, int(math.Ceil(cfg.SessionIssueRPS))))
+}
+
+// sessionIssueAllowed reports whether another session token may be minted now.
+func (h *Handler) sessionIssueAllowed() bool {
+	return h.sessionIssueLimit == nil || h.sessionIssueLimit.Allow()
+}
@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeJSONFileAtomic writes payload as indented JSON via a temp file rename so
+// readers never observe a partially written store. Empty path is a no-op.
+func writeJSONFileAtomic(path string, payload any) error {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return nil
+	}
+	encoded, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// readJSONFile decodes path into out. It reports false without error when the file does not exist.
+func readJSONFile(path string, out any) (bool, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return false, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
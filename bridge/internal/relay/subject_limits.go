@@ -0,0 +1,54 @@
+package relay
+
+import (
+	"errors"
+	"sync"
+)
+
+// errSubjectConcurrencyLimited is returned to websocket callers when a subject has
+// Config.MaxInflightPerSubject core requests in flight.
+var errSubjectConcurrencyLimited = errors.New("too many concurrent core requests for subject")
+
+// subjectInflightKey scopes the per-subject budget by tenant so equal subject names
+// in different tenants do not share a budget.
+func subjectInflightKey(auth authContext) string {
+	subject := auth.Subject
+	if subject == "" {
+		subject = "anonymous"
+	}
+	if auth.Tenant == "" {
+		return subject
+	}
+	return auth.Tenant + "/" + subject
+}
+
+// acquireSubjectSlot takes one of the subject's Config.MaxInflightPerSubject core
+// request slots without blocking. The returned release func must be called once the
+// core request finishes; entries are dropped as soon as a subject has none in flight.
+func (h *Handler) acquireSubjectSlot(auth authContext) (func(), bool) {
+	limit := h.cfg.MaxInflightPerSubject
+	if limit <= 0 {
+		return func() {}, true
+	}
+	key := subjectInflightKey(auth)
+
+	h.subjectInflightMu.Lock()
+	defer h.subjectInflightMu.Unlock()
+	if h.subjectInflight[key] >= limit {
+		return nil, false
+	}
+	h.subjectInflight[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.subjectInflightMu.Lock()
+			defer h.subjectInflightMu.Unlock()
+			if h.subjectInflight[key] <= 1 {
+				delete(h.subjectInflight, key)
+				return
+			}
+			h.subjectInflight[key]--
+		})
+	}, true
+}
@@ -0,0 +1,41 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// coreTenantHeader carries the token's tenant to core when Config.RequireTenant is set.
+const coreTenantHeader = "X-Tenant-Id"
+
+// missingTenant reports whether auth must be refused before reaching core because
+// tenant scoping is required and the token carries no tenant claim.
+func (h *Handler) missingTenant(auth authContext) bool {
+	return h.cfg.RequireTenant && strings.TrimSpace(auth.Tenant) == ""
+}
+
+// setCoreTenantHeader sets X-Tenant-ID from the token claim. Any client-supplied
+// value is always discarded so callers cannot select another tenant.
+func (h *Handler) setCoreTenantHeader(header http.Header, auth authContext) {
+	header.Del(coreTenantHeader)
+	if !h.cfg.RequireTenant {
+		return
+	}
+	if tenant := strings.TrimSpace(auth.Tenant); tenant != "" {
+		header.Set(coreTenantHeader, tenant)
+	}
+}
+
+// issuedTenant resolves the tenant for a newly issued token. Tenant-bound callers
+// can only issue tokens for their own tenant.
+func issuedTenant(auth authContext, requested string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if auth.Tenant == "" {
+		return requested, nil
+	}
+	if requested != "" && requested != auth.Tenant {
+		return "", fmt.Errorf("cannot issue token for another tenant")
+	}
+	return auth.Tenant, nil
+}
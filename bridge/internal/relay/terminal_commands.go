@@ -0,0 +1,74 @@
+package relay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const terminalSessionsPath = "/terminal/sessions"
+
+// terminalCommandSet normalizes Config.AllowedTerminalCommands. Nil means every
+// command is allowed.
+func terminalCommandSet(commands []string) map[string]struct{} {
+	var out map[string]struct{}
+	for _, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]struct{})
+		}
+		out[command] = struct{}{}
+	}
+	return out
+}
+
+// terminalCommandName returns the program a terminal start body runs: the first
+// word of a "command" string, or the first element of a "command" argv list.
+func terminalCommandName(body map[string]any) string {
+	switch command := body["command"].(type) {
+	case string:
+		if fields := strings.Fields(command); len(fields) > 0 {
+			return fields[0]
+		}
+	case []any:
+		if len(command) > 0 {
+			return strings.TrimSpace(toString(command[0]))
+		}
+	}
+	return ""
+}
+
+// allowsTerminalCommand reports whether a terminal start request may reach core
+// under the terminal command allowlist, along with the program it resolved. A
+// missing command is rejected while the allowlist is set.
+func (h *Handler) allowsTerminalCommand(method string, path string, body map[string]any) (string, bool) {
+	if h.terminalCommands == nil || method != http.MethodPost || path != terminalSessionsPath {
+		return "", true
+	}
+	command := terminalCommandName(body)
+	_, ok := h.terminalCommands[command]
+	return command, ok
+}
+
+// allowsTerminalCommandBody is allowsTerminalCommand for a raw HTTP request body.
+func (h *Handler) allowsTerminalCommandBody(method string, path string, body []byte) (string, bool) {
+	if h.terminalCommands == nil {
+		return "", true
+	}
+	payload := map[string]any{}
+	_ = json.Unmarshal(body, &payload)
+	return h.allowsTerminalCommand(method, path, payload)
+}
+
+func terminalCommandDeniedFrame(msg wsClientMessage, command string, requestID string) map[string]any {
+	return map[string]any{
+		"type":       "error",
+		"id":         msg.ID,
+		"error":      "terminal command not allowed",
+		"command":    command,
+		"request_id": requestID,
+	}
+}
@@ -0,0 +1,107 @@
+package relay
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// terminalSessionTrackTTL bounds how long a terminal session started through the
+// bridge counts toward Config.MaxTerminalSessionsPerSubject. The bridge does not see
+// sessions that core ends on its own, so stale entries age out instead.
+const terminalSessionTrackTTL = time.Hour
+
+type trackedTerminalSession struct {
+	subjectKey string
+	expires    time.Time
+}
+
+// terminalSessionLimitReached reports whether auth's subject already has
+// Config.MaxTerminalSessionsPerSubject tracked sessions. The cap is best effort:
+// concurrent starts may briefly exceed it.
+func (h *Handler) terminalSessionLimitReached(auth authContext, now time.Time) bool {
+	limit := h.cfg.MaxTerminalSessionsPerSubject
+	if limit <= 0 {
+		return false
+	}
+	key := subjectInflightKey(auth)
+
+	h.terminalSessionsMu.Lock()
+	defer h.terminalSessionsMu.Unlock()
+	active := 0
+	for sessionID, entry := range h.terminalSessions {
+		if !now.Before(entry.expires) {
+			delete(h.terminalSessions, sessionID)
+			continue
+		}
+		if entry.subjectKey == key {
+			active++
+		}
+	}
+	return active >= limit
+}
+
+// trackTerminalSession records a session core started for auth's subject.
+func (h *Handler) trackTerminalSession(auth authContext, result coreJSONResult, now time.Time) {
+	if h.cfg.MaxTerminalSessionsPerSubject <= 0 || result.StatusCode < 200 || result.StatusCode >= 300 {
+		return
+	}
+	payload, _ := result.Payload.(map[string]any)
+	sessionID := strings.TrimSpace(toString(payload["session_id"]))
+	if sessionID == "" {
+		sessionID = strings.TrimSpace(toString(payload["id"]))
+	}
+	if sessionID == "" {
+		return
+	}
+	h.terminalSessionsMu.Lock()
+	h.terminalSessions[sessionID] = trackedTerminalSession{
+		subjectKey: subjectInflightKey(auth),
+		expires:    now.Add(terminalSessionTrackTTL),
+	}
+	h.terminalSessionsMu.Unlock()
+}
+
+// releaseTerminalSession frees sessionID's slot after a close core answered with
+// statusCode. Only a 2xx close, or a 404 for a session core already ended, frees
+// it, and only for the subject that started it, so one subject cannot free
+// another's slot by closing its session ID.
+func (h *Handler) releaseTerminalSession(auth authContext, sessionID string, statusCode int) {
+	if statusCode != http.StatusNotFound && (statusCode < 200 || statusCode >= 300) {
+		return
+	}
+	h.terminalSessionsMu.Lock()
+	if entry, ok := h.terminalSessions[sessionID]; ok && entry.subjectKey == subjectInflightKey(auth) {
+		delete(h.terminalSessions, sessionID)
+	}
+	h.terminalSessionsMu.Unlock()
+}
+
+// isTerminalStartRequest reports whether an HTTP request starts a terminal session.
+func isTerminalStartRequest(method string, path string) bool {
+	return method == http.MethodPost && path == "/terminal/sessions"
+}
+
+// terminalCloseSessionID returns the session ID of a POST
+// /terminal/sessions/{id}/close request, or "".
+func terminalCloseSessionID(method string, path string) string {
+	if method != http.MethodPost || !strings.HasPrefix(path, "/terminal/sessions/") || !strings.HasSuffix(path, "/close") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(path, "/terminal/sessions/"), "/close")
+}
+
+// trackTerminalRequest applies the HTTP equivalents of terminal_start and
+// terminal_close to the tracked sessions once core has answered.
+func (h *Handler) trackTerminalRequest(r *http.Request, auth authContext, statusCode int, payload any) {
+	if h.cfg.MaxTerminalSessionsPerSubject <= 0 {
+		return
+	}
+	if isTerminalStartRequest(r.Method, r.URL.Path) {
+		h.trackTerminalSession(auth, coreJSONResult{StatusCode: statusCode, Payload: payload}, time.Now())
+		return
+	}
+	if sessionID := terminalCloseSessionID(r.Method, r.URL.Path); sessionID != "" {
+		h.releaseTerminalSession(auth, sessionID, statusCode)
+	}
+}
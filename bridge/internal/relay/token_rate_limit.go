@@ -0,0 +1,73 @@
+package relay
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// issuedRateLimitRPS validates a requested rate_limit_rps claim. Requests above
+// Config.MaxTokenRateLimitRPS are capped; the claim is rejected when overrides are
+// disabled.
+func (h *Handler) issuedRateLimitRPS(value any) (float64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	var requested float64
+	switch v := value.(type) {
+	case float64:
+		requested = v
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("'rate_limit_rps' must be a positive number")
+		}
+		requested = parsed
+	default:
+		return 0, fmt.Errorf("'rate_limit_rps' must be a positive number")
+	}
+	if requested <= 0 || math.IsNaN(requested) || math.IsInf(requested, 0) {
+		return 0, fmt.Errorf("'rate_limit_rps' must be a positive number")
+	}
+	if h.cfg.MaxTokenRateLimitRPS <= 0 {
+		return 0, fmt.Errorf("'rate_limit_rps' overrides are not enabled")
+	}
+	return min(requested, h.cfg.MaxTokenRateLimitRPS), nil
+}
+
+// tokenRateLimit returns the limiter key and RPS override for a request carrying a
+// valid, unrevoked session token with a rate_limit_rps claim. The override is capped
+// by Config.MaxTokenRateLimitRPS so lowering the cap applies to issued tokens too.
+func (h *Handler) tokenRateLimit(r *http.Request, now time.Time) (string, float64, bool) {
+	if h.cfg.MaxTokenRateLimitRPS <= 0 {
+		return "", 0, false
+	}
+	token := extractRequestToken(r)
+	if !strings.HasPrefix(token, "na1.") {
+		return "", 0, false
+	}
+	claims, err := h.verifySessionToken(token)
+	if err != nil || claims.RateLimitRPS <= 0 || claims.JTI == "" {
+		return "", 0, false
+	}
+	if h.isSessionRevoked(claims.JTI, now.Unix()) {
+		return "", 0, false
+	}
+	return "session:" + claims.JTI, min(claims.RateLimitRPS, h.cfg.MaxTokenRateLimitRPS), true
+}
+
+// clientRateLimit is baseRateLimit for a limiter with an optional per-token RPS
+// override. The burst scales with the override so elevated clients keep the same
+// burst-to-rate ratio; a penalty always wins over an override.
+func (h *Handler) clientRateLimit(penalized bool, overrideRPS float64) (rate.Limit, int) {
+	if penalized || overrideRPS <= 0 {
+		return h.baseRateLimit(penalized)
+	}
+	burst := int(math.Ceil(float64(max(1, h.cfg.RateLimitBurst)) * overrideRPS / h.cfg.RateLimitRPS))
+	return rate.Limit(overrideRPS), max(1, burst)
+}
@@ -0,0 +1,136 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// defaultValidationFieldsPath is where field errors are read from when a
+// Config.ValidationErrorRoutes entry does not name a path.
+const defaultValidationFieldsPath = "errors"
+
+// ParseValidationErrorRoutes parses "route" or "route=fields.path" items into
+// Config.ValidationErrorRoutes.
+func ParseValidationErrorRoutes(items []string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, item := range items {
+		route, fieldsPath, _ := strings.Cut(strings.TrimSpace(item), "=")
+		route = strings.TrimSpace(route)
+		fieldsPath = strings.TrimSpace(fieldsPath)
+		if route == "" || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("invalid validation error route %q (expected route[=fields.path])", item)
+		}
+		if fieldsPath == "" {
+			fieldsPath = defaultValidationFieldsPath
+		}
+		out[route] = fieldsPath
+	}
+	return out, nil
+}
+
+// normalizeValidationError rewrites a core 422 body for a configured route into
+// {"error":"validation_failed","fields":{...}}. Bodies whose field errors cannot be
+// located are passed through unchanged.
+func (h *Handler) normalizeValidationError(route string, status int, payload any, requestID string) any {
+	if status != http.StatusUnprocessableEntity {
+		return payload
+	}
+	fieldsPath, ok := h.cfg.ValidationErrorRoutes[route]
+	if !ok {
+		return payload
+	}
+	raw, ok := lookupJSONPath(payload, fieldsPath)
+	if !ok {
+		return payload
+	}
+	fields, ok := validationFields(raw)
+	if !ok {
+		return payload
+	}
+	return map[string]any{
+		"error":      "validation_failed",
+		"fields":     fields,
+		"request_id": requestID,
+	}
+}
+
+func lookupJSONPath(payload any, dotted string) (any, bool) {
+	current := payload
+	for _, key := range strings.Split(dotted, ".") {
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// validationFields accepts either {"field": "message"} objects or lists of
+// {"field"|"loc": ..., "message"|"msg": ...} entries.
+func validationFields(raw any) (map[string]any, bool) {
+	switch value := raw.(type) {
+	case map[string]any:
+		fields := make(map[string]any, len(value))
+		for field, message := range value {
+			fields[field] = validationMessage(message)
+		}
+		return fields, true
+	case []any:
+		fields := make(map[string]any, len(value))
+		for _, item := range value {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				return nil, false
+			}
+			field := validationFieldName(entry)
+			if field == "" {
+				return nil, false
+			}
+			message := entry["message"]
+			if message == nil {
+				message = entry["msg"]
+			}
+			fields[field] = validationMessage(message)
+		}
+		return fields, true
+	default:
+		return nil, false
+	}
+}
+
+func validationFieldName(entry map[string]any) string {
+	if field := strings.TrimSpace(toString(entry["field"])); field != "" {
+		return field
+	}
+	loc, ok := entry["loc"].([]any)
+	if !ok {
+		return ""
+	}
+	parts := make([]string, 0, len(loc))
+	for _, part := range loc {
+		parts = append(parts, fmt.Sprint(part))
+	}
+	return strings.Join(parts, ".")
+}
+
+func validationMessage(message any) string {
+	switch value := message.(type) {
+	case string:
+		return value
+	case []any:
+		parts := make([]string, 0, len(value))
+		for _, part := range value {
+			parts = append(parts, fmt.Sprint(part))
+		}
+		return strings.Join(parts, "; ")
+	case nil:
+		return "invalid"
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultWSAckTimeoutSeconds is how long a require_ack=1 connection has to send
+// "ack_events" for a batch before the pump redelivers the unacknowledged events.
+const defaultWSAckTimeoutSeconds = 10.0
+
+// wsAckTracker holds the acknowledgment state of one require_ack=1 websocket
+// connection. The audit pump calls expect before delivering a batch and wait
+// afterwards; "ack_events" messages call ack.
+type wsAckTracker struct {
+	mu      sync.Mutex
+	pending int64
+	acked   int64
+	signal  chan struct{}
+}
+
+func newWSAckTracker() *wsAckTracker {
+	return &wsAckTracker{signal: make(chan struct{}, 1)}
+}
+
+// expect starts a batch covering events after sinceID up to lastID and forgets
+// acknowledgments from earlier batches.
+func (t *wsAckTracker) expect(sinceID int64, lastID int64) {
+	t.mu.Lock()
+	t.pending = lastID
+	t.acked = sinceID
+	t.mu.Unlock()
+	select {
+	case <-t.signal:
+	default:
+	}
+}
+
+// ack records that the client has processed every event up to id and returns
+// the acknowledged cursor, which never moves past the batch in flight.
+func (t *wsAckTracker) ack(id int64) int64 {
+	t.mu.Lock()
+	if id > t.pending {
+		id = t.pending
+	}
+	if id > t.acked {
+		t.acked = id
+	}
+	acked := t.acked
+	t.mu.Unlock()
+	select {
+	case t.signal <- struct{}{}:
+	default:
+	}
+	return acked
+}
+
+// wait blocks until the batch is fully acknowledged, the timeout elapses or done
+// closes. It returns the acknowledged cursor and whether the batch is complete.
+func (t *wsAckTracker) wait(done <-chan struct{}, timeout time.Duration) (int64, bool) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		t.mu.Lock()
+		acked, pending := t.acked, t.pending
+		t.mu.Unlock()
+		if acked >= pending {
+			return acked, true
+		}
+		select {
+		case <-done:
+			return acked, false
+		case <-timer.C:
+			return acked, false
+		case <-t.signal:
+		}
+	}
+}
+
+func (h *Handler) handleWSAckEvents(
+	writer *wsJSONWriter,
+	requestID string,
+	msg wsClientMessage,
+	acks *wsAckTracker,
+) error {
+	if acks == nil {
+		return writer.write(
+			map[string]any{"type": "error", "id": msg.ID, "error": "ack_events requires require_ack=1", "request_id": requestID},
+		)
+	}
+	if msg.LastID == nil {
+		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": "'last_id' is required", "request_id": requestID})
+	}
+	acked := acks.ack(*msg.LastID)
+	return writer.write(map[string]any{"type": "ack", "id": msg.ID, "request_id": requestID, "last_id": acked})
+}
@@ -0,0 +1,204 @@
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sharedAuditReplaySize bounds the recent events replayed to a connection that joins
+// a running shared poller with an older since_id.
+const sharedAuditReplaySize = wsMaxEventsPerPoll
+
+// auditSubscriber is one websocket connection attached to a shared audit poller.
+type auditSubscriber struct {
+	writer      *wsJSONWriter
+	requestID   string
+	lastEventID *int64
+	filter      *wsEventFilter
+	mu          sync.Mutex
+}
+
+// sharedAuditPoller long-polls core /events/stream once for every connection of a
+// tenant and fans each audit event out to subscribers whose since_id is behind it.
+// When caller identity or session metadata is forwarded to core, connections only
+// share a poller with callers core sees identically (see sharedAuditKey).
+type sharedAuditPoller struct {
+	auth        authContext
+	mu          sync.Mutex
+	subscribers map[*auditSubscriber]struct{}
+	recent      []wsSSEEvent
+	cursor      int64
+	stop        chan struct{}
+}
+
+// sharedAuditKey groups connections whose core /events/stream requests would be
+// indistinguishable: same tenant, plus the same forwarded identity and metadata,
+// mirroring how the response cache keys per caller.
+func (h *Handler) sharedAuditKey(auth authContext) string {
+	return auth.Tenant + h.identityCacheSuffix(auth) + metadataCacheSuffix(auth)
+}
+
+// subscribeSharedAudit attaches a connection to the tenant's shared poller, starting
+// the poller for the first subscriber. The returned func detaches it; the poller
+// stops once its last subscriber leaves.
+func (h *Handler) subscribeSharedAudit(
+	auth authContext,
+	writer *wsJSONWriter,
+	requestID string,
+	lastEventID *int64,
+	filter *wsEventFilter,
+) func() {
+	sub := &auditSubscriber{writer: writer, requestID: requestID, lastEventID: lastEventID, filter: filter}
+	key := h.sharedAuditKey(auth)
+
+	h.auditPollersMu.Lock()
+	poller, ok := h.auditPollers[key]
+	if !ok {
+		poller = &sharedAuditPoller{
+			auth:        auth,
+			subscribers: make(map[*auditSubscriber]struct{}),
+			cursor:      atomic.LoadInt64(lastEventID),
+			stop:        make(chan struct{}),
+		}
+		h.auditPollers[key] = poller
+		go h.runSharedAuditPoller(poller)
+	}
+	poller.mu.Lock()
+	poller.subscribers[sub] = struct{}{}
+	replay := append([]wsSSEEvent(nil), poller.recent...)
+	poller.mu.Unlock()
+	h.auditPollersMu.Unlock()
+
+	sub.deliver(replay)
+
+	return func() {
+		h.auditPollersMu.Lock()
+		defer h.auditPollersMu.Unlock()
+		poller.mu.Lock()
+		delete(poller.subscribers, sub)
+		empty := len(poller.subscribers) == 0
+		poller.mu.Unlock()
+		if empty && h.auditPollers[key] == poller {
+			delete(h.auditPollers, key)
+			close(poller.stop)
+		}
+	}
+}
+
+func (h *Handler) runSharedAuditPoller(poller *sharedAuditPoller) {
+	backoff := h.newWSPumpBackoff()
+	for {
+		select {
+		case <-poller.stop:
+			return
+		default:
+		}
+
+		poller.mu.Lock()
+		cursor := poller.cursor
+		poller.mu.Unlock()
+		events, nextSinceID, _, err := h.pollAuditEvents(
+			poller.auth,
+			normalizeRequestID(""),
+			cursor,
+			defaultWSPollTimeoutSeconds,
+			defaultWSPollIntervalSeconds,
+		)
+		if err != nil {
+			h.recordWSPumpError()
+			delay, notify, stop := backoff.failure(err)
+			if stop {
+				h.retireSharedAuditPoller(poller)
+				return
+			}
+			if notify {
+				for _, sub := range poller.snapshot() {
+					_ = sub.writer.write(wsPumpErrorFrame(err, sub.requestID))
+				}
+			}
+			select {
+			case <-poller.stop:
+				return
+			case <-time.After(delay):
+			}
+			continue
+		}
+		backoff.reset()
+
+		poller.mu.Lock()
+		if nextSinceID > poller.cursor {
+			poller.cursor = nextSinceID
+		}
+		poller.recent = append(poller.recent, events...)
+		if overflow := len(poller.recent) - sharedAuditReplaySize; overflow > 0 {
+			poller.recent = append([]wsSSEEvent(nil), poller.recent[overflow:]...)
+		}
+		poller.mu.Unlock()
+
+		for _, sub := range poller.snapshot() {
+			sub.deliver(events)
+		}
+
+		if len(events) == 0 {
+			select {
+			case <-poller.stop:
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+}
+
+// retireSharedAuditPoller detaches a poller that gave up so the next connection for
+// its tenant starts a fresh one.
+func (h *Handler) retireSharedAuditPoller(poller *sharedAuditPoller) {
+	h.auditPollersMu.Lock()
+	defer h.auditPollersMu.Unlock()
+	for key, current := range h.auditPollers {
+		if current == poller {
+			delete(h.auditPollers, key)
+		}
+	}
+}
+
+func (p *sharedAuditPoller) snapshot() []*auditSubscriber {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]*auditSubscriber, 0, len(p.subscribers))
+	for sub := range p.subscribers {
+		out = append(out, sub)
+	}
+	return out
+}
+
+// deliver writes events newer than the subscriber's own since_id and advances it.
+func (s *auditSubscriber) deliver(events []wsSSEEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range events {
+		id, ok := asInt64(item.Data["id"])
+		if ok && id <= atomic.LoadInt64(s.lastEventID) {
+			continue
+		}
+		if !s.filter.matches(item.Data) {
+			if ok {
+				atomic.StoreInt64(s.lastEventID, id)
+			}
+			continue
+		}
+		if err := s.writer.writeDroppable(
+			map[string]any{
+				"type":       "event",
+				"event":      item.Event,
+				"data":       item.Data,
+				"request_id": s.requestID,
+			},
+		); err != nil {
+			return
+		}
+		if ok {
+			atomic.StoreInt64(s.lastEventID, id)
+		}
+	}
+}
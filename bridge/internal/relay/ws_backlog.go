@@ -0,0 +1,26 @@
+package relay
+
+// wsBacklogSkip decides whether a connection's first poll should fast-forward past
+// a backlog deeper than Config.WSMaxBacklogEvents. It returns the cursor to resume
+// from and how many event IDs are skipped; skipped is 0 when no skip applies or the
+// client opted into backfill.
+func (h *Handler) wsBacklogSkip(sinceID int64, latestID int64, backfill bool) (int64, int64) {
+	limit := int64(h.cfg.WSMaxBacklogEvents)
+	if limit <= 0 || backfill || latestID-sinceID <= limit {
+		return sinceID, 0
+	}
+	skipTo := latestID - limit
+	return skipTo, skipTo - sinceID
+}
+
+// auditEventsAfter drops events at or below cursor.
+func auditEventsAfter(events []wsSSEEvent, cursor int64) []wsSSEEvent {
+	out := events[:0]
+	for _, item := range events {
+		if id, ok := asInt64(item.Data["id"]); ok && id <= cursor {
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+package relay
+
+import "strings"
+
+// SetWSBanner replaces the notice sent to new websocket connections right after
+// hello, e.g. when the operator reloads it on SIGHUP. Empty disables the notice.
+// Connections that are already open are not notified.
+func (h *Handler) SetWSBanner(message string) {
+	h.wsBanner.Store(strings.TrimSpace(message))
+}
+
+// wsBannerFrame returns the connect notice frame, or nil when no banner is set.
+func (h *Handler) wsBannerFrame(requestID string) map[string]any {
+	message, _ := h.wsBanner.Load().(string)
+	if message == "" {
+		return nil
+	}
+	return map[string]any{"type": "notice", "message": message, "request_id": requestID}
+}
@@ -0,0 +1,74 @@
+package relay
+
+import "sync"
+
+const (
+	// wsMaxBatchCommands caps the sub-commands in one "batch" message.
+	wsMaxBatchCommands = 32
+	// wsDefaultBatchParallel and wsMaxBatchParallel bound how many sub-commands of a
+	// parallel batch run at once.
+	wsDefaultBatchParallel = 4
+	wsMaxBatchParallel     = 8
+)
+
+// handleWSBatch runs the "command"-shaped entries of a "batch" message and replies
+// with one batch_result whose results line up with the request order. Each entry is
+// checked and forwarded exactly like a standalone command, so one failure only
+// affects its own slot. Entries run one at a time unless parallel is set.
+func (h *Handler) handleWSBatch(writer *wsJSONWriter, requestID string, msg wsClientMessage, auth authContext) error {
+	if len(msg.Commands) == 0 {
+		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": "'commands' is required", "request_id": requestID})
+	}
+	if len(msg.Commands) > wsMaxBatchCommands {
+		return writer.write(
+			map[string]any{
+				"type":         "error",
+				"id":           msg.ID,
+				"error":        "too many batch commands",
+				"max_commands": wsMaxBatchCommands,
+				"request_id":   requestID,
+			},
+		)
+	}
+
+	parallelism := 1
+	if msg.Parallel {
+		parallelism = wsDefaultBatchParallel
+		if msg.MaxParallel != nil && *msg.MaxParallel > 0 {
+			parallelism = *msg.MaxParallel
+		}
+		parallelism = min(parallelism, wsMaxBatchParallel, len(msg.Commands))
+	}
+
+	results := make([]map[string]any, len(msg.Commands))
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, command := range msg.Commands {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, command wsClientMessage) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = h.wsCommandFrame(requestID, command, auth)
+		}(i, command)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if status := toInt(result["status"]); result["type"] != "command_result" || status < 200 || status >= 300 {
+			failed++
+		}
+	}
+	return writer.write(
+		map[string]any{
+			"type":       "batch_result",
+			"id":         msg.ID,
+			"results":    results,
+			"succeeded":  len(results) - failed,
+			"failed":     failed,
+			"parallel":   parallelism,
+			"request_id": requestID,
+		},
+	)
+}
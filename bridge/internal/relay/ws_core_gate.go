@@ -0,0 +1,66 @@
+package relay
+
+import "time"
+
+// wsCoreBoundMessageTypes are the websocket messages that make a core request and
+// are refused up front by Config.WSFailFastWhenCoreDown.
+var wsCoreBoundMessageTypes = map[string]struct{}{
+	"terminal_list":             {},
+	"terminal_start":            {},
+	"terminal_poll":             {},
+	"terminal_input":            {},
+	"terminal_close":            {},
+	"browser_status":            {},
+	"browser_pages":             {},
+	"browser_action":            {},
+	"browser_navigate":          {},
+	"browser_click":             {},
+	"browser_fill":              {},
+	"browser_extract_text":      {},
+	"browser_screenshot":        {},
+	"browser_wait_for_selector": {},
+	"browser_evaluate_js":       {},
+	"browser_close":             {},
+	"command":                   {},
+	"batch":                     {},
+}
+
+// unavailableFor reports whether every replica is ejected, and how long until the
+// first one is retried.
+func (p *corePool) unavailableFor(now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var soonest time.Time
+	for _, replica := range p.replicas {
+		if !now.Before(replica.ejectedUntil) {
+			return 0, false
+		}
+		if soonest.IsZero() || replica.ejectedUntil.Before(soonest) {
+			soonest = replica.ejectedUntil
+		}
+	}
+	return soonest.Sub(now), len(p.replicas) > 0
+}
+
+// wsCoreUnavailableFrame returns the error frame for a core-bound message while
+// every core replica is ejected, or nil when the message may be forwarded.
+func (h *Handler) wsCoreUnavailableFrame(msgType string, msg wsClientMessage, requestID string) map[string]any {
+	if !h.cfg.WSFailFastWhenCoreDown {
+		return nil
+	}
+	if _, ok := wsCoreBoundMessageTypes[msgType]; !ok {
+		return nil
+	}
+	wait, down := h.cores.unavailableFor(time.Now())
+	if !down {
+		return nil
+	}
+	return map[string]any{
+		"type":           "error",
+		"id":             msg.ID,
+		"error":          "core unavailable",
+		"code":           "core_unavailable",
+		"retry_after_ms": wait.Milliseconds(),
+		"request_id":     requestID,
+	}
+}
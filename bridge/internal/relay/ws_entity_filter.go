@@ -0,0 +1,48 @@
+package relay
+
+import (
+	"strings"
+	"sync"
+)
+
+// wsEventFilter limits a websocket connection's audit events to one entity. It is
+// set from the /ws entity_id/entity_type query params and the set_entity_filter
+// message, and read by the audit pump.
+type wsEventFilter struct {
+	mu         sync.RWMutex
+	entityID   string
+	entityType string
+}
+
+func newWSEventFilter(entityID string, entityType string) *wsEventFilter {
+	f := &wsEventFilter{}
+	f.set(entityID, entityType)
+	return f
+}
+
+// set replaces the filter; empty values match any entity.
+func (f *wsEventFilter) set(entityID string, entityType string) {
+	f.mu.Lock()
+	f.entityID = strings.TrimSpace(entityID)
+	f.entityType = strings.TrimSpace(entityType)
+	f.mu.Unlock()
+}
+
+func (f *wsEventFilter) snapshot() (string, string) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.entityID, f.entityType
+}
+
+// matches reports whether an audit event's data passes the filter. Filtered events
+// still advance the connection's since_id.
+func (f *wsEventFilter) matches(data map[string]any) bool {
+	entityID, entityType := f.snapshot()
+	if entityID != "" && toString(data["entity_id"]) != entityID {
+		return false
+	}
+	if entityType != "" && toString(data["entity_type"]) != entityType {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package relay
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// wsHealthMinInterval is how often one websocket connection may run a "health"
+// message, which probes core like GET /health?deep=1.
+const wsHealthMinInterval = 5 * time.Second
+
+// wsHealthThrottle rate-limits "health" messages for one websocket connection.
+type wsHealthThrottle struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+// allow reports whether a probe may run now, or how long the caller must wait.
+func (t *wsHealthThrottle) allow(now time.Time) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.last.IsZero() {
+		if wait := wsHealthMinInterval - now.Sub(t.last); wait > 0 {
+			return false, wait
+		}
+	}
+	t.last = now
+	return true, 0
+}
+
+func (h *Handler) handleWSHealth(
+	writer *wsJSONWriter,
+	requestID string,
+	msg wsClientMessage,
+	auth authContext,
+	throttle *wsHealthThrottle,
+) error {
+	if !auth.hasScope(scopeRead) {
+		return writer.write(
+			map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      "forbidden by token scope",
+				"request_id": requestID,
+			},
+		)
+	}
+	if ok, wait := throttle.allow(time.Now()); !ok {
+		return writer.write(
+			map[string]any{
+				"type":        "error",
+				"id":          msg.ID,
+				"error":       "health rate limited",
+				"retry_after": int(math.Ceil(wait.Seconds())),
+				"request_id":  requestID,
+			},
+		)
+	}
+
+	status, payload := h.healthPayload(requestID, true)
+	return writer.write(
+		map[string]any{
+			"type":       "health_result",
+			"id":         msg.ID,
+			"status":     status,
+			"health":     payload,
+			"request_id": requestID,
+		},
+	)
+}
@@ -0,0 +1,259 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// wsPlanStreams tracks the plan subscriptions of a single websocket connection.
+type wsPlanStreams struct {
+	mu           sync.Mutex
+	cancels      map[string]chan struct{}
+	wg           sync.WaitGroup
+	done         <-chan struct{}
+	pollTimeout  float64
+	pollInterval float64
+}
+
+func newWSPlanStreams(done <-chan struct{}, pollTimeout float64, pollInterval float64) *wsPlanStreams {
+	return &wsPlanStreams{
+		cancels:      make(map[string]chan struct{}),
+		done:         done,
+		pollTimeout:  pollTimeout,
+		pollInterval: pollInterval,
+	}
+}
+
+// closeAll stops every subscription and waits for the stream goroutines to exit.
+func (s *wsPlanStreams) closeAll() {
+	s.mu.Lock()
+	for planID, cancel := range s.cancels {
+		close(cancel)
+		delete(s.cancels, planID)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// planIDs returns the active subscriptions in sorted order.
+func (s *wsPlanStreams) planIDs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.cancels))
+	for planID := range s.cancels {
+		out = append(out, planID)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *wsPlanStreams) stop(planID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cancel, ok := s.cancels[planID]
+	if ok {
+		close(cancel)
+		delete(s.cancels, planID)
+	}
+	return ok
+}
+
+func (s *wsPlanStreams) finished(planID string, cancel chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if current, ok := s.cancels[planID]; ok && current == cancel {
+		delete(s.cancels, planID)
+	}
+}
+
+func (h *Handler) handleWSSubscribePlan(
+	writer *wsJSONWriter,
+	requestID string,
+	msg wsClientMessage,
+	auth authContext,
+	streams *wsPlanStreams,
+) error {
+	planID, err := normalizeWSPlanID(msg.PlanID)
+	if err != nil {
+		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": err.Error(), "request_id": requestID})
+	}
+	path := "/plans/" + url.PathEscape(planID) + "/stream"
+	if !auth.canAccess(http.MethodGet, path) {
+		return writer.write(
+			map[string]any{
+				"type":       "error",
+				"id":         msg.ID,
+				"error":      "forbidden by token scope",
+				"path":       path,
+				"method":     http.MethodGet,
+				"request_id": requestID,
+			},
+		)
+	}
+
+	exists := h.startPlanStream(auth, writer, requestID, planID, streams)
+	return writer.write(
+		map[string]any{
+			"type":       "ack",
+			"id":         msg.ID,
+			"action":     "subscribe_plan",
+			"plan_id":    planID,
+			"active":     exists,
+			"request_id": requestID,
+		},
+	)
+}
+
+// startPlanStream subscribes the connection to planID unless it already is, and
+// reports whether a subscription existed.
+func (h *Handler) startPlanStream(
+	auth authContext,
+	writer *wsJSONWriter,
+	requestID string,
+	planID string,
+	streams *wsPlanStreams,
+) bool {
+	path := "/plans/" + url.PathEscape(planID) + "/stream"
+	streams.mu.Lock()
+	_, exists := streams.cancels[planID]
+	cancel := make(chan struct{})
+	if !exists {
+		streams.cancels[planID] = cancel
+		streams.wg.Add(1)
+	}
+	streams.mu.Unlock()
+	if !exists {
+		go func() {
+			defer streams.wg.Done()
+			defer streams.finished(planID, cancel)
+			h.streamPlanEvents(auth, writer, requestID, planID, path, cancel, streams)
+		}()
+	}
+	return exists
+}
+
+func (h *Handler) handleWSUnsubscribePlan(
+	writer *wsJSONWriter,
+	requestID string,
+	msg wsClientMessage,
+	streams *wsPlanStreams,
+) error {
+	planID, err := normalizeWSPlanID(msg.PlanID)
+	if err != nil {
+		return writer.write(map[string]any{"type": "error", "id": msg.ID, "error": err.Error(), "request_id": requestID})
+	}
+	stopped := streams.stop(planID)
+	return writer.write(
+		map[string]any{
+			"type":       "ack",
+			"id":         msg.ID,
+			"action":     "unsubscribe_plan",
+			"plan_id":    planID,
+			"stopped":    stopped,
+			"request_id": requestID,
+		},
+	)
+}
+
+// streamPlanEvents relays core's /plans/{id}/stream SSE as plan_event frames. Core
+// closes each stream on timeout, so it is re-polled until an end/error event,
+// unsubscribe, or connection close. Unchanged plan snapshots are not resent.
+func (h *Handler) streamPlanEvents(
+	auth authContext,
+	writer *wsJSONWriter,
+	requestID string,
+	planID string,
+	path string,
+	cancel <-chan struct{},
+	streams *wsPlanStreams,
+) {
+	query := fmt.Sprintf(
+		"timeout=%s&interval=%s",
+		formatFloat(streams.pollTimeout),
+		formatFloat(streams.pollInterval),
+	)
+	lastSnapshot := ""
+	for {
+		select {
+		case <-cancel:
+			return
+		case <-streams.done:
+			return
+		default:
+		}
+
+		rawResult, err := h.coreRawRequest(auth, path, query, requestID)
+		if err == nil && rawResult.StatusCode != http.StatusOK {
+			err = fmt.Errorf("plan stream failed with status %d: %s", rawResult.StatusCode, string(rawResult.Payload))
+		}
+		if err != nil {
+			_ = writer.write(
+				map[string]any{
+					"type":       "error",
+					"source":     "plan_stream",
+					"plan_id":    planID,
+					"error":      err.Error(),
+					"request_id": requestID,
+				},
+			)
+			return
+		}
+
+		for _, item := range parseSSE(rawResult.Payload) {
+			if item.Event == "timeout" {
+				continue
+			}
+			if item.Event == "plan" {
+				snapshot, _ := json.Marshal(item.Data)
+				if string(snapshot) == lastSnapshot {
+					continue
+				}
+				lastSnapshot = string(snapshot)
+			}
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			if err := writer.write(
+				map[string]any{
+					"type":       "plan_event",
+					"plan_id":    planID,
+					"event":      item.Event,
+					"data":       item.Data,
+					"request_id": requestID,
+				},
+			); err != nil {
+				return
+			}
+			if item.Event == "end" || item.Event == "error" {
+				return
+			}
+		}
+
+		select {
+		case <-cancel:
+			return
+		case <-streams.done:
+			return
+		case <-time.After(time.Duration(streams.pollInterval * float64(time.Second))):
+		}
+	}
+}
+
+func normalizeWSPlanID(value string) (string, error) {
+	planID := strings.TrimSpace(value)
+	if planID == "" {
+		return "", fmt.Errorf("'plan_id' is required")
+	}
+	if strings.Contains(planID, "/") || strings.Contains(planID, "?") {
+		return "", fmt.Errorf("invalid 'plan_id'")
+	}
+	return planID, nil
+}
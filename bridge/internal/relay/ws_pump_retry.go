@@ -0,0 +1,95 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// wsPumpRetryDelay is the pause after a transient core events failure.
+	wsPumpRetryDelay = 500 * time.Millisecond
+	// wsPumpAuthBackoffMax caps the exponential backoff after core rejects the bridge.
+	wsPumpAuthBackoffMax = 30 * time.Second
+	// wsPumpAuthMaxRetries is how many consecutive core 401/403 responses an audit
+	// pump tolerates before it stops polling.
+	wsPumpAuthMaxRetries = 6
+)
+
+// coreStatusError is a core events failure carrying the core HTTP status.
+type coreStatusError struct {
+	StatusCode int
+	msg        string
+}
+
+func (e *coreStatusError) Error() string {
+	return e.msg
+}
+
+func isCoreAuthFailure(err error) bool {
+	var statusErr *coreStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+}
+
+// wsPumpBackoff tracks consecutive core auth failures for one audit pump loop.
+type wsPumpBackoff struct {
+	base         time.Duration
+	authFailures int
+}
+
+// failure records a pump error and returns how long to wait before the next poll,
+// whether subscribers should be sent a frame for it, and whether the pump should stop.
+// Core auth failures back off exponentially and are reported once per streak.
+func (b *wsPumpBackoff) failure(err error) (time.Duration, bool, bool) {
+	if !isCoreAuthFailure(err) {
+		b.authFailures = 0
+		return wsPumpRetryDelay, true, false
+	}
+	b.authFailures++
+	if b.authFailures >= wsPumpAuthMaxRetries {
+		return 0, false, true
+	}
+	delay := b.base << (b.authFailures - 1)
+	if delay <= 0 || delay > wsPumpAuthBackoffMax {
+		delay = wsPumpAuthBackoffMax
+	}
+	return delay, b.authFailures == 1, false
+}
+
+func (b *wsPumpBackoff) reset() {
+	b.authFailures = 0
+}
+
+func (h *Handler) newWSPumpBackoff() *wsPumpBackoff {
+	return &wsPumpBackoff{base: h.wsAuthBackoff}
+}
+
+func (h *Handler) recordWSPumpError() {
+	atomic.AddUint64(&h.wsPumpErrorsTotal, 1)
+}
+
+// wsPumpErrorFrame builds the client frame for an audit pump error. Core auth
+// failures use a distinct auth_error type so clients can stop expecting events.
+func wsPumpErrorFrame(err error, requestID string) map[string]any {
+	var statusErr *coreStatusError
+	if isCoreAuthFailure(err) && errors.As(err, &statusErr) {
+		return map[string]any{
+			"type":        "auth_error",
+			"source":      "events",
+			"error":       fmt.Sprintf("core rejected bridge credentials (status %d)", statusErr.StatusCode),
+			"core_status": statusErr.StatusCode,
+			"request_id":  requestID,
+		}
+	}
+	return map[string]any{
+		"type":       "error",
+		"source":     "events",
+		"error":      err.Error(),
+		"request_id": requestID,
+	}
+}
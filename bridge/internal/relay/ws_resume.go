@@ -0,0 +1,132 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// wsResumeTokenTTL bounds how long a /ws resume token can restore a connection.
+	wsResumeTokenTTL    = 10 * time.Minute
+	wsResumeTokenPrefix = "nr1."
+	// wsResumeMaxPlans and wsResumeMaxPlanIDBytes bound the plan subscriptions a
+	// token carries; wsResumeTokenMaxBytes rejects oversized tokens before decoding.
+	wsResumeMaxPlans       = 32
+	wsResumeMaxPlanIDBytes = 128
+	wsResumeTokenMaxBytes  = 8 << 10
+)
+
+// wsResumeClaims is the signed state carried by a /ws resume token.
+type wsResumeClaims struct {
+	Sub          string  `json:"sub,omitempty"`
+	ConnectionID string  `json:"connection_id,omitempty"`
+	SinceID      int64   `json:"since_id"`
+	PollTimeout  float64 `json:"poll_timeout"`
+	PollInterval float64 `json:"poll_interval"`
+	// Plans lists plan_id subscriptions restored on reconnect; EntityID and
+	// EntityType restore the set_entity_filter state.
+	Plans      []string `json:"plans,omitempty"`
+	EntityID   string   `json:"entity_id,omitempty"`
+	EntityType string   `json:"entity_type,omitempty"`
+	Exp        int64    `json:"exp"`
+}
+
+// wsResumeState captures a connection's ID, cursor, poll settings, plan
+// subscriptions and entity filter for issueWSResumeToken.
+func wsResumeState(connectionID string, sinceID int64, streams *wsPlanStreams, filter *wsEventFilter) wsResumeClaims {
+	entityID, entityType := filter.snapshot()
+	return wsResumeClaims{
+		ConnectionID: connectionID,
+		SinceID:      sinceID,
+		PollTimeout:  streams.pollTimeout,
+		PollInterval: streams.pollInterval,
+		Plans:        streams.planIDs(),
+		EntityID:     entityID,
+		EntityType:   entityType,
+	}
+}
+
+// issueWSResumeToken signs state (see wsResumeState) for auth's subject, dropping
+// plan subscriptions beyond the size bounds. It returns "" when no signing key is
+// configured.
+func (h *Handler) issueWSResumeToken(auth authContext, state wsResumeClaims) string {
+	key := h.sessionSigningKey()
+	if key == "" {
+		return ""
+	}
+	plans := make([]string, 0, len(state.Plans))
+	for _, planID := range state.Plans {
+		if len(plans) == wsResumeMaxPlans {
+			break
+		}
+		if len(planID) <= wsResumeMaxPlanIDBytes {
+			plans = append(plans, planID)
+		}
+	}
+	state.Plans = plans
+	state.Sub = auth.Subject
+	state.Exp = time.Now().Add(wsResumeTokenTTL).Unix()
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return ""
+	}
+	body := wsResumeTokenPrefix + base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + signSessionBody(body, key)
+}
+
+// verifyWSResumeToken validates a ?resume= token for auth's subject.
+func (h *Handler) verifyWSResumeToken(token string, auth authContext) (wsResumeClaims, error) {
+	key := h.sessionSigningKey()
+	if key == "" {
+		return wsResumeClaims{}, fmt.Errorf("resume tokens are not enabled")
+	}
+	if len(token) > wsResumeTokenMaxBytes {
+		return wsResumeClaims{}, fmt.Errorf("resume token too large")
+	}
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 || parts[0] != "nr1" {
+		return wsResumeClaims{}, fmt.Errorf("invalid resume token format")
+	}
+	// The prefix is signed too, so a resume token can never verify as a session token.
+	if subtle.ConstantTimeCompare([]byte(parts[2]), []byte(signSessionBody(wsResumeTokenPrefix+parts[1], key))) != 1 {
+		return wsResumeClaims{}, fmt.Errorf("invalid resume token signature")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return wsResumeClaims{}, fmt.Errorf("invalid resume token payload")
+	}
+	var claims wsResumeClaims
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return wsResumeClaims{}, fmt.Errorf("invalid resume token claims")
+	}
+	if claims.Exp <= time.Now().Unix() {
+		return wsResumeClaims{}, fmt.Errorf("resume token expired")
+	}
+	if claims.Sub != auth.Subject {
+		return wsResumeClaims{}, fmt.Errorf("resume token belongs to another subject")
+	}
+	return claims, nil
+}
+
+// resumablePlans returns the token's plan subscriptions that are still valid and
+// readable by auth.
+func resumablePlans(auth authContext, plans []string) []string {
+	out := make([]string, 0, len(plans))
+	for _, value := range plans {
+		if len(out) == wsResumeMaxPlans {
+			break
+		}
+		planID, err := normalizeWSPlanID(value)
+		if err != nil || !auth.canAccess(http.MethodGet, "/plans/"+url.PathEscape(planID)+"/stream") {
+			continue
+		}
+		out = append(out, planID)
+	}
+	return out
+}
@@ -0,0 +1,110 @@
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWSTicketTTL = 30 * time.Second
+	maxWSTickets       = 1024
+)
+
+type wsTicket struct {
+	auth      authContext
+	expiresAt time.Time
+}
+
+func generateWSTicket() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "wst_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// issueWSTicket stores a single-use ticket bound to the caller's auth context.
+func (h *Handler) issueWSTicket(auth authContext, now time.Time) (string, time.Time, error) {
+	ticket, err := generateWSTicket()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate ws ticket")
+	}
+	expiresAt := now.Add(h.cfg.WSTicketTTL)
+
+	h.wsTicketsMu.Lock()
+	defer h.wsTicketsMu.Unlock()
+	h.pruneWSTicketsLocked(now)
+	if len(h.wsTickets) >= maxWSTickets {
+		h.evictOldestWSTicketsLocked(len(h.wsTickets) - maxWSTickets + 1)
+	}
+	h.wsTickets[ticket] = wsTicket{auth: auth, expiresAt: expiresAt}
+	return ticket, expiresAt, nil
+}
+
+// consumeWSTicket returns the auth context bound to ticket and deletes it.
+func (h *Handler) consumeWSTicket(ticket string, now time.Time) (authContext, bool) {
+	ticket = strings.TrimSpace(ticket)
+	if ticket == "" {
+		return authContext{}, false
+	}
+	h.wsTicketsMu.Lock()
+	entry, ok := h.wsTickets[ticket]
+	delete(h.wsTickets, ticket)
+	h.wsTicketsMu.Unlock()
+	if !ok || !now.Before(entry.expiresAt) {
+		return authContext{}, false
+	}
+	if h.isSessionRevoked(entry.auth.SessionID, now.Unix()) {
+		return authContext{}, false
+	}
+	return entry.auth, true
+}
+
+func (h *Handler) pruneWSTicketsLocked(now time.Time) {
+	for ticket, entry := range h.wsTickets {
+		if !now.Before(entry.expiresAt) {
+			delete(h.wsTickets, ticket)
+		}
+	}
+}
+
+func (h *Handler) evictOldestWSTicketsLocked(count int) {
+	if count <= 0 {
+		return
+	}
+	tickets := make([]string, 0, len(h.wsTickets))
+	for ticket := range h.wsTickets {
+		tickets = append(tickets, ticket)
+	}
+	sort.Slice(tickets, func(i, j int) bool {
+		return h.wsTickets[tickets[i]].expiresAt.Before(h.wsTickets[tickets[j]].expiresAt)
+	})
+	for _, ticket := range tickets[:min(count, len(tickets))] {
+		delete(h.wsTickets, ticket)
+	}
+}
+
+func (h *Handler) wsTicketCount() int {
+	h.wsTicketsMu.Lock()
+	defer h.wsTicketsMu.Unlock()
+	return len(h.wsTickets)
+}
+
+func (h *Handler) handleIssueWSTicket(auth authContext, requestID string) (map[string]any, error) {
+	ticket, expiresAt, err := h.issueWSTicket(auth, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"ticket":     ticket,
+		"expires_at": expiresAt.Unix(),
+		"ttl":        int(h.cfg.WSTicketTTL.Seconds()),
+		"subject":    auth.Subject,
+		"device_id":  auth.DeviceID,
+		"request_id": requestID,
+	}, nil
+}
@@ -0,0 +1,160 @@
+package relay
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultWSSendQueueSize = 256
+
+var errWSWriterClosed = errors.New("websocket writer closed")
+
+type wsOutboundFrame struct {
+	payload   map[string]any
+	droppable bool
+}
+
+// wsJSONWriter serializes outbound frames through a per-connection queue drained by
+// a single sender goroutine, so a slow reader never blocks the read loop. When the
+// queue is full, the oldest droppable (audit) frame is discarded; other frames such
+// as command responses are always queued.
+type wsJSONWriter struct {
+	conn     *websocket.Conn
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []wsOutboundFrame
+	capacity int
+	closed   bool
+	err      error
+	dropped  *uint64
+	sendDone chan struct{}
+	// openedAt is when the connection was established, reported by "diag".
+	openedAt time.Time
+	// connectionID is stamped on every outbound frame as connection_id.
+	connectionID string
+}
+
+func newWSJSONWriter(conn *websocket.Conn, capacity int, dropped *uint64, connectionID string) *wsJSONWriter {
+	if capacity <= 0 {
+		capacity = defaultWSSendQueueSize
+	}
+	w := &wsJSONWriter{
+		conn:         conn,
+		capacity:     capacity,
+		dropped:      dropped,
+		sendDone:     make(chan struct{}),
+		openedAt:     time.Now(),
+		connectionID: connectionID,
+	}
+	w.cond = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// write queues a frame that must not be dropped.
+func (w *wsJSONWriter) write(payload map[string]any) error {
+	return w.enqueue(wsOutboundFrame{payload: payload})
+}
+
+// writeDroppable queues a frame that may be discarded under backpressure.
+func (w *wsJSONWriter) writeDroppable(payload map[string]any) error {
+	return w.enqueue(wsOutboundFrame{payload: payload, droppable: true})
+}
+
+func (w *wsJSONWriter) enqueue(frame wsOutboundFrame) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		if w.err != nil {
+			return w.err
+		}
+		return errWSWriterClosed
+	}
+	if len(w.queue) >= w.capacity && !w.dropOldestLocked() {
+		if frame.droppable {
+			w.recordDrop()
+			return nil
+		}
+	}
+	w.queue = append(w.queue, frame)
+	w.cond.Signal()
+	return nil
+}
+
+// dropOldestLocked removes the oldest droppable frame, reporting whether one was found.
+func (w *wsJSONWriter) dropOldestLocked() bool {
+	for i, queued := range w.queue {
+		if !queued.droppable {
+			continue
+		}
+		w.queue = append(w.queue[:i], w.queue[i+1:]...)
+		w.recordDrop()
+		return true
+	}
+	return false
+}
+
+func (w *wsJSONWriter) recordDrop() {
+	if w.dropped != nil {
+		atomic.AddUint64(w.dropped, 1)
+	}
+}
+
+func (w *wsJSONWriter) run() {
+	defer close(w.sendDone)
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.mu.Unlock()
+			return
+		}
+		frame := w.queue[0]
+		w.queue[0] = wsOutboundFrame{}
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+
+		_ = w.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := w.conn.WriteJSON(withConnectionID(frame.payload, w.connectionID)); err != nil {
+			w.mu.Lock()
+			w.err = err
+			w.closed = true
+			w.queue = nil
+			w.mu.Unlock()
+			return
+		}
+	}
+}
+
+// close stops the sender goroutine, discarding any frames still queued.
+func (w *wsJSONWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.queue = nil
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	<-w.sendDone
+}
+
+// withConnectionID returns payload with connection_id set. Frames may be shared
+// across connections (see SharedAuditPump), so payload is copied, never mutated.
+func withConnectionID(payload map[string]any, connectionID string) map[string]any {
+	if connectionID == "" {
+		return payload
+	}
+	if _, exists := payload["connection_id"]; exists {
+		return payload
+	}
+	out := make(map[string]any, len(payload)+1)
+	for key, value := range payload {
+		out[key] = value
+	}
+	out["connection_id"] = connectionID
+	return out
+}